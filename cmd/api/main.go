@@ -8,20 +8,40 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Profile time zones are validated against the tz database, which
+	// slim container images don't ship
+	_ "time/tzdata"
 
 	"github.com/gym-api/ms-ga-identifier/internal/api/handler"
 	"github.com/gym-api/ms-ga-identifier/internal/api/router"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/external"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/mail"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/repository"
 	"github.com/gym-api/ms-ga-identifier/internal/middleware"
 	"github.com/gym-api/ms-ga-identifier/internal/service"
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
 	"github.com/gym-api/ms-ga-identifier/pkg/database"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/redis"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/gym-api/ms-ga-identifier/pkg/webauthn"
 )
 
+const (
+	// signingKeyGracePeriod covers clock skew on top of the token lifetimes
+	signingKeyGracePeriod = 5 * time.Minute
+	// signingKeyCheckInterval is how often the key directory is checked for rotation
+	signingKeyCheckInterval = time.Minute
+)
+
+// signingKeyRetention is how long a retired signing key still verifies: the
+// lifetime of the longest lived token it signs, plus a grace period.
+func signingKeyRetention(cfg *config.Config) time.Duration {
+	return max(cfg.JWT.ExpirationTime, cfg.OIDC.IDTokenTTL, cfg.Kiosk.TokenTTL) + signingKeyGracePeriod
+}
+
 func main() {
 	// Load configuration
 	cfg := config.Load()
@@ -52,31 +72,191 @@ func main() {
 	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
 	loginAttemptRepo := repository.NewLoginAttemptRepository(db)
 	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(db)
+	oauthClientRepo := repository.NewOAuthClientRepository(db)
+	authorizationCodeRepo := repository.NewAuthorizationCodeRepository(db)
+	totpCredentialRepo := repository.NewTOTPCredentialRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	mfaChallengeRepo := repository.NewMFAChallengeRepository(db)
+	webAuthnCredentialRepo := repository.NewWebAuthnCredentialRepository(db)
+	webAuthnSessionRepo := repository.NewWebAuthnSessionRepository(db)
+	passwordlessTokenRepo := repository.NewPasswordlessTokenRepository(db)
+	identifierRepo := repository.NewIdentifierRepository(db)
+	kioskDeviceRepo := repository.NewKioskDeviceRepository(db)
+	kioskPINRepo := repository.NewKioskPINRepository(db)
+	kioskCardLockoutRepo := repository.NewKioskCardLockoutRepository(db)
+	kioskSessionRepo := repository.NewKioskSessionRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	transactor := repository.NewTransactor(db)
 
-	// Initialize external clients
-	authClient := external.NewAuthClient(&cfg.Auth)
+	// Initialize external clients; roles and permissions are cached in Redis, or in memory without it
+	permissionCache := cache.NewPermissionCache(redisClient, external.PermissionRetention(&cfg.Auth))
+	authClient, err := external.NewAuthClient(&cfg.Auth, permissionCache)
+	if err != nil {
+		utils.Fatal("Failed to initialize auth client", utils.ErrorField(err.Error()))
+	}
 
 	// Initialize Kafka producer (optional)
-	var kafkaProducer *messaging.KafkaProducer
-	kafkaProducer = messaging.NewKafkaProducer(&cfg.Kafka)
-	defer func() {
-		if kafkaProducer != nil {
-			kafkaProducer.Close()
-		}
-	}()
+	kafkaProducer, err := messaging.NewKafkaProducer(&cfg.Kafka)
+	if err != nil {
+		utils.Fatal("Failed to initialize Kafka producer", utils.ErrorField(err.Error()))
+	}
+	defer kafkaProducer.Close()
+
+	// Events are written to the outbox with the changes they describe and
+	// relayed to Kafka in the background
+	outbox := messaging.NewOutbox(outboxRepo)
+	outboxRelay := messaging.NewOutboxRelay(outboxRepo, transactor, kafkaProducer, &cfg.Kafka.Outbox)
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	go outboxRelay.Run(relayCtx)
+
+	// Initialize JWT signing keys; retired keys stay valid while their tokens can still be in use,
+	// and new keys are published one JWKS cache period before they sign
+	keySet, err := utils.LoadKeySet(cfg.JWT.KeyDir, cfg.JWT.Algorithm, signingKeyRetention(cfg), handler.JWKSMaxAge)
+	if err != nil {
+		utils.Fatal("Failed to load JWT signing keys", utils.ErrorField(err.Error()))
+	}
+
+	rotationCtx, stopRotation := context.WithCancel(context.Background())
+	defer stopRotation()
+	if cfg.JWT.RotationInterval > 0 {
+		go keySet.RunRotation(rotationCtx, cfg.JWT.RotationInterval, signingKeyCheckInterval)
+	}
 
 	// Initialize JWT utility
-	jwtUtil := utils.NewJWTUtil(cfg.JWT.Secret, cfg.JWT.ExpirationTime)
+	jwtUtil := utils.NewJWTUtil(keySet, cfg.JWT.ExpirationTime)
+
+	// Initialize token hasher for refresh and reset tokens
+	if cfg.Server.Env == "production" {
+		for id, pepper := range cfg.TokenHash.Keys {
+			if pepper == config.DefaultTokenHashPepper {
+				utils.Fatal("Token hash key uses the default pepper", utils.String("key_id", id))
+			}
+		}
+	}
+	tokenHasher, err := utils.NewTokenHasher(cfg.TokenHash.CurrentKeyID, cfg.TokenHash.Keys)
+	if err != nil {
+		utils.Fatal("Failed to initialize token hasher", utils.ErrorField(err.Error()))
+	}
+
+	// Initialize encryption for TOTP secrets
+	secretBox, err := utils.NewSecretBox(cfg.MFA.SecretKey)
+	if err != nil {
+		utils.Fatal("Failed to initialize MFA secret encryption", utils.ErrorField(err.Error()))
+	}
+
+	// Initialize WebAuthn relying party for passkeys
+	relyingParty, err := webauthn.NewRelyingParty(cfg.WebAuthn.RPID, cfg.WebAuthn.RPName, cfg.WebAuthn.Origins)
+	if err != nil {
+		utils.Fatal("Failed to initialize WebAuthn", utils.ErrorField(err.Error()))
+	}
+
+	// Initialize access token denylist (disabled without Redis)
+	tokenDenylist := cache.NewTokenDenylist(redisClient)
+
+	// Initialize message catalog for API responses and emails
+	catalog, err := i18n.NewCatalog(cfg.I18n.DefaultLocale)
+	if err != nil {
+		utils.Fatal("Failed to load message catalog", utils.ErrorField(err.Error()))
+	}
+
+	// Initialize mailer; emails are sent in the background with retries
+	mailTransport, err := mail.NewMailer(&cfg.Mail)
+	if err != nil {
+		utils.Fatal("Failed to initialize mailer", utils.ErrorField(err.Error()))
+	}
+	mailQueue := mail.NewQueue(mailTransport, &cfg.Mail.Queue)
+	mailQueue.Start()
+
+	mailTemplates, err := mail.LoadTemplates(catalog)
+	if err != nil {
+		utils.Fatal("Failed to load email templates", utils.ErrorField(err.Error()))
+	}
 
 	// Initialize services
+	emailService := service.NewEmailService(mailQueue, mailTemplates, catalog, cfg)
+
+	verificationService := service.NewVerificationService(
+		identityRepo,
+		emailVerificationRepo,
+		transactor,
+		emailService,
+		outbox,
+		tokenHasher,
+		cfg,
+	)
+
+	lockoutService := service.NewLockoutService(
+		identityRepo,
+		loginAttemptRepo,
+		transactor,
+		emailService,
+		outbox,
+		cfg,
+	)
+
+	mfaService := service.NewMFAService(
+		identityRepo,
+		totpCredentialRepo,
+		recoveryCodeRepo,
+		mfaChallengeRepo,
+		transactor,
+		lockoutService,
+		outbox,
+		tokenHasher,
+		secretBox,
+		cfg,
+	)
+
+	identifierService := service.NewIdentifierService(
+		identityRepo,
+		identifierRepo,
+		emailService,
+		tokenHasher,
+		cfg,
+	)
+
+	webAuthnService := service.NewWebAuthnService(
+		identityRepo,
+		webAuthnCredentialRepo,
+		webAuthnSessionRepo,
+		identifierService,
+		transactor,
+		outbox,
+		tokenHasher,
+		relyingParty,
+		cfg,
+	)
+
+	passwordlessService := service.NewPasswordlessService(
+		identityRepo,
+		passwordlessTokenRepo,
+		emailService,
+		tokenHasher,
+		cfg,
+	)
+
 	identityService := service.NewIdentityService(
 		identityRepo,
 		refreshTokenRepo,
 		loginAttemptRepo,
 		passwordResetRepo,
+		transactor,
+		verificationService,
+		lockoutService,
+		mfaService,
+		webAuthnService,
+		passwordlessService,
+		identifierService,
+		emailService,
 		authClient,
-		kafkaProducer,
+		outbox,
 		jwtUtil,
+		tokenHasher,
+		tokenDenylist,
+		catalog,
 		cfg,
 	)
 
@@ -84,25 +264,107 @@ func main() {
 		identityRepo,
 		refreshTokenRepo,
 		authClient,
+		transactor,
+		outbox,
 		jwtUtil,
+		tokenHasher,
 		cfg,
 	)
 
 	passwordService := service.NewPasswordService(
 		identityRepo,
 		passwordResetRepo,
+		refreshTokenRepo,
+		transactor,
+		lockoutService,
+		emailService,
+		outbox,
+		tokenHasher,
+		cfg,
 	)
 
+	oidcService := service.NewOIDCService(
+		oauthClientRepo,
+		authorizationCodeRepo,
+		identityRepo,
+		identityService,
+		tokenService,
+		refreshTokenRepo,
+		tokenDenylist,
+		jwtUtil,
+		tokenHasher,
+		cfg,
+	)
+
+	identityAdminService := service.NewIdentityAdminService(
+		identityRepo,
+		identifierRepo,
+		refreshTokenRepo,
+		loginAttemptRepo,
+		transactor,
+		passwordService,
+		tokenDenylist,
+		outbox,
+		cfg,
+	)
+
+	kioskService := service.NewKioskService(
+		identityRepo,
+		identifierRepo,
+		kioskDeviceRepo,
+		kioskPINRepo,
+		kioskCardLockoutRepo,
+		kioskSessionRepo,
+		jwtUtil,
+		tokenHasher,
+		cfg,
+	)
+
+	authSyncService := service.NewAuthSyncService(
+		identityRepo,
+		refreshTokenRepo,
+		transactor,
+		permissionCache,
+		tokenDenylist,
+		outbox,
+		cfg,
+	)
+
+	// Role changes from the auth service clear cached permissions (optional)
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+	if cfg.Kafka.Consumer.Enabled {
+		authEventConsumer := messaging.NewAuthEventConsumer(
+			messaging.NewKafkaReader(&cfg.Kafka),
+			authSyncService,
+			&cfg.Kafka.Consumer,
+		)
+		go authEventConsumer.Run(consumerCtx)
+	}
+
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(jwtUtil)
+	authMiddleware := middleware.NewAuthMiddleware(jwtUtil, tokenDenylist, cfg.OIDC.Issuer)
+
+	rateLimiter := middleware.NewRateLimiter(
+		&cfg.RateLimit,
+		middleware.NewRateLimitStore(cfg.RateLimit.Algorithm, redisClient),
+	)
 
 	// Initialize handlers
-	identityHandler := handler.NewIdentityHandler(identityService)
+	identityHandler := handler.NewIdentityHandler(identityService, verificationService)
 	tokenHandler := handler.NewTokenHandler(tokenService)
 	passwordHandler := handler.NewPasswordHandler(passwordService)
+	mfaHandler := handler.NewMFAHandler(mfaService, identityService)
+	passkeyHandler := handler.NewPasskeyHandler(webAuthnService, identityService)
+	passwordlessHandler := handler.NewPasswordlessHandler(passwordlessService, identityService)
+	identifierHandler := handler.NewIdentifierHandler(identifierService)
+	kioskHandler := handler.NewKioskHandler(kioskService)
+	adminHandler := handler.NewAdminHandler(identityAdminService, lockoutService, mfaService, oidcService, identifierService, kioskService)
+	oidcHandler := handler.NewOIDCHandler(oidcService, identityService, mfaService)
+	wellKnownHandler := handler.NewWellKnownHandler(keySet, cfg.OIDC.Issuer)
 
 	// Initialize router
-	r := router.NewRouter(identityHandler, tokenHandler, passwordHandler, authMiddleware, cfg)
+	r := router.NewRouter(identityHandler, tokenHandler, passwordHandler, mfaHandler, passkeyHandler, passwordlessHandler, identifierHandler, kioskHandler, adminHandler, oidcHandler, wellKnownHandler, authMiddleware, rateLimiter, catalog, cfg)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -133,6 +395,11 @@ func main() {
 		utils.Fatal("Server forced to shutdown", utils.ErrorField(err.Error()))
 	}
 
+	// Give queued emails a chance to go out
+	if err := mailQueue.Close(ctx); err != nil {
+		utils.Warn("Unsent emails dropped on shutdown", utils.ErrorField(err.Error()))
+	}
+
 	// Close Redis connection
 	if redisClient != nil {
 		redisClient.Close()
@@ -0,0 +1,47 @@
+// Command eventschemas checks the Kafka event payloads against their JSON
+// Schemas in api/events and fails when a change would break consumers. With
+// -write it creates or updates the schema files for compatible changes.
+//
+// A breaking change, such as removing or retyping a property, needs a new
+// schema version in the messaging package's registry; the old version's file
+// is kept for consumers still reading it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+)
+
+func main() {
+	dir := flag.String("dir", "api/events", "directory holding the event schemas")
+	write := flag.Bool("write", false, "write missing and out of date schema files")
+	flag.Parse()
+
+	if *write {
+		written, err := messaging.WriteSchemas(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, file := range written {
+			fmt.Println("wrote", file)
+		}
+		return
+	}
+
+	issues, err := messaging.CheckSchemas(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if len(issues) > 0 {
+		fmt.Fprintln(os.Stderr, "event schemas don't match the payloads; run go run ./cmd/eventschemas -write for compatible changes")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,38 @@
+-- Per-identity MFA requirement, set by admins
+ALTER TABLE identities ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create mfa_totp_credentials table
+CREATE TABLE mfa_totp_credentials (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id       UUID NOT NULL UNIQUE REFERENCES identities(id) ON DELETE CASCADE,
+    secret_encrypted  TEXT NOT NULL,
+    confirmed_at      TIMESTAMPTZ,
+    last_used_step    BIGINT NOT NULL DEFAULT 0,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create mfa_recovery_codes table
+CREATE TABLE mfa_recovery_codes (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    code_hash   VARCHAR(128) NOT NULL UNIQUE,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create mfa_challenges table
+CREATE TABLE mfa_challenges (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    token_hash  VARCHAR(128) NOT NULL UNIQUE,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_mfa_recovery_codes_identity_id ON mfa_recovery_codes(identity_id);
+CREATE INDEX idx_mfa_challenges_identity_id ON mfa_challenges(identity_id);
+CREATE INDEX idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
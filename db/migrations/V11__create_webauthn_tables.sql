@@ -0,0 +1,32 @@
+-- Create webauthn_credentials table
+CREATE TABLE webauthn_credentials (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id     UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    credential_id   BYTEA NOT NULL UNIQUE,
+    public_key      BYTEA NOT NULL,
+    algorithm       INTEGER NOT NULL,
+    sign_count      BIGINT NOT NULL DEFAULT 0,
+    aaguid          BYTEA,
+    transports      JSONB NOT NULL DEFAULT '[]',
+    name            VARCHAR(100) NOT NULL,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backed_up       BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create webauthn_sessions table
+CREATE TABLE webauthn_sessions (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id    UUID REFERENCES identities(id) ON DELETE CASCADE,
+    ceremony       VARCHAR(20) NOT NULL,
+    challenge_hash VARCHAR(128) NOT NULL UNIQUE,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    used_at        TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_webauthn_credentials_identity_id ON webauthn_credentials(identity_id);
+CREATE INDEX idx_webauthn_sessions_expires_at ON webauthn_sessions(expires_at);
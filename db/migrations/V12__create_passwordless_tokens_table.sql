@@ -0,0 +1,19 @@
+-- Per-identity opt-in to passwordless login
+ALTER TABLE identities ADD COLUMN passwordless_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create passwordless_tokens table
+CREATE TABLE passwordless_tokens (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    method      VARCHAR(10) NOT NULL,
+    token_hash  VARCHAR(128) NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_passwordless_tokens_token_hash ON passwordless_tokens(token_hash);
+CREATE INDEX idx_passwordless_tokens_identity_id ON passwordless_tokens(identity_id);
+CREATE INDEX idx_passwordless_tokens_expires_at ON passwordless_tokens(expires_at);
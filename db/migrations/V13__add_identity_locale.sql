@@ -0,0 +1,2 @@
+-- Preferred language for emails; empty means the default locale
+ALTER TABLE identities ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
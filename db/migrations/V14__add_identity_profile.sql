@@ -0,0 +1,6 @@
+-- Profile fields captured at registration or edited by the user
+ALTER TABLE identities ADD COLUMN first_name   VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE identities ADD COLUMN last_name    VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE identities ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE identities ADD COLUMN phone        VARCHAR(20)  NOT NULL DEFAULT '';
+ALTER TABLE identities ADD COLUMN timezone     VARCHAR(64)  NOT NULL DEFAULT '';
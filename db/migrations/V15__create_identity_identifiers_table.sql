@@ -0,0 +1,32 @@
+-- Create identity_identifiers table. Values are stored normalized so that
+-- uniqueness holds per type regardless of how they were typed.
+CREATE TABLE identity_identifiers (
+    id                      UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_id             UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    type                    VARCHAR(20) NOT NULL
+                            CHECK (type IN ('email', 'phone', 'username', 'member_number', 'card_uid')),
+    value                   VARCHAR(255) NOT NULL,
+    verified                BOOLEAN NOT NULL DEFAULT FALSE,
+    is_primary              BOOLEAN NOT NULL DEFAULT FALSE,
+    verified_at             TIMESTAMPTZ,
+    verification_hash       VARCHAR(128),
+    verification_expires_at TIMESTAMPTZ,
+    verification_attempts   INTEGER NOT NULL DEFAULT 0,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (type, value)
+);
+
+-- At most one primary identifier of each type per identity
+CREATE UNIQUE INDEX idx_identity_identifiers_primary ON identity_identifiers(identity_id, type) WHERE is_primary;
+
+-- Create indexes
+CREATE INDEX idx_identity_identifiers_identity_id ON identity_identifiers(identity_id);
+
+-- Every existing identity signs in with its email. Should two emails differ
+-- only in case, the oldest identity keeps it.
+INSERT INTO identity_identifiers (identity_id, type, value, verified, is_primary, verified_at)
+SELECT id, 'email', LOWER(email), email_verified, TRUE, CASE WHEN email_verified THEN updated_at END
+FROM identities
+ORDER BY created_at
+ON CONFLICT (type, value) DO NOTHING;
@@ -0,0 +1,44 @@
+-- Create kiosk_devices table. Kiosks authenticate with client credentials;
+-- the secret is stored hashed.
+CREATE TABLE kiosk_devices (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name               VARCHAR(100) NOT NULL,
+    location           VARCHAR(255) NOT NULL DEFAULT '',
+    client_id          VARCHAR(255) NOT NULL UNIQUE,
+    client_secret_hash VARCHAR(128) NOT NULL,
+    active             BOOLEAN NOT NULL DEFAULT TRUE,
+    last_seen_at       TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create kiosk_pins table
+CREATE TABLE kiosk_pins (
+    identity_id UUID PRIMARY KEY REFERENCES identities(id) ON DELETE CASCADE,
+    pin_hash    VARCHAR(255) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create kiosk_card_lockouts table, counting wrong PINs per card
+CREATE TABLE kiosk_card_lockouts (
+    identifier_id UUID PRIMARY KEY REFERENCES identity_identifiers(id) ON DELETE CASCADE,
+    failures      INTEGER NOT NULL DEFAULT 0,
+    locked_until  TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create kiosk_sessions table, one row per check-in token issued
+CREATE TABLE kiosk_sessions (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id     UUID NOT NULL REFERENCES kiosk_devices(id) ON DELETE CASCADE,
+    identity_id   UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    identifier_id UUID REFERENCES identity_identifiers(id) ON DELETE SET NULL,
+    ip_address    VARCHAR(45),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_kiosk_sessions_device_id ON kiosk_sessions(device_id);
+CREATE INDEX idx_kiosk_sessions_identity_id ON kiosk_sessions(identity_id);
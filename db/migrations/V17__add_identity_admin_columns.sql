@@ -0,0 +1,8 @@
+-- Why an administrator last locked or suspended the identity
+ALTER TABLE identities ADD COLUMN status_reason VARCHAR(500) NOT NULL DEFAULT '';
+
+-- Set when an administrator forces a password reset, cleared by the new password
+ALTER TABLE identities ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Admin listing pages by creation date, newest first
+CREATE INDEX idx_identities_created_at ON identities (created_at DESC, id DESC);
@@ -0,0 +1,21 @@
+-- Create outbox_events table. Events are written in the same transaction as
+-- the change they describe and relayed to Kafka by the outbox relay; events
+-- with the same key are relayed in id order.
+CREATE TABLE outbox_events (
+    id               BIGSERIAL PRIMARY KEY,
+    event_key        VARCHAR(255) NOT NULL,
+    event_type       VARCHAR(100) NOT NULL,
+    payload          JSONB NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at     TIMESTAMPTZ,
+    dead_lettered_at TIMESTAMPTZ
+);
+
+-- Create indexes
+CREATE INDEX idx_outbox_events_pending ON outbox_events(event_key, id)
+    WHERE published_at IS NULL AND dead_lettered_at IS NULL;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at)
+    WHERE published_at IS NOT NULL;
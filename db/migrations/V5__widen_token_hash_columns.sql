@@ -0,0 +1,15 @@
+-- Token hashes are now HMAC-SHA256 digests prefixed with the key id that
+-- produced them ("<key_id>$<64 hex chars>"), which no longer fits VARCHAR(64).
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash TYPE VARCHAR(128);
+ALTER TABLE password_reset_tokens ALTER COLUMN token_hash TYPE VARCHAR(128);
+
+-- Rows written before this migration hold salted bcrypt hashes, which can never
+-- be matched by a lookup. Retire them so clients fall back to a fresh login or
+-- a new reset request.
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash LIKE '$2%' AND revoked_at IS NULL;
+
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash LIKE '$2%' AND used_at IS NULL;
@@ -0,0 +1,10 @@
+-- Track refresh token rotation chains
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by_id UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+
+-- Existing tokens each start their own family
+UPDATE refresh_tokens SET family_id = id WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+-- Create indexes
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
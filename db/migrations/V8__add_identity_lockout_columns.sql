@@ -0,0 +1,3 @@
+-- Track account lockout state
+ALTER TABLE identities ADD COLUMN locked_until TIMESTAMPTZ;
+ALTER TABLE identities ADD COLUMN lockout_count INTEGER NOT NULL DEFAULT 0;
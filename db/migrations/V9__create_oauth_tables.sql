@@ -0,0 +1,38 @@
+-- Create oauth_clients table
+CREATE TABLE oauth_clients (
+    id                  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id           VARCHAR(100) NOT NULL UNIQUE,
+    client_secret_hash  VARCHAR(128),
+    name                VARCHAR(255) NOT NULL,
+    redirect_uris       JSONB NOT NULL DEFAULT '[]',
+    allowed_scopes      JSONB NOT NULL DEFAULT '[]',
+    is_public           BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (is_public OR client_secret_hash IS NOT NULL)
+);
+
+-- Create oauth_authorization_codes table
+CREATE TABLE oauth_authorization_codes (
+    id                     UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code_hash              VARCHAR(128) NOT NULL UNIQUE,
+    client_id              VARCHAR(100) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    identity_id            UUID NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+    redirect_uri           TEXT NOT NULL,
+    scope                  VARCHAR(500) NOT NULL DEFAULT '',
+    nonce                  VARCHAR(255) NOT NULL DEFAULT '',
+    code_challenge         VARCHAR(128) NOT NULL DEFAULT '',
+    code_challenge_method  VARCHAR(10) NOT NULL DEFAULT '',
+    auth_time              TIMESTAMPTZ NOT NULL,
+    expires_at             TIMESTAMPTZ NOT NULL,
+    used_at                TIMESTAMPTZ,
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Refresh tokens remember the client and scope they were granted to
+ALTER TABLE refresh_tokens ADD COLUMN client_id VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN scope VARCHAR(500) NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX idx_oauth_authorization_codes_identity_id ON oauth_authorization_codes(identity_id);
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
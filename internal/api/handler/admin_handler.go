@@ -0,0 +1,437 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// Permissions the admin routes require; router.setupRoutes guards each route
+// with the one it needs.
+const (
+	PermissionIdentityRead          = "identity:read"
+	PermissionIdentityStatus        = "identity:status"
+	PermissionIdentityPasswordReset = "identity:password_reset"
+	PermissionIdentitySessions      = "identity:sessions"
+	PermissionIdentityDelete        = "identity:delete"
+	PermissionIdentityUnlock        = "identity:unlock"
+	PermissionIdentityMFA           = "identity:mfa"
+	PermissionIdentifierWrite       = "identifier:write"
+	PermissionKioskWrite            = "kiosk:write"
+	PermissionOAuthClientWrite      = "oauth_client:write"
+	PermissionMetricsRead           = "metrics:read"
+)
+
+type AdminHandler struct {
+	identityAdminService *service.IdentityAdminService
+	lockoutService       *service.LockoutService
+	mfaService           *service.MFAService
+	oidcService          *service.OIDCService
+	identifierService    *service.IdentifierService
+	kioskService         *service.KioskService
+}
+
+func NewAdminHandler(
+	identityAdminService *service.IdentityAdminService,
+	lockoutService *service.LockoutService,
+	mfaService *service.MFAService,
+	oidcService *service.OIDCService,
+	identifierService *service.IdentifierService,
+	kioskService *service.KioskService,
+) *AdminHandler {
+	return &AdminHandler{
+		identityAdminService: identityAdminService,
+		lockoutService:       lockoutService,
+		mfaService:           mfaService,
+		oidcService:          oidcService,
+		identifierService:    identifierService,
+		kioskService:         kioskService,
+	}
+}
+
+type ListIdentitiesQuery struct {
+	Status        string     `form:"status" binding:"omitempty,oneof=active locked suspended unverified"`
+	Email         string     `form:"email" binding:"max=255"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor        string     `form:"cursor"`
+	Limit         int        `form:"limit" binding:"omitempty,min=1,max=200"`
+}
+
+func (h *AdminHandler) ListIdentities(c *gin.Context) {
+	var query ListIdentitiesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.identityAdminService.List(c.Request.Context(), service.ListIdentitiesRequest{
+		Status:        entity.IdentityStatus(query.Status),
+		Email:         query.Email,
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Cursor:        query.Cursor,
+		Limit:         query.Limit,
+	})
+	if err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *AdminHandler) GetIdentity(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.identityAdminService.Get(c.Request.Context(), userID)
+	if err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type SetIdentityStatusRequest struct {
+	Status    string     `json:"status" binding:"required,oneof=active locked suspended"`
+	Reason    string     `json:"reason" binding:"max=500"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// SetIdentityStatus locks, suspends or reactivates an identity. Locks and
+// suspensions with expires_at end on their own.
+func (h *AdminHandler) SetIdentityStatus(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SetIdentityStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.identityAdminService.SetStatus(c.Request.Context(), userID, service.SetIdentityStatusRequest{
+		Status:    entity.IdentityStatus(req.Status),
+		Reason:    req.Reason,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type RequirePasswordResetRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// RequirePasswordReset emails the identity a reset link and refuses its
+// password until it has been used.
+func (h *AdminHandler) RequirePasswordReset(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RequirePasswordResetRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+	}
+
+	if err := h.identityAdminService.RequirePasswordReset(c.Request.Context(), userID, req.Reason); err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("admin.password_reset_required")})
+}
+
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identityAdminService.RevokeSessions(c.Request.Context(), userID); err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("admin.sessions_revoked")})
+}
+
+func (h *AdminHandler) DeleteIdentity(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identityAdminService.Delete(c.Request.Context(), userID); err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("admin.identity_deleted")})
+}
+
+type ListLoginAttemptsQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+func (h *AdminHandler) ListLoginAttempts(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	var query ListLoginAttemptsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	attempts, err := h.identityAdminService.LoginAttempts(c.Request.Context(), userID, query.Limit)
+	if err != nil {
+		identityAdminError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"login_attempts": attempts})
+}
+
+type UnlockIdentityRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *AdminHandler) UnlockIdentity(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_user_id")
+		return
+	}
+
+	var req UnlockIdentityRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+	}
+
+	if err := h.lockoutService.Unlock(c.Request.Context(), userID, req.Reason); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.NotFound(c, "errors.identity_not_found")
+		case errors.Is(err, service.ErrIdentityNotLocked):
+			utils.Conflict(c, utils.ErrorMessage(c, err))
+		default:
+			utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("admin.identity_unlocked")})
+}
+
+type SetMFARequirementRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+func (h *AdminHandler) SetMFARequirement(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_user_id")
+		return
+	}
+
+	var req SetMFARequirementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	if err := h.mfaService.SetRequired(c.Request.Context(), userID, *req.Required); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "errors.identity_not_found")
+			return
+		}
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"mfa_required": *req.Required})
+}
+
+// AddIdentifier attaches any identifier type, including member numbers and
+// card UIDs, as already verified.
+func (h *AdminHandler) AddIdentifier(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_user_id")
+		return
+	}
+
+	var req AddIdentifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	identifier, err := h.identifierService.AddVerified(c.Request.Context(), userID, service.AddIdentifierRequest{
+		Type:  entity.IdentifierType(req.Type),
+		Value: req.Value,
+	})
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, identifier)
+}
+
+// VerifyIdentifier marks an identifier as verified after staff checked it,
+// e.g. a phone number confirmed at the front desk.
+func (h *AdminHandler) VerifyIdentifier(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_user_id")
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_identifier_id")
+		return
+	}
+
+	identifier, err := h.identifierService.MarkVerified(c.Request.Context(), userID, id)
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, identifier)
+}
+
+type RegisterOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+func (h *AdminHandler) RegisterOAuthClient(c *gin.Context) {
+	var req RegisterOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.oidcService.RegisterClient(c.Request.Context(), service.RegisterClientRequest{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClientMetadata) {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, resp)
+}
+
+type RegisterKioskRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Location string `json:"location" binding:"max=255"`
+}
+
+// RegisterKiosk registers a check-in kiosk. The client secret is only
+// returned in this response.
+func (h *AdminHandler) RegisterKiosk(c *gin.Context) {
+	var req RegisterKioskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.kioskService.RegisterDevice(c.Request.Context(), service.RegisterKioskRequest{
+		Name:     req.Name,
+		Location: req.Location,
+	})
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, resp)
+}
+
+func (h *AdminHandler) ListKiosks(c *gin.Context) {
+	kiosks, err := h.kioskService.ListDevices(c.Request.Context())
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"kiosks": kiosks})
+}
+
+func (h *AdminHandler) DeactivateKiosk(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_kiosk_id")
+		return
+	}
+
+	if err := h.kioskService.DeactivateDevice(c.Request.Context(), id); err != nil {
+		kioskError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"active": false})
+}
+
+func adminUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_user_id")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func identityAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.NotFound(c, "errors.identity_not_found")
+	case errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidIdentityStatus),
+		errors.Is(err, service.ErrInvalidStatusExpiry):
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type IdentifierHandler struct {
+	identifierService *service.IdentifierService
+}
+
+func NewIdentifierHandler(identifierService *service.IdentifierService) *IdentifierHandler {
+	return &IdentifierHandler{
+		identifierService: identifierService,
+	}
+}
+
+func (h *IdentifierHandler) List(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	identifiers, err := h.identifierService.List(c.Request.Context(), userID)
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"identifiers": identifiers})
+}
+
+type AddIdentifierRequest struct {
+	Type  string `json:"type" binding:"required,oneof=email phone username member_number card_uid"`
+	Value string `json:"value" binding:"required,max=255"`
+}
+
+// Add attaches an email, phone number or username to the current user. An
+// email is sent a verification code.
+func (h *IdentifierHandler) Add(c *gin.Context) {
+	var req AddIdentifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	identifier, err := h.identifierService.Add(c.Request.Context(), userID, service.AddIdentifierRequest{
+		Type:  entity.IdentifierType(req.Type),
+		Value: req.Value,
+	})
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, identifier)
+}
+
+func (h *IdentifierHandler) Delete(c *gin.Context) {
+	userID, id, ok := identifierParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identifierService.Remove(c.Request.Context(), userID, id); err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("identifier.removed")})
+}
+
+// SendVerification emails a new verification code for an email identifier.
+func (h *IdentifierHandler) SendVerification(c *gin.Context) {
+	userID, id, ok := identifierParams(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.identifierService.SendVerificationCode(c.Request.Context(), userID, id)
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type VerifyIdentifierRequest struct {
+	Code string `json:"code" binding:"required,numeric"`
+}
+
+func (h *IdentifierHandler) Verify(c *gin.Context) {
+	var req VerifyIdentifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, id, ok := identifierParams(c)
+	if !ok {
+		return
+	}
+
+	identifier, err := h.identifierService.Verify(c.Request.Context(), userID, id, req.Code)
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, identifier)
+}
+
+func (h *IdentifierHandler) SetPrimary(c *gin.Context) {
+	userID, id, ok := identifierParams(c)
+	if !ok {
+		return
+	}
+
+	identifier, err := h.identifierService.SetPrimary(c.Request.Context(), userID, id)
+	if err != nil {
+		identifierError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, identifier)
+}
+
+func identifierParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_identifier_id")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func identifierError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidIdentifier), errors.Is(err, service.ErrIdentifierNotVerifiable),
+		errors.Is(err, service.ErrIdentifierNotVerified):
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrInvalidIdentifierCode):
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrIdentifierTypeRestricted), errors.Is(err, service.ErrPrimaryEmailRemoval):
+		utils.Forbidden(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrIdentifierNotFound):
+		utils.NotFound(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.NotFound(c, "errors.identity_not_found")
+	case errors.Is(err, service.ErrIdentifierTaken), errors.Is(err, service.ErrIdentifierAlreadyVerified):
+		utils.Conflict(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrIdentifierCodeThrottled):
+		utils.TooManyRequests(c, utils.ErrorMessage(c, err))
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
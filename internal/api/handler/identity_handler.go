@@ -1,33 +1,43 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 	"github.com/gym-api/ms-ga-identifier/internal/middleware"
 	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
 )
 
 type IdentityHandler struct {
-	identityService *service.IdentityService
+	identityService     *service.IdentityService
+	verificationService *service.VerificationService
 }
 
-func NewIdentityHandler(identityService *service.IdentityService) *IdentityHandler {
-	return &IdentityHandler{identityService: identityService}
+func NewIdentityHandler(identityService *service.IdentityService, verificationService *service.VerificationService) *IdentityHandler {
+	return &IdentityHandler{
+		identityService:     identityService,
+		verificationService: verificationService,
+	}
 }
 
 type RegisterRequest struct {
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=8"`
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name" binding:"required"`
+	FirstName string `json:"first_name" binding:"required,max=100"`
+	LastName  string `json:"last_name" binding:"required,max=100"`
+	Locale    string `json:"locale"`
 }
 
 func (h *IdentityHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
 		return
 	}
 
@@ -36,88 +46,277 @@ func (h *IdentityHandler) Register(c *gin.Context) {
 		Password:  req.Password,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
+		Locale:    req.Locale,
 	})
 
 	if err != nil {
-		utils.Conflict(c, err.Error())
+		if errors.Is(err, service.ErrPasswordPolicy) || errors.Is(err, service.ErrInvalidProfile) ||
+			errors.Is(err, service.ErrInvalidIdentifier) || errors.Is(err, i18n.ErrUnsupportedLocale) {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.Conflict(c, utils.ErrorMessage(c, err))
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusCreated, resp)
 }
 
+// LoginRequest takes any identifier of the identity. Email is still accepted
+// on its own for clients that predate identifiers.
 type LoginRequest struct {
-	Email      string `json:"email" binding:"required,email"`
-	Password   string `json:"password" binding:"required"`
-	DeviceInfo string `json:"device_info"`
+	Identifier     string `json:"identifier" binding:"required_without=Email"`
+	IdentifierType string `json:"identifier_type" binding:"omitempty,oneof=email phone username member_number card_uid"`
+	Email          string `json:"email" binding:"omitempty,email"`
+	Password       string `json:"password" binding:"required"`
+	DeviceInfo     string `json:"device_info"`
 }
 
 func (h *IdentityHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
 		return
 	}
 
 	ipAddress := c.ClientIP()
 
+	identifier, identifierType := req.Identifier, entity.IdentifierType(req.IdentifierType)
+	if identifier == "" {
+		identifier, identifierType = req.Email, entity.IdentifierTypeEmail
+	}
+
 	resp, err := h.identityService.Login(c.Request.Context(), service.LoginRequest{
-		Email:      req.Email,
-		Password:   req.Password,
-		DeviceInfo: req.DeviceInfo,
-		IPAddress:  ipAddress,
+		Identifier:     identifier,
+		IdentifierType: identifierType,
+		Password:       req.Password,
+		DeviceInfo:     req.DeviceInfo,
+		IPAddress:      ipAddress,
 	})
 
 	if err != nil {
-		utils.Unauthorized(c, err.Error())
+		if errors.Is(err, service.ErrAccountLocked) || errors.Is(err, service.ErrPasswordResetRequired) {
+			utils.Forbidden(c, utils.ErrorMessage(c, err))
+			return
+		}
+		if errors.Is(err, service.ErrPermissionsUnavailable) {
+			utils.ServiceUnavailable(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, resp)
 }
 
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func (h *IdentityHandler) Logout(c *gin.Context) {
-	userID := middleware.GetUserID(c)
+	// The body is optional; without it the current session is ended
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+	}
 
-	// Get user ID from context (need to parse from JWT)
-	// For now, we'll implement basic logout
-	_ = userID // Suppress unused variable warning
+	logoutReq, ok := logoutRequestFromContext(c)
+	if !ok {
+		return
+	}
+	logoutReq.RefreshToken = req.RefreshToken
+
+	if err := h.identityService.Logout(c.Request.Context(), logoutReq); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			utils.NotFound(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": "Logged out successfully"})
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("identity.logged_out")})
 }
 
+func (h *IdentityHandler) LogoutAll(c *gin.Context) {
+	logoutReq, ok := logoutRequestFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identityService.LogoutAll(c.Request.Context(), logoutReq); err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("identity.logged_out_all")})
+}
+
+func logoutRequestFromContext(c *gin.Context) (service.LogoutRequest, bool) {
+	userID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		utils.Unauthorized(c, "errors.invalid_user_in_token")
+		return service.LogoutRequest{}, false
+	}
+	sessionID, _ := uuid.Parse(middleware.GetSessionID(c))
+
+	return service.LogoutRequest{
+		UserID:               userID,
+		SessionID:            sessionID,
+		AccessTokenID:        middleware.GetTokenID(c),
+		AccessTokenExpiresAt: middleware.GetTokenExpiresAt(c),
+	}, true
+}
+
+// GetCurrentUser returns what the access token says about the user along
+// with their profile.
 func (h *IdentityHandler) GetCurrentUser(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.identityService.GetProfile(c.Request.Context(), userID)
+	if err != nil {
+		profileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, currentUserWithProfile(c, profile))
+}
+
+type UpdateProfileRequest struct {
+	FirstName   *string `json:"first_name"`
+	LastName    *string `json:"last_name"`
+	DisplayName *string `json:"display_name"`
+	Phone       *string `json:"phone"`
+	Locale      *string `json:"locale"`
+	Timezone    *string `json:"timezone"`
+}
+
+// UpdateProfile changes the profile fields present in the body; an empty
+// string clears a field.
+func (h *IdentityHandler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.identityService.UpdateProfile(c.Request.Context(), userID, service.UpdateProfileRequest{
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		DisplayName: req.DisplayName,
+		Phone:       req.Phone,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+	})
+	if err != nil {
+		profileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, currentUserWithProfile(c, profile))
+}
+
+func currentUserWithProfile(c *gin.Context, profile *service.ProfileResponse) gin.H {
+	info := currentUser(c)
+	info["user_id"] = middleware.GetUserID(c)
+	info["profile"] = profile
+	return info
+}
+
+func profileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidProfile):
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.NotFound(c, "errors.identity_not_found")
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
+
+// currentUser returns what the access token says about the signed in user.
+func currentUser(c *gin.Context) gin.H {
 	email := middleware.GetEmail(c)
 	roles := middleware.GetRoles(c)
 	permissions := middleware.GetPermissions(c)
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{
+	return gin.H{
 		"email":       email,
 		"roles":       roles,
 		"permissions": permissions,
-	})
+	}
 }
 
-type ChangePasswordRequest struct {
-	CurrentPassword string `json:"current_password" binding:"required"`
-	NewPassword    string `json:"new_password" binding:"required,min=8"`
+type UpdateLocaleRequest struct {
+	Locale string `json:"locale" binding:"required"`
 }
 
-func (h *IdentityHandler) ChangePassword(c *gin.Context) {
-	var req ChangePasswordRequest
+// UpdateLocale sets the language emails are sent in.
+func (h *IdentityHandler) UpdateLocale(c *gin.Context) {
+	var req UpdateLocaleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.identityService.UpdateLocale(c.Request.Context(), userID, req.Locale)
+	if err != nil {
+		if errors.Is(err, i18n.ErrUnsupportedLocale) {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": "Password changed successfully"})
+	utils.SuccessResponse(c, http.StatusOK, resp)
 }
 
 func (h *IdentityHandler) VerifyEmail(c *gin.Context) {
 	token := c.Param("token")
 
-	// Implement email verification logic
-	_ = token // Suppress unused variable warning
+	resp, err := h.verificationService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *IdentityHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
 
-	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": "Email verified successfully"})
+	resp, err := h.verificationService.ResendVerification(c.Request.Context(), req.Email)
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
 }
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+type KioskHandler struct {
+	kioskService *service.KioskService
+}
+
+func NewKioskHandler(kioskService *service.KioskService) *KioskHandler {
+	return &KioskHandler{
+		kioskService: kioskService,
+	}
+}
+
+type KioskCheckInRequest struct {
+	CardUID string `json:"card_uid" binding:"required,max=64"`
+	PIN     string `json:"pin" binding:"required,max=16"`
+}
+
+// CheckIn is called by a kiosk, authenticated with its client credentials
+// over HTTP Basic, to swap a member's card UID and PIN for a check-in token.
+func (h *KioskHandler) CheckIn(c *gin.Context) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="kiosk"`)
+		utils.Unauthorized(c, utils.ErrorMessage(c, service.ErrInvalidKioskCredentials))
+		return
+	}
+
+	device, err := h.kioskService.AuthenticateDevice(c.Request.Context(), clientID, clientSecret)
+	if err != nil {
+		kioskError(c, err)
+		return
+	}
+
+	var req KioskCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.kioskService.CheckIn(c.Request.Context(), device, service.KioskCheckInRequest{
+		CardUID:   req.CardUID,
+		PIN:       req.PIN,
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		kioskError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type SetKioskPINRequest struct {
+	Password string `json:"password" binding:"required"`
+	PIN      string `json:"pin" binding:"required"`
+}
+
+func (h *KioskHandler) SetPIN(c *gin.Context) {
+	var req SetKioskPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.kioskService.SetPIN(c.Request.Context(), userID, req.Password, req.PIN)
+	if err != nil {
+		kioskError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *KioskHandler) RemovePIN(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.kioskService.RemovePIN(c.Request.Context(), userID)
+	if err != nil {
+		kioskError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func kioskError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPIN):
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrInvalidKioskCredentials), errors.Is(err, service.ErrInvalidCardOrPIN),
+		errors.Is(err, service.ErrInvalidCurrentPassword):
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrCardLocked), errors.Is(err, service.ErrAccountLocked):
+		utils.Forbidden(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrKioskDeviceNotFound):
+		utils.NotFound(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.NotFound(c, "errors.identity_not_found")
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/middleware"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+type MFAHandler struct {
+	mfaService      *service.MFAService
+	identityService *service.IdentityService
+}
+
+func NewMFAHandler(mfaService *service.MFAService, identityService *service.IdentityService) *MFAHandler {
+	return &MFAHandler{
+		mfaService:      mfaService,
+		identityService: identityService,
+	}
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceInfo   string `json:"device_info"`
+}
+
+// Login completes a login that returned mfa_required.
+func (h *MFAHandler) Login(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.identityService.LoginWithMFA(c.Request.Context(), service.MFALoginRequest{
+		MFAToken:     req.MFAToken,
+		Code:         req.Code,
+		RecoveryCode: req.RecoveryCode,
+		DeviceInfo:   req.DeviceInfo,
+		IPAddress:    c.ClientIP(),
+	})
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type MFAEnrollWithTokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// LoginEnroll starts TOTP enrollment for a login that returned
+// mfa_enrollment_required. The login is then completed at Login with a code
+// from the new authenticator.
+func (h *MFAHandler) LoginEnroll(c *gin.Context) {
+	var req MFAEnrollWithTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.mfaService.EnrollWithChallenge(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *MFAHandler) Status(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mfaService.Status(c.Request.Context(), userID)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mfaService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFADisableRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Code            string `json:"code" binding:"required"`
+}
+
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mfaService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mfaService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code, c.ClientIP())
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	err := h.mfaService.Disable(c.Request.Context(), service.DisableMFARequest{
+		UserID:          userID,
+		CurrentPassword: req.CurrentPassword,
+		Code:            req.Code,
+		IPAddress:       c.ClientIP(),
+	})
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("mfa.disabled")})
+}
+
+func mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAChallenge),
+		errors.Is(err, service.ErrInvalidCurrentPassword):
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrMFARequiredByPolicy):
+		utils.Forbidden(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrMFAAlreadyEnrolled), errors.Is(err, service.ErrMFANotEnrolled):
+		utils.Conflict(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrPermissionsUnavailable):
+		utils.ServiceUnavailable(c, utils.ErrorMessage(c, err))
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
+
+func userIDFromContext(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		utils.Unauthorized(c, "errors.invalid_user_in_token")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
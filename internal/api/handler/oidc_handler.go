@@ -0,0 +1,464 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/middleware"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+// OAuth error codes from RFC 6749 and OpenID Connect Core.
+const (
+	oauthErrInvalidRequest          = "invalid_request"
+	oauthErrInvalidClient           = "invalid_client"
+	oauthErrInvalidGrant            = "invalid_grant"
+	oauthErrInvalidScope            = "invalid_scope"
+	oauthErrUnsupportedGrantType    = "unsupported_grant_type"
+	oauthErrUnsupportedResponseType = "unsupported_response_type"
+	oauthErrAccessDenied            = "access_denied"
+	oauthErrLoginRequired           = "login_required"
+	oauthErrInvalidToken            = "invalid_token"
+	oauthErrServerError             = "server_error"
+)
+
+// loginFormTemplate gets its texts from the catalog through T, the request's
+// Localizer.T.
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head><meta charset="utf-8"><title>{{call .T "login.title"}}</title></head>
+<body>
+<h1>{{call .T "login.heading" .}}</h1>
+{{if .Error}}<p role="alert">{{call .T .Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}{{if .MFAToken}}<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>{{call .T "login.mfa_code"}} <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" autofocus></label>
+<label>{{call .T "login.recovery_code"}} <input type="text" name="recovery_code" autocomplete="off"></label>
+<button type="submit">{{call .T "login.verify"}}</button>
+{{else}}<label>{{call .T "login.identifier"}} <input type="text" name="identifier" autocomplete="username" required autofocus></label>
+<label>{{call .T "login.password"}} <input type="password" name="password" required></label>
+<button type="submit">{{call .T "login.submit"}}</button>
+{{end}}
+</form>
+</body>
+</html>
+`))
+
+type OIDCHandler struct {
+	oidcService     *service.OIDCService
+	identityService *service.IdentityService
+	mfaService      *service.MFAService
+}
+
+func NewOIDCHandler(oidcService *service.OIDCService, identityService *service.IdentityService, mfaService *service.MFAService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:     oidcService,
+		identityService: identityService,
+		mfaService:      mfaService,
+	}
+}
+
+// loginForm is what the login form shows besides the authorization request.
+// Error is a message key. With MFAToken set it asks for the second factor
+// instead of the password.
+type loginForm struct {
+	ClientName string
+	Error      string
+	MFAToken   string
+}
+
+// Authorize starts the authorization code flow by showing the login form.
+// Codes are only issued after the user signs in there, never to a caller
+// presenting a bearer token.
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	client, err := h.oidcService.ValidateAuthorizeRequest(c.Request.Context(), req)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+
+	if req.Prompt == "none" {
+		redirectWithError(c, req, oauthErrLoginRequired, "User is not signed in")
+		return
+	}
+
+	renderLoginForm(c, http.StatusOK, loginForm{ClientName: client.Name}, req)
+}
+
+// AuthorizeLogin handles the login form posted from Authorize, and the second
+// factor form that follows it for identities using MFA.
+func (h *OIDCHandler) AuthorizeLogin(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	client, err := h.oidcService.ValidateAuthorizeRequest(c.Request.Context(), req)
+	if err != nil {
+		authorizeError(c, req, err)
+		return
+	}
+
+	if mfaToken := c.PostForm("mfa_token"); mfaToken != "" {
+		h.completeMFA(c, req, client.Name, mfaToken)
+		return
+	}
+
+	identity, err := h.identityService.Authenticate(c.Request.Context(), service.LoginRequest{
+		Identifier: c.PostForm("identifier"),
+		Password:   c.PostForm("password"),
+		IPAddress:  c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			renderLoginForm(c, http.StatusUnauthorized, loginForm{ClientName: client.Name, Error: "login.invalid_credentials"}, req)
+		case errors.Is(err, service.ErrAccountLocked):
+			renderLoginForm(c, http.StatusForbidden, loginForm{ClientName: client.Name, Error: "login.account_locked"}, req)
+		case errors.Is(err, service.ErrPasswordResetRequired):
+			renderLoginForm(c, http.StatusForbidden, loginForm{ClientName: client.Name, Error: "login.password_reset_required"}, req)
+		default:
+			utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		}
+		return
+	}
+
+	challenge, err := h.mfaService.Challenge(c.Request.Context(), identity)
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+	if challenge != nil {
+		if challenge.EnrollmentRequired {
+			renderLoginForm(c, http.StatusForbidden, loginForm{
+				ClientName: client.Name,
+				Error:      "login.mfa_enrollment_required",
+			}, req)
+			return
+		}
+		renderLoginForm(c, http.StatusOK, loginForm{ClientName: client.Name, MFAToken: challenge.Token}, req)
+		return
+	}
+
+	h.issueCode(c, req, identity.UserID, time.Now())
+}
+
+func (h *OIDCHandler) completeMFA(c *gin.Context, req service.AuthorizeRequest, clientName, mfaToken string) {
+	identity, _, err := h.identityService.CompleteMFA(c.Request.Context(), service.MFALoginRequest{
+		MFAToken:     mfaToken,
+		Code:         c.PostForm("code"),
+		RecoveryCode: c.PostForm("recovery_code"),
+		IPAddress:    c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMFACode):
+			renderLoginForm(c, http.StatusUnauthorized, loginForm{ClientName: clientName, Error: "login.invalid_mfa_code", MFAToken: mfaToken}, req)
+		case errors.Is(err, service.ErrInvalidMFAChallenge):
+			renderLoginForm(c, http.StatusUnauthorized, loginForm{ClientName: clientName, Error: "login.mfa_expired"}, req)
+		case errors.Is(err, service.ErrAccountLocked):
+			renderLoginForm(c, http.StatusForbidden, loginForm{ClientName: clientName, Error: "login.account_locked"}, req)
+		default:
+			utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		}
+		return
+	}
+
+	h.issueCode(c, req, identity.UserID, time.Now())
+}
+
+func (h *OIDCHandler) issueCode(c *gin.Context, req service.AuthorizeRequest, userID uuid.UUID, authTime time.Time) {
+	code, err := h.oidcService.Authorize(c.Request.Context(), req, userID, authTime)
+	if err != nil {
+		if errors.Is(err, service.ErrAccountLocked) {
+			redirectWithError(c, req, oauthErrAccessDenied, err.Error())
+			return
+		}
+		authorizeError(c, req, err)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectTo(c, req.RedirectURI, params)
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// Token is the OAuth token endpoint. Clients authenticate with HTTP Basic or
+// with client_id and client_secret in the form; public clients send only
+// client_id.
+func (h *OIDCHandler) Token(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(c, req.ClientID, req.ClientSecret)
+
+	resp, err := h.oidcService.Exchange(c.Request.Context(), service.TokenRequest{
+		GrantType:    req.GrantType,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         req.Code,
+		RedirectURI:  req.RedirectURI,
+		CodeVerifier: req.CodeVerifier,
+		RefreshToken: req.RefreshToken,
+		IPAddress:    c.ClientIP(),
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if err != nil {
+		tokenEndpointError(c, err, basic)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// TokenRevocationRequest is the form of the introspection and revocation
+// endpoints.
+type TokenRevocationRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// Introspect is the RFC 7662 introspection endpoint. Confidential clients
+// authenticate as at the token endpoint; unknown, expired and revoked tokens
+// are reported as inactive rather than as errors.
+func (h *OIDCHandler) Introspect(c *gin.Context) {
+	var req TokenRevocationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		return
+	}
+	if req.Token == "" {
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidRequest, "token is required")
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(c, req.ClientID, req.ClientSecret)
+	resp, err := h.oidcService.Introspect(c.Request.Context(), clientID, clientSecret, req.Token, req.TokenTypeHint)
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if err != nil {
+		tokenEndpointError(c, err, basic)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke is the RFC 7009 revocation endpoint. It answers 200 for any token,
+// valid or not, once the client is authenticated.
+func (h *OIDCHandler) Revoke(c *gin.Context) {
+	var req TokenRevocationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		return
+	}
+	if req.Token == "" {
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidRequest, "token is required")
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err := h.oidcService.Revoke(c.Request.Context(), clientID, clientSecret, req.Token, req.TokenTypeHint); err != nil {
+		tokenEndpointError(c, err, basic)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials returns the credentials the client authenticated with,
+// HTTP Basic taking precedence over the form, and whether Basic was used.
+func clientCredentials(c *gin.Context, formID, formSecret string) (string, string, bool) {
+	clientID, clientSecret, basic := c.Request.BasicAuth()
+	if !basic {
+		return formID, formSecret, false
+	}
+	// Basic credentials are form-encoded before being base64 encoded
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	return clientID, clientSecret, true
+}
+
+// tokenEndpointError writes the error of a client authenticated endpoint.
+func tokenEndpointError(c *gin.Context, err error, basic bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidClient):
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthError(c, http.StatusUnauthorized, oauthErrInvalidClient, err.Error())
+	case errors.Is(err, service.ErrInvalidGrant):
+		oauthError(c, http.StatusBadRequest, oauthErrInvalidGrant, err.Error())
+	case errors.Is(err, service.ErrUnsupportedGrantType):
+		oauthError(c, http.StatusBadRequest, oauthErrUnsupportedGrantType, err.Error())
+	default:
+		oauthError(c, http.StatusInternalServerError, oauthErrServerError, err.Error())
+	}
+}
+
+type userInfoResponse struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	*utils.ProfileClaims
+}
+
+// UserInfo returns the subject of the token plus the email, profile and phone
+// claims its scopes allow. The router only lets tokens granted the openid
+// scope through.
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	userID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, oauthErrInvalidToken, "Invalid user in token")
+		return
+	}
+
+	hasScope := func(scope string) bool { return middleware.HasScope(c, scope) }
+	claims, err := h.oidcService.ProfileClaims(c.Request.Context(), userID, hasScope)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, oauthErrServerError, err.Error())
+		return
+	}
+
+	info := userInfoResponse{
+		Subject:       userID.String(),
+		ProfileClaims: claims,
+	}
+	if hasScope(service.ScopeEmail) {
+		info.Email = middleware.GetEmail(c)
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// authorizeError reports an invalid authorization request. Errors about the
+// client or redirect URI are shown to the user; anything else is sent back to
+// the client's redirect URI.
+func authorizeError(c *gin.Context, req service.AuthorizeRequest, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidClient), errors.Is(err, service.ErrInvalidRedirectURI):
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrUnsupportedResponseType):
+		redirectWithError(c, req, oauthErrUnsupportedResponseType, err.Error())
+	case errors.Is(err, service.ErrInvalidScope):
+		redirectWithError(c, req, oauthErrInvalidScope, err.Error())
+	case errors.Is(err, service.ErrPKCERequired):
+		redirectWithError(c, req, oauthErrInvalidRequest, err.Error())
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
+
+func redirectWithError(c *gin.Context, req service.AuthorizeRequest, code, description string) {
+	params := url.Values{
+		"error":             {code},
+		"error_description": {description},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectTo(c, req.RedirectURI, params)
+}
+
+// redirectTo redirects to a registered redirect URI with params added to its
+// query.
+func redirectTo(c *gin.Context, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_redirect_uri")
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	status := http.StatusFound
+	if c.Request.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	c.Redirect(status, u.String())
+}
+
+func renderLoginForm(c *gin.Context, status int, form loginForm, req service.AuthorizeRequest) {
+	params := map[string]string{}
+	for name, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+
+	// The form collects credentials, so keep it out of caches and frames
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+
+	localizer := i18n.FromContext(c.Request.Context())
+	err := loginFormTemplate.Execute(c.Writer, gin.H{
+		"T":          localizer.T,
+		"Locale":     localizer.Locale(),
+		"ClientName": form.ClientName,
+		"Action":     c.Request.URL.Path,
+		"Params":     params,
+		"Error":      form.Error,
+		"MFAToken":   form.MFAToken,
+	})
+	if err != nil {
+		utils.Errorf("Failed to render login form", utils.ErrorField(err.Error()))
+	}
+}
+
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
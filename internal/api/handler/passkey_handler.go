@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/gym-api/ms-ga-identifier/pkg/webauthn"
+)
+
+type PasskeyHandler struct {
+	webAuthnService *service.WebAuthnService
+	identityService *service.IdentityService
+}
+
+func NewPasskeyHandler(webAuthnService *service.WebAuthnService, identityService *service.IdentityService) *PasskeyHandler {
+	return &PasskeyHandler{
+		webAuthnService: webAuthnService,
+		identityService: identityService,
+	}
+}
+
+type PasskeyBeginLoginRequest struct {
+	Identifier     string `json:"identifier"`
+	IdentifierType string `json:"identifier_type" binding:"omitempty,oneof=email phone username member_number card_uid"`
+	Email          string `json:"email" binding:"omitempty,email"`
+}
+
+// BeginLogin returns the options for navigator.credentials.get.
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	// The body is optional
+	var req PasskeyBeginLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	identifier, identifierType := req.Identifier, entity.IdentifierType(req.IdentifierType)
+	if identifier == "" && req.Email != "" {
+		identifier, identifierType = req.Email, entity.IdentifierTypeEmail
+	}
+
+	options, err := h.webAuthnService.BeginLogin(c.Request.Context(), identifier, identifierType)
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"public_key": options})
+}
+
+type PasskeyFinishLoginRequest struct {
+	Credential webauthn.AssertionCredential `json:"credential" binding:"required"`
+	DeviceInfo string                       `json:"device_info"`
+}
+
+// FinishLogin checks the signed assertion and issues tokens like Login.
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req PasskeyFinishLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.identityService.LoginWithPasskey(c.Request.Context(), service.PasskeyLoginRequest{
+		Credential: &req.Credential,
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  c.ClientIP(),
+	})
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+func (h *PasskeyHandler) List(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.webAuthnService.ListCredentials(c.Request.Context(), userID)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// BeginRegistration returns the options for navigator.credentials.create.
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	options, err := h.webAuthnService.BeginRegistration(c.Request.Context(), userID)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"public_key": options})
+}
+
+type PasskeyFinishRegistrationRequest struct {
+	Name       string                          `json:"name" binding:"max=100"`
+	Credential webauthn.RegistrationCredential `json:"credential" binding:"required"`
+}
+
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	var req PasskeyFinishRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	passkey, err := h.webAuthnService.FinishRegistration(c.Request.Context(), userID, req.Name, &req.Credential)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPasskey) {
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+			return
+		}
+		passkeyError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, passkey)
+}
+
+func (h *PasskeyHandler) Delete(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "errors.invalid_passkey_id")
+		return
+	}
+
+	if err := h.webAuthnService.DeleteCredential(c.Request.Context(), userID, id); err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, gin.H{"message": i18n.FromContext(c.Request.Context()).T("passkey.removed")})
+}
+
+func passkeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPasskey):
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrPasswordResetRequired):
+		utils.Forbidden(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrPasskeyNotFound):
+		utils.NotFound(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrPasskeyAlreadyExists):
+		utils.Conflict(c, utils.ErrorMessage(c, err))
+	case errors.Is(err, service.ErrPermissionsUnavailable):
+		utils.ServiceUnavailable(c, utils.ErrorMessage(c, err))
+	default:
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+	}
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/middleware"
 	"github.com/gym-api/ms-ga-identifier/internal/service"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 )
@@ -23,13 +26,13 @@ type ForgotPasswordRequest struct {
 func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
 	var req ForgotPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
 		return
 	}
 
 	resp, err := h.passwordService.ForgotPassword(c.Request.Context(), req.Email)
 	if err != nil {
-		utils.InternalServerError(c, err.Error())
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
 		return
 	}
 
@@ -44,13 +47,59 @@ type ResetPasswordRequest struct {
 func (h *PasswordHandler) ResetPassword(c *gin.Context) {
 	var req ResetPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
 		return
 	}
 
 	resp, err := h.passwordService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
 	if err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+func (h *PasswordHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, err := uuid.Parse(middleware.GetUserID(c))
+	if err != nil {
+		utils.Unauthorized(c, "errors.invalid_user_in_token")
+		return
+	}
+
+	// Tokens issued before session ids existed parse to uuid.Nil, which
+	// matches no family, so every session is revoked
+	sessionID, _ := uuid.Parse(middleware.GetSessionID(c))
+
+	resp, err := h.passwordService.ChangePassword(c.Request.Context(), service.ChangePasswordRequest{
+		UserID:          userID,
+		SessionID:       sessionID,
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+		IPAddress:       c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCurrentPassword):
+			utils.Unauthorized(c, utils.ErrorMessage(c, err))
+		case errors.Is(err, service.ErrAccountLocked):
+			utils.Forbidden(c, utils.ErrorMessage(c, err))
+		case errors.Is(err, service.ErrPasswordPolicy), errors.Is(err, service.ErrPasswordUnchanged):
+			utils.BadRequest(c, utils.ErrorMessage(c, err))
+		default:
+			utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		}
 		return
 	}
 
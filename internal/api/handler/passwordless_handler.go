@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+type PasswordlessHandler struct {
+	passwordlessService *service.PasswordlessService
+	identityService     *service.IdentityService
+}
+
+func NewPasswordlessHandler(passwordlessService *service.PasswordlessService, identityService *service.IdentityService) *PasswordlessHandler {
+	return &PasswordlessHandler{
+		passwordlessService: passwordlessService,
+		identityService:     identityService,
+	}
+}
+
+type PasswordlessLoginRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Method string `json:"method" binding:"omitempty,oneof=link code"`
+}
+
+// Request emails a one-time login link, or a code if method is "code".
+func (h *PasswordlessHandler) Request(c *gin.Context) {
+	var req PasswordlessLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	method := entity.PasswordlessMethodLink
+	if req.Method != "" {
+		method = entity.PasswordlessMethod(req.Method)
+	}
+
+	resp, err := h.passwordlessService.RequestLogin(c.Request.Context(), req.Email, method)
+	if err != nil {
+		if errors.Is(err, service.ErrPasswordlessThrottled) {
+			utils.TooManyRequests(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type PasswordlessVerifyRequest struct {
+	Token      string `json:"token" binding:"required_without=Code"`
+	Email      string `json:"email" binding:"required_with=Code,omitempty,email"`
+	Code       string `json:"code" binding:"omitempty,numeric"`
+	DeviceInfo string `json:"device_info"`
+}
+
+// Verify exchanges a login link token, or an email and code, for tokens.
+func (h *PasswordlessHandler) Verify(c *gin.Context) {
+	var req PasswordlessVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	resp, err := h.identityService.LoginWithPasswordless(c.Request.Context(), service.PasswordlessLoginRequest{
+		Token:      req.Token,
+		Email:      req.Email,
+		Code:       req.Code,
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPasswordlessToken):
+			utils.Unauthorized(c, utils.ErrorMessage(c, err))
+		case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrPasswordResetRequired):
+			utils.Forbidden(c, utils.ErrorMessage(c, err))
+		case errors.Is(err, service.ErrPermissionsUnavailable):
+			utils.ServiceUnavailable(c, utils.ErrorMessage(c, err))
+		default:
+			utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
+
+type PasswordlessSettingsRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// SetEnabled opts the current user in to or out of passwordless login.
+func (h *PasswordlessHandler) SetEnabled(c *gin.Context) {
+	var req PasswordlessSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.passwordlessService.SetEnabled(c.Request.Context(), userID, *req.Enabled)
+	if err != nil {
+		utils.InternalServerError(c, utils.ErrorMessage(c, err))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, resp)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,13 +24,17 @@ type RefreshTokenRequest struct {
 func (h *TokenHandler) RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, err.Error())
+		utils.BadRequest(c, utils.ErrorMessage(c, err))
 		return
 	}
 
-	resp, err := h.tokenService.RefreshToken(c.Request.Context(), req.RefreshToken)
+	resp, err := h.tokenService.RefreshToken(c.Request.Context(), req.RefreshToken, "", c.ClientIP())
 	if err != nil {
-		utils.Unauthorized(c, err.Error())
+		if errors.Is(err, service.ErrPermissionsUnavailable) {
+			utils.ServiceUnavailable(c, utils.ErrorMessage(c, err))
+			return
+		}
+		utils.Unauthorized(c, utils.ErrorMessage(c, err))
 		return
 	}
 
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+// JWKSMaxAge is how long clients may cache the key set. New signing keys are
+// published this long before they are used, so cached sets already hold
+// them; clients should still refetch when they see a kid they don't know.
+const JWKSMaxAge = 5 * time.Minute
+
+var jwksCacheControl = fmt.Sprintf("public, max-age=%d", int(JWKSMaxAge.Seconds()))
+
+// discoveryCacheControl lets clients cache the provider metadata, which only
+// changes with a deployment.
+const discoveryCacheControl = "public, max-age=3600"
+
+type WellKnownHandler struct {
+	keySet *utils.KeySet
+	issuer string
+}
+
+func NewWellKnownHandler(keySet *utils.KeySet, issuer string) *WellKnownHandler {
+	return &WellKnownHandler{
+		keySet: keySet,
+		issuer: strings.TrimSuffix(issuer, "/"),
+	}
+}
+
+// JWKS serves the public signing keys in the standard JWK Set format, not
+// wrapped in the usual response envelope.
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", jwksCacheControl)
+	c.JSON(http.StatusOK, h.keySet.JWKS())
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	c.Header("Cache-Control", discoveryCacheControl)
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                        h.issuer,
+		"authorization_endpoint":                        h.issuer + "/oauth/authorize",
+		"token_endpoint":                                h.issuer + "/oauth/token",
+		"userinfo_endpoint":                             h.issuer + "/oauth/userinfo",
+		"introspection_endpoint":                        h.issuer + "/oauth/introspect",
+		"revocation_endpoint":                           h.issuer + "/oauth/revoke",
+		"jwks_uri":                                      h.issuer + "/.well-known/jwks.json",
+		"response_types_supported":                      []string{service.ResponseTypeCode},
+		"grant_types_supported":                         []string{service.GrantTypeAuthorizationCode, service.GrantTypeRefreshToken},
+		"subject_types_supported":                       []string{"public"},
+		"id_token_signing_alg_values_supported":         []string{h.keySet.Active().Algorithm},
+		"scopes_supported":                              service.SupportedScopes,
+		"token_endpoint_auth_methods_supported":         []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":    []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":              []string{service.CodeChallengeMethodS256},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "sid", "email", "email_verified",
+			"name", "given_name", "family_name", "locale", "zoneinfo", "updated_at",
+			"phone_number", "phone_number_verified",
+		},
+	})
+}
@@ -1,38 +1,71 @@
 package router
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gym-api/ms-ga-identifier/internal/api/handler"
 	"github.com/gym-api/ms-ga-identifier/internal/middleware"
+	"github.com/gym-api/ms-ga-identifier/internal/service"
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 )
 
 type Router struct {
-	engine           *gin.Engine
-	identityHandler  *handler.IdentityHandler
-	tokenHandler     *handler.TokenHandler
-	passwordHandler  *handler.PasswordHandler
-	authMiddleware   *middleware.AuthMiddleware
-	cfg              *config.Config
+	engine              *gin.Engine
+	identityHandler     *handler.IdentityHandler
+	tokenHandler        *handler.TokenHandler
+	passwordHandler     *handler.PasswordHandler
+	mfaHandler          *handler.MFAHandler
+	passkeyHandler      *handler.PasskeyHandler
+	passwordlessHandler *handler.PasswordlessHandler
+	identifierHandler   *handler.IdentifierHandler
+	kioskHandler        *handler.KioskHandler
+	adminHandler        *handler.AdminHandler
+	oidcHandler         *handler.OIDCHandler
+	wellKnown           *handler.WellKnownHandler
+	authMiddleware      *middleware.AuthMiddleware
+	rateLimiter         *middleware.RateLimiter
+	catalog             *i18n.Catalog
+	cfg                 *config.Config
 }
 
 func NewRouter(
 	identityHandler *handler.IdentityHandler,
 	tokenHandler *handler.TokenHandler,
 	passwordHandler *handler.PasswordHandler,
+	mfaHandler *handler.MFAHandler,
+	passkeyHandler *handler.PasskeyHandler,
+	passwordlessHandler *handler.PasswordlessHandler,
+	identifierHandler *handler.IdentifierHandler,
+	kioskHandler *handler.KioskHandler,
+	adminHandler *handler.AdminHandler,
+	oidcHandler *handler.OIDCHandler,
+	wellKnown *handler.WellKnownHandler,
 	authMiddleware *middleware.AuthMiddleware,
+	rateLimiter *middleware.RateLimiter,
+	catalog *i18n.Catalog,
 	cfg *config.Config,
 ) *gin.Engine {
 	r := &Router{
-		engine:          gin.Default(),
-		identityHandler: identityHandler,
-		tokenHandler:    tokenHandler,
-		passwordHandler: passwordHandler,
-		authMiddleware:  authMiddleware,
-		cfg:            cfg,
+		engine:              gin.Default(),
+		identityHandler:     identityHandler,
+		tokenHandler:        tokenHandler,
+		passwordHandler:     passwordHandler,
+		mfaHandler:          mfaHandler,
+		passkeyHandler:      passkeyHandler,
+		passwordlessHandler: passwordlessHandler,
+		identifierHandler:   identifierHandler,
+		kioskHandler:        kioskHandler,
+		adminHandler:        adminHandler,
+		oidcHandler:         oidcHandler,
+		wellKnown:           wellKnown,
+		authMiddleware:      authMiddleware,
+		rateLimiter:         rateLimiter,
+		catalog:             catalog,
+		cfg:                 cfg,
 	}
 
 	r.setupRoutes()
@@ -40,6 +73,9 @@ func NewRouter(
 }
 
 func (r *Router) setupRoutes() {
+	r.engine.Use(middleware.CorrelationID())
+	r.engine.Use(middleware.Locale(r.catalog))
+
 	// Health check endpoints
 	r.engine.GET("/health", func(c *gin.Context) {
 		utils.SuccessResponse(c, http.StatusOK, gin.H{"status": "healthy"})
@@ -49,18 +85,51 @@ func (r *Router) setupRoutes() {
 		utils.SuccessResponse(c, http.StatusOK, gin.H{"status": "ready"})
 	})
 
+	// Runtime, outbox relay and auth event metrics, for staff like the
+	// admin API
+	r.engine.GET("/debug/vars",
+		r.authMiddleware.RequireAuth(),
+		middleware.RequireRole(r.cfg.Admin.Roles...),
+		middleware.RequirePermission(handler.PermissionMetricsRead),
+		gin.WrapH(expvar.Handler()),
+	)
+
+	// Discovery endpoints
+	r.engine.GET("/.well-known/jwks.json", r.wellKnown.JWKS)
+	r.engine.GET("/.well-known/openid-configuration", r.wellKnown.OpenIDConfiguration)
+
+	// OpenID Connect provider endpoints
+	oauth := r.engine.Group("/oauth")
+	{
+		oauth.GET("/authorize", r.oidcHandler.Authorize)
+		oauth.POST("/authorize", r.rateLimiter.Limit("login"), r.oidcHandler.AuthorizeLogin)
+		oauth.POST("/token", r.oidcHandler.Token)
+		oauth.POST("/introspect", r.oidcHandler.Introspect)
+		oauth.POST("/revoke", r.oidcHandler.Revoke)
+		oauth.GET("/userinfo", r.authMiddleware.RequireAuth(service.ScopeOpenID), middleware.RequireScope(service.ScopeOpenID), r.oidcHandler.UserInfo)
+		oauth.POST("/userinfo", r.authMiddleware.RequireAuth(service.ScopeOpenID), middleware.RequireScope(service.ScopeOpenID), r.oidcHandler.UserInfo)
+	}
+
 	// API routes
 	api := r.engine.Group("/api/v1")
 	{
 		// Public endpoints
 		public := api.Group("")
 		{
-			public.POST("/register", r.identityHandler.Register)
-			public.POST("/login", r.identityHandler.Login)
-			public.POST("/refresh", r.tokenHandler.RefreshToken)
-			public.POST("/forgot-password", r.passwordHandler.ForgotPassword)
+			public.POST("/register", r.rateLimiter.Limit("register"), r.identityHandler.Register)
+			public.POST("/login", r.rateLimiter.Limit("login"), r.identityHandler.Login)
+			public.POST("/login/mfa", r.rateLimiter.Limit("login"), r.mfaHandler.Login)
+			public.POST("/login/mfa/enroll", r.rateLimiter.Limit("login"), r.mfaHandler.LoginEnroll)
+			public.POST("/login/passkey/begin", r.rateLimiter.Limit("login"), r.passkeyHandler.BeginLogin)
+			public.POST("/login/passkey/finish", r.rateLimiter.Limit("login"), r.passkeyHandler.FinishLogin)
+			public.POST("/login/passwordless", r.rateLimiter.Limit("passwordless"), r.passwordlessHandler.Request)
+			public.POST("/login/passwordless/verify", r.rateLimiter.Limit("login"), r.passwordlessHandler.Verify)
+			public.POST("/refresh", r.rateLimiter.Limit("refresh"), r.tokenHandler.RefreshToken)
+			public.POST("/forgot-password", r.rateLimiter.Limit("forgot_password"), r.passwordHandler.ForgotPassword)
 			public.POST("/reset-password", r.passwordHandler.ResetPassword)
 			public.GET("/verify-email/:token", r.identityHandler.VerifyEmail)
+			public.POST("/resend-verification", r.identityHandler.ResendVerification)
+			public.POST("/kiosk/check-in", r.rateLimiter.Limit("kiosk"), r.kioskHandler.CheckIn)
 		}
 
 		// Protected endpoints
@@ -68,8 +137,51 @@ func (r *Router) setupRoutes() {
 		protected.Use(r.authMiddleware.RequireAuth())
 		{
 			protected.POST("/logout", r.identityHandler.Logout)
+			protected.POST("/logout-all", r.identityHandler.LogoutAll)
 			protected.GET("/me", r.identityHandler.GetCurrentUser)
-			protected.POST("/change-password", r.identityHandler.ChangePassword)
+			protected.PATCH("/me", r.identityHandler.UpdateProfile)
+			protected.PUT("/locale", r.identityHandler.UpdateLocale)
+			protected.POST("/change-password", r.passwordHandler.ChangePassword)
+			protected.GET("/mfa", r.mfaHandler.Status)
+			protected.POST("/mfa/totp/enroll", r.mfaHandler.Enroll)
+			protected.POST("/mfa/totp/confirm", r.mfaHandler.Confirm)
+			protected.POST("/mfa/totp/disable", r.mfaHandler.Disable)
+			protected.POST("/mfa/recovery-codes", r.mfaHandler.RegenerateRecoveryCodes)
+			protected.PUT("/passwordless", r.passwordlessHandler.SetEnabled)
+			protected.GET("/passkeys", r.passkeyHandler.List)
+			protected.POST("/passkeys/register/begin", r.passkeyHandler.BeginRegistration)
+			protected.POST("/passkeys/register/finish", r.passkeyHandler.FinishRegistration)
+			protected.DELETE("/passkeys/:id", r.passkeyHandler.Delete)
+			protected.GET("/identifiers", r.identifierHandler.List)
+			protected.POST("/identifiers", r.identifierHandler.Add)
+			protected.DELETE("/identifiers/:id", r.identifierHandler.Delete)
+			protected.POST("/identifiers/:id/verification", r.identifierHandler.SendVerification)
+			protected.POST("/identifiers/:id/verify", r.identifierHandler.Verify)
+			protected.PUT("/identifiers/:id/primary", r.identifierHandler.SetPrimary)
+			protected.PUT("/kiosk/pin", r.kioskHandler.SetPIN)
+			protected.DELETE("/kiosk/pin", r.kioskHandler.RemovePIN)
+		}
+
+		// Admin endpoints, for the admin roles and each guarded by the
+		// permission it needs
+		admin := api.Group("/admin")
+		admin.Use(r.authMiddleware.RequireAuth(), middleware.RequireRole(r.cfg.Admin.Roles...))
+		{
+			admin.GET("/identities", middleware.RequirePermission(handler.PermissionIdentityRead), r.adminHandler.ListIdentities)
+			admin.GET("/identities/:user_id", middleware.RequirePermission(handler.PermissionIdentityRead), r.adminHandler.GetIdentity)
+			admin.DELETE("/identities/:user_id", middleware.RequirePermission(handler.PermissionIdentityDelete), r.adminHandler.DeleteIdentity)
+			admin.PUT("/identities/:user_id/status", middleware.RequirePermission(handler.PermissionIdentityStatus), r.adminHandler.SetIdentityStatus)
+			admin.POST("/identities/:user_id/password-reset", middleware.RequirePermission(handler.PermissionIdentityPasswordReset), r.adminHandler.RequirePasswordReset)
+			admin.POST("/identities/:user_id/sessions/revoke", middleware.RequirePermission(handler.PermissionIdentitySessions), r.adminHandler.RevokeSessions)
+			admin.GET("/identities/:user_id/login-attempts", middleware.RequirePermission(handler.PermissionIdentityRead), r.adminHandler.ListLoginAttempts)
+			admin.POST("/identities/:user_id/unlock", middleware.RequirePermission(handler.PermissionIdentityUnlock), r.adminHandler.UnlockIdentity)
+			admin.PUT("/identities/:user_id/mfa", middleware.RequirePermission(handler.PermissionIdentityMFA), r.adminHandler.SetMFARequirement)
+			admin.POST("/identities/:user_id/identifiers", middleware.RequirePermission(handler.PermissionIdentifierWrite), r.adminHandler.AddIdentifier)
+			admin.POST("/identities/:user_id/identifiers/:id/verify", middleware.RequirePermission(handler.PermissionIdentifierWrite), r.adminHandler.VerifyIdentifier)
+			admin.POST("/oauth-clients", middleware.RequirePermission(handler.PermissionOAuthClientWrite), r.adminHandler.RegisterOAuthClient)
+			admin.GET("/kiosks", middleware.RequirePermission(handler.PermissionKioskWrite), r.adminHandler.ListKiosks)
+			admin.POST("/kiosks", middleware.RequirePermission(handler.PermissionKioskWrite), r.adminHandler.RegisterKiosk)
+			admin.DELETE("/kiosks/:id", middleware.RequirePermission(handler.PermissionKioskWrite), r.adminHandler.DeactivateKiosk)
 		}
 	}
 }
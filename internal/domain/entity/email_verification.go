@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EmailVerificationToken struct {
+	ID         uuid.UUID
+	IdentityID uuid.UUID
+	TokenHash  string
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	CreatedAt  time.Time
+}
+
+func (evt *EmailVerificationToken) IsUsed() bool {
+	return evt.UsedAt != nil
+}
+
+func (evt *EmailVerificationToken) IsExpired() bool {
+	return time.Now().After(evt.ExpiresAt)
+}
+
+func (evt *EmailVerificationToken) IsValid() bool {
+	return !evt.IsUsed() && !evt.IsExpired()
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IdentifierType string
+
+const (
+	IdentifierTypeEmail        IdentifierType = "email"
+	IdentifierTypePhone        IdentifierType = "phone"
+	IdentifierTypeUsername     IdentifierType = "username"
+	IdentifierTypeMemberNumber IdentifierType = "member_number"
+	IdentifierTypeCardUID      IdentifierType = "card_uid"
+)
+
+// Identifier is a value an identity can sign in with besides its password.
+// Value is normalized for its type and unique among identifiers of that
+// type. Each identity has at most one primary identifier per type; the
+// primary email is the one kept in Identity.Email.
+type Identifier struct {
+	ID         uuid.UUID
+	IdentityID uuid.UUID
+	Type       IdentifierType
+	Value      string
+	Verified   bool
+	Primary    bool
+	VerifiedAt *time.Time
+	// VerificationHash is the hash of the code last sent to prove ownership,
+	// valid until VerificationExpiresAt.
+	VerificationHash      string
+	VerificationExpiresAt *time.Time
+	VerificationAttempts  int
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+// CanSignIn reports whether the identifier may be used to log in. Only the
+// primary email can be used before it is verified, as it always could.
+func (i *Identifier) CanSignIn() bool {
+	return i.Verified || i.Primary
+}
+
+// HasPendingVerification reports whether a verification code was sent and
+// has not expired yet.
+func (i *Identifier) HasPendingVerification() bool {
+	return i.VerificationHash != "" && i.VerificationExpiresAt != nil && time.Now().Before(*i.VerificationExpiresAt)
+}
@@ -22,8 +22,25 @@ type Identity struct {
 	PasswordHash  string
 	Status        IdentityStatus
 	EmailVerified bool
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	// LockedUntil is when a temporary lock or suspension ends (or ended). It
+	// is nil for identities that were never locked and for permanent ones.
+	LockedUntil  *time.Time
+	LockoutCount int
+	// StatusReason is why an administrator last locked or suspended the
+	// identity.
+	StatusReason string
+	// MFARequired forces a second factor at login, enrolling one first if
+	// needed.
+	MFARequired bool
+	// PasswordlessEnabled lets the identity log in with a link or code sent
+	// by email instead of the password.
+	PasswordlessEnabled bool
+	// PasswordResetRequired blocks password logins until the password is
+	// changed through a reset link.
+	PasswordResetRequired bool
+	Profile               Profile
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 func (i *Identity) IsActive() bool {
@@ -34,10 +51,26 @@ func (i *Identity) IsLocked() bool {
 	return i.Status == StatusLocked
 }
 
+// IsTemporarilyLocked reports whether the identity is locked with an expiry.
+func (i *Identity) IsTemporarilyLocked() bool {
+	return i.Status == StatusLocked && i.LockedUntil != nil
+}
+
+// LockExpired reports whether a temporary lock has run out.
+func (i *Identity) LockExpired() bool {
+	return i.IsTemporarilyLocked() && time.Now().After(*i.LockedUntil)
+}
+
 func (i *Identity) IsSuspended() bool {
 	return i.Status == StatusSuspended
 }
 
+// SuspensionExpired reports whether a suspension with an end date has run
+// out.
+func (i *Identity) SuspensionExpired() bool {
+	return i.IsSuspended() && i.LockedUntil != nil && time.Now().After(*i.LockedUntil)
+}
+
 func (i *Identity) CanLogin() bool {
 	return i.Status == StatusActive && i.EmailVerified
 }
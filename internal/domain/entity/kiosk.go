@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KioskDevice is a check-in kiosk registered by staff. It authenticates with
+// ClientID and the secret hashed in ClientSecretHash; deactivated kiosks are
+// refused.
+type KioskDevice struct {
+	ID               uuid.UUID
+	Name             string
+	Location         string
+	ClientID         string
+	ClientSecretHash string
+	Active           bool
+	LastSeenAt       *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// KioskPIN is the short PIN a member types at a kiosk after tapping a card.
+type KioskPIN struct {
+	IdentityID uuid.UUID
+	PINHash    string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// KioskCardLockout counts wrong PINs entered with a card. The card is refused
+// until LockedUntil once too many were entered.
+type KioskCardLockout struct {
+	IdentifierID uuid.UUID
+	Failures     int
+	LockedUntil  *time.Time
+	UpdatedAt    time.Time
+}
+
+func (l *KioskCardLockout) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+// KioskSession records a check-in token issued to a member at a kiosk.
+type KioskSession struct {
+	ID           uuid.UUID
+	DeviceID     uuid.UUID
+	IdentityID   uuid.UUID
+	IdentifierID *uuid.UUID
+	IPAddress    string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
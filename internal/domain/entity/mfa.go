@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPCredential is an identity's authenticator app enrollment. It only counts
+// as a second factor once confirmed with a valid code. LastUsedStep is the
+// last accepted time step, so a code can't be used twice.
+type TOTPCredential struct {
+	ID              uuid.UUID
+	IdentityID      uuid.UUID
+	SecretEncrypted string
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (c *TOTPCredential) IsConfirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost. Only its hash is stored.
+type RecoveryCode struct {
+	ID         uuid.UUID
+	IdentityID uuid.UUID
+	CodeHash   string
+	UsedAt     *time.Time
+	CreatedAt  time.Time
+}
+
+// MFAChallenge is handed out by a login that passed the password check and
+// must be completed with a second factor.
+type MFAChallenge struct {
+	ID         uuid.UUID
+	IdentityID uuid.UUID
+	TokenHash  string
+	Attempts   int
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	CreatedAt  time.Time
+}
+
+func (c *MFAChallenge) IsUsed() bool {
+	return c.UsedAt != nil
+}
+
+func (c *MFAChallenge) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+func (c *MFAChallenge) IsValid() bool {
+	return !c.IsUsed() && !c.IsExpired()
+}
@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is an application allowed to sign users in through the OpenID
+// Connect endpoints. Public clients (mobile and single page apps) have no
+// secret and must use PKCE.
+type OAuthClient struct {
+	ID               uuid.UUID
+	ClientID         string
+	ClientSecretHash string
+	Name             string
+	RedirectURIs     []string
+	AllowedScopes    []string
+	IsPublic         bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// HasRedirectURI reports whether uri is registered. Redirect URIs are compared
+// exactly.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, s := range c.AllowedScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationCode is a one-time code handed to a client by the authorization
+// endpoint and exchanged for tokens at the token endpoint.
+type AuthorizationCode struct {
+	ID                  uuid.UUID
+	CodeHash            string
+	ClientID            string
+	IdentityID          uuid.UUID
+	RedirectURI         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+	CreatedAt           time.Time
+}
+
+func (ac *AuthorizationCode) IsUsed() bool {
+	return ac.UsedAt != nil
+}
+
+func (ac *AuthorizationCode) IsExpired() bool {
+	return time.Now().After(ac.ExpiresAt)
+}
+
+func (ac *AuthorizationCode) IsValid() bool {
+	return !ac.IsUsed() && !ac.IsExpired()
+}
+
+// HasScope reports whether scope was granted with the code.
+func (ac *AuthorizationCode) HasScope(scope string) bool {
+	for _, s := range strings.Fields(ac.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
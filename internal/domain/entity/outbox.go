@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// OutboxEvent is an event waiting to be relayed to Kafka. It is written in
+// the same transaction as the change it describes. Events with the same Key
+// are relayed in ID order; an event that keeps failing is dead-lettered after
+// the configured number of attempts and left in the table.
+type OutboxEvent struct {
+	ID             int64
+	Key            string
+	Type           string
+	Payload        []byte
+	Attempts       int
+	LastError      string
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	PublishedAt    *time.Time
+	DeadLetteredAt *time.Time
+}
+
+// IsPending reports whether the event still has to be relayed.
+func (e *OutboxEvent) IsPending() bool {
+	return e.PublishedAt == nil && e.DeadLetteredAt == nil
+}
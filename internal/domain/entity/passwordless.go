@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PasswordlessMethod string
+
+const (
+	PasswordlessMethodLink PasswordlessMethod = "link"
+	PasswordlessMethodCode PasswordlessMethod = "code"
+)
+
+// PasswordlessToken is a one-time login link or code sent by email. Only its
+// hash is stored; a code is hashed together with the token id because codes
+// are short enough to collide between identities.
+type PasswordlessToken struct {
+	ID         uuid.UUID
+	IdentityID uuid.UUID
+	Method     PasswordlessMethod
+	TokenHash  string
+	Attempts   int
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	CreatedAt  time.Time
+}
+
+func (t *PasswordlessToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+func (t *PasswordlessToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+func (t *PasswordlessToken) IsValid() bool {
+	return !t.IsUsed() && !t.IsExpired()
+}
@@ -0,0 +1,26 @@
+package entity
+
+import "strings"
+
+// Profile is what the user tells us about themselves. Every field is
+// optional; empty means not set.
+type Profile struct {
+	FirstName   string
+	LastName    string
+	DisplayName string
+	// Phone is in E.164 format, e.g. "+5511912345678".
+	Phone string
+	// Locale is the preferred language for emails, e.g. "es". Empty means
+	// the default locale.
+	Locale string
+	// Timezone is an IANA time zone name, e.g. "America/Sao_Paulo".
+	Timezone string
+}
+
+// FullName is the display name, or the first and last name when it isn't set.
+func (p Profile) FullName() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
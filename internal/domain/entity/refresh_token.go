@@ -6,15 +6,22 @@ import (
 	"github.com/google/uuid"
 )
 
+// RefreshToken is one link in a rotation chain. Every refresh issues a new
+// token in the same FamilyID and points the old one at it via ReplacedByID.
+// ClientID and Scope are set for sessions granted to an OAuth client.
 type RefreshToken struct {
-	ID         uuid.UUID
-	IdentityID uuid.UUID
-	TokenHash  string
-	DeviceInfo string
-	IPAddress  string
-	ExpiresAt  time.Time
-	CreatedAt  time.Time
-	RevokedAt  *time.Time
+	ID           uuid.UUID
+	IdentityID   uuid.UUID
+	FamilyID     uuid.UUID
+	TokenHash    string
+	ClientID     string
+	Scope        string
+	DeviceInfo   string
+	IPAddress    string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+	RevokedAt    *time.Time
+	ReplacedByID *uuid.UUID
 }
 
 func (rt *RefreshToken) IsActive() bool {
@@ -28,3 +35,9 @@ func (rt *RefreshToken) IsExpired() bool {
 func (rt *RefreshToken) IsRevoked() bool {
 	return rt.RevokedAt != nil
 }
+
+// IsRotated reports whether the token has already been exchanged for a newer
+// one. Presenting a rotated token again indicates it was stolen.
+func (rt *RefreshToken) IsRotated() bool {
+	return rt.ReplacedByID != nil
+}
@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey or security key registered to an identity.
+// PublicKey is the COSE encoded key sent by the authenticator. SignCount is
+// the last counter value seen and must increase with every login unless the
+// authenticator doesn't keep one.
+type WebAuthnCredential struct {
+	ID             uuid.UUID
+	IdentityID     uuid.UUID
+	CredentialID   []byte
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	Name           string
+	BackupEligible bool
+	BackedUp       bool
+	LastUsedAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type WebAuthnCeremony string
+
+const (
+	WebAuthnCeremonyRegistration WebAuthnCeremony = "registration"
+	WebAuthnCeremonyLogin        WebAuthnCeremony = "login"
+)
+
+// WebAuthnSession holds the challenge of a registration or login ceremony
+// until the browser sends the signed response. IdentityID is nil for logins
+// that let the authenticator pick a discoverable credential.
+type WebAuthnSession struct {
+	ID            uuid.UUID
+	IdentityID    *uuid.UUID
+	Ceremony      WebAuthnCeremony
+	ChallengeHash string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+func (s *WebAuthnSession) IsUsed() bool {
+	return s.UsedAt != nil
+}
+
+func (s *WebAuthnSession) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+func (s *WebAuthnSession) IsValid() bool {
+	return !s.IsUsed() && !s.IsExpired()
+}
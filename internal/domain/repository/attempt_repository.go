@@ -11,5 +11,6 @@ import (
 type LoginAttemptRepository interface {
 	Create(ctx context.Context, attempt *entity.LoginAttempt) error
 	CountRecentFailures(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error)
+	CountRecentFailuresByEmail(ctx context.Context, email string, since time.Time) (int, error)
 	GetRecentByIdentityID(ctx context.Context, identityID uuid.UUID, limit int) ([]*entity.LoginAttempt, error)
 }
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type IdentifierRepository interface {
+	Create(ctx context.Context, identifier *entity.Identifier) (*entity.Identifier, error)
+	GetByID(ctx context.Context, id, identityID uuid.UUID) (*entity.Identifier, error)
+	GetByValue(ctx context.Context, identifierType entity.IdentifierType, value string) (*entity.Identifier, error)
+	ListByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.Identifier, error)
+	SetVerificationCode(ctx context.Context, id uuid.UUID, codeHash string, expiresAt time.Time) error
+	IncrementVerificationAttempts(ctx context.Context, id uuid.UUID) error
+	MarkVerified(ctx context.Context, id uuid.UUID) error
+	// SetPrimary makes the identifier the primary one of its type. Making an
+	// email primary also changes the identity's email.
+	SetPrimary(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id, identityID uuid.UUID) error
+}
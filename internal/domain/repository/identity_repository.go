@@ -2,18 +2,47 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 )
 
+// IdentityFilter narrows IdentityRepository.List. Zero values don't filter.
+// Results are ordered newest first and resume after the (After, AfterID)
+// cursor when it is set.
+type IdentityFilter struct {
+	Status        entity.IdentityStatus
+	Email         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	After         *time.Time
+	AfterID       uuid.UUID
+	Limit         int
+}
+
 type IdentityRepository interface {
-	Create(ctx context.Context, identity *entity.Identity) (*entity.Identity, error)
+	// Create stores the identity and, in the same transaction, the given
+	// identifiers.
+	Create(ctx context.Context, identity *entity.Identity, identifiers ...*entity.Identifier) (*entity.Identity, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*entity.Identity, error)
 	GetByEmail(ctx context.Context, email string) (*entity.Identity, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Identity, error)
+	// List returns identities matching filter; Email matches any part of
+	// the address, case-insensitively.
+	List(ctx context.Context, filter IdentityFilter) ([]*entity.Identity, error)
 	Update(ctx context.Context, identity *entity.Identity) (*entity.Identity, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status entity.IdentityStatus) error
+	UpdateLockout(ctx context.Context, id uuid.UUID, status entity.IdentityStatus, lockedUntil *time.Time, lockoutCount int) error
+	// UpdateAdminStatus sets a status chosen by an administrator together
+	// with its reason and optional end.
+	UpdateAdminStatus(ctx context.Context, id uuid.UUID, status entity.IdentityStatus, lockedUntil *time.Time, reason string) error
+	UpdatePasswordResetRequired(ctx context.Context, id uuid.UUID, required bool) error
+	UpdateMFARequired(ctx context.Context, id uuid.UUID, required bool) error
+	UpdatePasswordlessEnabled(ctx context.Context, id uuid.UUID, enabled bool) error
+	UpdateLocale(ctx context.Context, id uuid.UUID, locale string) error
+	UpdateProfile(ctx context.Context, id uuid.UUID, profile entity.Profile) error
+	// UpdatePassword also clears PasswordResetRequired.
 	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
 	SetEmailVerified(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
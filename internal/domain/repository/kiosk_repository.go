@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type KioskDeviceRepository interface {
+	Create(ctx context.Context, device *entity.KioskDevice) (*entity.KioskDevice, error)
+	GetByClientID(ctx context.Context, clientID string) (*entity.KioskDevice, error)
+	List(ctx context.Context) ([]*entity.KioskDevice, error)
+	UpdateLastSeen(ctx context.Context, id uuid.UUID) error
+	Deactivate(ctx context.Context, id uuid.UUID) error
+}
+
+type KioskPINRepository interface {
+	// Upsert sets the identity's PIN, replacing any previous one.
+	Upsert(ctx context.Context, pin *entity.KioskPIN) error
+	GetByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.KioskPIN, error)
+	Delete(ctx context.Context, identityID uuid.UUID) error
+}
+
+type KioskCardLockoutRepository interface {
+	GetByIdentifierID(ctx context.Context, identifierID uuid.UUID) (*entity.KioskCardLockout, error)
+	// RecordFailure counts a wrong PIN and returns the failures so far.
+	RecordFailure(ctx context.Context, identifierID uuid.UUID) (int, error)
+	Lock(ctx context.Context, identifierID uuid.UUID, until time.Time) error
+	Reset(ctx context.Context, identifierID uuid.UUID) error
+	// ResetByIdentityID clears the lockouts of all of the identity's cards.
+	ResetByIdentityID(ctx context.Context, identityID uuid.UUID) error
+}
+
+type KioskSessionRepository interface {
+	Create(ctx context.Context, session *entity.KioskSession) (*entity.KioskSession, error)
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+var (
+	// ErrTOTPStepUsed is returned by UpdateLastUsedStep when a code from the
+	// same or a later time step has already been accepted.
+	ErrTOTPStepUsed = errors.New("totp code already used")
+	// ErrRecoveryCodeNotFound is returned by MarkAsUsed when no unused code
+	// matches.
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found or already used")
+	// ErrMFAChallengeUsed is returned by MarkAsUsed when the challenge has
+	// already been completed.
+	ErrMFAChallengeUsed = errors.New("mfa challenge already used")
+)
+
+type TOTPCredentialRepository interface {
+	Create(ctx context.Context, credential *entity.TOTPCredential) (*entity.TOTPCredential, error)
+	GetByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.TOTPCredential, error)
+	Confirm(ctx context.Context, id uuid.UUID, step int64) error
+	UpdateLastUsedStep(ctx context.Context, id uuid.UUID, step int64) error
+	DeleteByIdentityID(ctx context.Context, identityID uuid.UUID) error
+}
+
+type RecoveryCodeRepository interface {
+	// Replace removes the identity's codes and stores the new set.
+	Replace(ctx context.Context, identityID uuid.UUID, codes []*entity.RecoveryCode) error
+	MarkAsUsed(ctx context.Context, identityID uuid.UUID, codeHashes ...string) error
+	CountUnused(ctx context.Context, identityID uuid.UUID) (int, error)
+}
+
+type MFAChallengeRepository interface {
+	Create(ctx context.Context, challenge *entity.MFAChallenge) (*entity.MFAChallenge, error)
+	GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.MFAChallenge, error)
+	IncrementAttempts(ctx context.Context, id uuid.UUID) error
+	MarkAsUsed(ctx context.Context, id uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
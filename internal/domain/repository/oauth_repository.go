@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+// ErrAuthorizationCodeUsed is returned by MarkAsUsed when the code has already
+// been exchanged.
+var ErrAuthorizationCodeUsed = errors.New("authorization code already used")
+
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *entity.OAuthClient) (*entity.OAuthClient, error)
+	GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error)
+}
+
+type AuthorizationCodeRepository interface {
+	Create(ctx context.Context, code *entity.AuthorizationCode) (*entity.AuthorizationCode, error)
+	GetByCodeHash(ctx context.Context, codeHashes ...string) (*entity.AuthorizationCode, error)
+	// MarkAsUsed consumes the code, failing with ErrAuthorizationCodeUsed if it
+	// was consumed concurrently.
+	MarkAsUsed(ctx context.Context, id uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
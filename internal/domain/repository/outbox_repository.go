@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+// Transactor runs fn in a database transaction. Repositories called with the
+// context fn receives take part in it; the transaction commits when fn
+// returns nil and rolls back otherwise.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// OutboxStats describes the events still waiting in the outbox.
+type OutboxStats struct {
+	Pending         int64
+	OldestPendingAt *time.Time
+	DeadLettered    int64
+}
+
+type OutboxRepository interface {
+	Create(ctx context.Context, event *entity.OutboxEvent) error
+	// LockRelay takes the lock that lets a single relay run at a time and
+	// reports whether it got it. It must be called in a transaction and is
+	// held until that ends.
+	LockRelay(ctx context.Context) (bool, error)
+	// ListDue returns up to limit events to publish next, oldest first: for
+	// each key, its oldest event that is neither published nor dead-lettered,
+	// if that one's next attempt is due. Later events of a key wait for the
+	// one before them.
+	ListDue(ctx context.Context, limit int) ([]*entity.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64, publishedAt time.Time) error
+	// MarkFailed schedules the event's next attempt retryAfter from now by
+	// the database's clock, which ListDue compares against.
+	MarkFailed(ctx context.Context, id int64, attempts int, retryAfter time.Duration, lastError string) error
+	MarkDeadLettered(ctx context.Context, id int64, attempts int, lastError string) error
+	Stats(ctx context.Context) (*OutboxStats, error)
+	DeletePublishedBefore(ctx context.Context, before time.Time) error
+}
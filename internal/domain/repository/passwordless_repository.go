@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+// ErrPasswordlessTokenUsed is returned by MarkAsUsed when the token has
+// already been redeemed.
+var ErrPasswordlessTokenUsed = errors.New("passwordless token already used")
+
+type PasswordlessTokenRepository interface {
+	Create(ctx context.Context, token *entity.PasswordlessToken) (*entity.PasswordlessToken, error)
+	GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.PasswordlessToken, error)
+	GetLatestByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.PasswordlessToken, error)
+	CountCreatedSince(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error)
+	IncrementAttempts(ctx context.Context, id uuid.UUID) error
+	MarkAsUsed(ctx context.Context, id uuid.UUID) error
+	MarkAllAsUsedByIdentityID(ctx context.Context, identityID uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
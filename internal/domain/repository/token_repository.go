@@ -2,23 +2,44 @@ package repository
 
 import (
 	"context"
+	"errors"
 
 	"github.com/google/uuid"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 )
 
+// ErrRefreshTokenNotRotatable is returned by Rotate when the token was revoked
+// or rotated concurrently, i.e. it is no longer the live head of its family.
+var ErrRefreshTokenNotRotatable = errors.New("refresh token already revoked or rotated")
+
+// ErrPasswordResetTokenUsed is returned by MarkAsUsed when the token has
+// already been used.
+var ErrPasswordResetTokenUsed = errors.New("password reset token already used")
+
 type RefreshTokenRepository interface {
 	Create(ctx context.Context, token *entity.RefreshToken) (*entity.RefreshToken, error)
-	GetByTokenHash(ctx context.Context, tokenHash string) (*entity.RefreshToken, error)
+	GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.RefreshToken, error)
 	GetActiveByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.RefreshToken, error)
 	Revoke(ctx context.Context, id uuid.UUID) error
 	RevokeAllByIdentityID(ctx context.Context, identityID uuid.UUID) error
+	RevokeAllByIdentityIDExceptFamily(ctx context.Context, identityID, familyID uuid.UUID) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	// IsFamilyActive reports whether the family still has an unrevoked,
+	// unexpired token, i.e. whether its session is live.
+	IsFamilyActive(ctx context.Context, familyID uuid.UUID) (bool, error)
+	Rotate(ctx context.Context, oldID uuid.UUID, next *entity.RefreshToken) (*entity.RefreshToken, error)
+	// HasSessions reports whether the identity has any refresh token that
+	// hasn't been cleaned up yet.
+	HasSessions(ctx context.Context, identityID uuid.UUID) (bool, error)
+	// HasDevice reports whether one of those tokens was issued to the same
+	// device, matching on device info when given and on IP address otherwise.
+	HasDevice(ctx context.Context, identityID uuid.UUID, deviceInfo, ipAddress string) (bool, error)
 	DeleteExpired(ctx context.Context) error
 }
 
 type PasswordResetRepository interface {
 	Create(ctx context.Context, token *entity.PasswordResetToken) (*entity.PasswordResetToken, error)
-	GetByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordResetToken, error)
+	GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.PasswordResetToken, error)
 	MarkAsUsed(ctx context.Context, id uuid.UUID) error
 	DeleteExpired(ctx context.Context) error
 }
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+// ErrVerificationTokenUsed is returned by MarkAsUsed when the token has
+// already been used.
+var ErrVerificationTokenUsed = errors.New("verification token already used")
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, token *entity.EmailVerificationToken) (*entity.EmailVerificationToken, error)
+	GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.EmailVerificationToken, error)
+	GetLatestByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.EmailVerificationToken, error)
+	CountCreatedSince(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error)
+	MarkAsUsed(ctx context.Context, id uuid.UUID) error
+	MarkAllAsUsedByIdentityID(ctx context.Context, identityID uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+var (
+	// ErrSignCountNotIncreased is returned by UpdateUsage when another login
+	// has already recorded the same or a higher sign count.
+	ErrSignCountNotIncreased = errors.New("webauthn sign count not increased")
+	// ErrWebAuthnSessionUsed is returned by MarkAsUsed when the ceremony has
+	// already been completed.
+	ErrWebAuthnSessionUsed = errors.New("webauthn session already used")
+)
+
+type WebAuthnCredentialRepository interface {
+	Create(ctx context.Context, credential *entity.WebAuthnCredential) (*entity.WebAuthnCredential, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*entity.WebAuthnCredential, error)
+	ListByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.WebAuthnCredential, error)
+	UpdateUsage(ctx context.Context, id uuid.UUID, signCount uint32, backedUp bool) error
+	Delete(ctx context.Context, id, identityID uuid.UUID) error
+}
+
+type WebAuthnSessionRepository interface {
+	Create(ctx context.Context, session *entity.WebAuthnSession) (*entity.WebAuthnSession, error)
+	GetByChallengeHash(ctx context.Context, challengeHashes ...string) (*entity.WebAuthnSession, error)
+	MarkAsUsed(ctx context.Context, id uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/redis"
+)
+
+const (
+	permissionPrefix        = "permissions:"
+	permissionGenerationKey = "permissions:generation"
+	permissionVersionPrefix = "permissions:version:"
+	// maxMemoryPermissions bounds the in-memory cache used without Redis.
+	maxMemoryPermissions = 10000
+)
+
+// Permissions are a user's roles and permissions as the auth service
+// reported them at CachedAt.
+type Permissions struct {
+	Roles       []string  `json:"roles"`
+	Permissions []string  `json:"permissions"`
+	CachedAt    time.Time `json:"cached_at"`
+}
+
+// PermissionCache keeps each user's roles and permissions for retain, so
+// logins and refreshes don't all go to the auth service. Whether an entry is
+// still fresh enough is up to the caller. Entries are keyed by a generation
+// that InvalidateAll bumps, which drops every entry at once, and Invalidate
+// bumps a per-user version, so permissions read before an invalidation can't
+// be written back after it; see Version.
+//
+// Without Redis the entries are kept in memory. They are then per replica,
+// and an invalidation only reaches the replica that handles it.
+type PermissionCache struct {
+	redis  *redis.RedisClient
+	memory *memoryPermissions
+	retain time.Duration
+}
+
+func NewPermissionCache(redisClient *redis.RedisClient, retain time.Duration) *PermissionCache {
+	c := &PermissionCache{redis: redisClient, retain: retain}
+	if redisClient == nil {
+		c.memory = &memoryPermissions{entries: make(map[string]memoryPermission)}
+	}
+	return c
+}
+
+// Get returns the cached permissions of the user, or nil if there are none.
+func (c *PermissionCache) Get(ctx context.Context, userID string) (*Permissions, error) {
+	if c.retain <= 0 {
+		return nil, nil
+	}
+	if c.memory != nil {
+		return c.memory.get(userID), nil
+	}
+
+	key, err := c.key(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	value, err := c.redis.Get(ctx, key)
+	if err != nil {
+		if redis.IsNil(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var perms Permissions
+	if err := json.Unmarshal([]byte(value), &perms); err != nil {
+		return nil, err
+	}
+	return &perms, nil
+}
+
+// Version returns the user's cache version, which changes with every
+// invalidation that affects the user. Take it before asking the auth service
+// and pass it to Set with the answer.
+func (c *PermissionCache) Version(ctx context.Context, userID string) (string, error) {
+	if c.retain <= 0 {
+		return "", nil
+	}
+	if c.memory != nil {
+		return c.memory.version(), nil
+	}
+
+	generation, err := c.getOrZero(ctx, permissionGenerationKey)
+	if err != nil {
+		return "", err
+	}
+	version, err := c.getOrZero(ctx, permissionVersionPrefix+userID)
+	if err != nil {
+		return "", err
+	}
+	return generation + ":" + version, nil
+}
+
+// permissionSetScript writes an entry only if neither the generation nor the
+// user's version moved on since the permissions were read.
+const permissionSetScript = `
+if (redis.call('GET', KEYS[1]) or '0') ~= ARGV[1] then return 0 end
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[2] then return 0 end
+redis.call('SET', KEYS[3], ARGV[3], 'PX', ARGV[4])
+return 1
+`
+
+// Set caches perms, stamping CachedAt with the current time if unset. It
+// does nothing if the user's entry was invalidated after version was taken,
+// as perms may predate the change.
+func (c *PermissionCache) Set(ctx context.Context, userID, version string, perms *Permissions) error {
+	if c.retain <= 0 {
+		return nil
+	}
+	if perms.CachedAt.IsZero() {
+		perms.CachedAt = time.Now()
+	}
+	if c.memory != nil {
+		c.memory.set(userID, version, perms, time.Now().Add(c.retain))
+		return nil
+	}
+
+	generation, userVersion, ok := strings.Cut(version, ":")
+	if !ok {
+		return fmt.Errorf("invalid permission cache version %q", version)
+	}
+	value, err := json.Marshal(perms)
+	if err != nil {
+		return err
+	}
+	_, err = c.redis.Eval(ctx, permissionSetScript,
+		[]string{permissionGenerationKey, permissionVersionPrefix + userID, permissionPrefix + generation + ":" + userID},
+		generation, userVersion, value, c.retain.Milliseconds())
+	return err
+}
+
+// permissionInvalidateScript bumps the user's version and drops their entry.
+// The version outlives any load that could have read it.
+const permissionInvalidateScript = `
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[2])
+return 1
+`
+
+// Invalidate drops the cached permissions of the user.
+func (c *PermissionCache) Invalidate(ctx context.Context, userID string) error {
+	if c.memory != nil {
+		c.memory.delete(userID)
+		return nil
+	}
+	key, err := c.key(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = c.redis.Eval(ctx, permissionInvalidateScript,
+		[]string{permissionVersionPrefix + userID, key}, c.retain.Milliseconds())
+	return err
+}
+
+// InvalidateAll drops every cached entry, for changes such as a role's
+// permissions that affect users we can't list. The old entries are left to
+// expire.
+func (c *PermissionCache) InvalidateAll(ctx context.Context) error {
+	if c.memory != nil {
+		c.memory.clear()
+		return nil
+	}
+	_, err := c.redis.Incr(ctx, permissionGenerationKey)
+	return err
+}
+
+func (c *PermissionCache) key(ctx context.Context, userID string) (string, error) {
+	generation, err := c.getOrZero(ctx, permissionGenerationKey)
+	if err != nil {
+		return "", err
+	}
+	return permissionPrefix + generation + ":" + userID, nil
+}
+
+// getOrZero reads a counter, which is "0" until first incremented.
+func (c *PermissionCache) getOrZero(ctx context.Context, key string) (string, error) {
+	value, err := c.redis.Get(ctx, key)
+	if err != nil {
+		if redis.IsNil(err) {
+			return "0", nil
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+type memoryPermission struct {
+	perms     Permissions
+	expiresAt time.Time
+}
+
+// memoryPermissions versions all entries together: any invalidation turns
+// away writes of permissions read before it, which at worst leaves an entry
+// to be loaded again.
+type memoryPermissions struct {
+	mu            sync.Mutex
+	entries       map[string]memoryPermission
+	invalidations int64
+}
+
+func (m *memoryPermissions) version() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return strconv.FormatInt(m.invalidations, 10)
+}
+
+func (m *memoryPermissions) get(userID string) *Permissions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	perms := entry.perms
+	return &perms
+}
+
+func (m *memoryPermissions) set(userID, version string, perms *Permissions, expiresAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if version != strconv.FormatInt(m.invalidations, 10) {
+		return
+	}
+	if _, ok := m.entries[userID]; !ok && len(m.entries) >= maxMemoryPermissions {
+		m.evictLocked()
+	}
+	m.entries[userID] = memoryPermission{perms: *perms, expiresAt: expiresAt}
+}
+
+// evictLocked makes room by dropping expired entries or, failing that, an
+// arbitrary one.
+func (m *memoryPermissions) evictLocked() {
+	now := time.Now()
+	for userID, entry := range m.entries {
+		if now.After(entry.expiresAt) {
+			delete(m.entries, userID)
+		}
+	}
+	if len(m.entries) < maxMemoryPermissions {
+		return
+	}
+	for userID := range m.entries {
+		delete(m.entries, userID)
+		return
+	}
+}
+
+func (m *memoryPermissions) delete(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, userID)
+	m.invalidations++
+}
+
+func (m *memoryPermissions) clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]memoryPermission)
+	m.invalidations++
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPermissionCacheDropsWritesFromBeforeInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c := NewPermissionCache(nil, time.Hour)
+	old := &Permissions{Roles: []string{"admin"}}
+
+	tests := []struct {
+		name       string
+		invalidate func() error
+	}{
+		{name: "user invalidated", invalidate: func() error { return c.Invalidate(ctx, "user-1") }},
+		{name: "everyone invalidated", invalidate: func() error { return c.InvalidateAll(ctx) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A load reads the version, then the roles change while it waits
+			version, err := c.Version(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("Version: %v", err)
+			}
+			if err := tt.invalidate(); err != nil {
+				t.Fatalf("invalidate: %v", err)
+			}
+			if err := c.Set(ctx, "user-1", version, old); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if cached, _ := c.Get(ctx, "user-1"); cached != nil {
+				t.Fatalf("stale permissions were cached: %+v", cached)
+			}
+
+			// A load started after the change is cached
+			version, _ = c.Version(ctx, "user-1")
+			if err := c.Set(ctx, "user-1", version, &Permissions{Roles: []string{"member"}}); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			cached, _ := c.Get(ctx, "user-1")
+			if cached == nil || len(cached.Roles) != 1 || cached.Roles[0] != "member" {
+				t.Fatalf("cached = %+v, want the member role", cached)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/redis"
+)
+
+const (
+	tokenDenylistPrefix = "denylist:jti:"
+	userDenylistPrefix  = "denylist:user:"
+)
+
+// TokenDenylist records revoked access token ids until the tokens would have
+// expired on their own. A nil Redis client disables the denylist.
+type TokenDenylist struct {
+	redis *redis.RedisClient
+}
+
+func NewTokenDenylist(redisClient *redis.RedisClient) *TokenDenylist {
+	return &TokenDenylist{redis: redisClient}
+}
+
+// Add denies the token with the given jti until expiresAt.
+func (d *TokenDenylist) Add(ctx context.Context, jti string, expiresAt time.Time) error {
+	if d.redis == nil || jti == "" {
+		return nil
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.redis.Set(ctx, tokenDenylistPrefix+jti, 1, ttl)
+}
+
+func (d *TokenDenylist) IsDenied(ctx context.Context, jti string) (bool, error) {
+	if d.redis == nil || jti == "" {
+		return false, nil
+	}
+	n, err := d.redis.Exists(ctx, tokenDenylistPrefix+jti)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeUser denies every access token of the user issued up to now. The
+// entry is kept for ttl, which should be the access token lifetime.
+func (d *TokenDenylist) RevokeUser(ctx context.Context, userID string, ttl time.Duration) error {
+	if d.redis == nil || userID == "" {
+		return nil
+	}
+	return d.redis.Set(ctx, userDenylistPrefix+userID, time.Now().Unix(), ttl)
+}
+
+// IsUserRevoked reports whether a token of the user issued at issuedAt was
+// revoked by RevokeUser. Token times have second precision, so a token
+// issued in the same second as the revocation counts as revoked.
+func (d *TokenDenylist) IsUserRevoked(ctx context.Context, userID string, issuedAt time.Time) (bool, error) {
+	if d.redis == nil || userID == "" {
+		return false, nil
+	}
+	value, err := d.redis.Get(ctx, userDenylistPrefix+userID)
+	if err != nil {
+		if redis.IsNil(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return issuedAt.Unix() <= revokedAt, nil
+}
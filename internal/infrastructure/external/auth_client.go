@@ -1,36 +1,146 @@
 package external
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 )
 
+const (
+	// OutagePolicyFailClosed refuses to issue tokens without current roles.
+	OutagePolicyFailClosed = "fail_closed"
+	// OutagePolicyStaleCache falls back to cached roles up to
+	// PermissionMaxStale old.
+	OutagePolicyStaleCache = "stale_cache"
+
+	// revalidateTimeout bounds the background refresh of a stale cache entry.
+	revalidateTimeout = 10 * time.Second
+)
+
+// ErrAuthServiceUnavailable is returned when the auth service can't be
+// reached and the outage policy has nothing to fall back on.
+var ErrAuthServiceUnavailable = errors.New("auth service unavailable")
+
 type RolePermission struct {
 	Role        string   `json:"role"`
 	Permissions []string `json:"permissions"`
 }
 
+// AuthClient gets users' roles and permissions from the auth service. Each
+// request times out, transient failures are retried with jittered backoff,
+// and a circuit breaker stops calls while the service is down. Results are
+// cached; see config.AuthConfig.
 type AuthClient struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	cfg         *config.AuthConfig
+	breaker     *circuitBreaker
+	permissions *cache.PermissionCache
+	// revalidating holds the users whose stale entry is being refreshed.
+	revalidating sync.Map
 }
 
-func NewAuthClient(cfg *config.AuthConfig) *AuthClient {
+func NewAuthClient(cfg *config.AuthConfig, permissions *cache.PermissionCache) (*AuthClient, error) {
+	switch cfg.OutagePolicy {
+	case "", OutagePolicyFailClosed, OutagePolicyStaleCache:
+	default:
+		return nil, fmt.Errorf("unknown auth outage policy %q", cfg.OutagePolicy)
+	}
+
 	return &AuthClient{
-		baseURL: cfg.ServiceURL,
-		client:  &http.Client{},
+		baseURL:     cfg.ServiceURL,
+		client:      &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		cfg:         cfg,
+		breaker:     newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		permissions: permissions,
+	}, nil
+}
+
+// PermissionRetention is how long the permission cache must keep entries for
+// the client's freshness and outage settings.
+func PermissionRetention(cfg *config.AuthConfig) time.Duration {
+	retain := cfg.PermissionCacheTTL + cfg.PermissionStaleWindow
+	if cfg.OutagePolicy == OutagePolicyStaleCache && cfg.PermissionMaxStale > retain {
+		retain = cfg.PermissionMaxStale
+	}
+	return retain
+}
+
+// statusError is an unexpected response status.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("auth service returned status code: %d", e.code)
+}
+
+// retryable reports whether a failure may be transient: anything but a
+// response the service meant, except 429 and 5xx.
+func retryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= http.StatusInternalServerError
 	}
+	return true
 }
 
-func (c *AuthClient) GetUserRolesAndPermissions(userID uuid.UUID) ([]RolePermission, error) {
+// GetUserRolesAndPermissions asks the auth service, retrying transient
+// failures. Its errors wrap ErrAuthServiceUnavailable, except the caller's
+// context ending.
+func (c *AuthClient) GetUserRolesAndPermissions(ctx context.Context, userID uuid.UUID) ([]RolePermission, error) {
+	backoff := c.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, fmt.Errorf("%w: circuit breaker open", ErrAuthServiceUnavailable)
+		}
+
+		rolePerms, err := c.fetch(ctx, userID)
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the service
+			c.breaker.abandon()
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			c.breaker.success()
+			return rolePerms, nil
+		}
+		if !retryable(err) {
+			// The service is up but won't answer; retrying won't change that
+			c.breaker.success()
+			return nil, fmt.Errorf("%w: %v", ErrAuthServiceUnavailable, err)
+		}
+		c.breaker.failure()
+
+		if attempt >= c.cfg.MaxRetries {
+			return nil, fmt.Errorf("%w: %v", ErrAuthServiceUnavailable, err)
+		}
+		utils.Warn("Auth service request failed, retrying",
+			utils.String("user_id", userID.String()),
+			utils.Int("attempt", attempt+1),
+			utils.ErrorField(err.Error()),
+		)
+		if !sleepJittered(ctx, backoff) {
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (c *AuthClient) fetch(ctx context.Context, userID uuid.UUID) ([]RolePermission, error) {
 	url := fmt.Sprintf("%s/auth/users/%s/roles-with-permissions", c.baseURL, userID.String())
-	
-	req, err := http.NewRequest("GET", url, nil)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -41,8 +151,12 @@ func (c *AuthClient) GetUserRolesAndPermissions(userID uuid.UUID) ([]RolePermiss
 	}
 	defer resp.Body.Close()
 
+	// A user the auth service doesn't know has no roles
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("auth service returned status code: %d", resp.StatusCode)
+		return nil, &statusError{code: resp.StatusCode}
 	}
 
 	var result struct {
@@ -57,21 +171,108 @@ func (c *AuthClient) GetUserRolesAndPermissions(userID uuid.UUID) ([]RolePermiss
 	return result.Data, nil
 }
 
-func (c *AuthClient) ExtractRolesAndPermissions(userID uuid.UUID) ([]string, []string, error) {
-	rolePerms, err := c.GetUserRolesAndPermissions(userID)
+// ExtractRolesAndPermissions returns the user's roles and permissions. A
+// cache entry younger than PermissionCacheTTL is used as is; within
+// PermissionStaleWindow after that it is used while being refreshed in the
+// background. Otherwise the auth service is asked, and if it is unavailable
+// the outage policy decides between a stale entry and
+// ErrAuthServiceUnavailable.
+func (c *AuthClient) ExtractRolesAndPermissions(ctx context.Context, userID uuid.UUID) ([]string, []string, error) {
+	cached, err := c.permissions.Get(ctx, userID.String())
 	if err != nil {
-		utils.Errorf("Failed to get roles and permissions", utils.ErrorField(err.Error()))
-		// Return empty roles/permissions if auth service is unavailable
-		return []string{}, []string{}, nil
+		utils.Warn("Failed to read cached permissions", utils.ErrorField(err.Error()))
+	}
+	if cached != nil {
+		age := time.Since(cached.CachedAt)
+		if age < c.cfg.PermissionCacheTTL {
+			return cached.Roles, cached.Permissions, nil
+		}
+		if age < c.cfg.PermissionCacheTTL+c.cfg.PermissionStaleWindow {
+			c.revalidate(userID)
+			return cached.Roles, cached.Permissions, nil
+		}
+	}
+
+	perms, err := c.load(ctx, userID)
+	if err == nil {
+		return perms.Roles, perms.Permissions, nil
 	}
 
-	roles := make([]string, 0)
-	permissions := make([]string, 0)
+	if errors.Is(err, ErrAuthServiceUnavailable) && c.cfg.OutagePolicy == OutagePolicyStaleCache &&
+		cached != nil && time.Since(cached.CachedAt) < c.cfg.PermissionMaxStale {
+		utils.Warn("Auth service unavailable, using cached permissions",
+			utils.String("user_id", userID.String()),
+			utils.String("cached_at", cached.CachedAt.Format(time.RFC3339)),
+			utils.ErrorField(err.Error()),
+		)
+		return cached.Roles, cached.Permissions, nil
+	}
+
+	utils.Errorf("Failed to get roles and permissions", utils.String("user_id", userID.String()), utils.ErrorField(err.Error()))
+	return nil, nil, err
+}
+
+// load gets the user's roles and permissions from the auth service and
+// caches them, unless the user's entry was invalidated in the meantime.
+func (c *AuthClient) load(ctx context.Context, userID uuid.UUID) (*cache.Permissions, error) {
+	// Taken first, so an invalidation during the request keeps its answer out
+	version, versionErr := c.permissions.Version(ctx, userID.String())
+	if versionErr != nil {
+		utils.Warn("Failed to read cached permissions version", utils.ErrorField(versionErr.Error()))
+	}
+
+	rolePerms, err := c.GetUserRolesAndPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 
+	perms := &cache.Permissions{
+		Roles:       make([]string, 0),
+		Permissions: make([]string, 0),
+	}
 	for _, rp := range rolePerms {
-		roles = append(roles, rp.Role)
-		permissions = append(permissions, rp.Permissions...)
+		perms.Roles = append(perms.Roles, rp.Role)
+		perms.Permissions = append(perms.Permissions, rp.Permissions...)
+	}
+
+	if versionErr == nil {
+		if err := c.permissions.Set(ctx, userID.String(), version, perms); err != nil {
+			utils.Warn("Failed to cache permissions", utils.ErrorField(err.Error()))
+		}
 	}
+	return perms, nil
+}
 
-	return roles, permissions, nil
+// revalidate refreshes the user's cache entry in the background, once at a
+// time per user.
+func (c *AuthClient) revalidate(userID uuid.UUID) {
+	key := userID.String()
+	if _, busy := c.revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	go func() {
+		defer c.revalidating.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+		if _, err := c.load(ctx, userID); err != nil {
+			utils.Warn("Failed to refresh cached permissions", utils.String("user_id", key), utils.ErrorField(err.Error()))
+		}
+	}()
+}
+
+// sleepJittered waits between half of d and d, so clients that failed
+// together don't all retry together, and reports whether ctx is still live.
+func sleepJittered(ctx context.Context, d time.Duration) bool {
+	if d > 0 {
+		d = d/2 + rand.N(d/2+1)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+// FileMailer writes each message to a directory as an .eml file that mail
+// clients can open. It is meant for development and tests.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// LogMailer only logs that a message would have been sent. The body is not
+// logged since it usually carries a token.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	utils.Info("Email not delivered (log transport)",
+		utils.String("to", msg.To),
+		utils.String("subject", msg.Subject),
+	)
+	return nil
+}
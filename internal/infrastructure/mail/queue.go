@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+var (
+	ErrQueueFull   = errors.New("mail queue is full")
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// Queue sends email in the background so requests don't wait on the mail
+// server. Failed sends are retried with a doubling backoff; messages still in
+// the queue when the process exits are lost.
+type Queue struct {
+	mailer Mailer
+	cfg    *config.MailQueueConfig
+	jobs   chan *Message
+	done   chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+	abort  sync.Once
+}
+
+func NewQueue(mailer Mailer, cfg *config.MailQueueConfig) *Queue {
+	return &Queue{
+		mailer: mailer,
+		cfg:    cfg,
+		jobs:   make(chan *Message, cfg.Size),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start launches the workers.
+func (q *Queue) Start() {
+	workers := q.cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Send enqueues msg and returns without waiting for delivery.
+func (q *Queue) Send(ctx context.Context, msg *Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent,
+// until ctx is done.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		// Abandon retry waits so the workers exit
+		q.abort.Do(func() { close(q.done) })
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for msg := range q.jobs {
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg *Message) {
+	backoff := q.cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := q.mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if attempt >= q.cfg.MaxAttempts {
+			utils.Errorf("Failed to send email",
+				utils.String("to", msg.To),
+				utils.String("subject", msg.Subject),
+				utils.Int("attempts", attempt),
+				utils.ErrorField(err.Error()),
+			)
+			return
+		}
+		utils.Warn("Email send failed, retrying",
+			utils.String("to", msg.To),
+			utils.Int("attempt", attempt),
+			utils.ErrorField(err.Error()),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-q.done:
+			return
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders the embedded email templates. Each email has a text
+// template, <name>.txt, which also defines the "subject" block, and an HTML
+// template, <name>.html, which defines the "content" block of layout.html.
+// Wording comes from the i18n catalog through the t function, so the
+// templates are parsed once per locale.
+type Templates struct {
+	catalog *i18n.Catalog
+	text    map[string]map[string]*texttemplate.Template
+	html    map[string]map[string]*htmltemplate.Template
+}
+
+func LoadTemplates(catalog *i18n.Catalog) (*Templates, error) {
+	t := &Templates{
+		catalog: catalog,
+		text:    make(map[string]map[string]*texttemplate.Template),
+		html:    make(map[string]map[string]*htmltemplate.Template),
+	}
+
+	files, err := fs.Glob(templateFS, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, locale := range catalog.Locales() {
+		funcs := translateFuncs(catalog.Localizer(locale))
+
+		layout, err := htmltemplate.New("layout.html").Funcs(funcs).ParseFS(templateFS, "templates/layout.html")
+		if err != nil {
+			return nil, err
+		}
+
+		t.text[locale] = make(map[string]*texttemplate.Template)
+		t.html[locale] = make(map[string]*htmltemplate.Template)
+		for _, file := range files {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+
+			text, err := texttemplate.New(path.Base(file)).Funcs(funcs).ParseFS(templateFS, file)
+			if err != nil {
+				return nil, err
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("email template %s has no subject", name)
+			}
+
+			html, err := htmltemplate.Must(layout.Clone()).ParseFS(templateFS, "templates/"+name+".html")
+			if err != nil {
+				return nil, err
+			}
+
+			t.text[locale][name] = text
+			t.html[locale][name] = html
+		}
+	}
+
+	return t, nil
+}
+
+func translateFuncs(localizer *i18n.Localizer) map[string]interface{} {
+	return map[string]interface{}{
+		"t": func(key string, data ...interface{}) string {
+			return localizer.T(key, data...)
+		},
+	}
+}
+
+// Render fills in the subject and both bodies of the named email in locale,
+// or in the default locale if the catalog doesn't have it.
+func (t *Templates) Render(name, locale string, data interface{}) (subject, text, html string, err error) {
+	if _, ok := t.text[locale]; !ok {
+		locale = t.catalog.DefaultLocale()
+	}
+	textTmpl, ok := t.text[locale][name]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown email template %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := textTmpl.Execute(&buf, data); err != nil {
+		return "", "", "", err
+	}
+	text = strings.TrimSpace(buf.String()) + "\n"
+
+	buf.Reset()
+	if err := t.html[locale][name].ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		return "", "", "", err
+	}
+	html = buf.String()
+
+	return subject, text, html, nil
+}
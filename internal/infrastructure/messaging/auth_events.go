@@ -0,0 +1,81 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Events of the auth service, which owns roles and permissions.
+const (
+	AuthEventUserRolesChanged       EventType = "auth.user.roles_changed"
+	AuthEventRolePermissionsChanged EventType = "auth.role.permissions_changed"
+	AuthEventUserDeleted            EventType = "auth.user.deleted"
+)
+
+// errInvalidAuthEvent marks an event that can never be handled, so it isn't
+// retried.
+var errInvalidAuthEvent = errors.New("invalid auth event")
+
+// AuthEventHandler applies the auth service's events. Delivery is at least
+// once, so each method must be safe to call again for the same event.
+type AuthEventHandler interface {
+	UserRolesChanged(ctx context.Context, userID uuid.UUID) error
+	RolePermissionsChanged(ctx context.Context, role string) error
+	UserDeleted(ctx context.Context, userID uuid.UUID) error
+}
+
+// authUserEvent is the data of the user events. The user may also be given
+// only as the event's subject.
+type authUserEvent struct {
+	UserID string `json:"user_id"`
+}
+
+type authRoleEvent struct {
+	Role string `json:"role"`
+}
+
+// dispatchAuthEvent calls the handler method for the event's type. Events of
+// other types are ignored.
+func dispatchAuthEvent(ctx context.Context, handler AuthEventHandler, event *CloudEvent) error {
+	switch event.Type {
+	case AuthEventUserRolesChanged, AuthEventUserDeleted:
+		userID, err := authEventUserID(event)
+		if err != nil {
+			return err
+		}
+		if event.Type == AuthEventUserDeleted {
+			return handler.UserDeleted(ctx, userID)
+		}
+		return handler.UserRolesChanged(ctx, userID)
+
+	case AuthEventRolePermissionsChanged:
+		var data authRoleEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil || data.Role == "" {
+			return fmt.Errorf("%w: %s without a role", errInvalidAuthEvent, event.Type)
+		}
+		return handler.RolePermissionsChanged(ctx, data.Role)
+	}
+	return nil
+}
+
+func authEventUserID(event *CloudEvent) (uuid.UUID, error) {
+	var data authUserEvent
+	if len(event.Data) > 0 {
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return uuid.Nil, fmt.Errorf("%w: %s: %v", errInvalidAuthEvent, event.Type, err)
+		}
+	}
+	if data.UserID == "" {
+		data.UserID = event.Subject
+	}
+
+	userID, err := uuid.Parse(data.UserID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %s with user id %q", errInvalidAuthEvent, event.Type, data.UserID)
+	}
+	return userID, nil
+}
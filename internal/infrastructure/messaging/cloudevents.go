@@ -0,0 +1,156 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	CloudEventsSpecVersion = "1.0"
+	// EventSource is the source attribute of every event this service emits.
+	EventSource = "/ms-ga-identifier"
+
+	// ContentModeStructured sends the whole CloudEvent as the message value;
+	// ContentModeBinary sends the data as the value and the attributes as
+	// ce_ headers.
+	ContentModeStructured = "structured"
+	ContentModeBinary     = "binary"
+
+	contentTypeJSON       = "application/json"
+	contentTypeCloudEvent = "application/cloudevents+json"
+	kafkaHeaderPrefix     = "ce_"
+)
+
+// CloudEvent is the CloudEvents 1.0 envelope of an identity event, in its
+// structured JSON form. CorrelationID is an extension attribute carrying the
+// X-Correlation-ID of the request that caused the event.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            EventType       `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewCloudEvent wraps data in an envelope with a new id, taking the
+// correlation id from ctx.
+func NewCloudEvent(ctx context.Context, data EventData) (*CloudEvent, error) {
+	entry, ok := schemaRegistry[data.EventType()]
+	if !ok {
+		return nil, fmt.Errorf("event type %s is not registered", data.EventType())
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              uuid.New().String(),
+		Source:          EventSource,
+		Type:            data.EventType(),
+		Subject:         data.Subject(),
+		Time:            time.Now().UTC(),
+		DataContentType: contentTypeJSON,
+		DataSchema:      SchemaID(data.EventType(), entry.version),
+		CorrelationID:   utils.CorrelationIDFromContext(ctx),
+		Data:            encoded,
+	}, nil
+}
+
+// kafkaMessage encodes the event in the given content mode, keyed by key.
+func (e *CloudEvent) kafkaMessage(key, mode string) (kafka.Message, error) {
+	msg := kafka.Message{Key: []byte(key)}
+	if mode != ContentModeBinary {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		msg.Value = value
+		msg.Headers = []kafka.Header{{Key: "content-type", Value: []byte(contentTypeCloudEvent)}}
+		return msg, nil
+	}
+
+	msg.Value = e.Data
+	msg.Headers = []kafka.Header{
+		{Key: "content-type", Value: []byte(e.DataContentType)},
+		{Key: kafkaHeaderPrefix + "specversion", Value: []byte(e.SpecVersion)},
+		{Key: kafkaHeaderPrefix + "id", Value: []byte(e.ID)},
+		{Key: kafkaHeaderPrefix + "source", Value: []byte(e.Source)},
+		{Key: kafkaHeaderPrefix + "type", Value: []byte(e.Type)},
+		{Key: kafkaHeaderPrefix + "time", Value: []byte(e.Time.Format(time.RFC3339Nano))},
+		{Key: kafkaHeaderPrefix + "dataschema", Value: []byte(e.DataSchema)},
+	}
+	if e.Subject != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: kafkaHeaderPrefix + "subject", Value: []byte(e.Subject)})
+	}
+	if e.CorrelationID != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: kafkaHeaderPrefix + "correlationid", Value: []byte(e.CorrelationID)})
+	}
+	return msg, nil
+}
+
+// encodeOutboxEvent turns an outbox payload into a Kafka message. Payloads
+// written before events were CloudEvents are sent as they are.
+func encodeOutboxEvent(key string, payload []byte, mode string) (kafka.Message, error) {
+	var event CloudEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return kafka.Message{}, err
+	}
+	if event.SpecVersion == "" {
+		return kafka.Message{Key: []byte(key), Value: payload}, nil
+	}
+	return event.kafkaMessage(key, mode)
+}
+
+// decodeCloudEvent reads a CloudEvent from a message in either content mode.
+// A message with a ce_type header is binary, anything else structured.
+func decodeCloudEvent(msg kafka.Message) (*CloudEvent, error) {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	if _, ok := headers[kafkaHeaderPrefix+"type"]; !ok {
+		var event CloudEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return nil, err
+		}
+		if event.SpecVersion == "" || event.Type == "" {
+			return nil, errors.New("message is not a CloudEvent")
+		}
+		return &event, nil
+	}
+
+	event := &CloudEvent{
+		SpecVersion:     headers[kafkaHeaderPrefix+"specversion"],
+		ID:              headers[kafkaHeaderPrefix+"id"],
+		Source:          headers[kafkaHeaderPrefix+"source"],
+		Type:            EventType(headers[kafkaHeaderPrefix+"type"]),
+		Subject:         headers[kafkaHeaderPrefix+"subject"],
+		DataContentType: headers["content-type"],
+		DataSchema:      headers[kafkaHeaderPrefix+"dataschema"],
+		CorrelationID:   headers[kafkaHeaderPrefix+"correlationid"],
+		Data:            msg.Value,
+	}
+	if t := headers[kafkaHeaderPrefix+"time"]; t != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return nil, err
+		}
+		event.Time = parsed
+	}
+	return event, nil
+}
@@ -0,0 +1,182 @@
+package messaging
+
+import (
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type EventType string
+
+const (
+	EventIdentityRegistered    EventType = "identity.registered"
+	EventIdentityLoggedIn      EventType = "identity.logged_in"
+	EventIdentityLoggedOut     EventType = "identity.logged_out"
+	EventPasswordChanged       EventType = "identity.password_changed"
+	EventRefreshTokenReused    EventType = "identity.refresh_token_reused"
+	EventEmailVerified         EventType = "identity.email_verified"
+	EventIdentityLocked        EventType = "identity.locked"
+	EventIdentityUnlocked      EventType = "identity.unlocked"
+	EventMFAEnabled            EventType = "identity.mfa_enabled"
+	EventMFADisabled           EventType = "identity.mfa_disabled"
+	EventPasskeyAdded          EventType = "identity.passkey_added"
+	EventPasskeyRemoved        EventType = "identity.passkey_removed"
+	EventStatusChanged         EventType = "identity.status_changed"
+	EventPasswordResetRequired EventType = "identity.password_reset_required"
+	EventIdentityDeleted       EventType = "identity.deleted"
+)
+
+// EventData is the typed payload of an event, the data of its CloudEvent.
+type EventData interface {
+	EventType() EventType
+	// Subject is the user the event is about. It keys the Kafka message, so
+	// a user's events stay in order.
+	Subject() string
+}
+
+// schemaRegistry lists every event with the version of its payload schema
+// and a zero value to describe it. A change that breaks the schema in
+// api/events must come with a new version; see cmd/eventschemas.
+var schemaRegistry = map[EventType]schemaEntry{
+	EventIdentityRegistered:    {1, IdentityRegistered{}},
+	EventIdentityLoggedIn:      {1, IdentityLoggedIn{}},
+	EventIdentityLoggedOut:     {1, IdentityLoggedOut{}},
+	EventPasswordChanged:       {1, PasswordChanged{}},
+	EventRefreshTokenReused:    {1, RefreshTokenReused{}},
+	EventEmailVerified:         {1, EmailVerified{}},
+	EventIdentityLocked:        {1, IdentityLocked{}},
+	EventIdentityUnlocked:      {1, IdentityUnlocked{}},
+	EventMFAEnabled:            {1, MFAEnabled{}},
+	EventMFADisabled:           {1, MFADisabled{}},
+	EventPasskeyAdded:          {1, PasskeyAdded{}},
+	EventPasskeyRemoved:        {1, PasskeyRemoved{}},
+	EventStatusChanged:         {1, StatusChanged{}},
+	EventPasswordResetRequired: {1, PasswordResetRequired{}},
+	EventIdentityDeleted:       {1, IdentityDeleted{}},
+}
+
+type schemaEntry struct {
+	version int
+	zero    EventData
+}
+
+// IdentityRef names the user an event is about. Every payload starts with it.
+type IdentityRef struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func RefFor(identity *entity.Identity) IdentityRef {
+	return IdentityRef{UserID: identity.UserID.String(), Email: identity.Email}
+}
+
+func (r IdentityRef) Subject() string { return r.UserID }
+
+type IdentityRegistered struct {
+	IdentityRef
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Locale    string `json:"locale"`
+}
+
+type IdentityLoggedIn struct {
+	IdentityRef
+	DeviceInfo string `json:"device_info"`
+	IPAddress  string `json:"ip_address"`
+	// ClientID is set when the session was granted to an OAuth client.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type IdentityLoggedOut struct {
+	IdentityRef
+	// Scope is "single" or "all".
+	Scope   string `json:"scope"`
+	Trigger string `json:"trigger,omitempty"`
+}
+
+type PasswordChanged struct {
+	IdentityRef
+	// Method is how the password was changed, such as "change" or "reset".
+	Method string `json:"method"`
+}
+
+type RefreshTokenReused struct {
+	IdentityRef
+	FamilyID   string `json:"family_id"`
+	TokenID    string `json:"token_id"`
+	DeviceInfo string `json:"device_info"`
+	IPAddress  string `json:"ip_address"`
+}
+
+type EmailVerified struct {
+	IdentityRef
+}
+
+type IdentityLocked struct {
+	IdentityRef
+	Failures     int  `json:"failures"`
+	LockoutCount int  `json:"lockout_count"`
+	Permanent    bool `json:"permanent"`
+	// LockedUntil is unset for permanent locks.
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+type IdentityUnlocked struct {
+	IdentityRef
+	Trigger string `json:"trigger"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type MFAEnabled struct {
+	IdentityRef
+}
+
+type MFADisabled struct {
+	IdentityRef
+}
+
+type PasskeyAdded struct {
+	IdentityRef
+	PasskeyID string `json:"passkey_id"`
+}
+
+type PasskeyRemoved struct {
+	IdentityRef
+	PasskeyID string `json:"passkey_id"`
+}
+
+type StatusChanged struct {
+	IdentityRef
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Trigger string `json:"trigger"`
+	Reason  string `json:"reason,omitempty"`
+	// ExpiresAt is when a temporary lock or suspension ends.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type PasswordResetRequired struct {
+	IdentityRef
+	Reason string `json:"reason,omitempty"`
+}
+
+type IdentityDeleted struct {
+	IdentityRef
+	Trigger string `json:"trigger"`
+}
+
+func (IdentityRegistered) EventType() EventType    { return EventIdentityRegistered }
+func (IdentityLoggedIn) EventType() EventType      { return EventIdentityLoggedIn }
+func (IdentityLoggedOut) EventType() EventType     { return EventIdentityLoggedOut }
+func (PasswordChanged) EventType() EventType       { return EventPasswordChanged }
+func (RefreshTokenReused) EventType() EventType    { return EventRefreshTokenReused }
+func (EmailVerified) EventType() EventType         { return EventEmailVerified }
+func (IdentityLocked) EventType() EventType        { return EventIdentityLocked }
+func (IdentityUnlocked) EventType() EventType      { return EventIdentityUnlocked }
+func (MFAEnabled) EventType() EventType            { return EventMFAEnabled }
+func (MFADisabled) EventType() EventType           { return EventMFADisabled }
+func (PasskeyAdded) EventType() EventType          { return EventPasskeyAdded }
+func (PasskeyRemoved) EventType() EventType        { return EventPasskeyRemoved }
+func (StatusChanged) EventType() EventType         { return EventStatusChanged }
+func (PasswordResetRequired) EventType() EventType { return EventPasswordResetRequired }
+func (IdentityDeleted) EventType() EventType       { return EventIdentityDeleted }
@@ -0,0 +1,200 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/segmentio/kafka-go"
+)
+
+// authEventCommitTimeout bounds an offset commit, which is made even when
+// the consumer is stopping so a handled message isn't delivered again.
+const authEventCommitTimeout = 5 * time.Second
+
+// authEventMetrics are served with the other expvars at /debug/vars.
+// skipped_total counts messages committed without being handled: malformed
+// ones and ones that still failed after MaxAttempts.
+var (
+	authEventMetrics = expvar.NewMap("auth_events")
+	authEventHandled = new(expvar.Int)
+	authEventFailed  = new(expvar.Int)
+	authEventSkipped = new(expvar.Int)
+)
+
+func init() {
+	authEventMetrics.Set("handled_total", authEventHandled)
+	authEventMetrics.Set("failed_total", authEventFailed)
+	authEventMetrics.Set("skipped_total", authEventSkipped)
+}
+
+// MessageReader is the part of a kafka.Reader in a consumer group that
+// AuthEventConsumer uses. MemoryBroker provides one without Kafka.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// NewKafkaReader joins the consumer group of cfg.Consumer. Offsets are only
+// committed explicitly, and a new group starts at the newest messages.
+func NewKafkaReader(cfg *config.KafkaConfig) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     cfg.Consumer.GroupID,
+		GroupTopics: cfg.Consumer.Topics,
+		StartOffset: kafka.LastOffset,
+	})
+}
+
+// AuthEventConsumer applies the auth service's events one message at a time,
+// committing each message's offset only once it has been handled, so a crash
+// delivers it again instead of losing it. A failing message is retried and,
+// after MaxAttempts, skipped: the cached permissions it should have cleared
+// stay in use until they are next refreshed, and the stale_cache outage
+// policy may serve them for longer. Events that sign users out (UserDeleted,
+// and UserRolesChanged with RevokeSessions) are never skipped; they are
+// retried every MaxBackoff until handled, holding up the partition behind
+// them.
+type AuthEventConsumer struct {
+	reader  MessageReader
+	handler AuthEventHandler
+	cfg     *config.KafkaConsumerConfig
+}
+
+func NewAuthEventConsumer(
+	reader MessageReader,
+	handler AuthEventHandler,
+	cfg *config.KafkaConsumerConfig,
+) *AuthEventConsumer {
+	return &AuthEventConsumer{
+		reader:  reader,
+		handler: handler,
+		cfg:     cfg,
+	}
+}
+
+// Run consumes until ctx is cancelled, then closes the reader.
+func (c *AuthEventConsumer) Run(ctx context.Context) {
+	defer c.reader.Close()
+
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			utils.Errorf("Failed to fetch auth event", utils.ErrorField(err.Error()))
+			if !sleepContext(ctx, c.cfg.RetryBackoff) {
+				return
+			}
+			continue
+		}
+
+		if !c.handle(ctx, msg) {
+			return
+		}
+
+		commitCtx, cancel := context.WithTimeout(context.Background(), authEventCommitTimeout)
+		err = c.reader.CommitMessages(commitCtx, msg)
+		cancel()
+		if err != nil {
+			// The message will be handled again, which handlers allow for
+			utils.Errorf("Failed to commit auth event offset",
+				utils.String("topic", msg.Topic),
+				utils.Int("partition", msg.Partition),
+				utils.Int64("offset", msg.Offset),
+				utils.ErrorField(err.Error()),
+			)
+		}
+	}
+}
+
+// handle applies msg, retrying failures. It returns false if ctx was
+// cancelled first, leaving msg to be committed by whoever consumes next.
+func (c *AuthEventConsumer) handle(ctx context.Context, msg kafka.Message) bool {
+	event, err := decodeCloudEvent(msg)
+	if err != nil {
+		c.skip(msg, "", 0, err)
+		return true
+	}
+
+	backoff := c.cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := dispatchAuthEvent(ctx, c.handler, event)
+		if err == nil {
+			authEventHandled.Add(1)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if errors.Is(err, errInvalidAuthEvent) {
+			c.skip(msg, event.Type, attempt, err)
+			return true
+		}
+		if attempt >= c.cfg.MaxAttempts && !c.signsOut(event.Type) {
+			c.skip(msg, event.Type, attempt, err)
+			return true
+		}
+
+		authEventFailed.Add(1)
+		if attempt >= c.cfg.MaxAttempts {
+			utils.Errorf("Auth event can't be skipped, retrying until handled",
+				utils.String("topic", msg.Topic),
+				utils.Int("partition", msg.Partition),
+				utils.Int64("offset", msg.Offset),
+				utils.String("event_type", string(event.Type)),
+				utils.Int("attempt", attempt),
+				utils.ErrorField(err.Error()),
+			)
+		} else {
+			utils.Warn("Auth event handling failed, retrying",
+				utils.String("event_id", event.ID),
+				utils.String("event_type", string(event.Type)),
+				utils.Int("attempt", attempt),
+				utils.ErrorField(err.Error()),
+			)
+		}
+		if !sleepContext(ctx, backoff) {
+			return false
+		}
+		backoff *= 2
+		if c.cfg.MaxBackoff > 0 && backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// signsOut reports whether events of type t revoke sessions, so skipping one
+// would leave a user signed in who shouldn't be.
+func (c *AuthEventConsumer) signsOut(t EventType) bool {
+	return t == AuthEventUserDeleted || (t == AuthEventUserRolesChanged && c.cfg.RevokeSessions)
+}
+
+func (c *AuthEventConsumer) skip(msg kafka.Message, eventType EventType, attempts int, cause error) {
+	authEventSkipped.Add(1)
+	utils.Errorf("Auth event skipped",
+		utils.String("topic", msg.Topic),
+		utils.Int("partition", msg.Partition),
+		utils.Int64("offset", msg.Offset),
+		utils.String("event_type", string(eventType)),
+		utils.Int("attempts", attempts),
+		utils.ErrorField(cause.Error()),
+	)
+}
+
+// sleepContext waits for d and reports whether ctx is still live.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
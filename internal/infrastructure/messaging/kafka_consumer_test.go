@@ -0,0 +1,337 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/segmentio/kafka-go"
+)
+
+const testGroup = "ms-ga-identifier"
+
+func TestMain(m *testing.M) {
+	utils.InitLogger("production")
+	os.Exit(m.Run())
+}
+
+var errHandlerUnavailable = errors.New("cache unavailable")
+
+// fakeAuthHandler records the calls it gets. fail makes the next n calls of a
+// kind fail, or every call with a negative n.
+type fakeAuthHandler struct {
+	mu    sync.Mutex
+	calls []string
+	fail  map[string]int
+	// block, when set, holds every call until it is closed.
+	block chan struct{}
+}
+
+func newFakeAuthHandler() *fakeAuthHandler {
+	return &fakeAuthHandler{fail: make(map[string]int)}
+}
+
+func (h *fakeAuthHandler) UserRolesChanged(ctx context.Context, userID uuid.UUID) error {
+	return h.call("roles_changed:" + userID.String())
+}
+
+func (h *fakeAuthHandler) RolePermissionsChanged(ctx context.Context, role string) error {
+	return h.call("permissions_changed:" + role)
+}
+
+func (h *fakeAuthHandler) UserDeleted(ctx context.Context, userID uuid.UUID) error {
+	return h.call("deleted:" + userID.String())
+}
+
+func (h *fakeAuthHandler) call(name string) error {
+	if h.block != nil {
+		<-h.block
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, name)
+	switch n := h.fail[name]; {
+	case n < 0:
+		return errHandlerUnavailable
+	case n > 0:
+		h.fail[name] = n - 1
+		return errHandlerUnavailable
+	}
+	return nil
+}
+
+func (h *fakeAuthHandler) setFail(name string, n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fail[name] = n
+}
+
+func (h *fakeAuthHandler) callCount(name string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	count := 0
+	for _, c := range h.calls {
+		if c == name {
+			count++
+		}
+	}
+	return count
+}
+
+func (h *fakeAuthHandler) recorded() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.calls...)
+}
+
+func testConsumerConfig() *config.KafkaConsumerConfig {
+	return &config.KafkaConsumerConfig{
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		MaxBackoff:   2 * time.Millisecond,
+	}
+}
+
+// authEvent builds a structured CloudEvent message from the auth service.
+func authEvent(t *testing.T, eventType EventType, subject string, data interface{}) kafka.Message {
+	t.Helper()
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := json.Marshal(&CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              uuid.New().String(),
+		Source:          "ms-ga-auth",
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentTypeJSON,
+		Data:            encoded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Value: value}
+}
+
+// startConsumer runs a consumer in the group until the test ends.
+func startConsumer(t *testing.T, broker *MemoryBroker, handler AuthEventHandler, cfg *config.KafkaConsumerConfig) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewAuthEventConsumer(broker.Reader(testGroup), handler, cfg).Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitForCommit(t *testing.T, broker *MemoryBroker, offset int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for broker.Committed(testGroup) < offset {
+		if time.Now().After(deadline) {
+			t.Fatalf("committed offset = %d, want %d", broker.Committed(testGroup), offset)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitForStop(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer didn't stop")
+	}
+}
+
+func TestAuthEventConsumerDispatches(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+	changed, deleted := uuid.New(), uuid.New()
+
+	broker.Publish(
+		authEvent(t, AuthEventUserRolesChanged, "", authUserEvent{UserID: changed.String()}),
+		authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}),
+		authEvent(t, "auth.user.renamed", "", authUserEvent{UserID: changed.String()}),
+		authEvent(t, AuthEventUserDeleted, deleted.String(), struct{}{}),
+	)
+	startConsumer(t, broker, handler, testConsumerConfig())
+	waitForCommit(t, broker, 4)
+
+	want := []string{
+		"roles_changed:" + changed.String(),
+		"permissions_changed:coach",
+		"deleted:" + deleted.String(),
+	}
+	got := handler.recorded()
+	if len(got) != len(want) {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAuthEventConsumerCommitsAfterHandling(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+	handler.block = make(chan struct{})
+
+	broker.Publish(authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}))
+	startConsumer(t, broker, handler, testConsumerConfig())
+
+	time.Sleep(20 * time.Millisecond)
+	if committed := broker.Committed(testGroup); committed != 0 {
+		t.Fatalf("committed offset = %d before the event was handled", committed)
+	}
+
+	close(handler.block)
+	waitForCommit(t, broker, 1)
+}
+
+func TestAuthEventConsumerRetriesFailures(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+	handler.setFail("permissions_changed:coach", 2)
+
+	broker.Publish(authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}))
+	startConsumer(t, broker, handler, testConsumerConfig())
+	waitForCommit(t, broker, 1)
+
+	if n := handler.callCount("permissions_changed:coach"); n != 3 {
+		t.Fatalf("handled %d times, want 3", n)
+	}
+}
+
+func TestAuthEventConsumerRedeliversUncommitted(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+	handler.setFail("permissions_changed:coach", -1)
+	cfg := testConsumerConfig()
+	cfg.MaxAttempts = 1000
+
+	broker.Publish(authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}))
+
+	// Stopped while still retrying, the message stays uncommitted
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewAuthEventConsumer(broker.Reader(testGroup), handler, cfg).Run(ctx)
+	}()
+	for handler.callCount("permissions_changed:coach") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	waitForStop(t, done)
+	if committed := broker.Committed(testGroup); committed != 0 {
+		t.Fatalf("committed offset = %d after a failed event", committed)
+	}
+
+	// The group's next reader gets it again
+	handler.setFail("permissions_changed:coach", 0)
+	before := handler.callCount("permissions_changed:coach")
+	startConsumer(t, broker, handler, testConsumerConfig())
+	waitForCommit(t, broker, 1)
+	if handler.callCount("permissions_changed:coach") <= before {
+		t.Fatal("event wasn't delivered again")
+	}
+}
+
+func TestAuthEventConsumerSkipsAfterMaxAttempts(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+	handler.setFail("permissions_changed:coach", -1)
+	userID := uuid.New()
+
+	broker.Publish(
+		authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}),
+		authEvent(t, AuthEventUserRolesChanged, "", authUserEvent{UserID: userID.String()}),
+	)
+	startConsumer(t, broker, handler, testConsumerConfig())
+	waitForCommit(t, broker, 2)
+
+	if n := handler.callCount("permissions_changed:coach"); n != 3 {
+		t.Fatalf("failing event handled %d times, want MaxAttempts", n)
+	}
+	if n := handler.callCount("roles_changed:" + userID.String()); n != 1 {
+		t.Fatalf("next event handled %d times, want 1", n)
+	}
+}
+
+func TestAuthEventConsumerSkipsMalformed(t *testing.T) {
+	broker := NewMemoryBroker("auth-events")
+	handler := newFakeAuthHandler()
+
+	broker.Publish(
+		kafka.Message{Value: []byte("not json")},
+		authEvent(t, AuthEventUserDeleted, "", authUserEvent{UserID: "not-a-uuid"}),
+		authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{}),
+	)
+	startConsumer(t, broker, handler, testConsumerConfig())
+	waitForCommit(t, broker, 3)
+
+	if calls := handler.recorded(); len(calls) != 0 {
+		t.Fatalf("malformed events reached the handler: %v", calls)
+	}
+}
+
+func TestAuthEventConsumerRetriesSignOutPastMaxAttempts(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name           string
+		eventType      EventType
+		call           string
+		revokeSessions bool
+	}{
+		{name: "user deleted", eventType: AuthEventUserDeleted, call: "deleted:" + userID.String()},
+		{name: "roles changed with revoke sessions", eventType: AuthEventUserRolesChanged, call: "roles_changed:" + userID.String(), revokeSessions: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := NewMemoryBroker("auth-events")
+			handler := newFakeAuthHandler()
+			handler.setFail(tt.call, -1)
+			cfg := testConsumerConfig()
+			cfg.RevokeSessions = tt.revokeSessions
+
+			broker.Publish(
+				authEvent(t, tt.eventType, "", authUserEvent{UserID: userID.String()}),
+				authEvent(t, AuthEventRolePermissionsChanged, "", authRoleEvent{Role: "coach"}),
+			)
+			startConsumer(t, broker, handler, cfg)
+
+			for handler.callCount(tt.call) < 2*cfg.MaxAttempts {
+				time.Sleep(time.Millisecond)
+			}
+			if committed := broker.Committed(testGroup); committed != 0 {
+				t.Fatalf("committed offset = %d after a failed sign out", committed)
+			}
+			if n := handler.callCount("permissions_changed:coach"); n != 0 {
+				t.Fatal("a later event was handled past the failed sign out")
+			}
+
+			// The same consumer applies it once the handler recovers
+			handler.setFail(tt.call, 0)
+			waitForCommit(t, broker, 2)
+			if n := handler.callCount("permissions_changed:coach"); n != 1 {
+				t.Fatalf("later event handled %d times, want 1", n)
+			}
+		})
+	}
+}
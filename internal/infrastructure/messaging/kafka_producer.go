@@ -2,85 +2,61 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
 	"github.com/segmentio/kafka-go"
 )
 
-type EventType string
-
 const (
-	EventIdentityRegistered EventType = "identity.registered"
-	EventIdentityLoggedIn   EventType = "identity.logged_in"
-	EventIdentityLoggedOut  EventType = "identity.logged_out"
-	EventPasswordChanged   EventType = "identity.password_changed"
+	// producerMaxAttempts is how many times kafka-go tries a write before
+	// returning its error; the outbox relay retries after that.
+	producerMaxAttempts = 3
+	// producerWriteTimeout bounds a write, including waiting for acks.
+	producerWriteTimeout = 10 * time.Second
 )
 
-type IdentityEvent struct {
-	Type      EventType `json:"type"`
-	UserID    string    `json:"user_id"`
-	Email     string    `json:"email"`
-	Timestamp string    `json:"timestamp"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-}
-
 type KafkaProducer struct {
 	writer *kafka.Writer
 	topic  string
+	mode   string
 }
 
-func NewKafkaProducer(cfg *config.KafkaConfig) *KafkaProducer {
+func NewKafkaProducer(cfg *config.KafkaConfig) (*KafkaProducer, error) {
+	mode := cfg.ContentMode
+	if mode == "" {
+		mode = ContentModeStructured
+	}
+	if mode != ContentModeStructured && mode != ContentModeBinary {
+		return nil, fmt.Errorf("unknown CloudEvents content mode %q", cfg.ContentMode)
+	}
+
+	// Messages are keyed by user and hashed to a partition, so each user's
+	// events stay in order. The outbox relay does its own batching, and marks
+	// events published once Write returns, so a write only succeeds when every
+	// in-sync replica has the message.
 	writer := &kafka.Writer{
-		Addr:     kafka.TCP(cfg.Brokers...),
-		Topic:    cfg.Topic,
-		Balancer: &kafka.LeastBytes{},
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  producerMaxAttempts,
+		WriteTimeout: producerWriteTimeout,
 	}
 
 	return &KafkaProducer{
 		writer: writer,
 		topic:  cfg.Topic,
-	}
-}
-
-func (p *KafkaProducer) PublishEvent(ctx context.Context, event IdentityEvent) error {
-	data, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-
-	return p.writer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(event.UserID),
-		Value: data,
-	})
-}
-
-func (p *KafkaProducer) PublishIdentityRegistered(ctx context.Context, userID, email string) error {
-	event := IdentityEvent{
-		Type:   EventIdentityRegistered,
-		UserID: userID,
-		Email:  email,
-	}
-	return p.PublishEvent(ctx, event)
+		mode:   mode,
+	}, nil
 }
 
-func (p *KafkaProducer) PublishIdentityLoggedIn(ctx context.Context, userID, email string, metadata map[string]interface{}) error {
-	event := IdentityEvent{
-		Type:     EventIdentityLoggedIn,
-		UserID:   userID,
-		Email:    email,
-		Metadata: metadata,
-	}
-	return p.PublishEvent(ctx, event)
-}
-
-func (p *KafkaProducer) PublishIdentityLoggedOut(ctx context.Context, userID, email string) error {
-	event := IdentityEvent{
-		Type:   EventIdentityLoggedOut,
-		UserID: userID,
-		Email:  email,
-	}
-	return p.PublishEvent(ctx, event)
+// Write publishes already encoded messages in one call. When only some fail
+// the error is a kafka.WriteErrors holding the error of each message.
+func (p *KafkaProducer) Write(ctx context.Context, messages ...kafka.Message) error {
+	return p.writer.WriteMessages(ctx, messages...)
 }
 
 func (p *KafkaProducer) Close() error {
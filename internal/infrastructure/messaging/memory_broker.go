@@ -0,0 +1,123 @@
+package messaging
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryBroker is an in-memory stand-in for a single-partition Kafka topic
+// with consumer groups, for exercising consumers without a broker. A reader
+// starts after the last offset its group committed, so messages fetched but
+// not committed are delivered again to the group's next reader.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	topic     string
+	messages  []kafka.Message
+	committed map[string]int64
+	// changed is closed and replaced whenever a reader may have something
+	// new to do.
+	changed chan struct{}
+}
+
+func NewMemoryBroker(topic string) *MemoryBroker {
+	return &MemoryBroker{
+		topic:     topic,
+		committed: make(map[string]int64),
+		changed:   make(chan struct{}),
+	}
+}
+
+// Publish appends messages to the topic, assigning their offsets.
+func (b *MemoryBroker) Publish(messages ...kafka.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range messages {
+		msg.Topic = b.topic
+		msg.Partition = 0
+		msg.Offset = int64(len(b.messages))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		b.messages = append(b.messages, msg)
+	}
+	b.notifyLocked()
+}
+
+// Committed returns the offset the group's next reader starts at.
+func (b *MemoryBroker) Committed(groupID string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[groupID]
+}
+
+// Reader joins the group, starting after its last committed offset.
+func (b *MemoryBroker) Reader(groupID string) MessageReader {
+	return &memoryReader{broker: b, group: groupID, next: b.Committed(groupID)}
+}
+
+func (b *MemoryBroker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+type memoryReader struct {
+	broker *MemoryBroker
+	group  string
+	next   int64
+	closed bool
+}
+
+// FetchMessage blocks until there is a message, like kafka.Reader, and
+// returns io.EOF once the reader is closed.
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	b := r.broker
+	for {
+		b.mu.Lock()
+		if r.closed {
+			b.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		if r.next < int64(len(b.messages)) {
+			msg := b.messages[r.next]
+			r.next++
+			b.mu.Unlock()
+			return msg, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.closed {
+		return io.ErrClosedPipe
+	}
+	for _, msg := range msgs {
+		if msg.Offset+1 > b.committed[r.group] {
+			b.committed[r.group] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *memoryReader) Close() error {
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r.closed = true
+	b.notifyLocked()
+	return nil
+}
@@ -0,0 +1,41 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+)
+
+// Outbox records identity events in the outbox table, from where
+// OutboxRelay publishes them to Kafka. Called with the context of a
+// repository.Transactor transaction, the event commits or rolls back with the
+// change it describes.
+type Outbox struct {
+	repo repository.OutboxRepository
+}
+
+func NewOutbox(repo repository.OutboxRepository) *Outbox {
+	return &Outbox{repo: repo}
+}
+
+// Publish writes data to the outbox as a CloudEvent, keyed by its subject so
+// a user's events are relayed in order. The request's correlation id is
+// taken from ctx.
+func (o *Outbox) Publish(ctx context.Context, data EventData) error {
+	event, err := NewCloudEvent(ctx, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return o.repo.Create(ctx, &entity.OutboxEvent{
+		Key:     event.Subject,
+		Type:    string(event.Type),
+		Payload: payload,
+	})
+}
@@ -0,0 +1,237 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// outboxWriteTimeout bounds one write to Kafka, so a broker outage
+	// doesn't hold the relay's transaction open.
+	outboxWriteTimeout = 30 * time.Second
+	outboxPruneEvery   = time.Hour
+	maxOutboxErrorLen  = 1000
+)
+
+// outboxMetrics are served with the other expvars at /debug/vars. lag_seconds
+// is the age of the oldest event not yet published.
+var (
+	outboxMetrics      = expvar.NewMap("outbox")
+	outboxPublished    = new(expvar.Int)
+	outboxFailed       = new(expvar.Int)
+	outboxDeadLettered = new(expvar.Int)
+	outboxPending      = new(expvar.Int)
+	outboxDeadLetters  = new(expvar.Int)
+	outboxLagSeconds   = new(expvar.Float)
+)
+
+func init() {
+	outboxMetrics.Set("published_total", outboxPublished)
+	outboxMetrics.Set("failed_total", outboxFailed)
+	outboxMetrics.Set("dead_lettered_total", outboxDeadLettered)
+	outboxMetrics.Set("pending", outboxPending)
+	outboxMetrics.Set("dead_letters", outboxDeadLetters)
+	outboxMetrics.Set("lag_seconds", outboxLagSeconds)
+}
+
+// OutboxRelay publishes the events written by Outbox to Kafka. Only one relay
+// runs at a time across replicas. Events of the same user are published in
+// the order they were written: while one is waiting for a retry the ones
+// after it wait too. An event that still fails after MaxAttempts is
+// dead-lettered, staying in the table with its last error, and no longer
+// holds the others back.
+type OutboxRelay struct {
+	repo       repository.OutboxRepository
+	transactor repository.Transactor
+	producer   *KafkaProducer
+	cfg        *config.OutboxConfig
+}
+
+func NewOutboxRelay(
+	repo repository.OutboxRepository,
+	transactor repository.Transactor,
+	producer *KafkaProducer,
+	cfg *config.OutboxConfig,
+) *OutboxRelay {
+	return &OutboxRelay{
+		repo:       repo,
+		transactor: transactor,
+		producer:   producer,
+		cfg:        cfg,
+	}
+}
+
+// Run relays events every PollInterval until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		r.drain(ctx)
+		r.updateMetrics(ctx)
+
+		if time.Since(lastPrune) >= outboxPruneEvery {
+			lastPrune = time.Now()
+			if err := r.repo.DeletePublishedBefore(ctx, time.Now().Add(-r.cfg.Retention)); err != nil {
+				utils.Errorf("Failed to prune outbox", utils.ErrorField(err.Error()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain relays batches until one publishes nothing.
+func (r *OutboxRelay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.relayBatch(ctx)
+		if err != nil {
+			utils.Errorf("Failed to relay outbox events", utils.ErrorField(err.Error()))
+			return
+		}
+		if published == 0 {
+			return
+		}
+	}
+}
+
+// relayBatch publishes the oldest pending event of each user, if it is due,
+// and returns how many were published. Taking one event per user means a
+// failure can't let a later event of that user overtake it.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	published := 0
+	err := r.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		locked, err := r.repo.LockRelay(ctx)
+		if err != nil || !locked {
+			return err
+		}
+
+		due, err := r.repo.ListDue(ctx, r.cfg.BatchSize)
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		// A payload that can't be encoded will never be published
+		var messages []kafka.Message
+		encoded := due[:0]
+		for _, event := range due {
+			msg, err := encodeOutboxEvent(event.Key, event.Payload, r.producer.mode)
+			if err != nil {
+				if err := r.deadLetter(ctx, event, event.Attempts, err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			messages = append(messages, msg)
+			encoded = append(encoded, event)
+		}
+		due = encoded
+		if len(due) == 0 {
+			return nil
+		}
+
+		writeCtx, cancel := context.WithTimeout(ctx, outboxWriteTimeout)
+		writeErr := r.producer.Write(writeCtx, messages...)
+		cancel()
+
+		var writeErrs kafka.WriteErrors
+		partial := errors.As(writeErr, &writeErrs) && len(writeErrs) == len(due)
+
+		var ids []int64
+		for i, event := range due {
+			err := writeErr
+			if partial {
+				err = writeErrs[i]
+			}
+			if err == nil {
+				ids = append(ids, event.ID)
+				continue
+			}
+			if err := r.recordFailure(ctx, event, err); err != nil {
+				return err
+			}
+		}
+
+		if err := r.repo.MarkPublished(ctx, ids, time.Now()); err != nil {
+			return err
+		}
+		published = len(ids)
+		outboxPublished.Add(int64(published))
+		return nil
+	})
+	return published, err
+}
+
+func (r *OutboxRelay) recordFailure(ctx context.Context, event *entity.OutboxEvent, cause error) error {
+	attempts := event.Attempts + 1
+	message := cause.Error()
+	if len(message) > maxOutboxErrorLen {
+		message = message[:maxOutboxErrorLen]
+	}
+
+	if attempts >= r.cfg.MaxAttempts {
+		return r.deadLetter(ctx, event, attempts, message)
+	}
+
+	outboxFailed.Add(1)
+	utils.Warn("Outbox event publish failed, retrying",
+		utils.Int64("event_id", event.ID),
+		utils.String("event_type", event.Type),
+		utils.Int("attempt", attempts),
+		utils.ErrorField(message),
+	)
+	return r.repo.MarkFailed(ctx, event.ID, attempts, r.backoff(attempts), message)
+}
+
+func (r *OutboxRelay) deadLetter(ctx context.Context, event *entity.OutboxEvent, attempts int, message string) error {
+	outboxDeadLettered.Add(1)
+	utils.Errorf("Outbox event dead-lettered",
+		utils.Int64("event_id", event.ID),
+		utils.String("event_type", event.Type),
+		utils.String("key", event.Key),
+		utils.Int("attempts", attempts),
+		utils.ErrorField(message),
+	)
+	return r.repo.MarkDeadLettered(ctx, event.ID, attempts, message)
+}
+
+// backoff is the wait after the given number of failed attempts.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	backoff := r.cfg.RetryBackoff
+	for i := 1; i < attempts && backoff < r.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.cfg.MaxBackoff {
+		backoff = r.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+func (r *OutboxRelay) updateMetrics(ctx context.Context) {
+	stats, err := r.repo.Stats(ctx)
+	if err != nil {
+		utils.Errorf("Failed to read outbox stats", utils.ErrorField(err.Error()))
+		return
+	}
+
+	outboxPending.Set(stats.Pending)
+	outboxDeadLetters.Set(stats.DeadLettered)
+	lag := 0.0
+	if stats.OldestPendingAt != nil {
+		lag = time.Since(*stats.OldestPendingAt).Seconds()
+	}
+	outboxLagSeconds.Set(lag)
+}
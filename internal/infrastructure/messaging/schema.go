@@ -0,0 +1,286 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaID is the dataschema of events of type t at the given version, and
+// the $id of their JSON Schema.
+func SchemaID(t EventType, version int) string {
+	return fmt.Sprintf("urn:ms-ga-identifier:events:%s:v%d", t, version)
+}
+
+// SchemaFile is the name of the JSON Schema file for type t at version.
+func SchemaFile(t EventType, version int) string {
+	return fmt.Sprintf("%s.v%d.json", t, version)
+}
+
+type schemaDocument struct {
+	Schema     string                     `json:"$schema"`
+	ID         string                     `json:"$id"`
+	Title      string                     `json:"title"`
+	Type       string                     `json:"type"`
+	Properties map[string]*schemaProperty `json:"properties"`
+	Required   []string                   `json:"required"`
+}
+
+type schemaProperty struct {
+	Type   string          `json:"type"`
+	Format string          `json:"format,omitempty"`
+	Items  *schemaProperty `json:"items,omitempty"`
+}
+
+func (p *schemaProperty) String() string {
+	s := p.Type
+	if p.Format != "" {
+		s += " (" + p.Format + ")"
+	}
+	if p.Items != nil {
+		s += " of " + p.Items.String()
+	}
+	return s
+}
+
+// SchemaIssue is a difference between an event payload and its schema file.
+// A breaking one needs a new schema version; the others are fixed by
+// rewriting the file.
+type SchemaIssue struct {
+	Event    EventType
+	File     string
+	Breaking bool
+	Message  string
+}
+
+func (i SchemaIssue) String() string {
+	kind := "out of date"
+	if i.Breaking {
+		kind = "breaking"
+	}
+	return fmt.Sprintf("%s: %s: %s", i.File, kind, i.Message)
+}
+
+// CheckSchemas compares the payload of every registered event with the
+// schema file of its current version in dir. Removing a property, changing
+// its type or making a required one optional is breaking; new properties
+// and missing files only need the schema rewritten.
+func CheckSchemas(dir string) ([]SchemaIssue, error) {
+	var issues []SchemaIssue
+	for _, t := range registeredEvents() {
+		entry := schemaRegistry[t]
+		file := SchemaFile(t, entry.version)
+		generated, err := generateSchema(t, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		committed, err := readSchema(filepath.Join(dir, file))
+		if errors.Is(err, os.ErrNotExist) {
+			issues = append(issues, SchemaIssue{Event: t, File: file, Message: "schema file is missing"})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		issues = append(issues, compareSchemas(t, file, committed, generated)...)
+	}
+	return issues, nil
+}
+
+// WriteSchemas writes the schema file of every registered event whose file
+// is missing or out of date. It writes nothing when a change is breaking.
+func WriteSchemas(dir string) ([]string, error) {
+	issues, err := CheckSchemas(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if issue.Breaking {
+			return nil, fmt.Errorf("%s; register a new schema version instead", issue)
+		}
+	}
+
+	var written []string
+	seen := make(map[string]bool)
+	for _, issue := range issues {
+		if seen[issue.File] {
+			continue
+		}
+		seen[issue.File] = true
+
+		doc, err := generateSchema(issue.Event, schemaRegistry[issue.Event])
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, issue.File), append(data, '\n'), 0o644); err != nil {
+			return nil, err
+		}
+		written = append(written, issue.File)
+	}
+	return written, nil
+}
+
+func registeredEvents() []EventType {
+	types := make([]EventType, 0, len(schemaRegistry))
+	for t := range schemaRegistry {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func readSchema(path string) (*schemaDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc schemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func compareSchemas(t EventType, file string, committed, generated *schemaDocument) []SchemaIssue {
+	var issues []SchemaIssue
+	add := func(breaking bool, format string, args ...interface{}) {
+		issues = append(issues, SchemaIssue{Event: t, File: file, Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if committed.ID != generated.ID {
+		add(false, "$id is %q, want %q", committed.ID, generated.ID)
+	}
+
+	committedRequired := stringSet(committed.Required)
+	generatedRequired := stringSet(generated.Required)
+
+	for _, name := range sortedKeys(committed.Properties) {
+		was := committed.Properties[name]
+		now, ok := generated.Properties[name]
+		switch {
+		case !ok:
+			add(true, "property %q was removed", name)
+		case was.String() != now.String():
+			add(true, "property %q changed from %s to %s", name, was, now)
+		case committedRequired[name] && !generatedRequired[name]:
+			add(true, "property %q is no longer always present", name)
+		case !committedRequired[name] && generatedRequired[name]:
+			add(false, "property %q is now always present", name)
+		}
+	}
+	for _, name := range sortedKeys(generated.Properties) {
+		if _, ok := committed.Properties[name]; !ok {
+			add(false, "property %q is new", name)
+		}
+	}
+	return issues
+}
+
+func generateSchema(t EventType, entry schemaEntry) (*schemaDocument, error) {
+	doc := &schemaDocument{
+		Schema:     jsonSchemaDialect,
+		ID:         SchemaID(t, entry.version),
+		Title:      string(t),
+		Type:       "object",
+		Properties: make(map[string]*schemaProperty),
+		Required:   []string{},
+	}
+	if err := addProperties(doc, reflect.TypeOf(entry.zero)); err != nil {
+		return nil, fmt.Errorf("%s: %w", t, err)
+	}
+	return doc, nil
+}
+
+// addProperties describes the JSON encoding of struct type st, flattening
+// embedded structs the way encoding/json does.
+func addProperties(doc *schemaDocument, st reflect.Type) error {
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := addProperties(doc, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := propertyFor(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		doc.Properties[name] = prop
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			doc.Required = append(doc.Required, name)
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func propertyFor(t reflect.Type) (*schemaProperty, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schemaProperty{Type: "string", Format: "date-time"}, nil
+	case t.Kind() == reflect.String:
+		return &schemaProperty{Type: "string"}, nil
+	case t.Kind() == reflect.Bool:
+		return &schemaProperty{Type: "boolean"}, nil
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &schemaProperty{Type: "integer"}, nil
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &schemaProperty{Type: "number"}, nil
+	case t.Kind() == reflect.Slice:
+		items, err := propertyFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schemaProperty{Type: "array", Items: items}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func sortedKeys(m map[string]*schemaProperty) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCommittedSchemas fails when an event payload no longer matches its
+// schema file in api/events, so drift is caught by go test as well as by
+// make schema-check.
+func TestCommittedSchemas(t *testing.T) {
+	issues, err := CheckSchemas("../../../api/events")
+	if err != nil {
+		t.Fatalf("CheckSchemas: %v", err)
+	}
+	for _, issue := range issues {
+		if issue.Breaking {
+			t.Errorf("%s; bump the event's version in schemaRegistry", issue)
+		} else {
+			t.Errorf("%s; run go run ./cmd/eventschemas -write", issue)
+		}
+	}
+}
+
+func TestCompareSchemasBreaking(t *testing.T) {
+	committed := func() *schemaDocument {
+		return &schemaDocument{
+			ID: "urn:test:v1",
+			Properties: map[string]*schemaProperty{
+				"user_id": {Type: "string"},
+				"count":   {Type: "integer"},
+			},
+			Required: []string{"user_id", "count"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func(*schemaDocument)
+		breaking bool
+		message  string
+	}{
+		{
+			name:     "property removed",
+			change:   func(d *schemaDocument) { delete(d.Properties, "count") },
+			breaking: true,
+			message:  `property "count" was removed`,
+		},
+		{
+			name:     "property retyped",
+			change:   func(d *schemaDocument) { d.Properties["count"] = &schemaProperty{Type: "string"} },
+			breaking: true,
+			message:  `property "count" changed from integer to string`,
+		},
+		{
+			name:     "property made optional",
+			change:   func(d *schemaDocument) { d.Required = []string{"user_id"} },
+			breaking: true,
+			message:  `property "count" is no longer always present`,
+		},
+		{
+			name:    "property added",
+			change:  func(d *schemaDocument) { d.Properties["reason"] = &schemaProperty{Type: "string"} },
+			message: `property "reason" is new`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated := committed()
+			tt.change(generated)
+
+			issues := compareSchemas("test.event", "test.event.v1.json", committed(), generated)
+			if len(issues) != 1 {
+				t.Fatalf("got %d issues, want 1: %v", len(issues), issues)
+			}
+			if issues[0].Breaking != tt.breaking {
+				t.Errorf("Breaking = %v, want %v", issues[0].Breaking, tt.breaking)
+			}
+			if !strings.Contains(issues[0].Message, tt.message) {
+				t.Errorf("Message = %q, want %q", issues[0].Message, tt.message)
+			}
+		})
+	}
+}
@@ -44,3 +44,143 @@ func PasswordResetModelToEntity(m *model.PasswordResetModel) *entity.PasswordRes
 func EntityToPasswordResetModel(e *entity.PasswordResetToken) *model.PasswordResetModel {
 	return model.EntityToPasswordResetModel(e)
 }
+
+// EmailVerificationModelToEntity converts GORM model to domain entity
+func EmailVerificationModelToEntity(m *model.EmailVerificationModel) *entity.EmailVerificationToken {
+	return m.ToEntity()
+}
+
+// EntityToEmailVerificationModel converts domain entity to GORM model
+func EntityToEmailVerificationModel(e *entity.EmailVerificationToken) *model.EmailVerificationModel {
+	return model.EntityToEmailVerificationModel(e)
+}
+
+// OAuthClientModelToEntity converts GORM model to domain entity
+func OAuthClientModelToEntity(m *model.OAuthClientModel) *entity.OAuthClient {
+	return m.ToEntity()
+}
+
+// EntityToOAuthClientModel converts domain entity to GORM model
+func EntityToOAuthClientModel(e *entity.OAuthClient) *model.OAuthClientModel {
+	return model.EntityToOAuthClientModel(e)
+}
+
+// AuthorizationCodeModelToEntity converts GORM model to domain entity
+func AuthorizationCodeModelToEntity(m *model.AuthorizationCodeModel) *entity.AuthorizationCode {
+	return m.ToEntity()
+}
+
+// EntityToAuthorizationCodeModel converts domain entity to GORM model
+func EntityToAuthorizationCodeModel(e *entity.AuthorizationCode) *model.AuthorizationCodeModel {
+	return model.EntityToAuthorizationCodeModel(e)
+}
+
+// TOTPCredentialModelToEntity converts GORM model to domain entity
+func TOTPCredentialModelToEntity(m *model.TOTPCredentialModel) *entity.TOTPCredential {
+	return m.ToEntity()
+}
+
+// EntityToTOTPCredentialModel converts domain entity to GORM model
+func EntityToTOTPCredentialModel(e *entity.TOTPCredential) *model.TOTPCredentialModel {
+	return model.EntityToTOTPCredentialModel(e)
+}
+
+// RecoveryCodeModelToEntity converts GORM model to domain entity
+func RecoveryCodeModelToEntity(m *model.RecoveryCodeModel) *entity.RecoveryCode {
+	return m.ToEntity()
+}
+
+// EntityToRecoveryCodeModel converts domain entity to GORM model
+func EntityToRecoveryCodeModel(e *entity.RecoveryCode) *model.RecoveryCodeModel {
+	return model.EntityToRecoveryCodeModel(e)
+}
+
+// MFAChallengeModelToEntity converts GORM model to domain entity
+func MFAChallengeModelToEntity(m *model.MFAChallengeModel) *entity.MFAChallenge {
+	return m.ToEntity()
+}
+
+// EntityToMFAChallengeModel converts domain entity to GORM model
+func EntityToMFAChallengeModel(e *entity.MFAChallenge) *model.MFAChallengeModel {
+	return model.EntityToMFAChallengeModel(e)
+}
+
+// WebAuthnCredentialModelToEntity converts GORM model to domain entity
+func WebAuthnCredentialModelToEntity(m *model.WebAuthnCredentialModel) *entity.WebAuthnCredential {
+	return m.ToEntity()
+}
+
+// EntityToWebAuthnCredentialModel converts domain entity to GORM model
+func EntityToWebAuthnCredentialModel(e *entity.WebAuthnCredential) *model.WebAuthnCredentialModel {
+	return model.EntityToWebAuthnCredentialModel(e)
+}
+
+// WebAuthnSessionModelToEntity converts GORM model to domain entity
+func WebAuthnSessionModelToEntity(m *model.WebAuthnSessionModel) *entity.WebAuthnSession {
+	return m.ToEntity()
+}
+
+// EntityToWebAuthnSessionModel converts domain entity to GORM model
+func EntityToWebAuthnSessionModel(e *entity.WebAuthnSession) *model.WebAuthnSessionModel {
+	return model.EntityToWebAuthnSessionModel(e)
+}
+
+// PasswordlessTokenModelToEntity converts GORM model to domain entity
+func PasswordlessTokenModelToEntity(m *model.PasswordlessTokenModel) *entity.PasswordlessToken {
+	return m.ToEntity()
+}
+
+// EntityToPasswordlessTokenModel converts domain entity to GORM model
+func EntityToPasswordlessTokenModel(e *entity.PasswordlessToken) *model.PasswordlessTokenModel {
+	return model.EntityToPasswordlessTokenModel(e)
+}
+
+// IdentifierModelToEntity converts GORM model to domain entity
+func IdentifierModelToEntity(m *model.IdentifierModel) *entity.Identifier {
+	return m.ToEntity()
+}
+
+// EntityToIdentifierModel converts domain entity to GORM model
+func EntityToIdentifierModel(e *entity.Identifier) *model.IdentifierModel {
+	return model.EntityToIdentifierModel(e)
+}
+
+// KioskDeviceModelToEntity converts GORM model to domain entity
+func KioskDeviceModelToEntity(m *model.KioskDeviceModel) *entity.KioskDevice {
+	return m.ToEntity()
+}
+
+// EntityToKioskDeviceModel converts domain entity to GORM model
+func EntityToKioskDeviceModel(e *entity.KioskDevice) *model.KioskDeviceModel {
+	return model.EntityToKioskDeviceModel(e)
+}
+
+// KioskPINModelToEntity converts GORM model to domain entity
+func KioskPINModelToEntity(m *model.KioskPINModel) *entity.KioskPIN {
+	return m.ToEntity()
+}
+
+// EntityToKioskPINModel converts domain entity to GORM model
+func EntityToKioskPINModel(e *entity.KioskPIN) *model.KioskPINModel {
+	return model.EntityToKioskPINModel(e)
+}
+
+// KioskCardLockoutModelToEntity converts GORM model to domain entity
+func KioskCardLockoutModelToEntity(m *model.KioskCardLockoutModel) *entity.KioskCardLockout {
+	return m.ToEntity()
+}
+
+// EntityToKioskCardLockoutModel converts domain entity to GORM model
+func EntityToKioskCardLockoutModel(e *entity.KioskCardLockout) *model.KioskCardLockoutModel {
+	return model.EntityToKioskCardLockoutModel(e)
+}
+
+// KioskSessionModelToEntity converts GORM model to domain entity
+func KioskSessionModelToEntity(m *model.KioskSessionModel) *entity.KioskSession {
+	return m.ToEntity()
+}
+
+// EntityToKioskSessionModel converts domain entity to GORM model
+func EntityToKioskSessionModel(e *entity.KioskSession) *model.KioskSessionModel {
+	return model.EntityToKioskSessionModel(e)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type AuthorizationCodeModel struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CodeHash            string     `gorm:"type:varchar(128);uniqueIndex;not null"`
+	ClientID            string     `gorm:"type:varchar(100);not null"`
+	IdentityID          uuid.UUID  `gorm:"type:uuid;not null;index"`
+	RedirectURI         string     `gorm:"type:text;not null"`
+	Scope               string     `gorm:"type:varchar(500);not null;default:''"`
+	Nonce               string     `gorm:"type:varchar(255);not null;default:''"`
+	CodeChallenge       string     `gorm:"type:varchar(128);not null;default:''"`
+	CodeChallengeMethod string     `gorm:"type:varchar(10);not null;default:''"`
+	AuthTime            time.Time  `gorm:"not null"`
+	ExpiresAt           time.Time  `gorm:"not null;index"`
+	UsedAt              *time.Time `gorm:"index"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime"`
+}
+
+func (AuthorizationCodeModel) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+func (m *AuthorizationCodeModel) ToEntity() *entity.AuthorizationCode {
+	return &entity.AuthorizationCode{
+		ID:                  m.ID,
+		CodeHash:            m.CodeHash,
+		ClientID:            m.ClientID,
+		IdentityID:          m.IdentityID,
+		RedirectURI:         m.RedirectURI,
+		Scope:               m.Scope,
+		Nonce:               m.Nonce,
+		CodeChallenge:       m.CodeChallenge,
+		CodeChallengeMethod: m.CodeChallengeMethod,
+		AuthTime:            m.AuthTime,
+		ExpiresAt:           m.ExpiresAt,
+		UsedAt:              m.UsedAt,
+		CreatedAt:           m.CreatedAt,
+	}
+}
+
+func EntityToAuthorizationCodeModel(e *entity.AuthorizationCode) *AuthorizationCodeModel {
+	return &AuthorizationCodeModel{
+		ID:                  e.ID,
+		CodeHash:            e.CodeHash,
+		ClientID:            e.ClientID,
+		IdentityID:          e.IdentityID,
+		RedirectURI:         e.RedirectURI,
+		Scope:               e.Scope,
+		Nonce:               e.Nonce,
+		CodeChallenge:       e.CodeChallenge,
+		CodeChallengeMethod: e.CodeChallengeMethod,
+		AuthTime:            e.AuthTime,
+		ExpiresAt:           e.ExpiresAt,
+		UsedAt:              e.UsedAt,
+		CreatedAt:           e.CreatedAt,
+	}
+}
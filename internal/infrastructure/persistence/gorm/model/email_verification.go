@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type EmailVerificationModel struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TokenHash  string     `gorm:"type:varchar(128);uniqueIndex;not null"`
+	ExpiresAt  time.Time  `gorm:"not null;index"`
+	UsedAt     *time.Time `gorm:"index"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+}
+
+func (EmailVerificationModel) TableName() string {
+	return "email_verification_tokens"
+}
+
+func (m *EmailVerificationModel) ToEntity() *entity.EmailVerificationToken {
+	return &entity.EmailVerificationToken{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		TokenHash:  m.TokenHash,
+		ExpiresAt:  m.ExpiresAt,
+		UsedAt:     m.UsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func EntityToEmailVerificationModel(e *entity.EmailVerificationToken) *EmailVerificationModel {
+	return &EmailVerificationModel{
+		ID:         e.ID,
+		IdentityID: e.IdentityID,
+		TokenHash:  e.TokenHash,
+		ExpiresAt:  e.ExpiresAt,
+		UsedAt:     e.UsedAt,
+		CreatedAt:  e.CreatedAt,
+	}
+}
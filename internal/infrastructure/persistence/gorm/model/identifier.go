@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type IdentifierModel struct {
+	ID                    uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID            uuid.UUID `gorm:"type:uuid;not null;index"`
+	Type                  string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_identity_identifiers_type_value"`
+	Value                 string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_identifiers_type_value"`
+	Verified              bool      `gorm:"not null;default:false"`
+	IsPrimary             bool      `gorm:"not null;default:false"`
+	VerifiedAt            *time.Time
+	VerificationHash      *string `gorm:"type:varchar(128)"`
+	VerificationExpiresAt *time.Time
+	VerificationAttempts  int       `gorm:"not null;default:0"`
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
+}
+
+func (IdentifierModel) TableName() string {
+	return "identity_identifiers"
+}
+
+func (m *IdentifierModel) ToEntity() *entity.Identifier {
+	var verificationHash string
+	if m.VerificationHash != nil {
+		verificationHash = *m.VerificationHash
+	}
+	return &entity.Identifier{
+		ID:                    m.ID,
+		IdentityID:            m.IdentityID,
+		Type:                  entity.IdentifierType(m.Type),
+		Value:                 m.Value,
+		Verified:              m.Verified,
+		Primary:               m.IsPrimary,
+		VerifiedAt:            m.VerifiedAt,
+		VerificationHash:      verificationHash,
+		VerificationExpiresAt: m.VerificationExpiresAt,
+		VerificationAttempts:  m.VerificationAttempts,
+		CreatedAt:             m.CreatedAt,
+		UpdatedAt:             m.UpdatedAt,
+	}
+}
+
+func EntityToIdentifierModel(e *entity.Identifier) *IdentifierModel {
+	var verificationHash *string
+	if e.VerificationHash != "" {
+		verificationHash = &e.VerificationHash
+	}
+	return &IdentifierModel{
+		ID:                    e.ID,
+		IdentityID:            e.IdentityID,
+		Type:                  string(e.Type),
+		Value:                 e.Value,
+		Verified:              e.Verified,
+		IsPrimary:             e.Primary,
+		VerifiedAt:            e.VerifiedAt,
+		VerificationHash:      verificationHash,
+		VerificationExpiresAt: e.VerificationExpiresAt,
+		VerificationAttempts:  e.VerificationAttempts,
+		CreatedAt:             e.CreatedAt,
+		UpdatedAt:             e.UpdatedAt,
+	}
+}
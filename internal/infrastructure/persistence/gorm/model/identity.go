@@ -8,14 +8,26 @@ import (
 )
 
 type IdentityModel struct {
-	ID            uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserID        uuid.UUID      `gorm:"type:uuid;uniqueIndex;not null"`
-	Email         string         `gorm:"type:varchar(255);uniqueIndex;not null"`
-	PasswordHash  string         `gorm:"type:varchar(255);not null"`
-	Status        string         `gorm:"type:varchar(20);default:unverified"`
-	EmailVerified bool           `gorm:"default:false"`
-	CreatedAt     time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
+	ID                    uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID                uuid.UUID `gorm:"type:uuid;uniqueIndex;not null"`
+	Email                 string    `gorm:"type:varchar(255);uniqueIndex;not null"`
+	PasswordHash          string    `gorm:"type:varchar(255);not null"`
+	Status                string    `gorm:"type:varchar(20);default:unverified"`
+	EmailVerified         bool      `gorm:"default:false"`
+	LockedUntil           *time.Time
+	LockoutCount          int       `gorm:"not null;default:0"`
+	StatusReason          string    `gorm:"type:varchar(500);not null;default:''"`
+	MFARequired           bool      `gorm:"column:mfa_required;not null;default:false"`
+	PasswordlessEnabled   bool      `gorm:"not null;default:false"`
+	PasswordResetRequired bool      `gorm:"not null;default:false"`
+	FirstName             string    `gorm:"type:varchar(100);not null;default:''"`
+	LastName              string    `gorm:"type:varchar(100);not null;default:''"`
+	DisplayName           string    `gorm:"type:varchar(100);not null;default:''"`
+	Phone                 string    `gorm:"type:varchar(20);not null;default:''"`
+	Locale                string    `gorm:"not null;default:''"`
+	Timezone              string    `gorm:"type:varchar(64);not null;default:''"`
+	CreatedAt             time.Time `gorm:"autoCreateTime"`
+	UpdatedAt             time.Time `gorm:"autoUpdateTime"`
 }
 
 func (IdentityModel) TableName() string {
@@ -24,26 +36,52 @@ func (IdentityModel) TableName() string {
 
 func (m *IdentityModel) ToEntity() *entity.Identity {
 	return &entity.Identity{
-		ID:            m.ID,
-		UserID:        m.UserID,
-		Email:         m.Email,
-		PasswordHash:  m.PasswordHash,
-		Status:        entity.IdentityStatus(m.Status),
-		EmailVerified: m.EmailVerified,
-		CreatedAt:     m.CreatedAt,
-		UpdatedAt:     m.UpdatedAt,
+		ID:                    m.ID,
+		UserID:                m.UserID,
+		Email:                 m.Email,
+		PasswordHash:          m.PasswordHash,
+		Status:                entity.IdentityStatus(m.Status),
+		EmailVerified:         m.EmailVerified,
+		LockedUntil:           m.LockedUntil,
+		LockoutCount:          m.LockoutCount,
+		StatusReason:          m.StatusReason,
+		MFARequired:           m.MFARequired,
+		PasswordlessEnabled:   m.PasswordlessEnabled,
+		PasswordResetRequired: m.PasswordResetRequired,
+		Profile: entity.Profile{
+			FirstName:   m.FirstName,
+			LastName:    m.LastName,
+			DisplayName: m.DisplayName,
+			Phone:       m.Phone,
+			Locale:      m.Locale,
+			Timezone:    m.Timezone,
+		},
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
 	}
 }
 
 func EntityToIdentityModel(e *entity.Identity) *IdentityModel {
 	return &IdentityModel{
-		ID:            e.ID,
-		UserID:        e.UserID,
-		Email:         e.Email,
-		PasswordHash:  e.PasswordHash,
-		Status:        string(e.Status),
-		EmailVerified: e.EmailVerified,
-		CreatedAt:     e.CreatedAt,
-		UpdatedAt:     e.UpdatedAt,
+		ID:                    e.ID,
+		UserID:                e.UserID,
+		Email:                 e.Email,
+		PasswordHash:          e.PasswordHash,
+		Status:                string(e.Status),
+		EmailVerified:         e.EmailVerified,
+		LockedUntil:           e.LockedUntil,
+		LockoutCount:          e.LockoutCount,
+		StatusReason:          e.StatusReason,
+		MFARequired:           e.MFARequired,
+		PasswordlessEnabled:   e.PasswordlessEnabled,
+		PasswordResetRequired: e.PasswordResetRequired,
+		FirstName:             e.Profile.FirstName,
+		LastName:              e.Profile.LastName,
+		DisplayName:           e.Profile.DisplayName,
+		Phone:                 e.Profile.Phone,
+		Locale:                e.Profile.Locale,
+		Timezone:              e.Profile.Timezone,
+		CreatedAt:             e.CreatedAt,
+		UpdatedAt:             e.UpdatedAt,
 	}
 }
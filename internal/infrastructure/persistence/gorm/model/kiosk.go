@@ -0,0 +1,148 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type KioskDeviceModel struct {
+	ID               uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name             string    `gorm:"type:varchar(100);not null"`
+	Location         string    `gorm:"type:varchar(255);not null;default:''"`
+	ClientID         string    `gorm:"type:varchar(255);uniqueIndex;not null"`
+	ClientSecretHash string    `gorm:"type:varchar(128);not null"`
+	Active           bool      `gorm:"not null;default:true"`
+	LastSeenAt       *time.Time
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+}
+
+func (KioskDeviceModel) TableName() string {
+	return "kiosk_devices"
+}
+
+func (m *KioskDeviceModel) ToEntity() *entity.KioskDevice {
+	return &entity.KioskDevice{
+		ID:               m.ID,
+		Name:             m.Name,
+		Location:         m.Location,
+		ClientID:         m.ClientID,
+		ClientSecretHash: m.ClientSecretHash,
+		Active:           m.Active,
+		LastSeenAt:       m.LastSeenAt,
+		CreatedAt:        m.CreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+	}
+}
+
+func EntityToKioskDeviceModel(e *entity.KioskDevice) *KioskDeviceModel {
+	return &KioskDeviceModel{
+		ID:               e.ID,
+		Name:             e.Name,
+		Location:         e.Location,
+		ClientID:         e.ClientID,
+		ClientSecretHash: e.ClientSecretHash,
+		Active:           e.Active,
+		LastSeenAt:       e.LastSeenAt,
+		CreatedAt:        e.CreatedAt,
+		UpdatedAt:        e.UpdatedAt,
+	}
+}
+
+type KioskPINModel struct {
+	IdentityID uuid.UUID `gorm:"type:uuid;primary_key"`
+	PINHash    string    `gorm:"column:pin_hash;type:varchar(255);not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (KioskPINModel) TableName() string {
+	return "kiosk_pins"
+}
+
+func (m *KioskPINModel) ToEntity() *entity.KioskPIN {
+	return &entity.KioskPIN{
+		IdentityID: m.IdentityID,
+		PINHash:    m.PINHash,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+func EntityToKioskPINModel(e *entity.KioskPIN) *KioskPINModel {
+	return &KioskPINModel{
+		IdentityID: e.IdentityID,
+		PINHash:    e.PINHash,
+		CreatedAt:  e.CreatedAt,
+		UpdatedAt:  e.UpdatedAt,
+	}
+}
+
+type KioskCardLockoutModel struct {
+	IdentifierID uuid.UUID `gorm:"type:uuid;primary_key"`
+	Failures     int       `gorm:"not null;default:0"`
+	LockedUntil  *time.Time
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (KioskCardLockoutModel) TableName() string {
+	return "kiosk_card_lockouts"
+}
+
+func (m *KioskCardLockoutModel) ToEntity() *entity.KioskCardLockout {
+	return &entity.KioskCardLockout{
+		IdentifierID: m.IdentifierID,
+		Failures:     m.Failures,
+		LockedUntil:  m.LockedUntil,
+		UpdatedAt:    m.UpdatedAt,
+	}
+}
+
+func EntityToKioskCardLockoutModel(e *entity.KioskCardLockout) *KioskCardLockoutModel {
+	return &KioskCardLockoutModel{
+		IdentifierID: e.IdentifierID,
+		Failures:     e.Failures,
+		LockedUntil:  e.LockedUntil,
+		UpdatedAt:    e.UpdatedAt,
+	}
+}
+
+type KioskSessionModel struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	DeviceID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	IdentityID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	IdentifierID *uuid.UUID `gorm:"type:uuid"`
+	IPAddress    string     `gorm:"type:varchar(45)"`
+	ExpiresAt    time.Time  `gorm:"not null"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+}
+
+func (KioskSessionModel) TableName() string {
+	return "kiosk_sessions"
+}
+
+func (m *KioskSessionModel) ToEntity() *entity.KioskSession {
+	return &entity.KioskSession{
+		ID:           m.ID,
+		DeviceID:     m.DeviceID,
+		IdentityID:   m.IdentityID,
+		IdentifierID: m.IdentifierID,
+		IPAddress:    m.IPAddress,
+		ExpiresAt:    m.ExpiresAt,
+		CreatedAt:    m.CreatedAt,
+	}
+}
+
+func EntityToKioskSessionModel(e *entity.KioskSession) *KioskSessionModel {
+	return &KioskSessionModel{
+		ID:           e.ID,
+		DeviceID:     e.DeviceID,
+		IdentityID:   e.IdentityID,
+		IdentifierID: e.IdentifierID,
+		IPAddress:    e.IPAddress,
+		ExpiresAt:    e.ExpiresAt,
+		CreatedAt:    e.CreatedAt,
+	}
+}
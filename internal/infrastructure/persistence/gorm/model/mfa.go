@@ -0,0 +1,116 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type TOTPCredentialModel struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID      uuid.UUID `gorm:"type:uuid;uniqueIndex;not null"`
+	SecretEncrypted string    `gorm:"type:text;not null"`
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64     `gorm:"not null;default:0"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+func (TOTPCredentialModel) TableName() string {
+	return "mfa_totp_credentials"
+}
+
+func (m *TOTPCredentialModel) ToEntity() *entity.TOTPCredential {
+	return &entity.TOTPCredential{
+		ID:              m.ID,
+		IdentityID:      m.IdentityID,
+		SecretEncrypted: m.SecretEncrypted,
+		ConfirmedAt:     m.ConfirmedAt,
+		LastUsedStep:    m.LastUsedStep,
+		CreatedAt:       m.CreatedAt,
+		UpdatedAt:       m.UpdatedAt,
+	}
+}
+
+func EntityToTOTPCredentialModel(e *entity.TOTPCredential) *TOTPCredentialModel {
+	return &TOTPCredentialModel{
+		ID:              e.ID,
+		IdentityID:      e.IdentityID,
+		SecretEncrypted: e.SecretEncrypted,
+		ConfirmedAt:     e.ConfirmedAt,
+		LastUsedStep:    e.LastUsedStep,
+		CreatedAt:       e.CreatedAt,
+		UpdatedAt:       e.UpdatedAt,
+	}
+}
+
+type RecoveryCodeModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash   string    `gorm:"type:varchar(128);uniqueIndex;not null"`
+	UsedAt     *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (RecoveryCodeModel) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+func (m *RecoveryCodeModel) ToEntity() *entity.RecoveryCode {
+	return &entity.RecoveryCode{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		CodeHash:   m.CodeHash,
+		UsedAt:     m.UsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func EntityToRecoveryCodeModel(e *entity.RecoveryCode) *RecoveryCodeModel {
+	return &RecoveryCodeModel{
+		ID:         e.ID,
+		IdentityID: e.IdentityID,
+		CodeHash:   e.CodeHash,
+		UsedAt:     e.UsedAt,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+type MFAChallengeModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash  string    `gorm:"type:varchar(128);uniqueIndex;not null"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (MFAChallengeModel) TableName() string {
+	return "mfa_challenges"
+}
+
+func (m *MFAChallengeModel) ToEntity() *entity.MFAChallenge {
+	return &entity.MFAChallenge{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		TokenHash:  m.TokenHash,
+		Attempts:   m.Attempts,
+		ExpiresAt:  m.ExpiresAt,
+		UsedAt:     m.UsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func EntityToMFAChallengeModel(e *entity.MFAChallenge) *MFAChallengeModel {
+	return &MFAChallengeModel{
+		ID:         e.ID,
+		IdentityID: e.IdentityID,
+		TokenHash:  e.TokenHash,
+		Attempts:   e.Attempts,
+		ExpiresAt:  e.ExpiresAt,
+		UsedAt:     e.UsedAt,
+		CreatedAt:  e.CreatedAt,
+	}
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type OAuthClientModel struct {
+	ID               uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ClientID         string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	ClientSecretHash *string   `gorm:"type:varchar(128)"`
+	Name             string    `gorm:"type:varchar(255);not null"`
+	RedirectURIs     []string  `gorm:"type:jsonb;serializer:json;not null"`
+	AllowedScopes    []string  `gorm:"type:jsonb;serializer:json;not null"`
+	IsPublic         bool      `gorm:"not null;default:false"`
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+}
+
+func (OAuthClientModel) TableName() string {
+	return "oauth_clients"
+}
+
+func (m *OAuthClientModel) ToEntity() *entity.OAuthClient {
+	var secretHash string
+	if m.ClientSecretHash != nil {
+		secretHash = *m.ClientSecretHash
+	}
+	return &entity.OAuthClient{
+		ID:               m.ID,
+		ClientID:         m.ClientID,
+		ClientSecretHash: secretHash,
+		Name:             m.Name,
+		RedirectURIs:     m.RedirectURIs,
+		AllowedScopes:    m.AllowedScopes,
+		IsPublic:         m.IsPublic,
+		CreatedAt:        m.CreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+	}
+}
+
+func EntityToOAuthClientModel(e *entity.OAuthClient) *OAuthClientModel {
+	var secretHash *string
+	if e.ClientSecretHash != "" {
+		secretHash = &e.ClientSecretHash
+	}
+	return &OAuthClientModel{
+		ID:               e.ID,
+		ClientID:         e.ClientID,
+		ClientSecretHash: secretHash,
+		Name:             e.Name,
+		RedirectURIs:     e.RedirectURIs,
+		AllowedScopes:    e.AllowedScopes,
+		IsPublic:         e.IsPublic,
+		CreatedAt:        e.CreatedAt,
+		UpdatedAt:        e.UpdatedAt,
+	}
+}
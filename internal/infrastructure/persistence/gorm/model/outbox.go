@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type OutboxEventModel struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement"`
+	EventKey       string     `gorm:"type:varchar(255);not null"`
+	EventType      string     `gorm:"type:varchar(100);not null"`
+	Payload        []byte     `gorm:"type:jsonb;not null"`
+	Attempts       int        `gorm:"not null;default:0"`
+	LastError      string     `gorm:"type:text;not null;default:''"`
+	NextAttemptAt  time.Time  `gorm:"not null"`
+	CreatedAt      time.Time  `gorm:"not null;autoCreateTime"`
+	PublishedAt    *time.Time `gorm:"index:idx_outbox_events_published_at"`
+	DeadLetteredAt *time.Time
+}
+
+func (OutboxEventModel) TableName() string {
+	return "outbox_events"
+}
+
+func (m *OutboxEventModel) ToEntity() *entity.OutboxEvent {
+	return &entity.OutboxEvent{
+		ID:             m.ID,
+		Key:            m.EventKey,
+		Type:           m.EventType,
+		Payload:        m.Payload,
+		Attempts:       m.Attempts,
+		LastError:      m.LastError,
+		NextAttemptAt:  m.NextAttemptAt,
+		CreatedAt:      m.CreatedAt,
+		PublishedAt:    m.PublishedAt,
+		DeadLetteredAt: m.DeadLetteredAt,
+	}
+}
+
+func EntityToOutboxEventModel(e *entity.OutboxEvent) *OutboxEventModel {
+	return &OutboxEventModel{
+		ID:             e.ID,
+		EventKey:       e.Key,
+		EventType:      e.Type,
+		Payload:        e.Payload,
+		Attempts:       e.Attempts,
+		LastError:      e.LastError,
+		NextAttemptAt:  e.NextAttemptAt,
+		CreatedAt:      e.CreatedAt,
+		PublishedAt:    e.PublishedAt,
+		DeadLetteredAt: e.DeadLetteredAt,
+	}
+}
@@ -10,7 +10,7 @@ import (
 type PasswordResetModel struct {
 	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	IdentityID uuid.UUID  `gorm:"type:uuid;not null;index"`
-	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null"`
+	TokenHash  string     `gorm:"type:varchar(128);uniqueIndex;not null"`
 	ExpiresAt  time.Time  `gorm:"not null;index"`
 	UsedAt     *time.Time `gorm:"index"`
 	CreatedAt  time.Time  `gorm:"autoCreateTime"`
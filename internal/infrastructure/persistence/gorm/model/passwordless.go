@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type PasswordlessTokenModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Method     string    `gorm:"type:varchar(10);not null"`
+	TokenHash  string    `gorm:"type:varchar(128);not null;index"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (PasswordlessTokenModel) TableName() string {
+	return "passwordless_tokens"
+}
+
+func (m *PasswordlessTokenModel) ToEntity() *entity.PasswordlessToken {
+	return &entity.PasswordlessToken{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		Method:     entity.PasswordlessMethod(m.Method),
+		TokenHash:  m.TokenHash,
+		Attempts:   m.Attempts,
+		ExpiresAt:  m.ExpiresAt,
+		UsedAt:     m.UsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func EntityToPasswordlessTokenModel(e *entity.PasswordlessToken) *PasswordlessTokenModel {
+	return &PasswordlessTokenModel{
+		ID:         e.ID,
+		IdentityID: e.IdentityID,
+		Method:     string(e.Method),
+		TokenHash:  e.TokenHash,
+		Attempts:   e.Attempts,
+		ExpiresAt:  e.ExpiresAt,
+		UsedAt:     e.UsedAt,
+		CreatedAt:  e.CreatedAt,
+	}
+}
@@ -8,14 +8,18 @@ import (
 )
 
 type RefreshTokenModel struct {
-	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	IdentityID uuid.UUID `gorm:"type:uuid;not null;index:idx_refresh_tokens_identity_id"`
-	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null"`
-	DeviceInfo string     `gorm:"type:varchar(255)"`
-	IPAddress  string     `gorm:"type:varchar(45)"`
-	ExpiresAt  time.Time  `gorm:"not null;index:idx_refresh_tokens_expires_at"`
-	RevokedAt  *time.Time `gorm:"index"`
-	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID   uuid.UUID  `gorm:"type:uuid;not null;index:idx_refresh_tokens_identity_id"`
+	FamilyID     uuid.UUID  `gorm:"type:uuid;not null;index:idx_refresh_tokens_family_id"`
+	TokenHash    string     `gorm:"type:varchar(128);uniqueIndex;not null"`
+	ClientID     string     `gorm:"type:varchar(100);not null;default:''"`
+	Scope        string     `gorm:"type:varchar(500);not null;default:''"`
+	DeviceInfo   string     `gorm:"type:varchar(255)"`
+	IPAddress    string     `gorm:"type:varchar(45)"`
+	ExpiresAt    time.Time  `gorm:"not null;index:idx_refresh_tokens_expires_at"`
+	RevokedAt    *time.Time `gorm:"index"`
+	ReplacedByID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
 }
 
 func (RefreshTokenModel) TableName() string {
@@ -24,26 +28,34 @@ func (RefreshTokenModel) TableName() string {
 
 func (m *RefreshTokenModel) ToEntity() *entity.RefreshToken {
 	return &entity.RefreshToken{
-		ID:         m.ID,
-		IdentityID: m.IdentityID,
-		TokenHash:  m.TokenHash,
-		DeviceInfo: m.DeviceInfo,
-		IPAddress:  m.IPAddress,
-		ExpiresAt:  m.ExpiresAt,
-		CreatedAt:  m.CreatedAt,
-		RevokedAt:  m.RevokedAt,
+		ID:           m.ID,
+		IdentityID:   m.IdentityID,
+		FamilyID:     m.FamilyID,
+		TokenHash:    m.TokenHash,
+		ClientID:     m.ClientID,
+		Scope:        m.Scope,
+		DeviceInfo:   m.DeviceInfo,
+		IPAddress:    m.IPAddress,
+		ExpiresAt:    m.ExpiresAt,
+		CreatedAt:    m.CreatedAt,
+		RevokedAt:    m.RevokedAt,
+		ReplacedByID: m.ReplacedByID,
 	}
 }
 
 func EntityToRefreshTokenModel(e *entity.RefreshToken) *RefreshTokenModel {
 	return &RefreshTokenModel{
-		ID:         e.ID,
-		IdentityID: e.IdentityID,
-		TokenHash:  e.TokenHash,
-		DeviceInfo: e.DeviceInfo,
-		IPAddress:  e.IPAddress,
-		ExpiresAt:  e.ExpiresAt,
-		CreatedAt:  e.CreatedAt,
-		RevokedAt:  e.RevokedAt,
+		ID:           e.ID,
+		IdentityID:   e.IdentityID,
+		FamilyID:     e.FamilyID,
+		TokenHash:    e.TokenHash,
+		ClientID:     e.ClientID,
+		Scope:        e.Scope,
+		DeviceInfo:   e.DeviceInfo,
+		IPAddress:    e.IPAddress,
+		ExpiresAt:    e.ExpiresAt,
+		CreatedAt:    e.CreatedAt,
+		RevokedAt:    e.RevokedAt,
+		ReplacedByID: e.ReplacedByID,
 	}
 }
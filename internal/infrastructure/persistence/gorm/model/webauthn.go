@@ -0,0 +1,109 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+)
+
+type WebAuthnCredentialModel struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	CredentialID   []byte    `gorm:"type:bytea;uniqueIndex;not null"`
+	PublicKey      []byte    `gorm:"type:bytea;not null"`
+	Algorithm      int64     `gorm:"not null"`
+	SignCount      int64     `gorm:"not null;default:0"`
+	AAGUID         []byte    `gorm:"column:aaguid;type:bytea"`
+	Transports     []string  `gorm:"type:jsonb;serializer:json;not null"`
+	Name           string    `gorm:"type:varchar(100);not null"`
+	BackupEligible bool      `gorm:"not null;default:false"`
+	BackedUp       bool      `gorm:"not null;default:false"`
+	LastUsedAt     *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+func (WebAuthnCredentialModel) TableName() string {
+	return "webauthn_credentials"
+}
+
+func (m *WebAuthnCredentialModel) ToEntity() *entity.WebAuthnCredential {
+	return &entity.WebAuthnCredential{
+		ID:             m.ID,
+		IdentityID:     m.IdentityID,
+		CredentialID:   m.CredentialID,
+		PublicKey:      m.PublicKey,
+		Algorithm:      m.Algorithm,
+		SignCount:      uint32(m.SignCount),
+		AAGUID:         m.AAGUID,
+		Transports:     m.Transports,
+		Name:           m.Name,
+		BackupEligible: m.BackupEligible,
+		BackedUp:       m.BackedUp,
+		LastUsedAt:     m.LastUsedAt,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+func EntityToWebAuthnCredentialModel(e *entity.WebAuthnCredential) *WebAuthnCredentialModel {
+	transports := e.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	return &WebAuthnCredentialModel{
+		ID:             e.ID,
+		IdentityID:     e.IdentityID,
+		CredentialID:   e.CredentialID,
+		PublicKey:      e.PublicKey,
+		Algorithm:      e.Algorithm,
+		SignCount:      int64(e.SignCount),
+		AAGUID:         e.AAGUID,
+		Transports:     transports,
+		Name:           e.Name,
+		BackupEligible: e.BackupEligible,
+		BackedUp:       e.BackedUp,
+		LastUsedAt:     e.LastUsedAt,
+		CreatedAt:      e.CreatedAt,
+		UpdatedAt:      e.UpdatedAt,
+	}
+}
+
+type WebAuthnSessionModel struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	IdentityID    *uuid.UUID `gorm:"type:uuid"`
+	Ceremony      string     `gorm:"type:varchar(20);not null"`
+	ChallengeHash string     `gorm:"type:varchar(128);uniqueIndex;not null"`
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+func (WebAuthnSessionModel) TableName() string {
+	return "webauthn_sessions"
+}
+
+func (m *WebAuthnSessionModel) ToEntity() *entity.WebAuthnSession {
+	return &entity.WebAuthnSession{
+		ID:            m.ID,
+		IdentityID:    m.IdentityID,
+		Ceremony:      entity.WebAuthnCeremony(m.Ceremony),
+		ChallengeHash: m.ChallengeHash,
+		ExpiresAt:     m.ExpiresAt,
+		UsedAt:        m.UsedAt,
+		CreatedAt:     m.CreatedAt,
+	}
+}
+
+func EntityToWebAuthnSessionModel(e *entity.WebAuthnSession) *WebAuthnSessionModel {
+	return &WebAuthnSessionModel{
+		ID:            e.ID,
+		IdentityID:    e.IdentityID,
+		Ceremony:      string(e.Ceremony),
+		ChallengeHash: e.ChallengeHash,
+		ExpiresAt:     e.ExpiresAt,
+		UsedAt:        e.UsedAt,
+		CreatedAt:     e.CreatedAt,
+	}
+}
@@ -21,21 +21,30 @@ func NewLoginAttemptRepository(db *gorm.DB) repository.LoginAttemptRepository {
 
 func (r *loginAttemptRepository) Create(ctx context.Context, attempt *entity.LoginAttempt) error {
 	m := model.EntityToLoginAttemptModel(attempt)
-	return r.db.WithContext(ctx).Create(m).Error
+	return dbFrom(ctx, r.db).Create(m).Error
 }
 
 func (r *loginAttemptRepository) CountRecentFailures(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := dbFrom(ctx, r.db).
 		Model(&model.LoginAttemptModel{}).
 		Where("identity_id = ? AND success = false AND attempted_at > ?", identityID, since).
 		Count(&count).Error
 	return int(count), err
 }
 
+func (r *loginAttemptRepository) CountRecentFailuresByEmail(ctx context.Context, email string, since time.Time) (int, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).
+		Model(&model.LoginAttemptModel{}).
+		Where("email = ? AND success = false AND attempted_at > ?", email, since).
+		Count(&count).Error
+	return int(count), err
+}
+
 func (r *loginAttemptRepository) GetRecentByIdentityID(ctx context.Context, identityID uuid.UUID, limit int) ([]*entity.LoginAttempt, error) {
 	var models []model.LoginAttemptModel
-	if err := r.db.WithContext(ctx).
+	if err := dbFrom(ctx, r.db).
 		Where("identity_id = ?", identityID).
 		Order("attempted_at DESC").
 		Limit(limit).
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type identifierRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentifierRepository(db *gorm.DB) repository.IdentifierRepository {
+	return &identifierRepository{db: db}
+}
+
+func (r *identifierRepository) Create(ctx context.Context, identifier *entity.Identifier) (*entity.Identifier, error) {
+	m := model.EntityToIdentifierModel(identifier)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *identifierRepository) GetByID(ctx context.Context, id, identityID uuid.UUID) (*entity.Identifier, error) {
+	var m model.IdentifierModel
+	if err := dbFrom(ctx, r.db).Where("id = ? AND identity_id = ?", id, identityID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *identifierRepository) GetByValue(ctx context.Context, identifierType entity.IdentifierType, value string) (*entity.Identifier, error) {
+	var m model.IdentifierModel
+	if err := dbFrom(ctx, r.db).Where("type = ? AND value = ?", string(identifierType), value).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *identifierRepository) ListByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.Identifier, error) {
+	var models []model.IdentifierModel
+	if err := dbFrom(ctx, r.db).Where("identity_id = ?", identityID).Order("type, created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	identifiers := make([]*entity.Identifier, 0, len(models))
+	for i := range models {
+		identifiers = append(identifiers, models[i].ToEntity())
+	}
+	return identifiers, nil
+}
+
+// SetVerificationCode stores a newly sent code, replacing the previous one
+// and its attempt count.
+func (r *identifierRepository) SetVerificationCode(ctx context.Context, id uuid.UUID, codeHash string, expiresAt time.Time) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentifierModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"verification_hash":       codeHash,
+		"verification_expires_at": expiresAt,
+		"verification_attempts":   0,
+	}).Error
+}
+
+func (r *identifierRepository) IncrementVerificationAttempts(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentifierModel{}).Where("id = ?", id).
+		Update("verification_attempts", gorm.Expr("verification_attempts + 1")).Error
+}
+
+// MarkVerified records the identifier as verified and discards any pending
+// code. Verifying the primary email verifies the identity's email as well.
+func (r *identifierRepository) MarkVerified(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var m model.IdentifierModel
+		if err := tx.Where("id = ?", id).First(&m).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&m).Updates(map[string]interface{}{
+			"verified":                true,
+			"verified_at":             time.Now(),
+			"verification_hash":       nil,
+			"verification_expires_at": nil,
+			"verification_attempts":   0,
+		}).Error; err != nil {
+			return err
+		}
+
+		if m.IsPrimary && m.Type == string(entity.IdentifierTypeEmail) {
+			return tx.Model(&model.IdentityModel{}).Where("id = ?", m.IdentityID).Update("email_verified", true).Error
+		}
+		return nil
+	})
+}
+
+func (r *identifierRepository) SetPrimary(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var m model.IdentifierModel
+		if err := tx.Where("id = ?", id).First(&m).Error; err != nil {
+			return err
+		}
+
+		// Clear the old primary first so the partial unique index holds
+		if err := tx.Model(&model.IdentifierModel{}).
+			Where("identity_id = ? AND type = ? AND is_primary", m.IdentityID, m.Type).
+			Update("is_primary", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&m).Update("is_primary", true).Error; err != nil {
+			return err
+		}
+
+		if m.Type == string(entity.IdentifierTypeEmail) {
+			return tx.Model(&model.IdentityModel{}).Where("id = ?", m.IdentityID).Updates(map[string]interface{}{
+				"email":          m.Value,
+				"email_verified": m.Verified,
+			}).Error
+		}
+		return nil
+	})
+}
+
+func (r *identifierRepository) Delete(ctx context.Context, id, identityID uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Where("id = ? AND identity_id = ?", id, identityID).Delete(&model.IdentifierModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
@@ -18,9 +20,22 @@ func NewIdentityRepository(db *gorm.DB) repository.IdentityRepository {
 	return &identityRepository{db: db}
 }
 
-func (r *identityRepository) Create(ctx context.Context, identity *entity.Identity) (*entity.Identity, error) {
+// Create stores the identity together with its initial identifiers, so an
+// identity never exists without the email it signs in with.
+func (r *identityRepository) Create(ctx context.Context, identity *entity.Identity, identifiers ...*entity.Identifier) (*entity.Identity, error) {
 	m := model.EntityToIdentityModel(identity)
-	if err := r.db.WithContext(ctx).Create(m).Error; err != nil {
+	err := dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		for _, identifier := range identifiers {
+			if err := tx.Create(model.EntityToIdentifierModel(identifier)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
@@ -28,7 +43,7 @@ func (r *identityRepository) Create(ctx context.Context, identity *entity.Identi
 
 func (r *identityRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Identity, error) {
 	var m model.IdentityModel
-	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Where("id = ?", id).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
@@ -36,7 +51,7 @@ func (r *identityRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity
 
 func (r *identityRepository) GetByEmail(ctx context.Context, email string) (*entity.Identity, error) {
 	var m model.IdentityModel
-	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Where("email = ?", email).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
@@ -44,32 +59,129 @@ func (r *identityRepository) GetByEmail(ctx context.Context, email string) (*ent
 
 func (r *identityRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Identity, error) {
 	var m model.IdentityModel
-	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Where("user_id = ?", userID).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
 }
 
+func (r *identityRepository) List(ctx context.Context, filter repository.IdentityFilter) ([]*entity.Identity, error) {
+	query := dbFrom(ctx, r.db).Model(&model.IdentityModel{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", string(filter.Status))
+	}
+	if filter.Email != "" {
+		query = query.Where("email ILIKE ? ESCAPE '\\'", "%"+escapeLike(filter.Email)+"%")
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.After != nil {
+		query = query.Where("(created_at, id) < (?, ?)", *filter.After, filter.AfterID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var models []model.IdentityModel
+	if err := query.Order("created_at DESC, id DESC").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	identities := make([]*entity.Identity, len(models))
+	for i := range models {
+		identities[i] = models[i].ToEntity()
+	}
+	return identities, nil
+}
+
 func (r *identityRepository) Update(ctx context.Context, identity *entity.Identity) (*entity.Identity, error) {
 	m := model.EntityToIdentityModel(identity)
-	if err := r.db.WithContext(ctx).Save(m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Save(m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
 }
 
 func (r *identityRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status entity.IdentityStatus) error {
-	return r.db.WithContext(ctx).Model(&model.IdentityModel{}).Where("id = ?", id).Update("status", status).Error
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Update("status", status).Error
+}
+
+func (r *identityRepository) UpdateLockout(ctx context.Context, id uuid.UUID, status entity.IdentityStatus, lockedUntil *time.Time, lockoutCount int) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":        status,
+		"locked_until":  lockedUntil,
+		"lockout_count": lockoutCount,
+	}).Error
+}
+
+func (r *identityRepository) UpdateAdminStatus(ctx context.Context, id uuid.UUID, status entity.IdentityStatus, lockedUntil *time.Time, reason string) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":        status,
+		"locked_until":  lockedUntil,
+		"status_reason": reason,
+	}).Error
+}
+
+func (r *identityRepository) UpdatePasswordResetRequired(ctx context.Context, id uuid.UUID, required bool) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Update("password_reset_required", required).Error
+}
+
+func (r *identityRepository) UpdateMFARequired(ctx context.Context, id uuid.UUID, required bool) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Update("mfa_required", required).Error
+}
+
+func (r *identityRepository) UpdatePasswordlessEnabled(ctx context.Context, id uuid.UUID, enabled bool) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Update("passwordless_enabled", enabled).Error
+}
+
+func (r *identityRepository) UpdateLocale(ctx context.Context, id uuid.UUID, locale string) error {
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Update("locale", locale).Error
+}
+
+func (r *identityRepository) UpdateProfile(ctx context.Context, id uuid.UUID, profile entity.Profile) error {
+	// A map so that cleared fields are written too
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"first_name":   profile.FirstName,
+		"last_name":    profile.LastName,
+		"display_name": profile.DisplayName,
+		"phone":        profile.Phone,
+		"locale":       profile.Locale,
+		"timezone":     profile.Timezone,
+	}).Error
 }
 
 func (r *identityRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
-	return r.db.WithContext(ctx).Model(&model.IdentityModel{}).Where("id = ?", id).Update("password_hash", passwordHash).Error
+	return dbFrom(ctx, r.db).Model(&model.IdentityModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password_hash":           passwordHash,
+		"password_reset_required": false,
+	}).Error
 }
 
+// SetEmailVerified marks the identity's email, and the primary email
+// identifier that holds it, as verified.
 func (r *identityRepository) SetEmailVerified(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Model(&model.IdentityModel{}).Where("id = ?", id).Update("email_verified", true).Error
+	return dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.IdentityModel{}).Where("id = ?", id).Update("email_verified", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.IdentifierModel{}).
+			Where("identity_id = ? AND type = ? AND is_primary AND NOT verified", id, string(entity.IdentifierTypeEmail)).
+			Updates(map[string]interface{}{
+				"verified":    true,
+				"verified_at": time.Now(),
+			}).Error
+	})
 }
 
 func (r *identityRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&model.IdentityModel{}, "id = ?", id).Error
+	return dbFrom(ctx, r.db).Delete(&model.IdentityModel{}, "id = ?", id).Error
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
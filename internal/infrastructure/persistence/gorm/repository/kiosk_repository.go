@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type kioskDeviceRepository struct {
+	db *gorm.DB
+}
+
+func NewKioskDeviceRepository(db *gorm.DB) repository.KioskDeviceRepository {
+	return &kioskDeviceRepository{db: db}
+}
+
+func (r *kioskDeviceRepository) Create(ctx context.Context, device *entity.KioskDevice) (*entity.KioskDevice, error) {
+	m := model.EntityToKioskDeviceModel(device)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *kioskDeviceRepository) GetByClientID(ctx context.Context, clientID string) (*entity.KioskDevice, error) {
+	var m model.KioskDeviceModel
+	if err := dbFrom(ctx, r.db).Where("client_id = ?", clientID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *kioskDeviceRepository) List(ctx context.Context) ([]*entity.KioskDevice, error) {
+	var models []model.KioskDeviceModel
+	if err := dbFrom(ctx, r.db).Order("created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	devices := make([]*entity.KioskDevice, 0, len(models))
+	for i := range models {
+		devices = append(devices, models[i].ToEntity())
+	}
+	return devices, nil
+}
+
+func (r *kioskDeviceRepository) UpdateLastSeen(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Model(&model.KioskDeviceModel{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
+
+func (r *kioskDeviceRepository) Deactivate(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.KioskDeviceModel{}).Where("id = ?", id).Update("active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// KioskPINRepository implementation
+type kioskPINRepository struct {
+	db *gorm.DB
+}
+
+func NewKioskPINRepository(db *gorm.DB) repository.KioskPINRepository {
+	return &kioskPINRepository{db: db}
+}
+
+func (r *kioskPINRepository) Upsert(ctx context.Context, pin *entity.KioskPIN) error {
+	m := model.EntityToKioskPINModel(pin)
+	return dbFrom(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "identity_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"pin_hash", "updated_at"}),
+	}).Create(m).Error
+}
+
+func (r *kioskPINRepository) GetByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.KioskPIN, error) {
+	var m model.KioskPINModel
+	if err := dbFrom(ctx, r.db).Where("identity_id = ?", identityID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *kioskPINRepository) Delete(ctx context.Context, identityID uuid.UUID) error {
+	return dbFrom(ctx, r.db).Delete(&model.KioskPINModel{}, "identity_id = ?", identityID).Error
+}
+
+// KioskCardLockoutRepository implementation
+type kioskCardLockoutRepository struct {
+	db *gorm.DB
+}
+
+func NewKioskCardLockoutRepository(db *gorm.DB) repository.KioskCardLockoutRepository {
+	return &kioskCardLockoutRepository{db: db}
+}
+
+func (r *kioskCardLockoutRepository) GetByIdentifierID(ctx context.Context, identifierID uuid.UUID) (*entity.KioskCardLockout, error) {
+	var m model.KioskCardLockoutModel
+	if err := dbFrom(ctx, r.db).Where("identifier_id = ?", identifierID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+// RecordFailure increments the count in one statement, so concurrent wrong
+// PINs on the same card are all counted.
+func (r *kioskCardLockoutRepository) RecordFailure(ctx context.Context, identifierID uuid.UUID) (int, error) {
+	var failures int
+	err := dbFrom(ctx, r.db).Raw(`
+		INSERT INTO kiosk_card_lockouts (identifier_id, failures, updated_at)
+		VALUES (?, 1, NOW())
+		ON CONFLICT (identifier_id) DO UPDATE
+		SET failures = kiosk_card_lockouts.failures + 1, updated_at = NOW()
+		RETURNING failures`, identifierID).Scan(&failures).Error
+	return failures, err
+}
+
+func (r *kioskCardLockoutRepository) Lock(ctx context.Context, identifierID uuid.UUID, until time.Time) error {
+	return dbFrom(ctx, r.db).Model(&model.KioskCardLockoutModel{}).Where("identifier_id = ?", identifierID).Update("locked_until", until).Error
+}
+
+func (r *kioskCardLockoutRepository) Reset(ctx context.Context, identifierID uuid.UUID) error {
+	return dbFrom(ctx, r.db).Delete(&model.KioskCardLockoutModel{}, "identifier_id = ?", identifierID).Error
+}
+
+func (r *kioskCardLockoutRepository) ResetByIdentityID(ctx context.Context, identityID uuid.UUID) error {
+	return dbFrom(ctx, r.db).
+		Where("identifier_id IN (?)", r.db.Model(&model.IdentifierModel{}).Select("id").Where("identity_id = ?", identityID)).
+		Delete(&model.KioskCardLockoutModel{}).Error
+}
+
+// KioskSessionRepository implementation
+type kioskSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewKioskSessionRepository(db *gorm.DB) repository.KioskSessionRepository {
+	return &kioskSessionRepository{db: db}
+}
+
+func (r *kioskSessionRepository) Create(ctx context.Context, session *entity.KioskSession) (*entity.KioskSession, error) {
+	m := model.EntityToKioskSessionModel(session)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
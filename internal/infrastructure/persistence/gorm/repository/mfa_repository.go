@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type totpCredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewTOTPCredentialRepository(db *gorm.DB) repository.TOTPCredentialRepository {
+	return &totpCredentialRepository{db: db}
+}
+
+func (r *totpCredentialRepository) Create(ctx context.Context, credential *entity.TOTPCredential) (*entity.TOTPCredential, error) {
+	m := model.EntityToTOTPCredentialModel(credential)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *totpCredentialRepository) GetByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.TOTPCredential, error) {
+	var m model.TOTPCredentialModel
+	if err := dbFrom(ctx, r.db).Where("identity_id = ?", identityID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *totpCredentialRepository) Confirm(ctx context.Context, id uuid.UUID, step int64) error {
+	return dbFrom(ctx, r.db).Model(&model.TOTPCredentialModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"confirmed_at":   time.Now(),
+		"last_used_step": step,
+	}).Error
+}
+
+// UpdateLastUsedStep only moves the step forward, so two requests racing with
+// the same code can't both succeed.
+func (r *totpCredentialRepository) UpdateLastUsedStep(ctx context.Context, id uuid.UUID, step int64) error {
+	res := dbFrom(ctx, r.db).Model(&model.TOTPCredentialModel{}).
+		Where("id = ? AND last_used_step < ?", id, step).
+		Update("last_used_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrTOTPStepUsed
+	}
+	return nil
+}
+
+func (r *totpCredentialRepository) DeleteByIdentityID(ctx context.Context, identityID uuid.UUID) error {
+	return dbFrom(ctx, r.db).Where("identity_id = ?", identityID).Delete(&model.TOTPCredentialModel{}).Error
+}
+
+// RecoveryCodeRepository implementation
+type recoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) repository.RecoveryCodeRepository {
+	return &recoveryCodeRepository{db: db}
+}
+
+func (r *recoveryCodeRepository) Replace(ctx context.Context, identityID uuid.UUID, codes []*entity.RecoveryCode) error {
+	models := make([]*model.RecoveryCodeModel, 0, len(codes))
+	for _, code := range codes {
+		models = append(models, model.EntityToRecoveryCodeModel(code))
+	}
+
+	return dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("identity_id = ?", identityID).Delete(&model.RecoveryCodeModel{}).Error; err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		return tx.Create(&models).Error
+	})
+}
+
+func (r *recoveryCodeRepository) MarkAsUsed(ctx context.Context, identityID uuid.UUID, codeHashes ...string) error {
+	res := dbFrom(ctx, r.db).Model(&model.RecoveryCodeModel{}).
+		Where("identity_id = ? AND code_hash IN ? AND used_at IS NULL", identityID, codeHashes).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (r *recoveryCodeRepository) CountUnused(ctx context.Context, identityID uuid.UUID) (int, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).
+		Model(&model.RecoveryCodeModel{}).
+		Where("identity_id = ? AND used_at IS NULL", identityID).
+		Count(&count).Error
+	return int(count), err
+}
+
+// MFAChallengeRepository implementation
+type mfaChallengeRepository struct {
+	db *gorm.DB
+}
+
+func NewMFAChallengeRepository(db *gorm.DB) repository.MFAChallengeRepository {
+	return &mfaChallengeRepository{db: db}
+}
+
+func (r *mfaChallengeRepository) Create(ctx context.Context, challenge *entity.MFAChallenge) (*entity.MFAChallenge, error) {
+	m := model.EntityToMFAChallengeModel(challenge)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *mfaChallengeRepository) GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.MFAChallenge, error) {
+	var m model.MFAChallengeModel
+	if err := dbFrom(ctx, r.db).Where("token_hash IN ?", tokenHashes).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *mfaChallengeRepository) IncrementAttempts(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Model(&model.MFAChallengeModel{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *mfaChallengeRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.MFAChallengeModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrMFAChallengeUsed
+	}
+	return nil
+}
+
+func (r *mfaChallengeRepository) DeleteExpired(ctx context.Context) error {
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.MFAChallengeModel{}).Error
+}
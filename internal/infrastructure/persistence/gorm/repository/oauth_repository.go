@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type oauthClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) repository.OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(ctx context.Context, client *entity.OAuthClient) (*entity.OAuthClient, error) {
+	m := model.EntityToOAuthClientModel(client)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *oauthClientRepository) GetByClientID(ctx context.Context, clientID string) (*entity.OAuthClient, error) {
+	var m model.OAuthClientModel
+	if err := dbFrom(ctx, r.db).Where("client_id = ?", clientID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+// AuthorizationCodeRepository implementation
+type authorizationCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewAuthorizationCodeRepository(db *gorm.DB) repository.AuthorizationCodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+func (r *authorizationCodeRepository) Create(ctx context.Context, code *entity.AuthorizationCode) (*entity.AuthorizationCode, error) {
+	m := model.EntityToAuthorizationCodeModel(code)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *authorizationCodeRepository) GetByCodeHash(ctx context.Context, codeHashes ...string) (*entity.AuthorizationCode, error) {
+	var m model.AuthorizationCodeModel
+	if err := dbFrom(ctx, r.db).Where("code_hash IN ?", codeHashes).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *authorizationCodeRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.AuthorizationCodeModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrAuthorizationCodeUsed
+	}
+	return nil
+}
+
+func (r *authorizationCodeRepository) DeleteExpired(ctx context.Context) error {
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.AuthorizationCodeModel{}).Error
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+// outboxRelayLockID is the advisory lock key held by the running relay.
+const outboxRelayLockID = 7_240_001
+
+const outboxPending = "published_at IS NULL AND dead_lettered_at IS NULL"
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) repository.OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Create(ctx context.Context, event *entity.OutboxEvent) error {
+	m := model.EntityToOutboxEventModel(event)
+	if m.NextAttemptAt.IsZero() {
+		m.NextAttemptAt = time.Now()
+	}
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return err
+	}
+	event.ID = m.ID
+	return nil
+}
+
+func (r *outboxRepository) LockRelay(ctx context.Context) (bool, error) {
+	var locked bool
+	err := dbFrom(ctx, r.db).Raw("SELECT pg_try_advisory_xact_lock(?)", outboxRelayLockID).Scan(&locked).Error
+	return locked, err
+}
+
+func (r *outboxRepository) ListDue(ctx context.Context, limit int) ([]*entity.OutboxEvent, error) {
+	// The head of each key is picked before filtering on next_attempt_at,
+	// so a later event can't overtake one waiting for a retry
+	heads := dbFrom(ctx, r.db).Model(&model.OutboxEventModel{}).
+		Select("DISTINCT ON (event_key) *").
+		Where(outboxPending).
+		Order("event_key, id")
+
+	var models []model.OutboxEventModel
+	if err := dbFrom(ctx, r.db).
+		Table("(?) AS heads", heads).
+		Where("next_attempt_at <= NOW()").
+		Order("id").
+		Limit(limit).
+		Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]*entity.OutboxEvent, len(models))
+	for i := range models {
+		events[i] = models[i].ToEntity()
+	}
+	return events, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, ids []int64, publishedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return dbFrom(ctx, r.db).Model(&model.OutboxEventModel{}).
+		Where("id IN ?", ids).
+		Update("published_at", publishedAt).Error
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id int64, attempts int, retryAfter time.Duration, lastError string) error {
+	return dbFrom(ctx, r.db).Model(&model.OutboxEventModel{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        attempts,
+			"next_attempt_at": gorm.Expr("NOW() + make_interval(secs => ?)", retryAfter.Seconds()),
+			"last_error":      lastError,
+		}).Error
+}
+
+func (r *outboxRepository) MarkDeadLettered(ctx context.Context, id int64, attempts int, lastError string) error {
+	return dbFrom(ctx, r.db).Model(&model.OutboxEventModel{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":         attempts,
+			"last_error":       lastError,
+			"dead_lettered_at": time.Now(),
+		}).Error
+}
+
+func (r *outboxRepository) Stats(ctx context.Context) (*repository.OutboxStats, error) {
+	var row struct {
+		Pending         int64
+		OldestPendingAt *time.Time
+		DeadLettered    int64
+	}
+	err := dbFrom(ctx, r.db).Model(&model.OutboxEventModel{}).
+		Select("COUNT(*) FILTER (WHERE " + outboxPending + ") AS pending, " +
+			"MIN(created_at) FILTER (WHERE " + outboxPending + ") AS oldest_pending_at, " +
+			"COUNT(*) FILTER (WHERE dead_lettered_at IS NOT NULL) AS dead_lettered").
+		Where("published_at IS NULL").
+		Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	return &repository.OutboxStats{
+		Pending:         row.Pending,
+		OldestPendingAt: row.OldestPendingAt,
+		DeadLettered:    row.DeadLettered,
+	}, nil
+}
+
+func (r *outboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) error {
+	return dbFrom(ctx, r.db).Where("published_at < ?", before).Delete(&model.OutboxEventModel{}).Error
+}
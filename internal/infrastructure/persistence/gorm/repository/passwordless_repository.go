@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type passwordlessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordlessTokenRepository(db *gorm.DB) repository.PasswordlessTokenRepository {
+	return &passwordlessTokenRepository{db: db}
+}
+
+func (r *passwordlessTokenRepository) Create(ctx context.Context, token *entity.PasswordlessToken) (*entity.PasswordlessToken, error) {
+	m := model.EntityToPasswordlessTokenModel(token)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *passwordlessTokenRepository) GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.PasswordlessToken, error) {
+	var m model.PasswordlessTokenModel
+	if err := dbFrom(ctx, r.db).
+		Where("token_hash IN ? AND method = ?", tokenHashes, string(entity.PasswordlessMethodLink)).
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *passwordlessTokenRepository) GetLatestByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.PasswordlessToken, error) {
+	var m model.PasswordlessTokenModel
+	if err := dbFrom(ctx, r.db).
+		Where("identity_id = ?", identityID).
+		Order("created_at DESC").
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *passwordlessTokenRepository) CountCreatedSince(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).
+		Model(&model.PasswordlessTokenModel{}).
+		Where("identity_id = ? AND created_at > ?", identityID, since).
+		Count(&count).Error
+	return int(count), err
+}
+
+func (r *passwordlessTokenRepository) IncrementAttempts(ctx context.Context, id uuid.UUID) error {
+	return dbFrom(ctx, r.db).Model(&model.PasswordlessTokenModel{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *passwordlessTokenRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.PasswordlessTokenModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrPasswordlessTokenUsed
+	}
+	return nil
+}
+
+func (r *passwordlessTokenRepository) MarkAllAsUsedByIdentityID(ctx context.Context, identityID uuid.UUID) error {
+	return dbFrom(ctx, r.db).Model(&model.PasswordlessTokenModel{}).
+		Where("identity_id = ? AND used_at IS NULL", identityID).
+		Update("used_at", time.Now()).Error
+}
+
+func (r *passwordlessTokenRepository) DeleteExpired(ctx context.Context) error {
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.PasswordlessTokenModel{}).Error
+}
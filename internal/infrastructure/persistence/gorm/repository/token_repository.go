@@ -21,15 +21,15 @@ func NewRefreshTokenRepository(db *gorm.DB) repository.RefreshTokenRepository {
 
 func (r *refreshTokenRepository) Create(ctx context.Context, token *entity.RefreshToken) (*entity.RefreshToken, error) {
 	m := model.EntityToRefreshTokenModel(token)
-	if err := r.db.WithContext(ctx).Create(m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
 }
 
-func (r *refreshTokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+func (r *refreshTokenRepository) GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.RefreshToken, error) {
 	var m model.RefreshTokenModel
-	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Where("token_hash IN ?", tokenHashes).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
@@ -37,12 +37,12 @@ func (r *refreshTokenRepository) GetByTokenHash(ctx context.Context, tokenHash s
 
 func (r *refreshTokenRepository) GetActiveByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.RefreshToken, error) {
 	var models []model.RefreshTokenModel
-	if err := r.db.WithContext(ctx).
+	if err := dbFrom(ctx, r.db).
 		Where("identity_id = ? AND revoked_at IS NULL AND expires_at > ?", identityID, time.Now()).
 		Find(&models).Error; err != nil {
 		return nil, err
 	}
-	
+
 	tokens := make([]*entity.RefreshToken, len(models))
 	for i, m := range models {
 		tokens[i] = m.ToEntity()
@@ -52,16 +52,91 @@ func (r *refreshTokenRepository) GetActiveByIdentityID(ctx context.Context, iden
 
 func (r *refreshTokenRepository) Revoke(ctx context.Context, id uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).Model(&model.RefreshTokenModel{}).Where("id = ?", id).Update("revoked_at", now).Error
+	return dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).Where("id = ?", id).Update("revoked_at", now).Error
 }
 
 func (r *refreshTokenRepository) RevokeAllByIdentityID(ctx context.Context, identityID uuid.UUID) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).Model(&model.RefreshTokenModel{}).Where("identity_id = ?", identityID).Update("revoked_at", now).Error
+	return dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).Where("identity_id = ?", identityID).Update("revoked_at", now).Error
+}
+
+func (r *refreshTokenRepository) RevokeAllByIdentityIDExceptFamily(ctx context.Context, identityID, familyID uuid.UUID) error {
+	now := time.Now()
+	return dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).
+		Where("identity_id = ? AND family_id <> ? AND revoked_at IS NULL", identityID, familyID).
+		Update("revoked_at", now).Error
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	now := time.Now()
+	return dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+func (r *refreshTokenRepository) IsFamilyActive(ctx context.Context, familyID uuid.UUID) (bool, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Rotate revokes oldID and stores next as its replacement in one transaction.
+// The conditional update guarantees only one of several concurrent refreshes
+// with the same token can win.
+func (r *refreshTokenRepository) Rotate(ctx context.Context, oldID uuid.UUID, next *entity.RefreshToken) (*entity.RefreshToken, error) {
+	m := model.EntityToRefreshTokenModel(next)
+	err := dbFrom(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&model.RefreshTokenModel{}).
+			Where("id = ? AND revoked_at IS NULL AND replaced_by_id IS NULL", oldID).
+			Updates(map[string]interface{}{
+				"revoked_at":     time.Now(),
+				"replaced_by_id": m.ID,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrRefreshTokenNotRotatable
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *refreshTokenRepository) HasSessions(ctx context.Context, identityID uuid.UUID) (bool, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).
+		Where("identity_id = ?", identityID).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *refreshTokenRepository) HasDevice(ctx context.Context, identityID uuid.UUID, deviceInfo, ipAddress string) (bool, error) {
+	query := dbFrom(ctx, r.db).Model(&model.RefreshTokenModel{}).
+		Where("identity_id = ?", identityID)
+	if deviceInfo != "" {
+		query = query.Where("device_info = ?", deviceInfo)
+	} else {
+		query = query.Where("ip_address = ?", ipAddress)
+	}
+
+	var count int64
+	err := query.Limit(1).Count(&count).Error
+	return count > 0, err
 }
 
 func (r *refreshTokenRepository) DeleteExpired(ctx context.Context) error {
-	return r.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&model.RefreshTokenModel{}).Error
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.RefreshTokenModel{}).Error
 }
 
 // PasswordResetRepository implementation
@@ -75,25 +150,33 @@ func NewPasswordResetRepository(db *gorm.DB) repository.PasswordResetRepository
 
 func (r *passwordResetRepository) Create(ctx context.Context, token *entity.PasswordResetToken) (*entity.PasswordResetToken, error) {
 	m := model.EntityToPasswordResetModel(token)
-	if err := r.db.WithContext(ctx).Create(m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
 }
 
-func (r *passwordResetRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordResetToken, error) {
+func (r *passwordResetRepository) GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.PasswordResetToken, error) {
 	var m model.PasswordResetModel
-	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&m).Error; err != nil {
+	if err := dbFrom(ctx, r.db).Where("token_hash IN ?", tokenHashes).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return m.ToEntity(), nil
 }
 
 func (r *passwordResetRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
-	now := time.Now()
-	return r.db.WithContext(ctx).Model(&model.PasswordResetModel{}).Where("id = ?", id).Update("used_at", now).Error
+	res := dbFrom(ctx, r.db).Model(&model.PasswordResetModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrPasswordResetTokenUsed
+	}
+	return nil
 }
 
 func (r *passwordResetRepository) DeleteExpired(ctx context.Context) error {
-	return r.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&model.PasswordResetModel{}).Error
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.PasswordResetModel{}).Error
 }
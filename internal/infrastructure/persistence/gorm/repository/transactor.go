@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+type transactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) repository.Transactor {
+	return &transactor{db: db}
+}
+
+// WithinTransaction runs fn in a transaction carried by its context. Called
+// inside another transaction it uses a savepoint.
+func (t *transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return dbFrom(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// dbFrom returns the transaction ctx carries, or db outside of one.
+func dbFrom(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
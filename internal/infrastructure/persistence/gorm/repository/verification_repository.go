@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type emailVerificationRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailVerificationRepository(db *gorm.DB) repository.EmailVerificationRepository {
+	return &emailVerificationRepository{db: db}
+}
+
+func (r *emailVerificationRepository) Create(ctx context.Context, token *entity.EmailVerificationToken) (*entity.EmailVerificationToken, error) {
+	m := model.EntityToEmailVerificationModel(token)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *emailVerificationRepository) GetByTokenHash(ctx context.Context, tokenHashes ...string) (*entity.EmailVerificationToken, error) {
+	var m model.EmailVerificationModel
+	if err := dbFrom(ctx, r.db).Where("token_hash IN ?", tokenHashes).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *emailVerificationRepository) GetLatestByIdentityID(ctx context.Context, identityID uuid.UUID) (*entity.EmailVerificationToken, error) {
+	var m model.EmailVerificationModel
+	if err := dbFrom(ctx, r.db).
+		Where("identity_id = ?", identityID).
+		Order("created_at DESC").
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *emailVerificationRepository) CountCreatedSince(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error) {
+	var count int64
+	err := dbFrom(ctx, r.db).
+		Model(&model.EmailVerificationModel{}).
+		Where("identity_id = ? AND created_at > ?", identityID, since).
+		Count(&count).Error
+	return int(count), err
+}
+
+func (r *emailVerificationRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.EmailVerificationModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrVerificationTokenUsed
+	}
+	return nil
+}
+
+func (r *emailVerificationRepository) MarkAllAsUsedByIdentityID(ctx context.Context, identityID uuid.UUID) error {
+	now := time.Now()
+	return dbFrom(ctx, r.db).Model(&model.EmailVerificationModel{}).
+		Where("identity_id = ? AND used_at IS NULL", identityID).
+		Update("used_at", now).Error
+}
+
+func (r *emailVerificationRepository) DeleteExpired(ctx context.Context) error {
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.EmailVerificationModel{}).Error
+}
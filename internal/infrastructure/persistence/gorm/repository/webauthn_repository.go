@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/persistence/gorm/model"
+	"gorm.io/gorm"
+)
+
+type webAuthnCredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnCredentialRepository(db *gorm.DB) repository.WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepository{db: db}
+}
+
+func (r *webAuthnCredentialRepository) Create(ctx context.Context, credential *entity.WebAuthnCredential) (*entity.WebAuthnCredential, error) {
+	m := model.EntityToWebAuthnCredentialModel(credential)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *webAuthnCredentialRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*entity.WebAuthnCredential, error) {
+	var m model.WebAuthnCredentialModel
+	if err := dbFrom(ctx, r.db).Where("credential_id = ?", credentialID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *webAuthnCredentialRepository) ListByIdentityID(ctx context.Context, identityID uuid.UUID) ([]*entity.WebAuthnCredential, error) {
+	var models []model.WebAuthnCredentialModel
+	if err := dbFrom(ctx, r.db).Where("identity_id = ?", identityID).Order("created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	credentials := make([]*entity.WebAuthnCredential, 0, len(models))
+	for i := range models {
+		credentials = append(credentials, models[i].ToEntity())
+	}
+	return credentials, nil
+}
+
+// UpdateUsage records a login. The sign count only moves forward, so two
+// requests racing with the same assertion can't both succeed; authenticators
+// without a counter always report zero and are let through.
+func (r *webAuthnCredentialRepository) UpdateUsage(ctx context.Context, id uuid.UUID, signCount uint32, backedUp bool) error {
+	res := dbFrom(ctx, r.db).Model(&model.WebAuthnCredentialModel{}).
+		Where("id = ? AND (sign_count < ? OR ? = 0)", id, int64(signCount), int64(signCount)).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(signCount),
+			"backed_up":    backedUp,
+			"last_used_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrSignCountNotIncreased
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepository) Delete(ctx context.Context, id, identityID uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Where("id = ? AND identity_id = ?", id, identityID).Delete(&model.WebAuthnCredentialModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// WebAuthnSessionRepository implementation
+type webAuthnSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnSessionRepository(db *gorm.DB) repository.WebAuthnSessionRepository {
+	return &webAuthnSessionRepository{db: db}
+}
+
+func (r *webAuthnSessionRepository) Create(ctx context.Context, session *entity.WebAuthnSession) (*entity.WebAuthnSession, error) {
+	m := model.EntityToWebAuthnSessionModel(session)
+	if err := dbFrom(ctx, r.db).Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *webAuthnSessionRepository) GetByChallengeHash(ctx context.Context, challengeHashes ...string) (*entity.WebAuthnSession, error) {
+	var m model.WebAuthnSessionModel
+	if err := dbFrom(ctx, r.db).Where("challenge_hash IN ?", challengeHashes).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEntity(), nil
+}
+
+func (r *webAuthnSessionRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	res := dbFrom(ctx, r.db).Model(&model.WebAuthnSessionModel{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrWebAuthnSessionUsed
+	}
+	return nil
+}
+
+func (r *webAuthnSessionRepository) DeleteExpired(ctx context.Context) error {
+	return dbFrom(ctx, r.db).Where("expires_at < ?", time.Now()).Delete(&model.WebAuthnSessionModel{}).Error
+}
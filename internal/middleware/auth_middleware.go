@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 )
 
@@ -12,52 +15,132 @@ const (
 	BearerPrefix        = "Bearer "
 	UserIDKey           = "user_id"
 	EmailKey            = "email"
+	SessionIDKey        = "session_id"
+	TokenIDKey          = "token_id"
+	TokenExpiresAtKey   = "token_expires_at"
+	TokenIssuedAtKey    = "token_issued_at"
+	ScopeKey            = "scope"
 	RolesKey            = "roles"
 	PermissionsKey      = "permissions"
 )
 
+// AuthMiddleware authenticates access tokens. audience is the audience of the
+// tokens issued to OAuth clients, which are only accepted by routes that
+// allow their scope.
 type AuthMiddleware struct {
-	jwtUtil *utils.JWTUtil
+	jwtUtil  *utils.JWTUtil
+	denylist *cache.TokenDenylist
+	audience string
 }
 
-func NewAuthMiddleware(jwtUtil *utils.JWTUtil) *AuthMiddleware {
-	return &AuthMiddleware{jwtUtil: jwtUtil}
+func NewAuthMiddleware(jwtUtil *utils.JWTUtil, denylist *cache.TokenDenylist, audience string) *AuthMiddleware {
+	return &AuthMiddleware{
+		jwtUtil:  jwtUtil,
+		denylist: denylist,
+		audience: audience,
+	}
 }
 
-func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
+// RequireAuth accepts first-party access tokens, and tokens issued to OAuth
+// clients if they were granted one of scopes.
+func (m *AuthMiddleware) RequireAuth(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader(AuthorizationHeader)
 		if authHeader == "" {
-			utils.Unauthorized(c, "Authorization header required")
+			utils.Unauthorized(c, "errors.authorization_required")
 			c.Abort()
 			return
 		}
 
 		if !strings.HasPrefix(authHeader, BearerPrefix) {
-			utils.Unauthorized(c, "Invalid authorization header format")
+			utils.Unauthorized(c, "errors.invalid_authorization_header")
 			c.Abort()
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, BearerPrefix)
-
-		claims, err := m.jwtUtil.ValidateToken(tokenString)
-		if err != nil {
-			utils.Unauthorized(c, "Invalid or expired token")
+		claims, message := m.authenticate(c, strings.TrimPrefix(authHeader, BearerPrefix), scopes)
+		if claims == nil {
+			utils.Unauthorized(c, message)
 			c.Abort()
 			return
 		}
 
-		// Set user info in context
-		c.Set(UserIDKey, claims.UserID)
-		c.Set(EmailKey, claims.Email)
-		c.Set(RolesKey, claims.Roles)
-		c.Set(PermissionsKey, claims.Permissions)
-
+		setClaims(c, claims)
 		c.Next()
 	}
 }
 
+// authenticate validates an access token. On failure it returns nil and the
+// message key of the reason to report.
+func (m *AuthMiddleware) authenticate(c *gin.Context, tokenString string, scopes []string) (*utils.Claims, string) {
+	claims, err := m.jwtUtil.ValidateToken(tokenString)
+	if err != nil {
+		return nil, "errors.invalid_token"
+	}
+
+	if claims.Scope == "" {
+		// Tokens with an audience, such as kiosk check-in tokens, are
+		// only for that service
+		if len(claims.Audience) > 0 {
+			return nil, "errors.invalid_token"
+		}
+	} else if !slices.Contains(claims.Audience, m.audience) || !grantsAny(claims.Scope, scopes) {
+		// Tokens issued to OAuth clients only reach the routes that
+		// allow their scope
+		return nil, "errors.token_not_for_endpoint"
+	}
+
+	// Reject tokens revoked by logout. A denylist outage is logged and
+	// the request allowed, so Redis problems don't sign everyone out.
+	denied, err := m.denylist.IsDenied(c.Request.Context(), claims.ID)
+	if err != nil {
+		utils.Errorf("Failed to check token denylist", utils.ErrorField(err.Error()))
+	}
+	if denied {
+		return nil, "errors.token_revoked"
+	}
+
+	// Reject tokens issued before an administrator revoked all of the
+	// user's sessions
+	if claims.IssuedAt != nil {
+		revoked, err := m.denylist.IsUserRevoked(c.Request.Context(), claims.UserID, claims.IssuedAt.Time)
+		if err != nil {
+			utils.Errorf("Failed to check token denylist", utils.ErrorField(err.Error()))
+		}
+		if revoked {
+			return nil, "errors.token_revoked"
+		}
+	}
+
+	return claims, ""
+}
+
+// grantsAny reports whether the space separated scope contains any of scopes.
+func grantsAny(scope string, scopes []string) bool {
+	for _, s := range strings.Fields(scope) {
+		if slices.Contains(scopes, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func setClaims(c *gin.Context, claims *utils.Claims) {
+	c.Set(UserIDKey, claims.UserID)
+	c.Set(TokenIDKey, claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set(TokenExpiresAtKey, claims.ExpiresAt.Time)
+	}
+	if claims.IssuedAt != nil {
+		c.Set(TokenIssuedAtKey, claims.IssuedAt.Time)
+	}
+	c.Set(EmailKey, claims.Email)
+	c.Set(SessionIDKey, claims.SessionID)
+	c.Set(ScopeKey, claims.Scope)
+	c.Set(RolesKey, claims.Roles)
+	c.Set(PermissionsKey, claims.Permissions)
+}
+
 func GetUserID(c *gin.Context) string {
 	if userID, exists := c.Get(UserIDKey); exists {
 		return userID.(string)
@@ -72,6 +155,43 @@ func GetEmail(c *gin.Context) string {
 	return ""
 }
 
+func GetSessionID(c *gin.Context) string {
+	if sessionID, exists := c.Get(SessionIDKey); exists {
+		return sessionID.(string)
+	}
+	return ""
+}
+
+func GetTokenID(c *gin.Context) string {
+	if tokenID, exists := c.Get(TokenIDKey); exists {
+		return tokenID.(string)
+	}
+	return ""
+}
+
+func GetTokenExpiresAt(c *gin.Context) time.Time {
+	if expiresAt, exists := c.Get(TokenExpiresAtKey); exists {
+		return expiresAt.(time.Time)
+	}
+	return time.Time{}
+}
+
+func GetTokenIssuedAt(c *gin.Context) time.Time {
+	if issuedAt, exists := c.Get(TokenIssuedAtKey); exists {
+		return issuedAt.(time.Time)
+	}
+	return time.Time{}
+}
+
+// GetScope returns the OAuth scope granted to the token, empty for tokens from
+// a first-party login.
+func GetScope(c *gin.Context) string {
+	if scope, exists := c.Get(ScopeKey); exists {
+		return scope.(string)
+	}
+	return ""
+}
+
 func GetRoles(c *gin.Context) []string {
 	if roles, exists := c.Get(RolesKey); exists {
 		return roles.([]string)
@@ -86,10 +206,21 @@ func GetPermissions(c *gin.Context) []string {
 	return []string{}
 }
 
+// HasPermission reports whether the token grants permission, directly or
+// through a wildcard such as "identity:*".
 func HasPermission(c *gin.Context, permission string) bool {
 	permissions := GetPermissions(c)
 	for _, p := range permissions {
-		if p == permission {
+		if permissionMatches(p, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func HasScope(c *gin.Context, scope string) bool {
+	for _, s := range strings.Fields(GetScope(c)) {
+		if s == scope {
 			return true
 		}
 	}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+// permissionWildcard grants every permission, or every permission under a
+// prefix when it ends one, as in "identity:*".
+const permissionWildcard = "*"
+
+// The guards below run after RequireAuth and reject the request with 403,
+// naming what is missing, unless the token's claims allow it. Chain several
+// to require all of them.
+
+// RequirePermission lets the request through if the token grants any of
+// permissions.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, permission) {
+				c.Next()
+				return
+			}
+		}
+		forbid(c, "errors.missing_permission", permissions)
+	}
+}
+
+// RequireAllPermissions lets the request through only if the token grants
+// every one of permissions, and lists the ones it lacks otherwise.
+func RequireAllPermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var missing []string
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				missing = append(missing, permission)
+			}
+		}
+		if len(missing) > 0 {
+			forbid(c, "errors.missing_permissions", missing)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole lets the request through if the token has any of roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, role := range roles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+		forbid(c, "errors.missing_role", roles)
+	}
+}
+
+// RequireScope lets the request through if the token was granted any of
+// scopes. Refusals carry the RFC 6750 insufficient_scope challenge.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, scope := range scopes {
+			if HasScope(c, scope) {
+				c.Next()
+				return
+			}
+		}
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+		forbid(c, "errors.missing_scope", scopes)
+	}
+}
+
+// forbid rejects the request with the message key, naming what is missing.
+func forbid(c *gin.Context, key string, names []string) {
+	message := i18n.FromContext(c.Request.Context()).T(key, map[string]interface{}{"Names": names})
+	utils.Forbidden(c, message)
+	c.Abort()
+}
+
+// permissionMatches reports whether the granted permission covers required.
+// "*" covers everything and "identity:*" covers "identity:read" as well as
+// "identity:mfa:reset", but not "identity" itself.
+func permissionMatches(granted, required string) bool {
+	if granted == required || granted == permissionWildcard {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(granted, permissionWildcard)
+	if !ok || !strings.HasSuffix(prefix, ":") {
+		return false
+	}
+	return strings.HasPrefix(required, prefix)
+}
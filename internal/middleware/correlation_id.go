@@ -3,19 +3,28 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 )
 
 const CorrelationIDHeader = "X-Correlation-ID"
 const CorrelationIDKey = "correlation_id"
 
+// maxCorrelationIDLength caps ids taken from the request header; longer ones
+// are replaced with a new id.
+const maxCorrelationIDLength = 128
+
+// CorrelationID takes the request's correlation id from X-Correlation-ID, or
+// makes a new one, echoes it in the response and puts it in the request
+// context, where the events the request causes pick it up.
 func CorrelationID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		correlationID := c.GetHeader(CorrelationIDHeader)
-		if correlationID == "" {
+		if correlationID == "" || len(correlationID) > maxCorrelationIDLength {
 			correlationID = uuid.New().String()
 		}
 
 		c.Set(CorrelationIDKey, correlationID)
+		c.Request = c.Request.WithContext(utils.WithCorrelationID(c.Request.Context(), correlationID))
 		c.Header(CorrelationIDHeader, correlationID)
 
 		c.Next()
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+)
+
+const LocaleKey = "locale"
+
+// Locale negotiates the response language from Accept-Language and puts a
+// Localizer for it in the request context, where utils.ErrorResponse and the
+// services pick it up.
+func Locale(catalog *i18n.Catalog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale := catalog.Match(c.GetHeader("Accept-Language"))
+
+		c.Set(LocaleKey, locale)
+		c.Request = c.Request.WithContext(i18n.WithLocalizer(c.Request.Context(), catalog.Localizer(locale)))
+		c.Header("Content-Language", locale)
+
+		c.Next()
+	}
+}
+
+func GetLocale(c *gin.Context) string {
+	if locale, exists := c.Get(LocaleKey); exists {
+		return locale.(string)
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+const (
+	RateLimitKeyIP    = "ip"
+	RateLimitKeyEmail = "email"
+
+	// rateLimitMaxBodyPeek caps how much of the body is read to find the email.
+	rateLimitMaxBodyPeek = 64 << 10
+)
+
+type RateLimiter struct {
+	cfg   *config.RateLimitConfig
+	store RateLimitStore
+}
+
+func NewRateLimiter(cfg *config.RateLimitConfig, store RateLimitStore) *RateLimiter {
+	return &RateLimiter{cfg: cfg, store: store}
+}
+
+// Limit enforces the rule configured for route. Each attribute in the rule's
+// KeyBy is counted separately; the request is rejected if any of them is over
+// the limit, and the headers report the most restrictive one.
+func (l *RateLimiter) Limit(route string) gin.HandlerFunc {
+	rule, ok := l.cfg.Rules[route]
+	if !l.cfg.Enabled || !ok || rule.Limit <= 0 || rule.Window <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		var tightest *RateLimitDecision
+		for _, key := range l.keys(c, route, rule) {
+			decision, err := l.store.Allow(c.Request.Context(), key, rule.Limit, rule.Window)
+			if err != nil {
+				// Never turn a limiter failure into an outage
+				utils.Errorf("Rate limit check failed", utils.ErrorField(err.Error()))
+				continue
+			}
+			if tightest == nil || !decision.Allowed || (tightest.Allowed && decision.Remaining < tightest.Remaining) {
+				d := decision
+				tightest = &d
+			}
+			if !decision.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		reset := int(math.Ceil(tightest.Reset.Seconds()))
+		c.Header("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(reset))
+
+		if !tightest.Allowed {
+			c.Header("Retry-After", strconv.Itoa(reset))
+			utils.TooManyRequests(c, "errors.too_many_requests")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (l *RateLimiter) keys(c *gin.Context, route string, rule config.RateLimitRule) []string {
+	keys := make([]string, 0, len(rule.KeyBy))
+	for _, by := range rule.KeyBy {
+		switch by {
+		case RateLimitKeyIP:
+			keys = append(keys, route+":ip:"+c.ClientIP())
+		case RateLimitKeyEmail:
+			if email := peekEmail(c); email != "" {
+				// Hash so raw emails don't end up in Redis
+				sum := sha256.Sum256([]byte(email))
+				keys = append(keys, route+":email:"+hex.EncodeToString(sum[:]))
+			}
+		}
+	}
+	return keys
+}
+
+// peekEmail reads the "identifier" field of a JSON body, or the "email" field
+// when there is none, and restores the body for the handler. Logins by any
+// identifier are limited like logins by email.
+func peekEmail(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	peeked, err := io.ReadAll(io.LimitReader(c.Request.Body, rateLimitMaxBodyPeek))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(peeked), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Identifier string `json:"identifier"`
+		Email      string `json:"email"`
+	}
+	if err := json.Unmarshal(peeked, &payload); err != nil {
+		return ""
+	}
+	if payload.Identifier != "" {
+		return strings.ToLower(strings.TrimSpace(payload.Identifier))
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
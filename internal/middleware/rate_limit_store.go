@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/redis"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+const (
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+)
+
+// RateLimitDecision is the outcome of one rate limit check.
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the key is fully replenished (allowed) or until
+	// the next request may succeed (denied).
+	Reset time.Duration
+}
+
+// RateLimitStore counts requests for a key and decides whether another one is
+// allowed within limit requests per window.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error)
+}
+
+// NewRateLimitStore returns a Redis backed store for algorithm that falls back
+// to an in-memory store whenever Redis is nil or failing.
+func NewRateLimitStore(algorithm string, redisClient *redis.RedisClient) RateLimitStore {
+	var primary, fallback RateLimitStore
+	switch algorithm {
+	case AlgorithmTokenBucket:
+		fallback = newMemoryTokenBucket()
+		if redisClient != nil {
+			primary = &redisTokenBucket{redis: redisClient}
+		}
+	default:
+		fallback = newMemorySlidingWindow()
+		if redisClient != nil {
+			primary = &redisSlidingWindow{redis: redisClient}
+		}
+	}
+
+	if primary == nil {
+		return fallback
+	}
+	return &fallbackStore{primary: primary, fallback: fallback}
+}
+
+type fallbackStore struct {
+	primary  RateLimitStore
+	fallback RateLimitStore
+}
+
+func (s *fallbackStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	decision, err := s.primary.Allow(ctx, key, limit, window)
+	if err == nil {
+		return decision, nil
+	}
+	utils.Warn("Rate limit store unavailable, using in-memory fallback", utils.ErrorField(err.Error()))
+	return s.fallback.Allow(ctx, key, limit, window)
+}
+
+// slidingWindowCount estimates the requests in the last window from the
+// current and previous fixed windows, weighting the previous one by how much
+// of it still overlaps.
+func slidingWindowCount(prev, curr int64, elapsed, window time.Duration) float64 {
+	weight := 1 - float64(elapsed)/float64(window)
+	return float64(prev)*weight + float64(curr)
+}
+
+func slidingWindowDecision(count float64, limit int, elapsed, window time.Duration) RateLimitDecision {
+	remaining := limit - int(math.Ceil(count))
+	if remaining < 0 {
+		remaining = 0
+	}
+	return RateLimitDecision{
+		Allowed:   count <= float64(limit),
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     window - elapsed,
+	}
+}
+
+// slidingWindowScript counts a request in the current window, giving a new
+// window's key its expiry in the same step so it can't be left without one,
+// and returns the current and previous windows' counts.
+const slidingWindowScript = `
+local curr = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local prev = tonumber(redis.call('GET', KEYS[2])) or 0
+return {curr, prev}
+`
+
+type redisSlidingWindow struct {
+	redis *redis.RedisClient
+}
+
+func (s *redisSlidingWindow) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	now := time.Now()
+	index := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() % int64(window))
+
+	currKey := fmt.Sprintf("ratelimit:sw:%s:%d", key, index)
+	prevKey := fmt.Sprintf("ratelimit:sw:%s:%d", key, index-1)
+
+	res, err := s.redis.Eval(ctx, slidingWindowScript, []string{currKey, prevKey}, (2 * window).Milliseconds())
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return RateLimitDecision{}, fmt.Errorf("unexpected sliding window result: %v", res)
+	}
+	curr, _ := values[0].(int64)
+	prev, _ := values[1].(int64)
+
+	return slidingWindowDecision(slidingWindowCount(prev, curr, elapsed, window), limit, elapsed, window), nil
+}
+
+// tokenBucketScript refills the bucket for the time since the last request
+// and takes one token if available. Tokens are returned as a string so Redis
+// doesn't truncate them to an integer.
+const tokenBucketScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + (now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`
+
+type redisTokenBucket struct {
+	redis *redis.RedisClient
+}
+
+func (s *redisTokenBucket) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	rate := float64(limit) / float64(window.Milliseconds())
+	res, err := s.redis.Eval(ctx, tokenBucketScript, []string{"ratelimit:tb:" + key},
+		limit, strconv.FormatFloat(rate, 'f', -1, 64), time.Now().UnixMilli(), window.Milliseconds())
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return RateLimitDecision{}, fmt.Errorf("unexpected token bucket result: %v", res)
+	}
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+
+	return tokenBucketDecision(allowed == 1, tokens, limit, window), nil
+}
+
+func tokenBucketDecision(allowed bool, tokens float64, limit int, window time.Duration) RateLimitDecision {
+	perToken := window / time.Duration(limit)
+	reset := time.Duration((float64(limit) - tokens) * float64(perToken))
+	if !allowed {
+		reset = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return RateLimitDecision{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(tokens),
+		Reset:     reset,
+	}
+}
+
+// memoryStoreSweepInterval is how often in-memory stores drop idle keys. Each
+// entry keeps the window of the rule that created it, since rules with
+// different windows share a store.
+const memoryStoreSweepInterval = time.Minute
+
+type slidingWindowEntry struct {
+	index  int64
+	prev   int64
+	curr   int64
+	seen   time.Time
+	window time.Duration
+}
+
+type memorySlidingWindow struct {
+	mu        sync.Mutex
+	entries   map[string]*slidingWindowEntry
+	lastSweep time.Time
+}
+
+func newMemorySlidingWindow() *memorySlidingWindow {
+	return &memorySlidingWindow{entries: make(map[string]*slidingWindowEntry), lastSweep: time.Now()}
+}
+
+func (s *memorySlidingWindow) Allow(_ context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	now := time.Now()
+	index := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() % int64(window))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &slidingWindowEntry{index: index}
+		s.entries[key] = e
+	}
+	e.window = window
+	switch {
+	case e.index == index-1:
+		e.prev, e.curr = e.curr, 0
+	case e.index < index-1:
+		e.prev, e.curr = 0, 0
+	}
+	e.index = index
+	e.curr++
+	e.seen = now
+
+	return slidingWindowDecision(slidingWindowCount(e.prev, e.curr, elapsed, window), limit, elapsed, window), nil
+}
+
+func (s *memorySlidingWindow) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.Sub(e.seen) > 2*e.window {
+			delete(s.entries, key)
+		}
+	}
+}
+
+type tokenBucketEntry struct {
+	tokens float64
+	ts     time.Time
+	window time.Duration
+}
+
+type memoryTokenBucket struct {
+	mu        sync.Mutex
+	entries   map[string]*tokenBucketEntry
+	lastSweep time.Time
+}
+
+func newMemoryTokenBucket() *memoryTokenBucket {
+	return &memoryTokenBucket{entries: make(map[string]*tokenBucketEntry), lastSweep: time.Now()}
+}
+
+func (s *memoryTokenBucket) Allow(_ context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &tokenBucketEntry{tokens: float64(limit), ts: now}
+		s.entries[key] = e
+	}
+	e.window = window
+	rate := float64(limit) / float64(window)
+	e.tokens = math.Min(float64(limit), e.tokens+float64(now.Sub(e.ts))*rate)
+	e.ts = now
+
+	allowed := e.tokens >= 1
+	if allowed {
+		e.tokens--
+	}
+
+	return tokenBucketDecision(allowed, e.tokens, limit, window), nil
+}
+
+func (s *memoryTokenBucket) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.Sub(e.ts) > e.window {
+			delete(s.entries, key)
+		}
+	}
+}
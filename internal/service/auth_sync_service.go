@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// AuthSyncService applies the role and user changes the auth service
+// announces on Kafka to cached permissions and sessions. It is the
+// messaging.AuthEventHandler of the auth event consumer.
+type AuthSyncService struct {
+	identityRepo repository.IdentityRepository
+	tokenRepo    repository.RefreshTokenRepository
+	transactor   repository.Transactor
+	permissions  *cache.PermissionCache
+	denylist     *cache.TokenDenylist
+	events       *messaging.Outbox
+	cfg          *config.Config
+}
+
+func NewAuthSyncService(
+	identityRepo repository.IdentityRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	transactor repository.Transactor,
+	permissions *cache.PermissionCache,
+	denylist *cache.TokenDenylist,
+	events *messaging.Outbox,
+	cfg *config.Config,
+) *AuthSyncService {
+	return &AuthSyncService{
+		identityRepo: identityRepo,
+		tokenRepo:    tokenRepo,
+		transactor:   transactor,
+		permissions:  permissions,
+		denylist:     denylist,
+		events:       events,
+		cfg:          cfg,
+	}
+}
+
+// UserRolesChanged drops the user's cached permissions, so the next login or
+// refresh gets the new roles. With kafka.consumer.revoke_sessions the user is
+// also signed out everywhere.
+func (s *AuthSyncService) UserRolesChanged(ctx context.Context, userID uuid.UUID) error {
+	if err := s.permissions.Invalidate(ctx, userID.String()); err != nil {
+		return err
+	}
+	if !s.cfg.Kafka.Consumer.RevokeSessions {
+		return nil
+	}
+	return s.signOut(ctx, userID, "roles_changed")
+}
+
+// RolePermissionsChanged drops every cached entry, as any user may hold the
+// role. Sessions are left alone; they pick up the change at their next
+// refresh.
+func (s *AuthSyncService) RolePermissionsChanged(ctx context.Context, role string) error {
+	if err := s.permissions.InvalidateAll(ctx); err != nil {
+		return err
+	}
+	utils.Info("Cached permissions cleared after role change", utils.String("role", role))
+	return nil
+}
+
+// UserDeleted signs the user out everywhere, since the auth service no
+// longer grants them anything. The identity itself is kept.
+func (s *AuthSyncService) UserDeleted(ctx context.Context, userID uuid.UUID) error {
+	if err := s.permissions.Invalidate(ctx, userID.String()); err != nil {
+		return err
+	}
+	return s.signOut(ctx, userID, "auth_user_deleted")
+}
+
+// signOut revokes the refresh tokens and access tokens of the user. Users
+// without an identity here have nothing to revoke.
+func (s *AuthSyncService) signOut(ctx context.Context, userID uuid.UUID, trigger string) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.tokenRepo.RevokeAllByIdentityID(ctx, identity.ID); err != nil {
+			return err
+		}
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityLoggedOut{
+			IdentityRef: messaging.RefFor(identity),
+			Scope:       "all",
+			Trigger:     trigger,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.denylist.RevokeUser(ctx, userID.String(), s.cfg.JWT.ExpirationTime); err != nil {
+		return err
+	}
+
+	utils.Info("Sessions revoked after auth service change",
+		utils.String("identity_id", identity.ID.String()),
+		utils.String("trigger", trigger),
+	)
+	return nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/mail"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+// EmailService renders and sends the emails the other services trigger.
+// Sending goes through the mail queue, so failures are logged rather than
+// returned: a request shouldn't fail because the mail server is down.
+type EmailService struct {
+	mailer    mail.Mailer
+	templates *mail.Templates
+	catalog   *i18n.Catalog
+	cfg       *config.Config
+}
+
+func NewEmailService(
+	mailer mail.Mailer,
+	templates *mail.Templates,
+	catalog *i18n.Catalog,
+	cfg *config.Config,
+) *EmailService {
+	return &EmailService{
+		mailer:    mailer,
+		templates: templates,
+		catalog:   catalog,
+		cfg:       cfg,
+	}
+}
+
+type emailData struct {
+	Locale      string
+	Link        string
+	Code        string
+	ExpiresIn   string
+	LockedUntil string
+	Time        string
+	DeviceInfo  string
+	IPAddress   string
+}
+
+func (s *EmailService) SendVerification(ctx context.Context, identity *entity.Identity, token string) {
+	s.send(ctx, identity, "verification", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Link:      tokenLink(s.cfg.Mail.VerifyEmailURL, token),
+			ExpiresIn: formatDuration(l, s.cfg.Verification.TokenTTL),
+		}
+	})
+}
+
+func (s *EmailService) SendPasswordReset(ctx context.Context, identity *entity.Identity, token string) {
+	s.send(ctx, identity, "password_reset", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Link:      tokenLink(s.cfg.Mail.ResetPasswordURL, token),
+			ExpiresIn: formatDuration(l, passwordResetTTL),
+		}
+	})
+}
+
+func (s *EmailService) SendPasswordlessLink(ctx context.Context, identity *entity.Identity, token string) {
+	s.send(ctx, identity, "passwordless_link", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Link:      tokenLink(s.cfg.Passwordless.LinkURL, token),
+			ExpiresIn: formatDuration(l, s.cfg.Passwordless.TokenTTL),
+		}
+	})
+}
+
+func (s *EmailService) SendPasswordlessCode(ctx context.Context, identity *entity.Identity, code string) {
+	s.send(ctx, identity, "passwordless_code", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Code:      code,
+			ExpiresIn: formatDuration(l, s.cfg.Passwordless.TokenTTL),
+		}
+	})
+}
+
+// SendIdentifierCode emails the code that proves the identity owns an email
+// address it added as an identifier.
+func (s *EmailService) SendIdentifierCode(ctx context.Context, identity *entity.Identity, address, code string) {
+	s.sendTo(ctx, identity, address, "identifier_code", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Code:      code,
+			ExpiresIn: formatDuration(l, identifierCodeTTL),
+		}
+	})
+}
+
+// SendAccountLocked tells the owner their account was locked. lockedUntil is
+// nil for permanent locks.
+func (s *EmailService) SendAccountLocked(ctx context.Context, identity *entity.Identity, lockedUntil *time.Time) {
+	s.send(ctx, identity, "account_locked", func(l *i18n.Localizer) emailData {
+		data := emailData{}
+		if lockedUntil != nil {
+			data.LockedUntil = lockedUntil.UTC().Format("2006-01-02 15:04 MST")
+		}
+		return data
+	})
+}
+
+func (s *EmailService) SendNewDevice(ctx context.Context, identity *entity.Identity, deviceInfo, ipAddress string) {
+	s.send(ctx, identity, "new_device", func(l *i18n.Localizer) emailData {
+		return emailData{
+			Time:       time.Now().UTC().Format("2006-01-02 15:04 MST"),
+			DeviceInfo: deviceInfo,
+			IPAddress:  ipAddress,
+		}
+	})
+}
+
+// send renders the email in the identity's preferred locale, falling back to
+// the default one.
+func (s *EmailService) send(ctx context.Context, identity *entity.Identity, template string, build func(*i18n.Localizer) emailData) {
+	s.sendTo(ctx, identity, identity.Email, template, build)
+}
+
+// sendTo renders the email in the identity's language and sends it to an
+// address that may not be the identity's email yet.
+func (s *EmailService) sendTo(ctx context.Context, identity *entity.Identity, to, template string, build func(*i18n.Localizer) emailData) {
+	locale := s.catalog.Match(identity.Profile.Locale)
+	data := build(s.catalog.Localizer(locale))
+	data.Locale = locale
+
+	subject, text, html, err := s.templates.Render(template, locale, data)
+	if err != nil {
+		utils.Errorf("Failed to render email",
+			utils.String("template", template),
+			utils.ErrorField(err.Error()),
+		)
+		return
+	}
+
+	err = s.mailer.Send(ctx, &mail.Message{
+		From:    s.cfg.Mail.From,
+		To:      to,
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	})
+	if err != nil {
+		utils.Errorf("Failed to queue email",
+			utils.String("template", template),
+			utils.String("identity_id", identity.ID.String()),
+			utils.ErrorField(err.Error()),
+		)
+	}
+}
+
+// tokenLink adds token to the query string of base.
+func tokenLink(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// formatDuration renders d for people, e.g. "15 minutes" or "24 hours".
+func formatDuration(l *i18n.Localizer, d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return l.T("duration.hours", map[string]int{"N": int(d / time.Hour)})
+	case d >= time.Minute:
+		return l.T("duration.minutes", map[string]int{"N": int(d / time.Minute)})
+	default:
+		return l.T("duration.seconds", map[string]int{"N": int(d / time.Second)})
+	}
+}
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	identifierCodeDigits      = 6
+	identifierCodeTTL         = 15 * time.Minute
+	identifierCodeCooldown    = time.Minute
+	identifierCodeMaxAttempts = 5
+)
+
+var (
+	ErrInvalidIdentifier         = i18n.NewError("errors.invalid_identifier", "invalid identifier")
+	ErrIdentifierTaken           = i18n.NewError("errors.identifier_taken", "identifier is already in use")
+	ErrIdentifierNotFound        = i18n.NewError("errors.identifier_not_found", "identifier not found")
+	ErrIdentifierTypeRestricted  = i18n.NewError("errors.identifier_type_restricted", "this identifier type can only be added by staff")
+	ErrIdentifierNotVerifiable   = i18n.NewError("errors.identifier_not_verifiable", "this identifier can only be verified by staff")
+	ErrIdentifierAlreadyVerified = i18n.NewError("errors.identifier_already_verified", "identifier is already verified")
+	ErrIdentifierNotVerified     = i18n.NewError("errors.identifier_not_verified", "identifier must be verified first")
+	ErrIdentifierCodeThrottled   = i18n.NewError("errors.identifier_code_throttled", "a verification code was sent recently, please try again later")
+	ErrInvalidIdentifierCode     = i18n.NewError("errors.invalid_identifier_code", "invalid or expired verification code")
+	ErrPrimaryEmailRemoval       = i18n.NewError("errors.primary_email_removal", "the primary email cannot be removed")
+)
+
+var (
+	usernamePattern     = regexp.MustCompile(`^[a-z][a-z0-9._-]{2,31}$`)
+	memberNumberPattern = regexp.MustCompile(`^[A-Z0-9]{1,32}$`)
+	// Card UIDs are 4, 7 or 10 bytes for ISO 14443 cards; other readers
+	// report up to 10 bytes as well
+	cardUIDPattern = regexp.MustCompile(`^(?:[0-9A-F]{2}){4,10}$`)
+)
+
+// selfServiceIdentifierTypes are the types users may add themselves. Member
+// numbers and cards are handed out at the front desk, so staff add those.
+var selfServiceIdentifierTypes = map[entity.IdentifierType]bool{
+	entity.IdentifierTypeEmail:    true,
+	entity.IdentifierTypePhone:    true,
+	entity.IdentifierTypeUsername: true,
+}
+
+// IdentifierService manages the emails, phone numbers, usernames, member
+// numbers and card UIDs an identity can sign in with.
+type IdentifierService struct {
+	identityRepo   repository.IdentityRepository
+	identifierRepo repository.IdentifierRepository
+	email          *EmailService
+	tokenHasher    *utils.TokenHasher
+	cfg            *config.Config
+}
+
+func NewIdentifierService(
+	identityRepo repository.IdentityRepository,
+	identifierRepo repository.IdentifierRepository,
+	email *EmailService,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
+) *IdentifierService {
+	return &IdentifierService{
+		identityRepo:   identityRepo,
+		identifierRepo: identifierRepo,
+		email:          email,
+		tokenHasher:    tokenHasher,
+		cfg:            cfg,
+	}
+}
+
+type IdentifierResponse struct {
+	ID         uuid.UUID             `json:"id"`
+	Type       entity.IdentifierType `json:"type"`
+	Value      string                `json:"value"`
+	Verified   bool                  `json:"verified"`
+	Primary    bool                  `json:"primary"`
+	VerifiedAt *time.Time            `json:"verified_at,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+}
+
+func toIdentifierResponse(identifier *entity.Identifier) *IdentifierResponse {
+	return &IdentifierResponse{
+		ID:         identifier.ID,
+		Type:       identifier.Type,
+		Value:      identifier.Value,
+		Verified:   identifier.Verified,
+		Primary:    identifier.Primary,
+		VerifiedAt: identifier.VerifiedAt,
+		CreatedAt:  identifier.CreatedAt,
+	}
+}
+
+type AddIdentifierRequest struct {
+	Type  entity.IdentifierType
+	Value string
+}
+
+type IdentifierMessageResponse struct {
+	Message string `json:"message"`
+}
+
+func (s *IdentifierService) List(ctx context.Context, userID uuid.UUID) ([]*IdentifierResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers, err := s.identifierRepo.ListByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*IdentifierResponse, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		resp = append(resp, toIdentifierResponse(identifier))
+	}
+	return resp, nil
+}
+
+// Add attaches an identifier the user chose. Usernames need no proof and are
+// verified right away; an email gets a verification code; phone numbers
+// stay unverified until staff confirm them.
+func (s *IdentifierService) Add(ctx context.Context, userID uuid.UUID, req AddIdentifierRequest) (*IdentifierResponse, error) {
+	if !selfServiceIdentifierTypes[req.Type] {
+		return nil, ErrIdentifierTypeRestricted
+	}
+
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identifier, err := s.add(ctx, identity, req, req.Type == entity.IdentifierTypeUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	if identifier.Type == entity.IdentifierTypeEmail {
+		if err := s.sendCode(ctx, identity, identifier); err != nil {
+			utils.Errorf("Failed to send identifier verification code", utils.ErrorField(err.Error()))
+		}
+	}
+
+	return toIdentifierResponse(identifier), nil
+}
+
+// AddVerified attaches an identifier on behalf of staff, who have checked it
+// in person, so it can be used to sign in straight away.
+func (s *IdentifierService) AddVerified(ctx context.Context, userID uuid.UUID, req AddIdentifierRequest) (*IdentifierResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identifier, err := s.add(ctx, identity, req, true)
+	if err != nil {
+		return nil, err
+	}
+	return toIdentifierResponse(identifier), nil
+}
+
+// Remove detaches an identifier. The primary email stays, since it is where
+// password resets and notices are sent.
+func (s *IdentifierService) Remove(ctx context.Context, userID, id uuid.UUID) error {
+	identity, identifier, err := s.get(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if identifier.Primary && identifier.Type == entity.IdentifierTypeEmail {
+		return ErrPrimaryEmailRemoval
+	}
+
+	if err := s.identifierRepo.Delete(ctx, identifier.ID, identity.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrIdentifierNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// SendVerificationCode emails a new code to an unverified email identifier.
+// Other types have no channel to send a code over and are verified by staff.
+func (s *IdentifierService) SendVerificationCode(ctx context.Context, userID, id uuid.UUID) (*IdentifierMessageResponse, error) {
+	identity, identifier, err := s.get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if identifier.Verified {
+		return nil, ErrIdentifierAlreadyVerified
+	}
+	if identifier.Type != entity.IdentifierTypeEmail {
+		return nil, ErrIdentifierNotVerifiable
+	}
+
+	if err := s.sendCode(ctx, identity, identifier); err != nil {
+		return nil, err
+	}
+
+	return &IdentifierMessageResponse{
+		Message: i18n.FromContext(ctx).T("identifier.code_sent"),
+	}, nil
+}
+
+// Verify checks the code sent for an identifier. Each wrong code uses up one
+// of the code's attempts.
+func (s *IdentifierService) Verify(ctx context.Context, userID, id uuid.UUID, code string) (*IdentifierResponse, error) {
+	_, identifier, err := s.get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if identifier.Verified {
+		return nil, ErrIdentifierAlreadyVerified
+	}
+	if !identifier.HasPendingVerification() || identifier.VerificationAttempts >= identifierCodeMaxAttempts {
+		return nil, ErrInvalidIdentifierCode
+	}
+
+	if !s.codeMatches(identifier, code) {
+		if err := s.identifierRepo.IncrementVerificationAttempts(ctx, identifier.ID); err != nil {
+			utils.Errorf("Failed to count identifier verification attempt", utils.ErrorField(err.Error()))
+		}
+		return nil, ErrInvalidIdentifierCode
+	}
+
+	return s.markVerified(ctx, identifier)
+}
+
+// MarkVerified verifies an identifier on behalf of staff.
+func (s *IdentifierService) MarkVerified(ctx context.Context, userID, id uuid.UUID) (*IdentifierResponse, error) {
+	_, identifier, err := s.get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if identifier.Verified {
+		return nil, ErrIdentifierAlreadyVerified
+	}
+	return s.markVerified(ctx, identifier)
+}
+
+// SetPrimary makes a verified identifier the primary one of its type. A new
+// primary email becomes the identity's email.
+func (s *IdentifierService) SetPrimary(ctx context.Context, userID, id uuid.UUID) (*IdentifierResponse, error) {
+	_, identifier, err := s.get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if identifier.Primary {
+		return toIdentifierResponse(identifier), nil
+	}
+	if !identifier.Verified {
+		return nil, ErrIdentifierNotVerified
+	}
+
+	if err := s.identifierRepo.SetPrimary(ctx, identifier.ID); err != nil {
+		return nil, err
+	}
+	identifier.Primary = true
+
+	return toIdentifierResponse(identifier), nil
+}
+
+// Resolve finds the identifier a user signs in with. When identifierType is
+// empty the type is guessed: values with an @ are emails and values starting
+// with + are phone numbers; anything else is tried as a username, then a
+// member number, then a card UID. Identifiers that can't be used to sign in
+// are treated as unknown, and gorm.ErrRecordNotFound is returned when
+// nothing matches.
+func (s *IdentifierService) Resolve(ctx context.Context, value string, identifierType entity.IdentifierType) (*entity.Identifier, error) {
+	types := []entity.IdentifierType{identifierType}
+	if identifierType == "" {
+		types = guessIdentifierTypes(value)
+	}
+
+	for _, t := range types {
+		normalized, err := normalizeIdentifier(t, value)
+		if err != nil {
+			continue
+		}
+
+		identifier, err := s.identifierRepo.GetByValue(ctx, t, normalized)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if identifier.CanSignIn() {
+			return identifier, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// isTaken reports whether any identity already holds the value.
+func (s *IdentifierService) isTaken(ctx context.Context, identifierType entity.IdentifierType, value string) (bool, error) {
+	_, err := s.identifierRepo.GetByValue(ctx, identifierType, value)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *IdentifierService) add(ctx context.Context, identity *entity.Identity, req AddIdentifierRequest, verified bool) (*entity.Identifier, error) {
+	value, err := normalizeIdentifier(req.Type, req.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := s.isTaken(ctx, req.Type, value)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrIdentifierTaken
+	}
+
+	existing, err := s.identifierRepo.ListByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+	hasPrimary := false
+	for _, other := range existing {
+		if other.Type == req.Type && other.Primary {
+			hasPrimary = true
+		}
+	}
+
+	now := time.Now()
+	identifier := &entity.Identifier{
+		ID:         uuid.New(),
+		IdentityID: identity.ID,
+		Type:       req.Type,
+		Value:      value,
+		Verified:   verified,
+		// The first verified identifier of a type becomes its primary; an
+		// email only becomes primary when asked, as it replaces the login email
+		Primary:   verified && !hasPrimary && req.Type != entity.IdentifierTypeEmail,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if verified {
+		identifier.VerifiedAt = &now
+	}
+
+	return s.identifierRepo.Create(ctx, identifier)
+}
+
+func (s *IdentifierService) get(ctx context.Context, userID, id uuid.UUID) (*entity.Identity, *entity.Identifier, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identifier, err := s.identifierRepo.GetByID(ctx, id, identity.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrIdentifierNotFound
+		}
+		return nil, nil, err
+	}
+	return identity, identifier, nil
+}
+
+func (s *IdentifierService) sendCode(ctx context.Context, identity *entity.Identity, identifier *entity.Identifier) error {
+	if identifier.HasPendingVerification() &&
+		time.Until(*identifier.VerificationExpiresAt) > identifierCodeTTL-identifierCodeCooldown {
+		return ErrIdentifierCodeThrottled
+	}
+
+	code, err := generateNumericCode(identifierCodeDigits)
+	if err != nil {
+		return err
+	}
+
+	codeHash := s.tokenHasher.Hash(codeHashInput(identifier.ID, code))
+	if err := s.identifierRepo.SetVerificationCode(ctx, identifier.ID, codeHash, time.Now().Add(identifierCodeTTL)); err != nil {
+		return err
+	}
+
+	s.email.SendIdentifierCode(ctx, identity, identifier.Value, code)
+	return nil
+}
+
+func (s *IdentifierService) codeMatches(identifier *entity.Identifier, code string) bool {
+	for _, candidate := range s.tokenHasher.Candidates(codeHashInput(identifier.ID, code)) {
+		if hmac.Equal([]byte(candidate), []byte(identifier.VerificationHash)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *IdentifierService) markVerified(ctx context.Context, identifier *entity.Identifier) (*IdentifierResponse, error) {
+	if err := s.identifierRepo.MarkVerified(ctx, identifier.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	identifier.Verified = true
+	identifier.VerifiedAt = &now
+	return toIdentifierResponse(identifier), nil
+}
+
+// normalizeIdentifier validates value for its type and returns the form it
+// is stored and looked up in.
+func normalizeIdentifier(identifierType entity.IdentifierType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch identifierType {
+	case entity.IdentifierTypeEmail:
+		value = strings.ToLower(value)
+		addr, err := netmail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return "", fmt.Errorf("%w: not a valid email address", ErrInvalidIdentifier)
+		}
+	case entity.IdentifierTypePhone:
+		value = stripSeparators(value, " -().")
+		if !e164Pattern.MatchString(value) {
+			return "", fmt.Errorf("%w: phone must be in E.164 format, e.g. +5511912345678", ErrInvalidIdentifier)
+		}
+	case entity.IdentifierTypeUsername:
+		value = strings.ToLower(value)
+		if !usernamePattern.MatchString(value) {
+			return "", fmt.Errorf("%w: username must be 3 to 32 letters, digits, '.', '_' or '-', starting with a letter", ErrInvalidIdentifier)
+		}
+	case entity.IdentifierTypeMemberNumber:
+		value = strings.ToUpper(stripSeparators(value, " -"))
+		if !memberNumberPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: member number must be up to 32 letters and digits", ErrInvalidIdentifier)
+		}
+	case entity.IdentifierTypeCardUID:
+		value = strings.ToUpper(stripSeparators(value, " :-"))
+		if !cardUIDPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: card UID must be 4 to 10 bytes in hex", ErrInvalidIdentifier)
+		}
+	default:
+		return "", fmt.Errorf("%w: unknown type %q", ErrInvalidIdentifier, identifierType)
+	}
+
+	return value, nil
+}
+
+func guessIdentifierTypes(value string) []entity.IdentifierType {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.Contains(value, "@"):
+		return []entity.IdentifierType{entity.IdentifierTypeEmail}
+	case strings.HasPrefix(value, "+"):
+		return []entity.IdentifierType{entity.IdentifierTypePhone}
+	default:
+		return []entity.IdentifierType{
+			entity.IdentifierTypeUsername,
+			entity.IdentifierTypeMemberNumber,
+			entity.IdentifierTypeCardUID,
+		}
+	}
+}
+
+func stripSeparators(value, separators string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(separators, r) {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+const (
+	defaultIdentityPageSize  = 50
+	maxIdentityPageSize      = 200
+	defaultLoginAttemptLimit = 20
+	maxLoginAttemptLimit     = 100
+)
+
+var (
+	ErrInvalidIdentityStatus = i18n.NewError("errors.invalid_identity_status", "status must be active, locked or suspended")
+	ErrInvalidStatusExpiry   = i18n.NewError("errors.invalid_status_expiry", "expires_at must be in the future")
+	ErrInvalidCursor         = i18n.NewError("errors.invalid_cursor", "invalid cursor")
+)
+
+// IdentityAdminService lets staff look up identities and manage their status
+// and sessions.
+type IdentityAdminService struct {
+	identityRepo   repository.IdentityRepository
+	identifierRepo repository.IdentifierRepository
+	tokenRepo      repository.RefreshTokenRepository
+	attemptRepo    repository.LoginAttemptRepository
+	transactor     repository.Transactor
+	passwords      *PasswordService
+	denylist       *cache.TokenDenylist
+	events         *messaging.Outbox
+	cfg            *config.Config
+}
+
+func NewIdentityAdminService(
+	identityRepo repository.IdentityRepository,
+	identifierRepo repository.IdentifierRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	transactor repository.Transactor,
+	passwords *PasswordService,
+	denylist *cache.TokenDenylist,
+	events *messaging.Outbox,
+	cfg *config.Config,
+) *IdentityAdminService {
+	return &IdentityAdminService{
+		identityRepo:   identityRepo,
+		identifierRepo: identifierRepo,
+		tokenRepo:      tokenRepo,
+		attemptRepo:    attemptRepo,
+		transactor:     transactor,
+		passwords:      passwords,
+		denylist:       denylist,
+		events:         events,
+		cfg:            cfg,
+	}
+}
+
+// AdminIdentityResponse is an identity as shown to staff. StatusExpiresAt is
+// only set while a lock or suspension with an end date is in force.
+type AdminIdentityResponse struct {
+	UserID                uuid.UUID             `json:"user_id"`
+	Email                 string                `json:"email"`
+	EmailVerified         bool                  `json:"email_verified"`
+	Status                entity.IdentityStatus `json:"status"`
+	StatusReason          string                `json:"status_reason,omitempty"`
+	StatusExpiresAt       *time.Time            `json:"status_expires_at,omitempty"`
+	LockoutCount          int                   `json:"lockout_count"`
+	MFARequired           bool                  `json:"mfa_required"`
+	PasswordlessEnabled   bool                  `json:"passwordless_enabled"`
+	PasswordResetRequired bool                  `json:"password_reset_required"`
+	CreatedAt             time.Time             `json:"created_at"`
+	UpdatedAt             time.Time             `json:"updated_at"`
+}
+
+func toAdminIdentityResponse(identity *entity.Identity) *AdminIdentityResponse {
+	resp := &AdminIdentityResponse{
+		UserID:                identity.UserID,
+		Email:                 identity.Email,
+		EmailVerified:         identity.EmailVerified,
+		Status:                identity.Status,
+		StatusReason:          identity.StatusReason,
+		LockoutCount:          identity.LockoutCount,
+		MFARequired:           identity.MFARequired,
+		PasswordlessEnabled:   identity.PasswordlessEnabled,
+		PasswordResetRequired: identity.PasswordResetRequired,
+		CreatedAt:             identity.CreatedAt,
+		UpdatedAt:             identity.UpdatedAt,
+	}
+	if (identity.IsLocked() || identity.IsSuspended()) && identity.LockedUntil != nil {
+		resp.StatusExpiresAt = identity.LockedUntil
+	}
+	return resp
+}
+
+type ListIdentitiesRequest struct {
+	Status        entity.IdentityStatus
+	Email         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	Limit  int
+}
+
+type ListIdentitiesResponse struct {
+	Identities []*AdminIdentityResponse `json:"identities"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// List returns a page of identities, newest first.
+func (s *IdentityAdminService) List(ctx context.Context, req ListIdentitiesRequest) (*ListIdentitiesResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultIdentityPageSize
+	}
+	if limit > maxIdentityPageSize {
+		limit = maxIdentityPageSize
+	}
+
+	filter := repository.IdentityFilter{
+		Status:        req.Status,
+		Email:         strings.ToLower(strings.TrimSpace(req.Email)),
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		// One more than asked for tells whether there is a next page
+		Limit: limit + 1,
+	}
+	if req.Cursor != "" {
+		after, afterID, err := decodeIdentityCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = &after
+		filter.AfterID = afterID
+	}
+
+	identities, err := s.identityRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListIdentitiesResponse{Identities: make([]*AdminIdentityResponse, 0, limit)}
+	if len(identities) > limit {
+		identities = identities[:limit]
+		last := identities[limit-1]
+		resp.NextCursor = encodeIdentityCursor(last.CreatedAt, last.ID)
+	}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, toAdminIdentityResponse(identity))
+	}
+	return resp, nil
+}
+
+// AdminIdentityDetailResponse adds the profile, identifiers and number of
+// signed in sessions to AdminIdentityResponse.
+type AdminIdentityDetailResponse struct {
+	*AdminIdentityResponse
+	Profile        *ProfileResponse      `json:"profile"`
+	Identifiers    []*IdentifierResponse `json:"identifiers"`
+	ActiveSessions int                   `json:"active_sessions"`
+}
+
+func (s *IdentityAdminService) Get(ctx context.Context, userID uuid.UUID) (*AdminIdentityDetailResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers, err := s.identifierRepo.ListByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each session is a refresh token family
+	tokens, err := s.tokenRepo.GetActiveByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+	families := make(map[uuid.UUID]struct{}, len(tokens))
+	for _, token := range tokens {
+		families[token.FamilyID] = struct{}{}
+	}
+
+	resp := &AdminIdentityDetailResponse{
+		AdminIdentityResponse: toAdminIdentityResponse(identity),
+		Profile:               newProfileResponse(identity.Profile),
+		Identifiers:           make([]*IdentifierResponse, 0, len(identifiers)),
+		ActiveSessions:        len(families),
+	}
+	for _, identifier := range identifiers {
+		resp.Identifiers = append(resp.Identifiers, toIdentifierResponse(identifier))
+	}
+	return resp, nil
+}
+
+type SetIdentityStatusRequest struct {
+	Status entity.IdentityStatus
+	Reason string
+	// ExpiresAt ends a lock or suspension automatically; nil keeps it until
+	// it is lifted.
+	ExpiresAt *time.Time
+}
+
+// SetStatus locks, suspends or reactivates an identity. Locking or
+// suspending also signs it out everywhere. Reactivating an identity whose
+// email isn't verified leaves it unverified.
+func (s *IdentityAdminService) SetStatus(ctx context.Context, userID uuid.UUID, req SetIdentityStatusRequest) (*AdminIdentityResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := req.Status
+	reason := strings.TrimSpace(req.Reason)
+	expiresAt := req.ExpiresAt
+	switch status {
+	case entity.StatusLocked, entity.StatusSuspended:
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil, ErrInvalidStatusExpiry
+		}
+	case entity.StatusActive:
+		status = unlockedStatus(identity)
+		reason = ""
+		// Ending a lock now discards the failures that led to it
+		if identity.IsLocked() {
+			now := time.Now()
+			expiresAt = &now
+		} else {
+			expiresAt = identity.LockedUntil
+		}
+	default:
+		return nil, ErrInvalidIdentityStatus
+	}
+
+	previous := identity.Status
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdateAdminStatus(ctx, identity.ID, status, expiresAt, reason); err != nil {
+			return err
+		}
+
+		if status == entity.StatusLocked || status == entity.StatusSuspended {
+			if err := s.revokeSessions(ctx, identity); err != nil {
+				return err
+			}
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		event := &messaging.StatusChanged{
+			IdentityRef: messaging.RefFor(identity),
+			From:        string(previous),
+			To:          string(status),
+			Trigger:     "admin",
+			Reason:      reason,
+		}
+		if status != entity.StatusActive {
+			event.ExpiresAt = expiresAt
+		}
+		return s.events.Publish(ctx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	identity.Status = status
+	identity.StatusReason = reason
+	identity.LockedUntil = expiresAt
+
+	utils.Info("Identity status changed by administrator",
+		utils.String("identity_id", identity.ID.String()),
+		utils.String("from", string(previous)),
+		utils.String("to", string(status)),
+	)
+
+	return toAdminIdentityResponse(identity), nil
+}
+
+// RequirePasswordReset blocks password logins until the identity sets a new
+// password through the reset link emailed to it, and signs it out
+// everywhere.
+func (s *IdentityAdminService) RequirePasswordReset(ctx context.Context, userID uuid.UUID, reason string) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdatePasswordResetRequired(ctx, identity.ID, true); err != nil {
+			return err
+		}
+		if err := s.revokeSessions(ctx, identity); err != nil {
+			return err
+		}
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.PasswordResetRequired{
+			IdentityRef: messaging.RefFor(identity),
+			Reason:      strings.TrimSpace(reason),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// The link is only sent once the reset is required
+	return s.passwords.SendReset(ctx, identity)
+}
+
+// RevokeSessions signs the identity out of every session, including the
+// access tokens already issued.
+func (s *IdentityAdminService) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.revokeSessions(ctx, identity); err != nil {
+			return err
+		}
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityLoggedOut{
+			IdentityRef: messaging.RefFor(identity),
+			Scope:       "all",
+			Trigger:     "admin",
+		})
+	})
+}
+
+// Delete removes the identity and everything that belongs to it. Login
+// attempts are kept without the identity.
+func (s *IdentityAdminService) Delete(ctx context.Context, userID uuid.UUID) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.Delete(ctx, identity.ID); err != nil {
+			return err
+		}
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityDeleted{
+			IdentityRef: messaging.RefFor(identity),
+			Trigger:     "admin",
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// Refresh tokens go with the identity, access tokens have to be denied
+	s.revokeAccessTokens(ctx, identity)
+
+	utils.Info("Identity deleted by administrator", utils.String("identity_id", identity.ID.String()))
+	return nil
+}
+
+type LoginAttemptResponse struct {
+	Identifier  string    `json:"identifier"`
+	IPAddress   string    `json:"ip_address"`
+	Success     bool      `json:"success"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// LoginAttempts returns the most recent password login attempts of the
+// identity, newest first.
+func (s *IdentityAdminService) LoginAttempts(ctx context.Context, userID uuid.UUID, limit int) ([]*LoginAttemptResponse, error) {
+	if limit <= 0 {
+		limit = defaultLoginAttemptLimit
+	}
+	if limit > maxLoginAttemptLimit {
+		limit = maxLoginAttemptLimit
+	}
+
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := s.attemptRepo.GetRecentByIdentityID(ctx, identity.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*LoginAttemptResponse, 0, len(attempts))
+	for _, attempt := range attempts {
+		resp = append(resp, &LoginAttemptResponse{
+			Identifier:  attempt.Email,
+			IPAddress:   attempt.IPAddress,
+			Success:     attempt.Success,
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (s *IdentityAdminService) revokeSessions(ctx context.Context, identity *entity.Identity) error {
+	if err := s.tokenRepo.RevokeAllByIdentityID(ctx, identity.ID); err != nil {
+		return err
+	}
+	s.revokeAccessTokens(ctx, identity)
+	return nil
+}
+
+// revokeAccessTokens denies the access tokens issued so far. A denylist
+// outage is only logged; the tokens then stay valid until they expire.
+func (s *IdentityAdminService) revokeAccessTokens(ctx context.Context, identity *entity.Identity) {
+	if err := s.denylist.RevokeUser(ctx, identity.UserID.String(), s.cfg.JWT.ExpirationTime); err != nil {
+		utils.Errorf("Failed to denylist access tokens", utils.String("identity_id", identity.ID.String()), utils.ErrorField(err.Error()))
+	}
+}
+
+// encodeIdentityCursor makes the opaque cursor that resumes a listing after
+// the identity created at createdAt with the given id.
+func encodeIdentityCursor(createdAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "," + id.String()))
+}
+
+func decodeIdentityCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return t, parsedID, nil
+}
@@ -5,27 +5,44 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/external"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/gym-api/ms-ga-identifier/pkg/webauthn"
 	"gorm.io/gorm"
 )
 
 type IdentityService struct {
-	identityRepo  repository.IdentityRepository
-	tokenRepo     repository.RefreshTokenRepository
-	attemptRepo   repository.LoginAttemptRepository
-	passwordRepo  repository.PasswordResetRepository
-	authClient    *external.AuthClient
-	kafkaProducer *messaging.KafkaProducer
-	jwtUtil       *utils.JWTUtil
-	cfg           *config.Config
+	identityRepo repository.IdentityRepository
+	tokenRepo    repository.RefreshTokenRepository
+	attemptRepo  repository.LoginAttemptRepository
+	passwordRepo repository.PasswordResetRepository
+	transactor   repository.Transactor
+	verification *VerificationService
+	lockout      *LockoutService
+	mfa          *MFAService
+	webAuthn     *WebAuthnService
+	passwordless *PasswordlessService
+	identifiers  *IdentifierService
+	email        *EmailService
+	authClient   *external.AuthClient
+	events       *messaging.Outbox
+	jwtUtil      *utils.JWTUtil
+	tokenHasher  *utils.TokenHasher
+	denylist     *cache.TokenDenylist
+	catalog      *i18n.Catalog
+	cfg          *config.Config
 }
 
 func NewIdentityService(
@@ -33,20 +50,42 @@ func NewIdentityService(
 	tokenRepo repository.RefreshTokenRepository,
 	attemptRepo repository.LoginAttemptRepository,
 	passwordRepo repository.PasswordResetRepository,
+	transactor repository.Transactor,
+	verification *VerificationService,
+	lockout *LockoutService,
+	mfa *MFAService,
+	webAuthn *WebAuthnService,
+	passwordless *PasswordlessService,
+	identifiers *IdentifierService,
+	email *EmailService,
 	authClient *external.AuthClient,
-	kafkaProducer *messaging.KafkaProducer,
+	events *messaging.Outbox,
 	jwtUtil *utils.JWTUtil,
+	tokenHasher *utils.TokenHasher,
+	denylist *cache.TokenDenylist,
+	catalog *i18n.Catalog,
 	cfg *config.Config,
 ) *IdentityService {
 	return &IdentityService{
-		identityRepo:  identityRepo,
-		tokenRepo:     tokenRepo,
-		attemptRepo:   attemptRepo,
-		passwordRepo:  passwordRepo,
-		authClient:    authClient,
-		kafkaProducer: kafkaProducer,
-		jwtUtil:       jwtUtil,
-		cfg:           cfg,
+		identityRepo: identityRepo,
+		tokenRepo:    tokenRepo,
+		attemptRepo:  attemptRepo,
+		passwordRepo: passwordRepo,
+		transactor:   transactor,
+		verification: verification,
+		lockout:      lockout,
+		mfa:          mfa,
+		webAuthn:     webAuthn,
+		passwordless: passwordless,
+		identifiers:  identifiers,
+		email:        email,
+		authClient:   authClient,
+		events:       events,
+		jwtUtil:      jwtUtil,
+		tokenHasher:  tokenHasher,
+		denylist:     denylist,
+		catalog:      catalog,
+		cfg:          cfg,
 	}
 }
 
@@ -55,22 +94,51 @@ type RegisterRequest struct {
 	Password  string
 	FirstName string
 	LastName  string
+	// Locale is the preferred language for emails. When empty, the locale
+	// negotiated for the request is stored.
+	Locale string
 }
 
 type RegisterResponse struct {
 	UserID  uuid.UUID `json:"user_id"`
-	Email   string   `json:"email"`
-	Message string   `json:"message"`
+	Email   string    `json:"email"`
+	Message string    `json:"message"`
 }
 
 func (s *IdentityService) Register(ctx context.Context, req RegisterRequest) (*RegisterResponse, error) {
-	// Check if email already exists
-	existing, err := s.identityRepo.GetByEmail(ctx, req.Email)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	email, err := normalizeIdentifier(entity.IdentifierTypeEmail, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if email already exists, including as another identity's
+	// secondary email
+	taken, err := s.identifiers.isTaken(ctx, entity.IdentifierTypeEmail, email)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailRegistered
+	}
+
+	// Enforce password policy
+	if err := validatePassword(s.cfg.Password, req.Password); err != nil {
 		return nil, err
 	}
-	if existing != nil {
-		return nil, errors.New("email already registered")
+
+	locale := i18n.FromContext(ctx).Locale()
+	if req.Locale != "" {
+		if locale, err = s.catalog.Supported(req.Locale); err != nil {
+			return nil, err
+		}
+	}
+	profile, err := s.normalizeProfile(entity.Profile{
+		FirstName: strings.TrimSpace(req.FirstName),
+		LastName:  strings.TrimSpace(req.LastName),
+		Locale:    locale,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate user ID
@@ -82,111 +150,480 @@ func (s *IdentityService) Register(ctx context.Context, req RegisterRequest) (*R
 		return nil, err
 	}
 
-	// Create identity
+	// Create identity, with its email as the primary identifier
 	identity := &entity.Identity{
 		ID:            uuid.New(),
 		UserID:        userID,
-		Email:         req.Email,
+		Email:         email,
 		PasswordHash:  passwordHash,
 		Status:        entity.StatusUnverified,
 		EmailVerified: false,
+		Profile:       profile,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
+	identifier := &entity.Identifier{
+		ID:         uuid.New(),
+		IdentityID: identity.ID,
+		Type:       entity.IdentifierTypeEmail,
+		Value:      email,
+		Primary:    true,
+		CreatedAt:  identity.CreatedAt,
+		UpdatedAt:  identity.UpdatedAt,
+	}
 
-	_, err = s.identityRepo.Create(ctx, identity)
+	// The registered event is written with the identity, so it can't be lost
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		created, err := s.identityRepo.Create(ctx, identity, identifier)
+		if err != nil {
+			return err
+		}
+		identity = created
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityRegistered{
+			IdentityRef: messaging.RefFor(identity),
+			FirstName:   profile.FirstName,
+			LastName:    profile.LastName,
+			Locale:      profile.Locale,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Publish event
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.PublishIdentityRegistered(ctx, userID.String(), req.Email)
+	// Issue email verification token
+	if err := s.verification.IssueToken(ctx, identity); err != nil {
+		utils.Errorf("Failed to issue email verification token", utils.ErrorField(err.Error()))
 	}
 
 	return &RegisterResponse{
 		UserID:  userID,
-		Email:   req.Email,
-		Message: "Registration successful. Please verify your email.",
+		Email:   email,
+		Message: i18n.FromContext(ctx).T("identity.registered"),
 	}, nil
 }
 
+type LocaleResponse struct {
+	Locale string `json:"locale"`
+}
+
+// UpdateLocale stores the user's preferred language for emails. locale may be
+// a more specific variant of a supported one, e.g. "pt-BR" stores "pt".
+func (s *IdentityService) UpdateLocale(ctx context.Context, userID uuid.UUID, locale string) (*LocaleResponse, error) {
+	supported, err := s.catalog.Supported(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.identityRepo.UpdateLocale(ctx, identity.ID, supported); err != nil {
+		return nil, err
+	}
+
+	return &LocaleResponse{Locale: supported}, nil
+}
+
+var (
+	ErrEmailRegistered    = i18n.NewError("errors.email_registered", "email already registered")
+	ErrInvalidCredentials = i18n.NewError("errors.invalid_credentials", "invalid credentials")
+	// ErrPasswordResetRequired means an administrator forced a password
+	// reset; the identity has to use the link emailed to it.
+	ErrPasswordResetRequired = i18n.NewError("errors.password_reset_required", "password reset required")
+	// ErrPermissionsUnavailable means the auth service couldn't be asked for
+	// the identity's roles, so no token is issued.
+	ErrPermissionsUnavailable = i18n.NewError("errors.permissions_unavailable", "roles and permissions are temporarily unavailable, please try again later")
+)
+
 type LoginRequest struct {
-	Email      string
-	Password   string
-	DeviceInfo string
-	IPAddress  string
+	// Identifier is any identifier the identity signs in with. When
+	// IdentifierType is empty, the type is guessed from the value.
+	Identifier     string
+	IdentifierType entity.IdentifierType
+	Password       string
+	DeviceInfo     string
+	IPAddress      string
 }
 
+// LoginResponse carries either the session tokens or, when a second factor is
+// needed, an MFA token to complete the login with.
 type LoginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int    `json:"expires_in"`
+	AccessToken           string   `json:"access_token,omitempty"`
+	RefreshToken          string   `json:"refresh_token,omitempty"`
+	TokenType             string   `json:"token_type,omitempty"`
+	ExpiresIn             int      `json:"expires_in,omitempty"`
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`
+	// SessionID is the refresh token family, carried as the sid claim.
+	SessionID uuid.UUID `json:"-"`
 }
 
 func (s *IdentityService) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
-	// Find identity by email
-	identity, err := s.identityRepo.GetByEmail(ctx, req.Email)
+	identity, err := s.Authenticate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Identities with a second factor get a challenge instead of tokens
+	challenge, err := s.mfa.Challenge(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResponse{
+			MFARequired:           true,
+			MFAToken:              challenge.Token,
+			MFAEnrollmentRequired: challenge.EnrollmentRequired,
+		}, nil
+	}
+
+	return s.StartSession(ctx, identity, SessionRequest{
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  req.IPAddress,
+	})
+}
+
+// Authenticate checks an identifier and password and applies the lockout
+// policy, without issuing any tokens.
+func (s *IdentityService) Authenticate(ctx context.Context, req LoginRequest) (*entity.Identity, error) {
+	// Find identity by identifier
+	identifier, err := s.identifiers.Resolve(ctx, req.Identifier, req.IdentifierType)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid credentials")
+			return nil, s.rejectUnknownIdentifier(ctx, req)
 		}
 		return nil, err
 	}
 
+	identity, err := s.identityRepo.GetByID(ctx, identifier.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lift a temporary lock that has run out
+	identity, err = s.lockout.ReleaseExpired(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check identity status
-	if identity.Status == entity.StatusLocked || identity.Status == entity.StatusSuspended {
-		return nil, errors.New("account locked or suspended")
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
 	}
 
 	// Check password
 	if !utils.CheckPassword(req.Password, identity.PasswordHash) {
 		// Record failed attempt
-		s.recordLoginAttempt(ctx, identity, req.Email, req.IPAddress, false)
-		return nil, errors.New("invalid credentials")
+		s.recordLoginAttempt(ctx, &identity.ID, req.Identifier, req.IPAddress, false)
+		locked, err := s.lockout.RegisterFailure(ctx, identity)
+		if err != nil {
+			utils.Errorf("Failed to apply lockout policy", utils.ErrorField(err.Error()))
+		}
+		if locked {
+			return nil, ErrAccountLocked
+		}
+		return nil, ErrInvalidCredentials
 	}
 
 	// Record successful attempt
-	s.recordLoginAttempt(ctx, identity, req.Email, req.IPAddress, true)
+	s.recordLoginAttempt(ctx, &identity.ID, req.Identifier, req.IPAddress, true)
+	if err := s.lockout.RegisterSuccess(ctx, identity); err != nil {
+		utils.Errorf("Failed to reset lockout count", utils.ErrorField(err.Error()))
+	}
+
+	// The password is known to be right but may no longer be trusted
+	if identity.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	return identity, nil
+}
+
+type MFALoginRequest struct {
+	MFAToken     string
+	Code         string
+	RecoveryCode string
+	DeviceInfo   string
+	IPAddress    string
+}
+
+// LoginWithMFA completes a login that was answered with an MFA challenge.
+func (s *IdentityService) LoginWithMFA(ctx context.Context, req MFALoginRequest) (*LoginResponse, error) {
+	identity, recoveryCodes, err := s.CompleteMFA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.StartSession(ctx, identity, SessionRequest{
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  req.IPAddress,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
 
-	// Get roles and permissions from auth service
-	roles, permissions, err := s.authClient.ExtractRolesAndPermissions(identity.UserID)
+// CompleteMFA checks the second factor of a login challenge. Wrong codes count
+// towards the lockout threshold like wrong passwords. Recovery codes are
+// returned if the identity enrolled as part of this login.
+func (s *IdentityService) CompleteMFA(ctx context.Context, req MFALoginRequest) (*entity.Identity, []string, error) {
+	identity, recoveryCodes, err := s.mfa.CompleteChallenge(ctx, req.MFAToken, req.Code, req.RecoveryCode)
 	if err != nil {
-		utils.Errorf("Failed to get roles and permissions", utils.ErrorField(err.Error()))
+		if errors.Is(err, ErrInvalidMFACode) && identity != nil {
+			s.recordLoginAttempt(ctx, &identity.ID, identity.Email, req.IPAddress, false)
+			locked, lockErr := s.lockout.RegisterFailure(ctx, identity)
+			if lockErr != nil {
+				utils.Errorf("Failed to apply lockout policy", utils.ErrorField(lockErr.Error()))
+			}
+			if locked {
+				return nil, nil, ErrAccountLocked
+			}
+		}
+		return nil, nil, err
+	}
+
+	// The account may have been locked since the password step
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, nil, ErrAccountLocked
+	}
+
+	return identity, recoveryCodes, nil
+}
+
+type PasskeyLoginRequest struct {
+	Credential *webauthn.AssertionCredential
+	DeviceInfo string
+	IPAddress  string
+}
+
+// LoginWithPasskey completes a passkey login. A passkey with user verification
+// counts as two factors; without it the identity gets the same MFA challenge
+// as after a password.
+func (s *IdentityService) LoginWithPasskey(ctx context.Context, req PasskeyLoginRequest) (*LoginResponse, error) {
+	// Failed assertions don't count towards the lockout threshold: they can't
+	// be used to guess anything, only to lock the owner out.
+	identity, userVerified, err := s.webAuthn.FinishLogin(ctx, req.Credential)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate JWT
-	accessToken, err := s.jwtUtil.GenerateToken(identity.UserID.String(), identity.Email, roles, permissions)
+	// Lift a temporary lock that has run out
+	identity, err = s.lockout.ReleaseExpired(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
+	}
+
+	s.recordLoginAttempt(ctx, &identity.ID, identity.Email, req.IPAddress, true)
+	if err := s.lockout.RegisterSuccess(ctx, identity); err != nil {
+		utils.Errorf("Failed to reset lockout count", utils.ErrorField(err.Error()))
+	}
+
+	// A forced reset can't be sidestepped by not using the password
+	if identity.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	if !userVerified {
+		challenge, err := s.mfa.Challenge(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+		if challenge != nil {
+			return &LoginResponse{
+				MFARequired:           true,
+				MFAToken:              challenge.Token,
+				MFAEnrollmentRequired: challenge.EnrollmentRequired,
+			}, nil
+		}
+	}
+
+	return s.StartSession(ctx, identity, SessionRequest{
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  req.IPAddress,
+	})
+}
+
+// PasswordlessLoginRequest redeems either a login link Token or an Email and
+// Code pair.
+type PasswordlessLoginRequest struct {
+	Token      string
+	Email      string
+	Code       string
+	DeviceInfo string
+	IPAddress  string
+}
+
+// LoginWithPasswordless completes a login with an emailed link or code. Wrong
+// codes count towards the lockout threshold like wrong passwords, and
+// identities with a second factor still get an MFA challenge.
+func (s *IdentityService) LoginWithPasswordless(ctx context.Context, req PasswordlessLoginRequest) (*LoginResponse, error) {
+	var identity *entity.Identity
+	var err error
+	if req.Token != "" {
+		identity, err = s.passwordless.RedeemLink(ctx, req.Token)
+	} else {
+		identity, err = s.passwordless.RedeemCode(ctx, req.Email, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasswordlessToken) && identity != nil {
+			s.recordLoginAttempt(ctx, &identity.ID, identity.Email, req.IPAddress, false)
+			locked, lockErr := s.lockout.RegisterFailure(ctx, identity)
+			if lockErr != nil {
+				utils.Errorf("Failed to apply lockout policy", utils.ErrorField(lockErr.Error()))
+			}
+			if locked {
+				return nil, ErrAccountLocked
+			}
+		}
+		return nil, err
+	}
+
+	// Lift a temporary lock that has run out
+	identity, err = s.lockout.ReleaseExpired(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
+	}
+
+	s.recordLoginAttempt(ctx, &identity.ID, identity.Email, req.IPAddress, true)
+	if err := s.lockout.RegisterSuccess(ctx, identity); err != nil {
+		utils.Errorf("Failed to reset lockout count", utils.ErrorField(err.Error()))
+	}
+
+	// A forced reset can't be sidestepped by not using the password
+	if identity.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	challenge, err := s.mfa.Challenge(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResponse{
+			MFARequired:           true,
+			MFAToken:              challenge.Token,
+			MFAEnrollmentRequired: challenge.EnrollmentRequired,
+		}, nil
+	}
+
+	return s.StartSession(ctx, identity, SessionRequest{
+		DeviceInfo: req.DeviceInfo,
+		IPAddress:  req.IPAddress,
+	})
+}
+
+// SessionRequest describes a new session. ClientID and Scope are set when the
+// session is granted to an OAuth client.
+type SessionRequest struct {
+	DeviceInfo string
+	IPAddress  string
+	ClientID   string
+	Scope      string
+}
+
+// permissionsError turns an outage of the auth service into
+// ErrPermissionsUnavailable.
+func permissionsError(err error) error {
+	if errors.Is(err, external.ErrAuthServiceUnavailable) {
+		return ErrPermissionsUnavailable
+	}
+	return err
+}
+
+// sessionAccessToken issues the access token of a session. First-party
+// sessions get the user's roles and permissions from the auth service.
+// Sessions of an OAuth client get a token for the provider's userinfo
+// endpoint instead, with the client's id and scope but no roles, and the
+// email only with the email scope.
+func sessionAccessToken(
+	ctx context.Context,
+	authClient *external.AuthClient,
+	jwtUtil *utils.JWTUtil,
+	cfg *config.Config,
+	identity *entity.Identity,
+	sessionID, clientID, scope string,
+) (string, error) {
+	if clientID != "" {
+		email := ""
+		if slices.Contains(strings.Fields(scope), ScopeEmail) {
+			email = identity.Email
+		}
+		return jwtUtil.GenerateClientToken(identity.UserID.String(), email, sessionID, clientID, scope, cfg.OIDC.Issuer)
+	}
+
+	roles, permissions, err := authClient.ExtractRolesAndPermissions(ctx, identity.UserID)
+	if err != nil {
+		return "", permissionsError(err)
+	}
+	return jwtUtil.GenerateToken(identity.UserID.String(), identity.Email, sessionID, roles, permissions)
+}
+
+// StartSession issues an access token and a refresh token starting a new
+// refresh token family for an identity that has already been authenticated.
+// Sessions of an OAuth client get a client access token without the user's
+// roles.
+func (s *IdentityService) StartSession(ctx context.Context, identity *entity.Identity, req SessionRequest) (*LoginResponse, error) {
+	// A login starts a new session; its id is the refresh token family
+	sessionID := uuid.New()
+
+	accessToken, err := sessionAccessToken(ctx, s.authClient, s.jwtUtil, s.cfg, identity, sessionID.String(), req.ClientID, req.Scope)
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
 	refreshToken := generateToken()
-	refreshTokenHash := utils.HashToken(refreshToken)
+	refreshTokenHash := s.tokenHasher.Hash(refreshToken)
 
 	refreshTokenEntity := &entity.RefreshToken{
 		ID:         uuid.New(),
 		IdentityID: identity.ID,
+		FamilyID:   sessionID,
 		TokenHash:  refreshTokenHash,
+		ClientID:   req.ClientID,
+		Scope:      req.Scope,
 		DeviceInfo: req.DeviceInfo,
 		IPAddress:  req.IPAddress,
 		ExpiresAt:  time.Now().Add(s.cfg.JWT.RefreshDuration),
 		CreatedAt:  time.Now(),
 	}
 
-	_, err = s.tokenRepo.Create(ctx, refreshTokenEntity)
-	if err != nil {
-		return nil, err
-	}
+	// Checked before the new token exists, so it doesn't match itself
+	s.notifyIfNewDevice(ctx, identity, req)
+
+	// The login event is written with the session it reports
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.tokenRepo.Create(ctx, refreshTokenEntity); err != nil {
+			return err
+		}
 
-	// Publish login event
-	if s.kafkaProducer != nil {
-		s.kafkaProducer.PublishIdentityLoggedIn(ctx, identity.UserID.String(), identity.Email, map[string]interface{}{
-			"device_info": req.DeviceInfo,
-			"ip_address":  req.IPAddress,
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityLoggedIn{
+			IdentityRef: messaging.RefFor(identity),
+			DeviceInfo:  req.DeviceInfo,
+			IPAddress:   req.IPAddress,
+			ClientID:    req.ClientID,
 		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &LoginResponse{
@@ -194,29 +631,149 @@ func (s *IdentityService) Login(ctx context.Context, req LoginRequest) (*LoginRe
 		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
 		ExpiresIn:    int(s.cfg.JWT.ExpirationTime.Seconds()),
+		SessionID:    sessionID,
 	}, nil
 }
 
-func (s *IdentityService) Logout(ctx context.Context, userID uuid.UUID, refreshToken string) error {
-	// Revoke all refresh tokens
-	err := s.tokenRepo.RevokeAllByIdentityID(ctx, userID)
+// notifyIfNewDevice emails the owner when a session starts on a device that
+// none of their current refresh tokens were issued to. The very first session
+// isn't reported, since that's usually right after registration.
+func (s *IdentityService) notifyIfNewDevice(ctx context.Context, identity *entity.Identity, req SessionRequest) {
+	if req.DeviceInfo == "" && req.IPAddress == "" {
+		return
+	}
+
+	hasSessions, err := s.tokenRepo.HasSessions(ctx, identity.ID)
+	if err != nil {
+		utils.Errorf("Failed to look up sessions", utils.ErrorField(err.Error()))
+		return
+	}
+	if !hasSessions {
+		return
+	}
+
+	known, err := s.tokenRepo.HasDevice(ctx, identity.ID, req.DeviceInfo, req.IPAddress)
+	if err != nil {
+		utils.Errorf("Failed to look up known devices", utils.ErrorField(err.Error()))
+		return
+	}
+	if !known {
+		s.email.SendNewDevice(ctx, identity, req.DeviceInfo, req.IPAddress)
+	}
+}
+
+var ErrSessionNotFound = i18n.NewError("errors.session_not_found", "session not found")
+
+type LogoutRequest struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	// RefreshToken optionally names the session to end; when empty the
+	// session the access token was issued for is used.
+	RefreshToken         string
+	AccessTokenID        string
+	AccessTokenExpiresAt time.Time
+}
+
+// Logout ends a single session: its refresh token family is revoked and the
+// access token used for the request is denylisted.
+func (s *IdentityService) Logout(ctx context.Context, req LogoutRequest) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, req.UserID)
 	if err != nil {
 		return err
 	}
 
-	// Get identity for publishing event
-	identity, err := s.identityRepo.GetByUserID(ctx, userID)
-	if err == nil && s.kafkaProducer != nil {
-		s.kafkaProducer.PublishIdentityLoggedOut(ctx, userID.String(), identity.Email)
+	familyID := req.SessionID
+	if req.RefreshToken != "" {
+		token, err := s.tokenRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(req.RefreshToken)...)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		if token.IdentityID != identity.ID {
+			return ErrSessionNotFound
+		}
+		familyID = token.FamilyID
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if familyID != uuid.Nil {
+			if err := s.tokenRepo.RevokeFamily(ctx, familyID); err != nil {
+				return err
+			}
+		}
+		return s.publishLoggedOut(ctx, identity, "single")
+	})
+	if err != nil {
+		return err
+	}
+
+	s.denyAccessToken(ctx, req.AccessTokenID, req.AccessTokenExpiresAt)
+	return nil
+}
+
+// LogoutAll revokes every session of the user and denylists the access token
+// used for the request.
+func (s *IdentityService) LogoutAll(ctx context.Context, req LogoutRequest) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Revoke all refresh tokens
+		if err := s.tokenRepo.RevokeAllByIdentityID(ctx, identity.ID); err != nil {
+			return err
+		}
+		return s.publishLoggedOut(ctx, identity, "all")
+	})
+	if err != nil {
+		return err
 	}
 
+	s.denyAccessToken(ctx, req.AccessTokenID, req.AccessTokenExpiresAt)
 	return nil
 }
 
-func (s *IdentityService) recordLoginAttempt(ctx context.Context, identity *entity.Identity, email, ipAddress string, success bool) {
+func (s *IdentityService) denyAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) {
+	if err := s.denylist.Add(ctx, tokenID, expiresAt); err != nil {
+		utils.Errorf("Failed to denylist access token", utils.String("jti", tokenID), utils.ErrorField(err.Error()))
+	}
+}
+
+func (s *IdentityService) publishLoggedOut(ctx context.Context, identity *entity.Identity, scope string) error {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.Publish(ctx, &messaging.IdentityLoggedOut{
+		IdentityRef: messaging.RefFor(identity),
+		Scope:       scope,
+	})
+}
+
+// rejectUnknownIdentifier handles a login for an identifier with no identity
+// the same way as a wrong password: the attempt is recorded with a nil
+// identity, a bcrypt comparison keeps the timing similar, and the lockout
+// threshold is applied to the identifier.
+func (s *IdentityService) rejectUnknownIdentifier(ctx context.Context, req LoginRequest) error {
+	utils.CheckPassword(req.Password, dummyPasswordHash())
+	s.recordLoginAttempt(ctx, nil, req.Identifier, req.IPAddress, false)
+
+	throttled, err := s.lockout.IsIdentifierThrottled(ctx, req.Identifier)
+	if err != nil {
+		utils.Errorf("Failed to apply lockout policy", utils.ErrorField(err.Error()))
+	}
+	if throttled {
+		return ErrAccountLocked
+	}
+	return ErrInvalidCredentials
+}
+
+func (s *IdentityService) recordLoginAttempt(ctx context.Context, identityID *uuid.UUID, email, ipAddress string, success bool) {
 	attempt := &entity.LoginAttempt{
 		ID:          uuid.New(),
-		IdentityID:  &identity.ID,
+		IdentityID:  identityID,
 		Email:       email,
 		IPAddress:   ipAddress,
 		Success:     success,
@@ -225,6 +782,20 @@ func (s *IdentityService) recordLoginAttempt(ctx context.Context, identity *enti
 	s.attemptRepo.Create(ctx, attempt)
 }
 
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash returns a bcrypt hash of a random password, used to spend
+// the same time on unknown emails as on real password checks.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword(generateToken())
+	})
+	return dummyHash
+}
+
 func generateToken() string {
 	bytes := make([]byte, 32)
 	rand.Read(bytes)
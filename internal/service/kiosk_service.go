@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// ScopeCheckIn is the only scope of tokens issued at a kiosk.
+	ScopeCheckIn = "checkin"
+
+	kioskPINMinLength = 4
+	kioskPINMaxLength = 6
+)
+
+var (
+	ErrInvalidKioskCredentials = i18n.NewError("errors.invalid_kiosk_credentials", "invalid kiosk credentials")
+	ErrKioskDeviceNotFound     = i18n.NewError("errors.kiosk_not_found", "kiosk device not found")
+	ErrInvalidCardOrPIN        = i18n.NewError("errors.invalid_card_or_pin", "invalid card or PIN")
+	ErrCardLocked              = i18n.NewError("errors.card_locked", "card locked after too many wrong PINs, please see the front desk")
+	ErrInvalidPIN              = i18n.NewError("errors.invalid_pin", "PIN must be 4 to 6 digits and not a simple sequence")
+)
+
+// KioskService registers check-in kiosks and swaps a member's card UID and
+// PIN, entered at a kiosk, for a short-lived token that can only check in.
+type KioskService struct {
+	identityRepo   repository.IdentityRepository
+	identifierRepo repository.IdentifierRepository
+	deviceRepo     repository.KioskDeviceRepository
+	pinRepo        repository.KioskPINRepository
+	cardLockRepo   repository.KioskCardLockoutRepository
+	sessionRepo    repository.KioskSessionRepository
+	jwtUtil        *utils.JWTUtil
+	tokenHasher    *utils.TokenHasher
+	cfg            *config.Config
+}
+
+func NewKioskService(
+	identityRepo repository.IdentityRepository,
+	identifierRepo repository.IdentifierRepository,
+	deviceRepo repository.KioskDeviceRepository,
+	pinRepo repository.KioskPINRepository,
+	cardLockRepo repository.KioskCardLockoutRepository,
+	sessionRepo repository.KioskSessionRepository,
+	jwtUtil *utils.JWTUtil,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
+) *KioskService {
+	return &KioskService{
+		identityRepo:   identityRepo,
+		identifierRepo: identifierRepo,
+		deviceRepo:     deviceRepo,
+		pinRepo:        pinRepo,
+		cardLockRepo:   cardLockRepo,
+		sessionRepo:    sessionRepo,
+		jwtUtil:        jwtUtil,
+		tokenHasher:    tokenHasher,
+		cfg:            cfg,
+	}
+}
+
+type RegisterKioskRequest struct {
+	Name     string
+	Location string
+}
+
+type KioskDeviceResponse struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Location string    `json:"location"`
+	ClientID string    `json:"client_id"`
+	// ClientSecret is only ever returned on registration; it is stored hashed.
+	ClientSecret string     `json:"client_secret,omitempty"`
+	Active       bool       `json:"active"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func toKioskDeviceResponse(device *entity.KioskDevice) *KioskDeviceResponse {
+	return &KioskDeviceResponse{
+		ID:         device.ID,
+		Name:       device.Name,
+		Location:   device.Location,
+		ClientID:   device.ClientID,
+		Active:     device.Active,
+		LastSeenAt: device.LastSeenAt,
+		CreatedAt:  device.CreatedAt,
+	}
+}
+
+// RegisterDevice registers a kiosk and returns its client credentials.
+func (s *KioskService) RegisterDevice(ctx context.Context, req RegisterKioskRequest) (*KioskDeviceResponse, error) {
+	secret := generateToken()
+	device := &entity.KioskDevice{
+		ID:               uuid.New(),
+		Name:             strings.TrimSpace(req.Name),
+		Location:         strings.TrimSpace(req.Location),
+		ClientID:         "kiosk-" + uuid.New().String(),
+		ClientSecretHash: s.tokenHasher.Hash(secret),
+		Active:           true,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	device, err := s.deviceRepo.Create(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := toKioskDeviceResponse(device)
+	resp.ClientSecret = secret
+	return resp, nil
+}
+
+func (s *KioskService) ListDevices(ctx context.Context) ([]*KioskDeviceResponse, error) {
+	devices, err := s.deviceRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*KioskDeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		resp = append(resp, toKioskDeviceResponse(device))
+	}
+	return resp, nil
+}
+
+// DeactivateDevice stops a kiosk from issuing tokens, e.g. when it is lost or
+// retired. Tokens it already issued run out on their own.
+func (s *KioskService) DeactivateDevice(ctx context.Context, id uuid.UUID) error {
+	if err := s.deviceRepo.Deactivate(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrKioskDeviceNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthenticateDevice checks a kiosk's client credentials.
+func (s *KioskService) AuthenticateDevice(ctx context.Context, clientID, clientSecret string) (*entity.KioskDevice, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrInvalidKioskCredentials
+	}
+
+	device, err := s.deviceRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidKioskCredentials
+		}
+		return nil, err
+	}
+	if !device.Active {
+		return nil, ErrInvalidKioskCredentials
+	}
+
+	for _, candidate := range s.tokenHasher.Candidates(clientSecret) {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(device.ClientSecretHash)) == 1 {
+			return device, nil
+		}
+	}
+	return nil, ErrInvalidKioskCredentials
+}
+
+type KioskPINStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetPIN sets the member's kiosk PIN after checking their password, and lifts
+// any lock on their cards.
+func (s *KioskService) SetPIN(ctx context.Context, userID uuid.UUID, password, pin string) (*KioskPINStatusResponse, error) {
+	if err := validatePIN(pin); err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(password, identity.PasswordHash) {
+		return nil, ErrInvalidCurrentPassword
+	}
+
+	pinHash, err := utils.HashPassword(pin)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pinRepo.Upsert(ctx, &entity.KioskPIN{
+		IdentityID: identity.ID,
+		PINHash:    pinHash,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.cardLockRepo.ResetByIdentityID(ctx, identity.ID); err != nil {
+		utils.Errorf("Failed to reset kiosk card lockouts", utils.ErrorField(err.Error()))
+	}
+
+	return &KioskPINStatusResponse{Enabled: true}, nil
+}
+
+// RemovePIN turns kiosk check-in off for the member.
+func (s *KioskService) RemovePIN(ctx context.Context, userID uuid.UUID) (*KioskPINStatusResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pinRepo.Delete(ctx, identity.ID); err != nil {
+		return nil, err
+	}
+	return &KioskPINStatusResponse{Enabled: false}, nil
+}
+
+type KioskCheckInRequest struct {
+	CardUID   string
+	PIN       string
+	IPAddress string
+}
+
+type KioskTokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"`
+	Scope       string    `json:"scope"`
+	UserID      uuid.UUID `json:"user_id"`
+}
+
+// CheckIn swaps a card UID and PIN entered at device for a check-in token.
+// Unknown cards, cards without a PIN and wrong PINs all get
+// ErrInvalidCardOrPIN; wrong PINs count towards locking the card.
+func (s *KioskService) CheckIn(ctx context.Context, device *entity.KioskDevice, req KioskCheckInRequest) (*KioskTokenResponse, error) {
+	card, err := s.findCard(ctx, req.CardUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Spend the same time as a real PIN check
+			utils.CheckPassword(req.PIN, dummyPasswordHash())
+			return nil, ErrInvalidCardOrPIN
+		}
+		return nil, err
+	}
+
+	lockout, err := s.cardLockRepo.GetByIdentifierID(ctx, card.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if lockout != nil && lockout.IsLocked() {
+		return nil, ErrCardLocked
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, card.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
+	}
+
+	pinHash := dummyPasswordHash()
+	pin, err := s.pinRepo.GetByIdentityID(ctx, identity.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if pin != nil {
+		pinHash = pin.PINHash
+	}
+
+	if !utils.CheckPassword(req.PIN, pinHash) || pin == nil {
+		return nil, s.registerPINFailure(ctx, card)
+	}
+
+	if err := s.cardLockRepo.Reset(ctx, card.ID); err != nil {
+		utils.Errorf("Failed to reset kiosk card lockout", utils.ErrorField(err.Error()))
+	}
+	if err := s.deviceRepo.UpdateLastSeen(ctx, device.ID); err != nil {
+		utils.Errorf("Failed to update kiosk last seen", utils.ErrorField(err.Error()))
+	}
+
+	session, err := s.sessionRepo.Create(ctx, &entity.KioskSession{
+		ID:           uuid.New(),
+		DeviceID:     device.ID,
+		IdentityID:   identity.ID,
+		IdentifierID: &card.ID,
+		IPAddress:    req.IPAddress,
+		ExpiresAt:    time.Now().Add(s.cfg.Kiosk.TokenTTL),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.jwtUtil.GenerateAudienceToken(identity.UserID.String(), session.ID.String(), ScopeCheckIn, s.cfg.Kiosk.Audience, s.cfg.Kiosk.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KioskTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.cfg.Kiosk.TokenTTL.Seconds()),
+		Scope:       ScopeCheckIn,
+		UserID:      identity.UserID,
+	}, nil
+}
+
+// findCard looks up a verified card identifier by UID.
+func (s *KioskService) findCard(ctx context.Context, cardUID string) (*entity.Identifier, error) {
+	value, err := normalizeIdentifier(entity.IdentifierTypeCardUID, cardUID)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	card, err := s.identifierRepo.GetByValue(ctx, entity.IdentifierTypeCardUID, value)
+	if err != nil {
+		return nil, err
+	}
+	if !card.Verified {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return card, nil
+}
+
+// registerPINFailure counts a wrong PIN and locks the card once there have
+// been too many.
+func (s *KioskService) registerPINFailure(ctx context.Context, card *entity.Identifier) error {
+	failures, err := s.cardLockRepo.RecordFailure(ctx, card.ID)
+	if err != nil {
+		utils.Errorf("Failed to count kiosk PIN failure", utils.ErrorField(err.Error()))
+		return ErrInvalidCardOrPIN
+	}
+	if failures < s.cfg.Kiosk.MaxPINFailures {
+		return ErrInvalidCardOrPIN
+	}
+
+	if err := s.cardLockRepo.Lock(ctx, card.ID, time.Now().Add(s.cfg.Kiosk.PINLockout)); err != nil {
+		utils.Errorf("Failed to lock kiosk card", utils.ErrorField(err.Error()))
+	}
+	utils.Warn("Kiosk card locked after wrong PINs",
+		utils.String("identifier_id", card.ID.String()),
+		utils.Int("failures", failures),
+	)
+	return ErrCardLocked
+}
+
+// validatePIN requires 4 to 6 digits that aren't all the same or a run like
+// 1234 or 9876.
+func validatePIN(pin string) error {
+	if len(pin) < kioskPINMinLength || len(pin) > kioskPINMaxLength {
+		return ErrInvalidPIN
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return ErrInvalidPIN
+		}
+	}
+
+	same, ascending, descending := true, true, true
+	for i := 1; i < len(pin); i++ {
+		diff := int(pin[i]) - int(pin[i-1])
+		same = same && diff == 0
+		ascending = ascending && diff == 1
+		descending = descending && diff == -1
+	}
+	if same || ascending || descending {
+		return ErrInvalidPIN
+	}
+	return nil
+}
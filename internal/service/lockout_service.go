@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+)
+
+var (
+	ErrAccountLocked     = i18n.NewError("errors.account_locked", "account locked or suspended")
+	ErrIdentityNotLocked = i18n.NewError("errors.identity_not_locked", "identity is not locked")
+)
+
+// LockoutService applies the account lockout policy on top of the recorded
+// login attempts.
+type LockoutService struct {
+	identityRepo repository.IdentityRepository
+	attemptRepo  repository.LoginAttemptRepository
+	transactor   repository.Transactor
+	email        *EmailService
+	events       *messaging.Outbox
+	cfg          *config.Config
+}
+
+func NewLockoutService(
+	identityRepo repository.IdentityRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	transactor repository.Transactor,
+	email *EmailService,
+	events *messaging.Outbox,
+	cfg *config.Config,
+) *LockoutService {
+	return &LockoutService{
+		identityRepo: identityRepo,
+		attemptRepo:  attemptRepo,
+		transactor:   transactor,
+		email:        email,
+		events:       events,
+		cfg:          cfg,
+	}
+}
+
+// ReleaseExpired unlocks identity if its temporary lock or suspension has run
+// out and returns the up to date identity.
+func (s *LockoutService) ReleaseExpired(ctx context.Context, identity *entity.Identity) (*entity.Identity, error) {
+	if identity.SuspensionExpired() {
+		status := unlockedStatus(identity)
+		err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := s.identityRepo.UpdateAdminStatus(ctx, identity.ID, status, identity.LockedUntil, ""); err != nil {
+				return err
+			}
+			if s.events == nil {
+				return nil
+			}
+			return s.events.Publish(ctx, &messaging.StatusChanged{
+				IdentityRef: messaging.RefFor(identity),
+				From:        string(entity.StatusSuspended),
+				To:          string(status),
+				Trigger:     "expired",
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		identity.Status = status
+		identity.StatusReason = ""
+		return identity, nil
+	}
+
+	if !identity.LockExpired() {
+		return identity, nil
+	}
+
+	status := unlockedStatus(identity)
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdateLockout(ctx, identity.ID, status, identity.LockedUntil, identity.LockoutCount); err != nil {
+			return err
+		}
+		return s.publishUnlocked(ctx, identity, "expired", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	identity.Status = status
+	return identity, nil
+}
+
+// RegisterFailure locks identity once it has reached the failure threshold.
+// It reports whether the identity is now locked.
+func (s *LockoutService) RegisterFailure(ctx context.Context, identity *entity.Identity) (bool, error) {
+	policy := s.cfg.Lockout
+
+	// Failures from before the last lock ended have already been punished
+	since := time.Now().Add(-policy.Window)
+	if identity.LockedUntil != nil && identity.LockedUntil.After(since) {
+		since = *identity.LockedUntil
+	}
+
+	failures, err := s.attemptRepo.CountRecentFailures(ctx, identity.ID, since)
+	if err != nil {
+		return false, err
+	}
+	if failures < policy.MaxFailures {
+		return false, nil
+	}
+
+	lockoutCount := identity.LockoutCount + 1
+	var lockedUntil *time.Time
+	if lockoutCount < policy.MaxLockouts {
+		until := time.Now().Add(lockDuration(policy, lockoutCount))
+		lockedUntil = &until
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdateLockout(ctx, identity.ID, entity.StatusLocked, lockedUntil, lockoutCount); err != nil {
+			return err
+		}
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.IdentityLocked{
+			IdentityRef:  messaging.RefFor(identity),
+			Failures:     failures,
+			LockoutCount: lockoutCount,
+			Permanent:    lockedUntil == nil,
+			LockedUntil:  lockedUntil,
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	identity.Status = entity.StatusLocked
+	identity.LockedUntil = lockedUntil
+	identity.LockoutCount = lockoutCount
+
+	utils.Warn("Identity locked after repeated login failures",
+		utils.String("identity_id", identity.ID.String()),
+		utils.Int("lockout_count", lockoutCount),
+		utils.Bool("permanent", lockedUntil == nil),
+	)
+
+	s.email.SendAccountLocked(ctx, identity, lockedUntil)
+
+	return true, nil
+}
+
+// RecordFailure records a wrong password given outside a login, such as the
+// current password when changing it, and applies the lockout policy like
+// RegisterFailure.
+func (s *LockoutService) RecordFailure(ctx context.Context, identity *entity.Identity, ipAddress string) (bool, error) {
+	attempt := &entity.LoginAttempt{
+		ID:          uuid.New(),
+		IdentityID:  &identity.ID,
+		Email:       identity.Email,
+		IPAddress:   ipAddress,
+		Success:     false,
+		AttemptedAt: time.Now(),
+	}
+	if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+		return false, err
+	}
+	return s.RegisterFailure(ctx, identity)
+}
+
+// RegisterSuccess clears the lockout history after a successful login.
+func (s *LockoutService) RegisterSuccess(ctx context.Context, identity *entity.Identity) error {
+	if identity.LockoutCount == 0 {
+		return nil
+	}
+	identity.LockoutCount = 0
+	return s.identityRepo.UpdateLockout(ctx, identity.ID, identity.Status, identity.LockedUntil, 0)
+}
+
+// IsIdentifierThrottled applies the failure threshold to identifiers that
+// don't belong to any identity, so lock responses don't reveal which ones
+// exist. Login attempts keep the identifier in their email column.
+func (s *LockoutService) IsIdentifierThrottled(ctx context.Context, identifier string) (bool, error) {
+	failures, err := s.attemptRepo.CountRecentFailuresByEmail(ctx, identifier, time.Now().Add(-s.cfg.Lockout.Window))
+	if err != nil {
+		return false, err
+	}
+	return failures >= s.cfg.Lockout.MaxFailures, nil
+}
+
+// Unlock lifts a temporary or permanent lock on behalf of an administrator.
+func (s *LockoutService) Unlock(ctx context.Context, userID uuid.UUID, reason string) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !identity.IsLocked() {
+		return ErrIdentityNotLocked
+	}
+
+	// Ending the lock now discards the failures that led to it
+	now := time.Now()
+	status := unlockedStatus(identity)
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdateLockout(ctx, identity.ID, status, &now, 0); err != nil {
+			return err
+		}
+		return s.publishUnlocked(ctx, identity, "admin", reason)
+	})
+}
+
+func (s *LockoutService) publishUnlocked(ctx context.Context, identity *entity.Identity, trigger, reason string) error {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.Publish(ctx, &messaging.IdentityUnlocked{
+		IdentityRef: messaging.RefFor(identity),
+		Trigger:     trigger,
+		Reason:      reason,
+	})
+}
+
+// lockDuration doubles the base duration for every previous lockout.
+func lockDuration(policy config.LockoutConfig, lockoutCount int) time.Duration {
+	d := policy.BaseDuration
+	for i := 1; i < lockoutCount; i++ {
+		d *= 2
+		if d >= policy.MaxDuration {
+			return policy.MaxDuration
+		}
+	}
+	return d
+}
+
+func unlockedStatus(identity *entity.Identity) entity.IdentityStatus {
+	if identity.EmailVerified {
+		return entity.StatusActive
+	}
+	return entity.StatusUnverified
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeLength is the number of base32 characters in a recovery code,
+// shown split in two halves.
+const recoveryCodeLength = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	ErrMFAAlreadyEnrolled  = i18n.NewError("errors.mfa_already_enrolled", "two-factor authentication is already enabled")
+	ErrMFANotEnrolled      = i18n.NewError("errors.mfa_not_enrolled", "two-factor authentication is not set up")
+	ErrMFARequiredByPolicy = i18n.NewError("errors.mfa_required_by_policy", "two-factor authentication is required for this account")
+	ErrInvalidMFACode      = i18n.NewError("errors.invalid_mfa_code", "invalid authentication code")
+	ErrInvalidMFAChallenge = i18n.NewError("errors.invalid_mfa_token", "invalid or expired mfa token")
+)
+
+// MFAService manages TOTP enrollment, recovery codes and the second step of
+// logins for identities that use or require a second factor.
+type MFAService struct {
+	identityRepo  repository.IdentityRepository
+	totpRepo      repository.TOTPCredentialRepository
+	recoveryRepo  repository.RecoveryCodeRepository
+	challengeRepo repository.MFAChallengeRepository
+	transactor    repository.Transactor
+	lockout       *LockoutService
+	events        *messaging.Outbox
+	tokenHasher   *utils.TokenHasher
+	secretBox     *utils.SecretBox
+	cfg           *config.Config
+}
+
+func NewMFAService(
+	identityRepo repository.IdentityRepository,
+	totpRepo repository.TOTPCredentialRepository,
+	recoveryRepo repository.RecoveryCodeRepository,
+	challengeRepo repository.MFAChallengeRepository,
+	transactor repository.Transactor,
+	lockout *LockoutService,
+	events *messaging.Outbox,
+	tokenHasher *utils.TokenHasher,
+	secretBox *utils.SecretBox,
+	cfg *config.Config,
+) *MFAService {
+	return &MFAService{
+		identityRepo:  identityRepo,
+		totpRepo:      totpRepo,
+		recoveryRepo:  recoveryRepo,
+		challengeRepo: challengeRepo,
+		transactor:    transactor,
+		lockout:       lockout,
+		events:        events,
+		tokenHasher:   tokenHasher,
+		secretBox:     secretBox,
+		cfg:           cfg,
+	}
+}
+
+type MFAStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+func (s *MFAService) Status(ctx context.Context, userID uuid.UUID) (*MFAStatusResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrolled, err := s.isEnrolled(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := s.recoveryRepo.CountUnused(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAStatusResponse{
+		Enabled:                enrolled,
+		Required:               identity.MFARequired,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// MFAChallenge is returned by a login that still needs a second factor.
+type MFAChallenge struct {
+	Token string
+	// EnrollmentRequired is set when MFA is required but the identity has
+	// not set it up yet; it must enroll with the token first.
+	EnrollmentRequired bool
+}
+
+// Challenge starts the second step of a login for an identity that passed the
+// password check. It returns nil if the identity doesn't need a second factor.
+func (s *MFAService) Challenge(ctx context.Context, identity *entity.Identity) (*MFAChallenge, error) {
+	enrolled, err := s.isEnrolled(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled && !identity.MFARequired {
+		return nil, nil
+	}
+
+	token := generateToken()
+	challenge := &entity.MFAChallenge{
+		ID:         uuid.New(),
+		IdentityID: identity.ID,
+		TokenHash:  s.tokenHasher.Hash(token),
+		ExpiresAt:  time.Now().Add(s.cfg.MFA.ChallengeTTL),
+		CreatedAt:  time.Now(),
+	}
+	if _, err := s.challengeRepo.Create(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		Token:              token,
+		EnrollmentRequired: !enrolled,
+	}, nil
+}
+
+// CompleteChallenge checks the second factor for a login challenge. If MFA is
+// required and the identity enrolled with this challenge, the code confirms
+// the enrollment and the new recovery codes are returned. The identity is
+// returned along with ErrInvalidMFACode so callers can count the failure.
+func (s *MFAService) CompleteChallenge(ctx context.Context, token, code, recoveryCode string) (*entity.Identity, []string, error) {
+	challenge, err := s.validChallenge(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, challenge.IdentityID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enrolled, err := s.isEnrolled(ctx, identity.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recoveryCodes []string
+	if enrolled {
+		err = s.verify(ctx, identity, code, recoveryCode)
+	} else {
+		recoveryCodes, err = s.confirm(ctx, identity, code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if incErr := s.challengeRepo.IncrementAttempts(ctx, challenge.ID); incErr != nil {
+				utils.Errorf("Failed to count mfa attempt", utils.ErrorField(incErr.Error()))
+			}
+			return identity, nil, err
+		}
+		return nil, nil, err
+	}
+
+	if err := s.challengeRepo.MarkAsUsed(ctx, challenge.ID); err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeUsed) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		return nil, nil, err
+	}
+
+	return identity, recoveryCodes, nil
+}
+
+// EnrollWithChallenge starts TOTP enrollment during a login for an identity
+// that is required to use MFA but hasn't set it up.
+func (s *MFAService) EnrollWithChallenge(ctx context.Context, token string) (*TOTPEnrollmentResponse, error) {
+	challenge, err := s.validChallenge(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, challenge.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.beginEnrollment(ctx, identity)
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// OTPAuthURI is the otpauth:// URI to show as a QR code.
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// BeginEnrollment generates a new TOTP secret for the user. It replaces any
+// enrollment that was started but never confirmed.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID uuid.UUID) (*TOTPEnrollmentResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginEnrollment(ctx, identity)
+}
+
+func (s *MFAService) beginEnrollment(ctx context.Context, identity *entity.Identity) (*TOTPEnrollmentResponse, error) {
+	existing, err := s.totpRepo.GetByIdentityID(ctx, identity.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.IsConfirmed() {
+			return nil, ErrMFAAlreadyEnrolled
+		}
+		if err := s.totpRepo.DeleteByIdentityID(ctx, identity.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.secretBox.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &entity.TOTPCredential{
+		ID:              uuid.New(),
+		IdentityID:      identity.ID,
+		SecretEncrypted: sealed,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if _, err := s.totpRepo.Create(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(s.cfg.MFA.Issuer, identity.Email, secret),
+	}, nil
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmEnrollment activates a pending enrollment with a code from the
+// authenticator app and returns a fresh set of recovery codes.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) (*RecoveryCodesResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.confirm(ctx, identity, code)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *MFAService) confirm(ctx context.Context, identity *entity.Identity, code string) ([]string, error) {
+	credential, err := s.totpRepo.GetByIdentityID(ctx, identity.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	if credential.IsConfirmed() {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+
+	step, err := s.checkTOTP(credential, code)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.totpRepo.Confirm(ctx, credential.ID, step); err != nil {
+			return err
+		}
+
+		codes, err = s.issueRecoveryCodes(ctx, identity.ID)
+		if err != nil {
+			return err
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.MFAEnabled{IdentityRef: messaging.RefFor(identity)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a
+// current TOTP code. Wrong codes count towards the lockout threshold.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code, ipAddress string) (*RecoveryCodesResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
+	}
+
+	if err := s.verifyStepUp(ctx, identity, code, ipAddress); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueRecoveryCodes(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+type DisableMFARequest struct {
+	UserID          uuid.UUID
+	CurrentPassword string
+	Code            string
+	IPAddress       string
+}
+
+// Disable removes the user's TOTP enrollment and recovery codes after checking
+// the current password and a TOTP code. It is not allowed while MFA is
+// required for the identity. Wrong passwords and codes count towards the
+// lockout threshold.
+func (s *MFAService) Disable(ctx context.Context, req DisableMFARequest) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return ErrAccountLocked
+	}
+	if identity.MFARequired {
+		return ErrMFARequiredByPolicy
+	}
+
+	if !utils.CheckPassword(req.CurrentPassword, identity.PasswordHash) {
+		if err := s.registerFailure(ctx, identity, req.IPAddress); err != nil {
+			return err
+		}
+		return ErrInvalidCurrentPassword
+	}
+	if err := s.verifyStepUp(ctx, identity, req.Code, req.IPAddress); err != nil {
+		return err
+	}
+
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.totpRepo.DeleteByIdentityID(ctx, identity.ID); err != nil {
+			return err
+		}
+		if err := s.recoveryRepo.Replace(ctx, identity.ID, nil); err != nil {
+			return err
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.MFADisabled{IdentityRef: messaging.RefFor(identity)})
+	})
+}
+
+// SetRequired sets whether the identity must use a second factor to log in.
+func (s *MFAService) SetRequired(ctx context.Context, userID uuid.UUID, required bool) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.identityRepo.UpdateMFARequired(ctx, identity.ID, required)
+}
+
+// verify checks a TOTP code, or a recovery code if one is given, for an
+// enrolled identity. Each TOTP time step and each recovery code is only
+// accepted once.
+func (s *MFAService) verify(ctx context.Context, identity *entity.Identity, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		err := s.recoveryRepo.MarkAsUsed(ctx, identity.ID, s.tokenHasher.Candidates(normalizeRecoveryCode(recoveryCode))...)
+		if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	credential, err := s.totpRepo.GetByIdentityID(ctx, identity.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnrolled
+		}
+		return err
+	}
+	if !credential.IsConfirmed() {
+		return ErrMFANotEnrolled
+	}
+
+	step, err := s.checkTOTP(credential, code)
+	if err != nil {
+		return err
+	}
+	if step <= credential.LastUsedStep {
+		return ErrInvalidMFACode
+	}
+	if err := s.totpRepo.UpdateLastUsedStep(ctx, credential.ID, step); err != nil {
+		if errors.Is(err, repository.ErrTOTPStepUsed) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	return nil
+}
+
+// verifyStepUp checks a TOTP code given by a signed-in user, counting a wrong
+// one as a failed login so a stolen access token can't be used to guess it.
+func (s *MFAService) verifyStepUp(ctx context.Context, identity *entity.Identity, code, ipAddress string) error {
+	err := s.verify(ctx, identity, code, "")
+	if errors.Is(err, ErrInvalidMFACode) {
+		if lockErr := s.registerFailure(ctx, identity, ipAddress); lockErr != nil {
+			return lockErr
+		}
+	}
+	return err
+}
+
+// registerFailure records a failed step-up check and returns ErrAccountLocked
+// if it locked the identity.
+func (s *MFAService) registerFailure(ctx context.Context, identity *entity.Identity, ipAddress string) error {
+	locked, err := s.lockout.RecordFailure(ctx, identity, ipAddress)
+	if err != nil {
+		utils.Errorf("Failed to apply lockout policy", utils.ErrorField(err.Error()))
+	}
+	if locked {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+func (s *MFAService) checkTOTP(credential *entity.TOTPCredential, code string) (int64, error) {
+	secret, err := s.secretBox.Open(credential.SecretEncrypted)
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, strings.TrimSpace(code), time.Now(), s.cfg.MFA.AllowedSkew)
+	if !ok {
+		return 0, ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+func (s *MFAService) validChallenge(ctx context.Context, token string) (*entity.MFAChallenge, error) {
+	challenge, err := s.challengeRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+	if !challenge.IsValid() || challenge.Attempts >= s.cfg.MFA.MaxChallengeAttempts {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return challenge, nil
+}
+
+func (s *MFAService) isEnrolled(ctx context.Context, identityID uuid.UUID) (bool, error) {
+	credential, err := s.totpRepo.GetByIdentityID(ctx, identityID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return credential.IsConfirmed(), nil
+}
+
+// issueRecoveryCodes replaces the identity's recovery codes and returns the
+// new ones. Only their hashes are stored.
+func (s *MFAService) issueRecoveryCodes(ctx context.Context, identityID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, s.cfg.MFA.RecoveryCodeCount)
+	entities := make([]*entity.RecoveryCode, 0, s.cfg.MFA.RecoveryCodeCount)
+	for i := 0; i < s.cfg.MFA.RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		entities = append(entities, &entity.RecoveryCode{
+			ID:         uuid.New(),
+			IdentityID: identityID,
+			CodeHash:   s.tokenHasher.Hash(normalizeRecoveryCode(code)),
+			CreatedAt:  time.Now(),
+		})
+	}
+
+	if err := s.recoveryRepo.Replace(ctx, identityID, entities); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7f2q-9xm4d".
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf)[:recoveryCodeLength])
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
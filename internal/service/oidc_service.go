@@ -0,0 +1,715 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/cache"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+	ScopePhone   = "phone"
+
+	ResponseTypeCode           = "code"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	CodeChallengeMethodS256    = "S256"
+
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+
+	// pkceVerifierMinLength and pkceVerifierMaxLength bound the code verifier
+	// as required by RFC 7636.
+	pkceVerifierMinLength = 43
+	pkceVerifierMaxLength = 128
+)
+
+// SupportedScopes are the scopes clients may be registered for and request.
+var SupportedScopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile, ScopePhone}
+
+var (
+	ErrInvalidClient           = errors.New("unknown client or invalid client credentials")
+	ErrInvalidRedirectURI      = errors.New("redirect uri is not registered for this client")
+	ErrUnsupportedResponseType = errors.New("only the code response type is supported")
+	ErrInvalidScope            = errors.New("requested scope is not allowed for this client")
+	ErrPKCERequired            = errors.New("a code_challenge using the S256 method is required")
+	ErrInvalidGrant            = errors.New("authorization grant is invalid, expired or was issued to another client")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrInvalidClientMetadata   = errors.New("invalid client metadata")
+)
+
+// OIDCService implements an OpenID Connect provider using the authorization
+// code flow with PKCE on top of the regular login sessions.
+type OIDCService struct {
+	clientRepo      repository.OAuthClientRepository
+	codeRepo        repository.AuthorizationCodeRepository
+	identityRepo    repository.IdentityRepository
+	identityService *IdentityService
+	tokenService    *TokenService
+	tokenRepo       repository.RefreshTokenRepository
+	denylist        *cache.TokenDenylist
+	jwtUtil         *utils.JWTUtil
+	tokenHasher     *utils.TokenHasher
+	cfg             *config.Config
+}
+
+func NewOIDCService(
+	clientRepo repository.OAuthClientRepository,
+	codeRepo repository.AuthorizationCodeRepository,
+	identityRepo repository.IdentityRepository,
+	identityService *IdentityService,
+	tokenService *TokenService,
+	tokenRepo repository.RefreshTokenRepository,
+	denylist *cache.TokenDenylist,
+	jwtUtil *utils.JWTUtil,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
+) *OIDCService {
+	return &OIDCService{
+		clientRepo:      clientRepo,
+		codeRepo:        codeRepo,
+		identityRepo:    identityRepo,
+		identityService: identityService,
+		tokenService:    tokenService,
+		tokenRepo:       tokenRepo,
+		denylist:        denylist,
+		jwtUtil:         jwtUtil,
+		tokenHasher:     tokenHasher,
+		cfg:             cfg,
+	}
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	Prompt              string `form:"prompt"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// ValidateAuthorizeRequest checks an authorization request against the
+// registered client. ErrInvalidClient and ErrInvalidRedirectURI mean the
+// redirect URI can't be trusted and the error must not be sent to it.
+func (s *OIDCService) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*entity.OAuthClient, error) {
+	client, err := s.clientRepo.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return nil, ErrUnsupportedResponseType
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !isSupportedScope(scope) || !client.AllowsScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	// Every code is bound to the request that asked for it with PKCE, so an
+	// intercepted code is useless even with a confidential client's secret.
+	// Only S256 is accepted.
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return nil, ErrPKCERequired
+	}
+
+	return client, nil
+}
+
+// Authorize issues an authorization code for the user after they have
+// authenticated. authTime is when that authentication happened.
+func (s *OIDCService) Authorize(ctx context.Context, req AuthorizeRequest, userID uuid.UUID, authTime time.Time) (string, error) {
+	client, err := s.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return "", ErrAccountLocked
+	}
+
+	code := generateToken()
+	authorizationCode := &entity.AuthorizationCode{
+		ID:                  uuid.New(),
+		CodeHash:            s.tokenHasher.Hash(code),
+		ClientID:            client.ClientID,
+		IdentityID:          identity.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               strings.Join(strings.Fields(req.Scope), " "),
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            authTime,
+		ExpiresAt:           time.Now().Add(s.cfg.OIDC.AuthorizationCodeTTL),
+		CreatedAt:           time.Now(),
+	}
+
+	if _, err := s.codeRepo.Create(ctx, authorizationCode); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	IPAddress    string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Exchange implements the token endpoint for the authorization_code and
+// refresh_token grants.
+func (s *OIDCService) Exchange(ctx context.Context, req TokenRequest) (*TokenResponse, error) {
+	if req.GrantType != GrantTypeAuthorizationCode && req.GrantType != GrantTypeRefreshToken {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GrantType == GrantTypeRefreshToken {
+		resp, err := s.tokenService.RefreshToken(ctx, req.RefreshToken, client.ClientID, req.IPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+		}
+		return &TokenResponse{
+			AccessToken:  resp.AccessToken,
+			TokenType:    resp.TokenType,
+			ExpiresIn:    resp.ExpiresIn,
+			RefreshToken: resp.RefreshToken,
+			Scope:        resp.Scope,
+		}, nil
+	}
+
+	return s.exchangeCode(ctx, client, req)
+}
+
+func (s *OIDCService) exchangeCode(ctx context.Context, client *entity.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	code, err := s.codeRepo.GetByCodeHash(ctx, s.tokenHasher.Candidates(req.Code)...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+
+	if !code.IsValid() || code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(code, req.CodeVerifier) {
+		return nil, ErrInvalidGrant
+	}
+
+	// Consume the code before issuing anything so it can't be redeemed twice
+	if err := s.codeRepo.MarkAsUsed(ctx, code.ID); err != nil {
+		if errors.Is(err, repository.ErrAuthorizationCodeUsed) {
+			utils.Warn("Authorization code replayed", utils.String("client_id", client.ClientID))
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, code.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrInvalidGrant
+	}
+
+	session, err := s.identityService.StartSession(ctx, identity, SessionRequest{
+		DeviceInfo: client.Name,
+		IPAddress:  req.IPAddress,
+		ClientID:   client.ClientID,
+		Scope:      code.Scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TokenResponse{
+		AccessToken:  session.AccessToken,
+		TokenType:    session.TokenType,
+		ExpiresIn:    session.ExpiresIn,
+		RefreshToken: session.RefreshToken,
+		Scope:        code.Scope,
+	}
+
+	if code.HasScope(ScopeOpenID) {
+		resp.IDToken, err = s.generateIDToken(identity, client, code, session.SessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *OIDCService) generateIDToken(identity *entity.Identity, client *entity.OAuthClient, code *entity.AuthorizationCode, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := utils.IDTokenClaims{
+		Nonce:     code.Nonce,
+		AuthTime:  jwt.NewNumericDate(code.AuthTime),
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.OIDC.Issuer,
+			Subject:   identity.UserID.String(),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.OIDC.IDTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	if code.HasScope(ScopeEmail) {
+		emailVerified := identity.EmailVerified
+		claims.Email = identity.Email
+		claims.EmailVerified = &emailVerified
+	}
+	claims.ProfileClaims = profileClaims(identity, code.HasScope)
+
+	return s.jwtUtil.Sign(claims)
+}
+
+// ProfileClaims returns the profile and phone claims the user's token was
+// granted, for the userinfo endpoint.
+func (s *OIDCService) ProfileClaims(ctx context.Context, userID uuid.UUID, hasScope func(string) bool) (*utils.ProfileClaims, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	claims := profileClaims(identity, hasScope)
+	return &claims, nil
+}
+
+func profileClaims(identity *entity.Identity, hasScope func(string) bool) utils.ProfileClaims {
+	var claims utils.ProfileClaims
+	profile := identity.Profile
+
+	if hasScope(ScopeProfile) {
+		claims.Name = profile.FullName()
+		claims.GivenName = profile.FirstName
+		claims.FamilyName = profile.LastName
+		claims.Locale = profile.Locale
+		claims.Zoneinfo = profile.Timezone
+		claims.UpdatedAt = identity.UpdatedAt.Unix()
+	}
+	if hasScope(ScopePhone) && profile.Phone != "" {
+		// Phone numbers are self-reported, never verified
+		verified := false
+		claims.PhoneNumber = profile.Phone
+		claims.PhoneNumberVerified = &verified
+	}
+
+	return claims
+}
+
+// IntrospectionResponse is the RFC 7662 introspection response. Inactive
+// tokens only report Active; access tokens also carry their own claims.
+type IntrospectionResponse struct {
+	Active      bool             `json:"active"`
+	Scope       string           `json:"scope,omitempty"`
+	ClientID    string           `json:"client_id,omitempty"`
+	Username    string           `json:"username,omitempty"`
+	TokenType   string           `json:"token_type,omitempty"`
+	ExpiresAt   int64            `json:"exp,omitempty"`
+	IssuedAt    int64            `json:"iat,omitempty"`
+	NotBefore   int64            `json:"nbf,omitempty"`
+	Subject     string           `json:"sub,omitempty"`
+	Audience    jwt.ClaimStrings `json:"aud,omitempty"`
+	Issuer      string           `json:"iss,omitempty"`
+	TokenID     string           `json:"jti,omitempty"`
+	UserID      string           `json:"user_id,omitempty"`
+	Email       string           `json:"email,omitempty"`
+	SessionID   string           `json:"sid,omitempty"`
+	Roles       []string         `json:"roles,omitempty"`
+	Permissions []string         `json:"permissions,omitempty"`
+}
+
+var inactiveToken = &IntrospectionResponse{Active: false}
+
+// Introspect reports whether token is an active access or refresh token.
+// Only confidential clients may introspect. Access tokens are reported to any
+// of them, so resource servers can check the tokens they are sent; refresh
+// tokens only to the client they were issued to. A token of a locked or
+// suspended identity is inactive. hint only decides which kind is tried
+// first.
+func (s *OIDCService) Introspect(ctx context.Context, clientID, clientSecret, token, hint string) (*IntrospectionResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic {
+		return nil, ErrInvalidClient
+	}
+	if token == "" {
+		return inactiveToken, nil
+	}
+
+	lookups := []func(context.Context, *entity.OAuthClient, string) (*IntrospectionResponse, error){
+		s.introspectAccessToken, s.introspectRefreshToken,
+	}
+	if hint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		resp, err := lookup(ctx, client, token)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			return resp, nil
+		}
+	}
+	return inactiveToken, nil
+}
+
+// introspectAccessToken returns nil when token isn't an access token at all.
+func (s *OIDCService) introspectAccessToken(ctx context.Context, _ *entity.OAuthClient, token string) (*IntrospectionResponse, error) {
+	claims, err := s.jwtUtil.ValidateToken(token)
+	if err != nil {
+		if errors.Is(err, utils.ErrExpiredToken) {
+			return inactiveToken, nil
+		}
+		return nil, nil
+	}
+
+	// Like the auth middleware, a denylist outage is logged and the token
+	// judged on the rest
+	denied, err := s.denylist.IsDenied(ctx, claims.ID)
+	if err != nil {
+		utils.Errorf("Failed to check token denylist", utils.ErrorField(err.Error()))
+	}
+	if denied {
+		return inactiveToken, nil
+	}
+	if claims.IssuedAt != nil {
+		revoked, err := s.denylist.IsUserRevoked(ctx, claims.UserID, claims.IssuedAt.Time)
+		if err != nil {
+			utils.Errorf("Failed to check token denylist", utils.ErrorField(err.Error()))
+		}
+		if revoked {
+			return inactiveToken, nil
+		}
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return inactiveToken, nil
+	}
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inactiveToken, nil
+		}
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return inactiveToken, nil
+	}
+
+	// Ending a session revokes its refresh token family, not the access
+	// tokens already issued for it. Kiosk tokens name a kiosk session instead.
+	if claims.SessionID != "" && !slices.Contains(claims.Audience, s.cfg.Kiosk.Audience) {
+		familyID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return inactiveToken, nil
+		}
+		live, err := s.tokenRepo.IsFamilyActive(ctx, familyID)
+		if err != nil {
+			return nil, err
+		}
+		if !live {
+			return inactiveToken, nil
+		}
+	}
+
+	resp := &IntrospectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		Username:    identity.Email,
+		TokenType:   "Bearer",
+		Subject:     claims.UserID,
+		Audience:    claims.Audience,
+		Issuer:      claims.Issuer,
+		TokenID:     claims.ID,
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		SessionID:   claims.SessionID,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.NotBefore = claims.NotBefore.Unix()
+	}
+	return resp, nil
+}
+
+// introspectRefreshToken returns nil when token isn't a known refresh token.
+func (s *OIDCService) introspectRefreshToken(ctx context.Context, client *entity.OAuthClient, token string) (*IntrospectionResponse, error) {
+	refreshToken, err := s.tokenRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if refreshToken.ClientID != client.ClientID || !refreshToken.IsActive() || refreshToken.IsRotated() {
+		return inactiveToken, nil
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, refreshToken.IdentityID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inactiveToken, nil
+		}
+		return nil, err
+	}
+	if identity.IsLocked() || identity.IsSuspended() {
+		return inactiveToken, nil
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     refreshToken.Scope,
+		ClientID:  refreshToken.ClientID,
+		Username:  identity.Email,
+		TokenType: TokenTypeHintRefreshToken,
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		Subject:   identity.UserID.String(),
+		UserID:    identity.UserID.String(),
+		Email:     identity.Email,
+		SessionID: refreshToken.FamilyID.String(),
+	}, nil
+}
+
+// Revoke implements RFC 7009. A refresh token ends its whole session and an
+// access token is denylisted until it expires, but only when presented by the
+// client it was issued to. Tokens of other clients, unknown and already
+// invalid tokens are ignored, as the RFC asks.
+func (s *OIDCService) Revoke(ctx context.Context, clientID, clientSecret, token, hint string) error {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+
+	revokeAccess := func() (bool, error) {
+		claims, err := s.jwtUtil.ValidateToken(token)
+		if err != nil {
+			return false, nil
+		}
+		if claims.ClientID != client.ClientID || claims.ExpiresAt == nil {
+			return true, nil
+		}
+		return true, s.denylist.Add(ctx, claims.ID, claims.ExpiresAt.Time)
+	}
+	revokeRefresh := func() (bool, error) {
+		refreshToken, err := s.tokenRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		if refreshToken.ClientID != client.ClientID {
+			return true, nil
+		}
+		return true, s.tokenRepo.RevokeFamily(ctx, refreshToken.FamilyID)
+	}
+
+	revokers := []func() (bool, error){revokeAccess, revokeRefresh}
+	if hint == TokenTypeHintRefreshToken {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+	for _, revoke := range revokers {
+		found, err := revoke()
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return nil
+}
+
+// authenticateClient identifies the client at the token endpoint. Public
+// clients only present their id; confidential ones must present their secret.
+func (s *OIDCService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*entity.OAuthClient, error) {
+	client, err := s.clientRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if client.IsPublic {
+		return client, nil
+	}
+	if clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+	for _, candidate := range s.tokenHasher.Candidates(clientSecret) {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(client.ClientSecretHash)) == 1 {
+			return client, nil
+		}
+	}
+	return nil, ErrInvalidClient
+}
+
+type RegisterClientRequest struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	Public       bool
+}
+
+type RegisterClientResponse struct {
+	ClientID string `json:"client_id"`
+	// ClientSecret is only ever returned here; it is stored hashed.
+	ClientSecret  string   `json:"client_secret,omitempty"`
+	Name          string   `json:"name"`
+	RedirectURIs  []string `json:"redirect_uris"`
+	AllowedScopes []string `json:"allowed_scopes"`
+	IsPublic      bool     `json:"is_public"`
+}
+
+// RegisterClient registers an OAuth client. Confidential clients get a secret
+// that is returned once.
+func (s *OIDCService) RegisterClient(ctx context.Context, req RegisterClientRequest) (*RegisterClientResponse, error) {
+	if len(req.RedirectURIs) == 0 {
+		return nil, fmt.Errorf("%w: at least one redirect uri is required", ErrInvalidClientMetadata)
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, fmt.Errorf("%w: redirect uri %q must be absolute and have no fragment", ErrInvalidClientMetadata, uri)
+		}
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = SupportedScopes
+	}
+	for _, scope := range scopes {
+		if !isSupportedScope(scope) {
+			return nil, fmt.Errorf("%w: unsupported scope %q", ErrInvalidClientMetadata, scope)
+		}
+	}
+
+	client := &entity.OAuthClient{
+		ID:            uuid.New(),
+		ClientID:      uuid.New().String(),
+		Name:          req.Name,
+		RedirectURIs:  req.RedirectURIs,
+		AllowedScopes: scopes,
+		IsPublic:      req.Public,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	var secret string
+	if !req.Public {
+		secret = generateToken()
+		client.ClientSecretHash = s.tokenHasher.Hash(secret)
+	}
+
+	client, err := s.clientRepo.Create(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegisterClientResponse{
+		ClientID:      client.ClientID,
+		ClientSecret:  secret,
+		Name:          client.Name,
+		RedirectURIs:  client.RedirectURIs,
+		AllowedScopes: client.AllowedScopes,
+		IsPublic:      client.IsPublic,
+	}, nil
+}
+
+// verifyCodeChallenge checks the PKCE verifier against the S256 challenge
+// stored with the code. PKCE is required, so a code without a challenge or a
+// verifier of the wrong length never matches.
+func verifyCodeChallenge(code *entity.AuthorizationCode, verifier string) bool {
+	if code.CodeChallenge == "" || len(verifier) < pkceVerifierMinLength || len(verifier) > pkceVerifierMaxLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) == 1
+}
+
+func isSupportedScope(scope string) bool {
+	for _, s := range SupportedScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
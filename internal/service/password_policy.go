@@ -0,0 +1,52 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+)
+
+var ErrPasswordPolicy = i18n.NewError("errors.password_policy", "password does not meet policy")
+
+// validatePassword checks password against the configured policy and lists
+// every unmet rule in the returned error.
+func validatePassword(policy config.PasswordConfig, password string) error {
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+	}
+
+	var missing []string
+	if len([]rune(password)) < policy.MinLength {
+		missing = append(missing, fmt.Sprintf("at least %d characters", policy.MinLength))
+	}
+	if policy.RequireUpper && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSpecial && !hasSpecial {
+		missing = append(missing, "a special character")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: must contain %s", ErrPasswordPolicy, strings.Join(missing, ", "))
+	}
+	return nil
+}
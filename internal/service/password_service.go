@@ -8,22 +8,56 @@ import (
 	"github.com/google/uuid"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 	"gorm.io/gorm"
 )
 
+// passwordResetTTL is how long a password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+var (
+	ErrInvalidCurrentPassword = i18n.NewError("errors.invalid_current_password", "current password is incorrect")
+	ErrPasswordUnchanged      = i18n.NewError("errors.password_unchanged", "new password must differ from the current password")
+	ErrInvalidResetToken      = i18n.NewError("errors.invalid_reset_token", "invalid or expired reset token")
+	ErrResetTokenUsed         = i18n.NewError("errors.reset_token_used", "reset token is expired or already used")
+)
+
 type PasswordService struct {
 	identityRepo repository.IdentityRepository
 	passwordRepo repository.PasswordResetRepository
+	tokenRepo    repository.RefreshTokenRepository
+	transactor   repository.Transactor
+	lockout      *LockoutService
+	email        *EmailService
+	events       *messaging.Outbox
+	tokenHasher  *utils.TokenHasher
+	cfg          *config.Config
 }
 
 func NewPasswordService(
 	identityRepo repository.IdentityRepository,
 	passwordRepo repository.PasswordResetRepository,
+	tokenRepo repository.RefreshTokenRepository,
+	transactor repository.Transactor,
+	lockout *LockoutService,
+	email *EmailService,
+	events *messaging.Outbox,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
 ) *PasswordService {
 	return &PasswordService{
 		identityRepo: identityRepo,
 		passwordRepo: passwordRepo,
+		tokenRepo:    tokenRepo,
+		transactor:   transactor,
+		lockout:      lockout,
+		email:        email,
+		events:       events,
+		tokenHasher:  tokenHasher,
+		cfg:          cfg,
 	}
 }
 
@@ -43,36 +77,41 @@ func (s *PasswordService) ForgotPassword(ctx context.Context, email string) (*Fo
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// Email doesn't exist, but we still return success
 			return &ForgotPasswordResponse{
-				Message: "If the email exists, a reset link has been sent.",
+				Message: i18n.FromContext(ctx).T("password.reset_sent"),
 			}, nil
 		}
 		return nil, err
 	}
 
+	if err := s.SendReset(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	return &ForgotPasswordResponse{
+		Message: i18n.FromContext(ctx).T("password.reset_sent"),
+	}, nil
+}
+
+// SendReset emails identity a new password reset link.
+func (s *PasswordService) SendReset(ctx context.Context, identity *entity.Identity) error {
 	// Generate reset token
 	token := generateToken()
-	tokenHash := utils.HashToken(token)
+	tokenHash := s.tokenHasher.Hash(token)
 
 	resetToken := &entity.PasswordResetToken{
 		ID:         uuid.New(),
 		IdentityID: identity.ID,
 		TokenHash:  tokenHash,
-		ExpiresAt:  time.Now().Add(1 * time.Hour), // Token valid for 1 hour
+		ExpiresAt:  time.Now().Add(passwordResetTTL),
 		CreatedAt:  time.Now(),
 	}
 
-	_, err = s.passwordRepo.Create(ctx, resetToken)
-	if err != nil {
-		return nil, err
+	if _, err := s.passwordRepo.Create(ctx, resetToken); err != nil {
+		return err
 	}
 
-	// In production, send email with reset link
-	// For now, just log the token (in development)
-	utils.Info("Password reset token generated", utils.String("token", token))
-
-	return &ForgotPasswordResponse{
-		Message: "If the email exists, a reset link has been sent.",
-	}, nil
+	s.email.SendPasswordReset(ctx, identity, token)
+	return nil
 }
 
 type ResetPasswordRequest struct {
@@ -85,21 +124,23 @@ type ResetPasswordResponse struct {
 }
 
 func (s *PasswordService) ResetPassword(ctx context.Context, token, newPassword string) (*ResetPasswordResponse, error) {
-	// Hash the provided token
-	tokenHash := utils.HashToken(token)
-
-	// Look up in DB
-	resetToken, err := s.passwordRepo.GetByTokenHash(ctx, tokenHash)
+	// Look up in DB under every configured hash key
+	resetToken, err := s.passwordRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid or expired reset token")
+			return nil, ErrInvalidResetToken
 		}
 		return nil, err
 	}
 
 	// Check token validity
 	if !resetToken.IsValid() {
-		return nil, errors.New("reset token is expired or already used")
+		return nil, ErrResetTokenUsed
+	}
+
+	// Enforce password policy
+	if err := validatePassword(s.cfg.Password, newPassword); err != nil {
+		return nil, err
 	}
 
 	// Hash new password
@@ -108,22 +149,119 @@ func (s *PasswordService) ResetPassword(ctx context.Context, token, newPassword
 		return nil, err
 	}
 
-	// Update password
-	err = s.identityRepo.UpdatePassword(ctx, resetToken.IdentityID, passwordHash)
+	// The token is claimed before the password changes and in the same
+	// transaction, so concurrent requests with the same token reset it once
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.passwordRepo.MarkAsUsed(ctx, resetToken.ID); err != nil {
+			if errors.Is(err, repository.ErrPasswordResetTokenUsed) {
+				return ErrResetTokenUsed
+			}
+			return err
+		}
+
+		if err := s.identityRepo.UpdatePassword(ctx, resetToken.IdentityID, passwordHash); err != nil {
+			return err
+		}
+
+		// Revoke all existing refresh tokens for security
+		if err := s.tokenRepo.RevokeAllByIdentityID(ctx, resetToken.IdentityID); err != nil {
+			return err
+		}
+
+		return s.publishPasswordChanged(ctx, resetToken.IdentityID, "reset")
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Mark token as used
-	err = s.passwordRepo.MarkAsUsed(ctx, resetToken.ID)
+	return &ResetPasswordResponse{
+		Message: i18n.FromContext(ctx).T("password.reset"),
+	}, nil
+}
+
+type ChangePasswordRequest struct {
+	UserID          uuid.UUID
+	SessionID       uuid.UUID
+	CurrentPassword string
+	NewPassword     string
+	IPAddress       string
+}
+
+type ChangePasswordResponse struct {
+	Message string `json:"message"`
+}
+
+// ChangePassword replaces the password of an authenticated user and signs out
+// every session except the one the request was made from. Wrong current
+// passwords count towards the lockout threshold like wrong login passwords.
+func (s *PasswordService) ChangePassword(ctx context.Context, req ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, req.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Revoke all existing refresh tokens for security
-	// This would require access to the token repository
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
+	}
 
-	return &ResetPasswordResponse{
-		Message: "Password reset successful.",
+	// Verify current password
+	if !utils.CheckPassword(req.CurrentPassword, identity.PasswordHash) {
+		locked, err := s.lockout.RecordFailure(ctx, identity, req.IPAddress)
+		if err != nil {
+			utils.Errorf("Failed to apply lockout policy", utils.ErrorField(err.Error()))
+		}
+		if locked {
+			return nil, ErrAccountLocked
+		}
+		return nil, ErrInvalidCurrentPassword
+	}
+
+	if req.CurrentPassword == req.NewPassword {
+		return nil, ErrPasswordUnchanged
+	}
+
+	// Enforce password policy
+	if err := validatePassword(s.cfg.Password, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	// Hash new password
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.identityRepo.UpdatePassword(ctx, identity.ID, passwordHash); err != nil {
+			return err
+		}
+
+		// Revoke every other session
+		if err := s.tokenRepo.RevokeAllByIdentityIDExceptFamily(ctx, identity.ID, req.SessionID); err != nil {
+			return err
+		}
+
+		return s.publishPasswordChanged(ctx, identity.ID, "change")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangePasswordResponse{
+		Message: i18n.FromContext(ctx).T("password.changed"),
 	}, nil
 }
+
+func (s *PasswordService) publishPasswordChanged(ctx context.Context, identityID uuid.UUID, method string) error {
+	if s.events == nil {
+		return nil
+	}
+	identity, err := s.identityRepo.GetByID(ctx, identityID)
+	if err != nil {
+		return err
+	}
+	return s.events.Publish(ctx, &messaging.PasswordChanged{
+		IdentityRef: messaging.RefFor(identity),
+		Method:      method,
+	})
+}
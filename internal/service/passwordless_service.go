@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const passwordlessCodeDigits = 6
+
+var (
+	ErrPasswordlessThrottled    = i18n.NewError("errors.passwordless_throttled", "too many login emails requested, please try again later")
+	ErrInvalidPasswordlessToken = i18n.NewError("errors.invalid_passwordless_token", "invalid or expired login link or code")
+)
+
+// PasswordlessService sends one-time login links and codes by email and
+// redeems them, for identities that opted in.
+type PasswordlessService struct {
+	identityRepo repository.IdentityRepository
+	tokenRepo    repository.PasswordlessTokenRepository
+	email        *EmailService
+	tokenHasher  *utils.TokenHasher
+	cfg          *config.Config
+}
+
+func NewPasswordlessService(
+	identityRepo repository.IdentityRepository,
+	tokenRepo repository.PasswordlessTokenRepository,
+	email *EmailService,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
+) *PasswordlessService {
+	return &PasswordlessService{
+		identityRepo: identityRepo,
+		tokenRepo:    tokenRepo,
+		email:        email,
+		tokenHasher:  tokenHasher,
+		cfg:          cfg,
+	}
+}
+
+type PasswordlessRequestResponse struct {
+	Message string `json:"message"`
+}
+
+// RequestLogin emails a login link or code. Earlier links and codes stop
+// working. The response doesn't reveal whether the email belongs to an
+// identity that has passwordless login enabled.
+func (s *PasswordlessService) RequestLogin(ctx context.Context, email string, method entity.PasswordlessMethod) (*PasswordlessRequestResponse, error) {
+	resp := &PasswordlessRequestResponse{
+		Message: i18n.FromContext(ctx).T("passwordless." + string(method) + "_sent"),
+	}
+
+	identity, err := s.identityRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return resp, nil
+		}
+		return nil, err
+	}
+	if !identity.PasswordlessEnabled {
+		return resp, nil
+	}
+
+	if err := s.checkRequestThrottle(ctx, identity.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenRepo.MarkAllAsUsedByIdentityID(ctx, identity.ID); err != nil {
+		return nil, err
+	}
+
+	token := &entity.PasswordlessToken{
+		ID:         uuid.New(),
+		IdentityID: identity.ID,
+		Method:     method,
+		ExpiresAt:  time.Now().Add(s.cfg.Passwordless.TokenTTL),
+		CreatedAt:  time.Now(),
+	}
+
+	var secret string
+	if method == entity.PasswordlessMethodCode {
+		secret, err = generateNumericCode(passwordlessCodeDigits)
+		if err != nil {
+			return nil, err
+		}
+		token.TokenHash = s.tokenHasher.Hash(codeHashInput(token.ID, secret))
+	} else {
+		secret = generateToken()
+		token.TokenHash = s.tokenHasher.Hash(secret)
+	}
+
+	if _, err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+
+	if method == entity.PasswordlessMethodCode {
+		s.email.SendPasswordlessCode(ctx, identity, secret)
+	} else {
+		s.email.SendPasswordlessLink(ctx, identity, secret)
+	}
+
+	return resp, nil
+}
+
+// RedeemLink exchanges a login link token for the identity it was sent to.
+func (s *PasswordlessService) RedeemLink(ctx context.Context, token string) (*entity.Identity, error) {
+	loginToken, err := s.tokenRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPasswordlessToken
+		}
+		return nil, err
+	}
+	if !loginToken.IsValid() {
+		return nil, ErrInvalidPasswordlessToken
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, loginToken.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.PasswordlessEnabled {
+		return nil, ErrInvalidPasswordlessToken
+	}
+
+	if err := s.redeem(ctx, loginToken); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// RedeemCode checks a login code for an email. A wrong code uses up one of the
+// code's attempts; the identity is returned along with
+// ErrInvalidPasswordlessToken so callers can count the failure.
+func (s *PasswordlessService) RedeemCode(ctx context.Context, email, code string) (*entity.Identity, error) {
+	identity, err := s.identityRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPasswordlessToken
+		}
+		return nil, err
+	}
+	if !identity.PasswordlessEnabled {
+		return nil, ErrInvalidPasswordlessToken
+	}
+
+	// Requesting a new code invalidates the old ones, so only the latest can match
+	loginToken, err := s.tokenRepo.GetLatestByIdentityID(ctx, identity.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPasswordlessToken
+		}
+		return nil, err
+	}
+	if loginToken.Method != entity.PasswordlessMethodCode || !loginToken.IsValid() ||
+		loginToken.Attempts >= s.cfg.Passwordless.MaxAttempts {
+		return nil, ErrInvalidPasswordlessToken
+	}
+
+	if !s.codeMatches(loginToken, code) {
+		if err := s.tokenRepo.IncrementAttempts(ctx, loginToken.ID); err != nil {
+			utils.Errorf("Failed to count passwordless attempt", utils.ErrorField(err.Error()))
+		}
+		return identity, ErrInvalidPasswordlessToken
+	}
+
+	if err := s.redeem(ctx, loginToken); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+type PasswordlessStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetEnabled opts the user in to or out of passwordless login. Opting out
+// invalidates any link or code that is still outstanding.
+func (s *PasswordlessService) SetEnabled(ctx context.Context, userID uuid.UUID, enabled bool) (*PasswordlessStatusResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.identityRepo.UpdatePasswordlessEnabled(ctx, identity.ID, enabled); err != nil {
+		return nil, err
+	}
+	if !enabled {
+		if err := s.tokenRepo.MarkAllAsUsedByIdentityID(ctx, identity.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PasswordlessStatusResponse{Enabled: enabled}, nil
+}
+
+func (s *PasswordlessService) redeem(ctx context.Context, loginToken *entity.PasswordlessToken) error {
+	if err := s.tokenRepo.MarkAsUsed(ctx, loginToken.ID); err != nil {
+		if errors.Is(err, repository.ErrPasswordlessTokenUsed) {
+			return ErrInvalidPasswordlessToken
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *PasswordlessService) codeMatches(loginToken *entity.PasswordlessToken, code string) bool {
+	for _, candidate := range s.tokenHasher.Candidates(codeHashInput(loginToken.ID, code)) {
+		if hmac.Equal([]byte(candidate), []byte(loginToken.TokenHash)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PasswordlessService) checkRequestThrottle(ctx context.Context, identityID uuid.UUID) error {
+	latest, err := s.tokenRepo.GetLatestByIdentityID(ctx, identityID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < s.cfg.Passwordless.ResendCooldown {
+		return ErrPasswordlessThrottled
+	}
+
+	count, err := s.tokenRepo.CountCreatedSince(ctx, identityID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if count >= s.cfg.Passwordless.MaxRequestsPerDay {
+		return ErrPasswordlessThrottled
+	}
+
+	return nil
+}
+
+// codeHashInput binds a code to its token so equal codes sent to different
+// identities hash differently.
+func codeHashInput(tokenID uuid.UUID, code string) string {
+	return tokenID.String() + ":" + code
+}
+
+func generateNumericCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+)
+
+const maxProfileNameLength = 100
+
+var ErrInvalidProfile = i18n.NewError("errors.invalid_profile", "invalid profile")
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+type ProfileResponse struct {
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+	Phone       string `json:"phone"`
+	Locale      string `json:"locale"`
+	Timezone    string `json:"timezone"`
+}
+
+func newProfileResponse(profile entity.Profile) *ProfileResponse {
+	return &ProfileResponse{
+		FirstName:   profile.FirstName,
+		LastName:    profile.LastName,
+		DisplayName: profile.DisplayName,
+		Phone:       profile.Phone,
+		Locale:      profile.Locale,
+		Timezone:    profile.Timezone,
+	}
+}
+
+func (s *IdentityService) GetProfile(ctx context.Context, userID uuid.UUID) (*ProfileResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newProfileResponse(identity.Profile), nil
+}
+
+// UpdateProfileRequest changes the fields that are set; an empty string
+// clears a field.
+type UpdateProfileRequest struct {
+	FirstName   *string
+	LastName    *string
+	DisplayName *string
+	Phone       *string
+	Locale      *string
+	Timezone    *string
+}
+
+func (s *IdentityService) UpdateProfile(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*ProfileResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := identity.Profile
+	for _, field := range []struct {
+		value *string
+		dst   *string
+	}{
+		{req.FirstName, &profile.FirstName},
+		{req.LastName, &profile.LastName},
+		{req.DisplayName, &profile.DisplayName},
+		{req.Phone, &profile.Phone},
+		{req.Locale, &profile.Locale},
+		{req.Timezone, &profile.Timezone},
+	} {
+		if field.value != nil {
+			*field.dst = strings.TrimSpace(*field.value)
+		}
+	}
+
+	if profile, err = s.normalizeProfile(profile); err != nil {
+		return nil, err
+	}
+
+	if err := s.identityRepo.UpdateProfile(ctx, identity.ID, profile); err != nil {
+		return nil, err
+	}
+
+	return newProfileResponse(profile), nil
+}
+
+// normalizeProfile checks the profile fields and maps the locale to the
+// supported one it matches.
+func (s *IdentityService) normalizeProfile(profile entity.Profile) (entity.Profile, error) {
+	for name, value := range map[string]string{
+		"first_name":   profile.FirstName,
+		"last_name":    profile.LastName,
+		"display_name": profile.DisplayName,
+	} {
+		if utf8.RuneCountInString(value) > maxProfileNameLength {
+			return profile, fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidProfile, name, maxProfileNameLength)
+		}
+	}
+
+	if profile.Phone != "" && !e164Pattern.MatchString(profile.Phone) {
+		return profile, fmt.Errorf("%w: phone must be in E.164 format, e.g. +5511912345678", ErrInvalidProfile)
+	}
+
+	if profile.Timezone != "" {
+		// "Local" would be the server's zone, not a real place
+		if _, err := time.LoadLocation(profile.Timezone); err != nil || profile.Timezone == "Local" {
+			return profile, fmt.Errorf("%w: unknown timezone %q", ErrInvalidProfile, profile.Timezone)
+		}
+	}
+
+	if profile.Locale != "" {
+		locale, err := s.catalog.Supported(profile.Locale)
+		if err != nil {
+			return profile, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+		profile.Locale = locale
+	}
+
+	return profile, nil
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
 	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
 	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/external"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
 	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 	"github.com/gym-api/ms-ga-identifier/pkg/utils"
 	"gorm.io/gorm"
 )
@@ -18,23 +20,32 @@ type TokenService struct {
 	identityRepo repository.IdentityRepository
 	tokenRepo    repository.RefreshTokenRepository
 	authClient   *external.AuthClient
-	jwtUtil     *utils.JWTUtil
-	cfg         *config.Config
+	transactor   repository.Transactor
+	events       *messaging.Outbox
+	jwtUtil      *utils.JWTUtil
+	tokenHasher  *utils.TokenHasher
+	cfg          *config.Config
 }
 
 func NewTokenService(
 	identityRepo repository.IdentityRepository,
 	tokenRepo repository.RefreshTokenRepository,
 	authClient *external.AuthClient,
+	transactor repository.Transactor,
+	events *messaging.Outbox,
 	jwtUtil *utils.JWTUtil,
+	tokenHasher *utils.TokenHasher,
 	cfg *config.Config,
 ) *TokenService {
 	return &TokenService{
 		identityRepo: identityRepo,
 		tokenRepo:    tokenRepo,
 		authClient:   authClient,
-		jwtUtil:     jwtUtil,
-		cfg:         cfg,
+		transactor:   transactor,
+		events:       events,
+		jwtUtil:      jwtUtil,
+		tokenHasher:  tokenHasher,
+		cfg:          cfg,
 	}
 }
 
@@ -43,26 +54,49 @@ type RefreshTokenRequest struct {
 }
 
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
 }
 
-func (s *TokenService) RefreshToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error) {
-	// Hash the provided refresh token
-	refreshTokenHash := utils.HashToken(refreshToken)
+var (
+	ErrInvalidRefreshToken = i18n.NewError("errors.invalid_refresh_token", "invalid or expired refresh token")
+	ErrRefreshTokenRevoked = i18n.NewError("errors.refresh_token_revoked", "refresh token is expired or revoked")
+	errRefreshTokenReused  = i18n.NewError("errors.refresh_token_reused", "refresh token reuse detected, all sessions in this family have been revoked")
+)
 
-	// Look up in DB
-	tokenEntity, err := s.tokenRepo.GetByTokenHash(ctx, refreshTokenHash)
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. The presented token is revoked; presenting it again revokes
+// its whole family. clientID must match the OAuth client the token was issued
+// to, and is empty for tokens from a first-party login.
+func (s *TokenService) RefreshToken(ctx context.Context, refreshToken, clientID, ipAddress string) (*RefreshTokenResponse, error) {
+	// Look up in DB under every configured hash key
+	tokenEntity, err := s.tokenRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(refreshToken)...)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid or expired refresh token")
+			return nil, ErrInvalidRefreshToken
 		}
 		return nil, err
 	}
 
+	// Tokens are bound to the client they were issued to
+	if tokenEntity.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// A rotated token being replayed means someone else holds a copy
+	if tokenEntity.IsRotated() {
+		if err := s.handleReuse(ctx, tokenEntity, ipAddress); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReused
+	}
+
 	// Check not expired and not revoked
 	if !tokenEntity.IsActive() {
-		return nil, errors.New("refresh token is expired or revoked")
+		return nil, ErrRefreshTokenRevoked
 	}
 
 	// Get identity
@@ -71,32 +105,101 @@ func (s *TokenService) RefreshToken(ctx context.Context, refreshToken string) (*
 		return nil, err
 	}
 
-	// Get fresh roles and permissions from auth service
-	roles, permissions, err := s.authClient.ExtractRolesAndPermissions(identity.UserID)
-	if err != nil {
-		utils.Errorf("Failed to get roles and permissions during token refresh", utils.ErrorField(err.Error()))
+	// Locked or suspended identities can't extend their sessions
+	if identity.IsLocked() || identity.IsSuspended() {
+		return nil, ErrAccountLocked
 	}
 
-	// Issue new access token
-	accessToken, err := s.jwtUtil.GenerateToken(identity.UserID.String(), identity.Email, roles, permissions)
+	// Issue the new access token, with fresh roles and permissions from the
+	// auth service, before the presented token is retired so a failure leaves
+	// it usable
+	accessToken, err := sessionAccessToken(ctx, s.authClient, s.jwtUtil, s.cfg, identity, tokenEntity.FamilyID.String(), tokenEntity.ClientID, tokenEntity.Scope)
 	if err != nil {
 		return nil, err
 	}
 
+	// Rotate: issue the next token in the family and retire the presented one.
+	// The family keeps the expiry of its first token, so rotation can't extend
+	// a session past RefreshDuration.
+	newRefreshToken := generateToken()
+	next := &entity.RefreshToken{
+		ID:         uuid.New(),
+		IdentityID: tokenEntity.IdentityID,
+		FamilyID:   tokenEntity.FamilyID,
+		TokenHash:  s.tokenHasher.Hash(newRefreshToken),
+		ClientID:   tokenEntity.ClientID,
+		Scope:      tokenEntity.Scope,
+		DeviceInfo: tokenEntity.DeviceInfo,
+		IPAddress:  ipAddress,
+		ExpiresAt:  tokenEntity.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := s.tokenRepo.Rotate(ctx, tokenEntity.ID, next); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotRotatable) {
+			// Lost a race against another refresh with the same token
+			if err := s.handleReuse(ctx, tokenEntity, ipAddress); err != nil {
+				return nil, err
+			}
+			return nil, errRefreshTokenReused
+		}
+		return nil, err
+	}
+
 	return &RefreshTokenResponse{
-		AccessToken: accessToken,
-		ExpiresIn:   int(s.cfg.JWT.ExpirationTime.Seconds()),
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.JWT.ExpirationTime.Seconds()),
+		Scope:        tokenEntity.Scope,
 	}, nil
 }
 
+// handleReuse revokes every token in the family of a replayed token and
+// raises a security event.
+func (s *TokenService) handleReuse(ctx context.Context, token *entity.RefreshToken, ipAddress string) error {
+	utils.Warn("Refresh token reuse detected",
+		utils.String("family_id", token.FamilyID.String()),
+		utils.String("identity_id", token.IdentityID.String()),
+		utils.String("ip_address", ipAddress),
+	)
+
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.tokenRepo.RevokeFamily(ctx, token.FamilyID); err != nil {
+			return err
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		identity, err := s.identityRepo.GetByID(ctx, token.IdentityID)
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, &messaging.RefreshTokenReused{
+			IdentityRef: messaging.RefFor(identity),
+			FamilyID:    token.FamilyID.String(),
+			TokenID:     token.ID.String(),
+			DeviceInfo:  token.DeviceInfo,
+			IPAddress:   ipAddress,
+		})
+	})
+	if err != nil {
+		utils.Errorf("Failed to revoke refresh token family", utils.String("family_id", token.FamilyID.String()), utils.ErrorField(err.Error()))
+	}
+	return err
+}
+
 func (s *TokenService) GenerateRefreshToken(ctx context.Context, identityID uuid.UUID, deviceInfo, ipAddress string) (string, error) {
 	// Generate refresh token
 	refreshToken := generateToken()
-	refreshTokenHash := utils.HashToken(refreshToken)
+	refreshTokenHash := s.tokenHasher.Hash(refreshToken)
 
+	// A fresh login starts a new rotation family
 	refreshTokenEntity := &entity.RefreshToken{
 		ID:         uuid.New(),
 		IdentityID: identityID,
+		FamilyID:   uuid.New(),
 		TokenHash:  refreshTokenHash,
 		DeviceInfo: deviceInfo,
 		IPAddress:  ipAddress,
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVerificationThrottled    = i18n.NewError("errors.verification_throttled", "too many verification emails requested, please try again later")
+	ErrInvalidVerificationToken = i18n.NewError("errors.invalid_verification_token", "invalid or expired verification token")
+	ErrVerificationTokenUsed    = i18n.NewError("errors.verification_token_used", "verification token is expired or already used")
+)
+
+type VerificationService struct {
+	identityRepo     repository.IdentityRepository
+	verificationRepo repository.EmailVerificationRepository
+	transactor       repository.Transactor
+	email            *EmailService
+	events           *messaging.Outbox
+	tokenHasher      *utils.TokenHasher
+	cfg              *config.Config
+}
+
+func NewVerificationService(
+	identityRepo repository.IdentityRepository,
+	verificationRepo repository.EmailVerificationRepository,
+	transactor repository.Transactor,
+	email *EmailService,
+	events *messaging.Outbox,
+	tokenHasher *utils.TokenHasher,
+	cfg *config.Config,
+) *VerificationService {
+	return &VerificationService{
+		identityRepo:     identityRepo,
+		verificationRepo: verificationRepo,
+		transactor:       transactor,
+		email:            email,
+		events:           events,
+		tokenHasher:      tokenHasher,
+		cfg:              cfg,
+	}
+}
+
+type VerifyEmailResponse struct {
+	Message string `json:"message"`
+}
+
+type ResendVerificationResponse struct {
+	Message string `json:"message"`
+}
+
+// IssueToken creates a new verification token for identity, invalidating any
+// previously issued ones.
+func (s *VerificationService) IssueToken(ctx context.Context, identity *entity.Identity) error {
+	if err := s.verificationRepo.MarkAllAsUsedByIdentityID(ctx, identity.ID); err != nil {
+		return err
+	}
+
+	token := generateToken()
+	verificationToken := &entity.EmailVerificationToken{
+		ID:         uuid.New(),
+		IdentityID: identity.ID,
+		TokenHash:  s.tokenHasher.Hash(token),
+		ExpiresAt:  time.Now().Add(s.cfg.Verification.TokenTTL),
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := s.verificationRepo.Create(ctx, verificationToken); err != nil {
+		return err
+	}
+
+	s.email.SendVerification(ctx, identity, token)
+
+	return nil
+}
+
+func (s *VerificationService) VerifyEmail(ctx context.Context, token string) (*VerifyEmailResponse, error) {
+	// Look up in DB under every configured hash key
+	verificationToken, err := s.verificationRepo.GetByTokenHash(ctx, s.tokenHasher.Candidates(token)...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	// Check token validity
+	if !verificationToken.IsValid() {
+		return nil, ErrVerificationTokenUsed
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, verificationToken.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claiming the token and verifying the email happen together, so
+	// concurrent requests with the same token verify it once
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.verificationRepo.MarkAsUsed(ctx, verificationToken.ID); err != nil {
+			if errors.Is(err, repository.ErrVerificationTokenUsed) {
+				return ErrVerificationTokenUsed
+			}
+			return err
+		}
+
+		if err := s.identityRepo.SetEmailVerified(ctx, identity.ID); err != nil {
+			return err
+		}
+
+		// Only unverified identities become active; locked or suspended ones stay as they are
+		if identity.Status == entity.StatusUnverified {
+			if err := s.identityRepo.UpdateStatus(ctx, identity.ID, entity.StatusActive); err != nil {
+				return err
+			}
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.EmailVerified{IdentityRef: messaging.RefFor(identity)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyEmailResponse{
+		Message: i18n.FromContext(ctx).T("verification.verified"),
+	}, nil
+}
+
+// ResendVerification issues a fresh token unless the identity is unknown,
+// already verified, or has asked too often recently. The response does not
+// reveal which of these applied.
+func (s *VerificationService) ResendVerification(ctx context.Context, email string) (*ResendVerificationResponse, error) {
+	resp := &ResendVerificationResponse{
+		Message: i18n.FromContext(ctx).T("verification.sent"),
+	}
+
+	identity, err := s.identityRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return resp, nil
+		}
+		return nil, err
+	}
+
+	if identity.EmailVerified {
+		return resp, nil
+	}
+
+	if err := s.checkResendThrottle(ctx, identity.ID); err != nil {
+		if !errors.Is(err, ErrVerificationThrottled) {
+			return nil, err
+		}
+		// Answered like any other request, so it doesn't reveal the account
+		utils.Warn("Verification email resend throttled", utils.String("identity_id", identity.ID.String()))
+		return resp, nil
+	}
+
+	if err := s.IssueToken(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *VerificationService) checkResendThrottle(ctx context.Context, identityID uuid.UUID) error {
+	latest, err := s.verificationRepo.GetLatestByIdentityID(ctx, identityID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < s.cfg.Verification.ResendCooldown {
+		return ErrVerificationThrottled
+	}
+
+	count, err := s.verificationRepo.CountCreatedSince(ctx, identityID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if count >= s.cfg.Verification.MaxResendsPerDay {
+		return ErrVerificationThrottled
+	}
+
+	return nil
+}
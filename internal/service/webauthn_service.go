@@ -0,0 +1,414 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/entity"
+	"github.com/gym-api/ms-ga-identifier/internal/domain/repository"
+	"github.com/gym-api/ms-ga-identifier/internal/infrastructure/messaging"
+	"github.com/gym-api/ms-ga-identifier/pkg/config"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
+	"github.com/gym-api/ms-ga-identifier/pkg/utils"
+	"github.com/gym-api/ms-ga-identifier/pkg/webauthn"
+	"gorm.io/gorm"
+)
+
+const defaultPasskeyName = "Passkey"
+
+var (
+	ErrInvalidPasskey       = i18n.NewError("errors.invalid_passkey", "invalid passkey response")
+	ErrPasskeyAlreadyExists = i18n.NewError("errors.passkey_exists", "passkey is already registered")
+	ErrPasskeyNotFound      = i18n.NewError("errors.passkey_not_found", "passkey not found")
+)
+
+// WebAuthnService runs the WebAuthn ceremonies for registering passkeys and
+// logging in with them. Each ceremony's challenge is stored until the signed
+// response comes back and can only be answered once.
+type WebAuthnService struct {
+	identityRepo   repository.IdentityRepository
+	credentialRepo repository.WebAuthnCredentialRepository
+	sessionRepo    repository.WebAuthnSessionRepository
+	identifiers    *IdentifierService
+	transactor     repository.Transactor
+	events         *messaging.Outbox
+	tokenHasher    *utils.TokenHasher
+	rp             *webauthn.RelyingParty
+	cfg            *config.Config
+}
+
+func NewWebAuthnService(
+	identityRepo repository.IdentityRepository,
+	credentialRepo repository.WebAuthnCredentialRepository,
+	sessionRepo repository.WebAuthnSessionRepository,
+	identifiers *IdentifierService,
+	transactor repository.Transactor,
+	events *messaging.Outbox,
+	tokenHasher *utils.TokenHasher,
+	rp *webauthn.RelyingParty,
+	cfg *config.Config,
+) *WebAuthnService {
+	return &WebAuthnService{
+		identityRepo:   identityRepo,
+		credentialRepo: credentialRepo,
+		sessionRepo:    sessionRepo,
+		identifiers:    identifiers,
+		transactor:     transactor,
+		events:         events,
+		tokenHasher:    tokenHasher,
+		rp:             rp,
+		cfg:            cfg,
+	}
+}
+
+type PasskeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	BackedUp   bool       `json:"backed_up"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func toPasskeyResponse(c *entity.WebAuthnCredential) PasskeyResponse {
+	return PasskeyResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		BackedUp:   c.BackedUp,
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+}
+
+// BeginRegistration starts registering a new passkey for the user. The
+// user's existing credentials are excluded so an authenticator isn't
+// registered twice.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*webauthn.CreationOptions, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.credentialRepo.ListByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.startCeremony(ctx, entity.WebAuthnCeremonyRegistration, &identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := webauthn.UserEntity{
+		ID:          identity.UserID[:],
+		Name:        identity.Email,
+		DisplayName: identity.Email,
+	}
+	return s.rp.CreationOptions(challenge, user, descriptors(existing), s.cfg.WebAuthn.UserVerification, s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new
+// credential under name.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uuid.UUID, name string, cred *webauthn.RegistrationCredential) (*PasskeyResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, challenge, err := s.completeCeremony(ctx, entity.WebAuthnCeremonyRegistration, cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if session.IdentityID == nil || *session.IdentityID != identity.ID {
+		return nil, ErrInvalidPasskey
+	}
+
+	verified, err := s.rp.VerifyRegistration(cred, challenge, s.requireUserVerification())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	existing, err := s.credentialRepo.GetByCredentialID(ctx, verified.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrPasskeyAlreadyExists
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	var credential *entity.WebAuthnCredential
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		credential, err = s.credentialRepo.Create(ctx, &entity.WebAuthnCredential{
+			ID:             uuid.New(),
+			IdentityID:     identity.ID,
+			CredentialID:   verified.ID,
+			PublicKey:      verified.PublicKey,
+			Algorithm:      verified.Algorithm,
+			SignCount:      verified.SignCount,
+			AAGUID:         verified.AAGUID,
+			Transports:     verified.Transports,
+			Name:           name,
+			BackupEligible: verified.BackupEligible,
+			BackedUp:       verified.BackedUp,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.PasskeyAdded{
+			IdentityRef: messaging.RefFor(identity),
+			PasskeyID:   credential.ID.String(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := toPasskeyResponse(credential)
+	return &resp, nil
+}
+
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID uuid.UUID) ([]PasskeyResponse, error) {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.credentialRepo.ListByIdentityID(ctx, identity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]PasskeyResponse, 0, len(credentials))
+	for _, c := range credentials {
+		resp = append(resp, toPasskeyResponse(c))
+	}
+	return resp, nil
+}
+
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, id uuid.UUID) error {
+	identity, err := s.identityRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.credentialRepo.Delete(ctx, id, identity.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPasskeyNotFound
+			}
+			return err
+		}
+
+		if s.events == nil {
+			return nil
+		}
+		return s.events.Publish(ctx, &messaging.PasskeyRemoved{
+			IdentityRef: messaging.RefFor(identity),
+			PasskeyID:   id.String(),
+		})
+	})
+}
+
+// BeginLogin starts a passkey login. With an identifier the options list
+// that identity's credentials, which security keys without discoverable
+// credentials need; without one the authenticator offers its passkeys for
+// this site.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, value string, identifierType entity.IdentifierType) (*webauthn.RequestOptions, error) {
+	var identityID *uuid.UUID
+	var allow []webauthn.CredentialDescriptor
+	if value != "" {
+		identifier, err := s.identifiers.Resolve(ctx, value, identifierType)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if identifier != nil {
+			credentials, err := s.credentialRepo.ListByIdentityID(ctx, identifier.IdentityID)
+			if err != nil {
+				return nil, err
+			}
+			if len(credentials) > 0 {
+				identityID = &identifier.IdentityID
+				allow = descriptors(credentials)
+			}
+		}
+		// Unknown identifiers and accounts without passkeys get made up
+		// credentials, so the response doesn't tell whether the account exists
+		if allow == nil {
+			allow = s.decoyDescriptors(value, identifierType)
+		}
+	}
+
+	challenge, err := s.startCeremony(ctx, entity.WebAuthnCeremonyLogin, identityID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rp.RequestOptions(challenge, allow, s.cfg.WebAuthn.UserVerification, s.cfg.WebAuthn.Timeout), nil
+}
+
+// FinishLogin verifies a signed login response and returns the identity that
+// owns the credential, and whether the authenticator verified the user (with
+// a PIN or biometric) rather than only checking presence.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, cred *webauthn.AssertionCredential) (*entity.Identity, bool, error) {
+	session, challenge, err := s.completeCeremony(ctx, entity.WebAuthnCeremonyLogin, cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, false, err
+	}
+
+	credential, err := s.credentialRepo.GetByCredentialID(ctx, cred.RawID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrInvalidPasskey
+		}
+		return nil, false, err
+	}
+	if session.IdentityID != nil && *session.IdentityID != credential.IdentityID {
+		return nil, false, ErrInvalidPasskey
+	}
+
+	identity, err := s.identityRepo.GetByID(ctx, credential.IdentityID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(cred.Response.UserHandle) > 0 && !bytes.Equal(cred.Response.UserHandle, identity.UserID[:]) {
+		return nil, false, ErrInvalidPasskey
+	}
+
+	assertion, err := s.rp.VerifyAssertion(cred, challenge, credential.PublicKey, credential.SignCount, s.requireUserVerification())
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegressed) {
+			utils.Warn("Passkey sign count went backwards, possible cloned authenticator",
+				utils.String("user_id", identity.UserID.String()),
+				utils.String("passkey_id", credential.ID.String()),
+			)
+		}
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	if err := s.credentialRepo.UpdateUsage(ctx, credential.ID, assertion.SignCount, assertion.BackedUp); err != nil {
+		if errors.Is(err, repository.ErrSignCountNotIncreased) {
+			return nil, false, ErrInvalidPasskey
+		}
+		return nil, false, err
+	}
+
+	return identity, assertion.UserVerified, nil
+}
+
+// startCeremony stores a new challenge for a ceremony and returns it.
+func (s *WebAuthnService) startCeremony(ctx context.Context, ceremony entity.WebAuthnCeremony, identityID *uuid.UUID) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &entity.WebAuthnSession{
+		ID:            uuid.New(),
+		IdentityID:    identityID,
+		Ceremony:      ceremony,
+		ChallengeHash: s.tokenHasher.Hash(encodeChallenge(challenge)),
+		ExpiresAt:     time.Now().Add(s.cfg.WebAuthn.Timeout),
+		CreatedAt:     time.Now(),
+	}
+	if _, err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// completeCeremony finds the ceremony a response was signed for through the
+// challenge in its client data and marks it used, so a response can only be
+// submitted once even if it turns out to be invalid.
+func (s *WebAuthnService) completeCeremony(ctx context.Context, ceremony entity.WebAuthnCeremony, clientDataJSON []byte) (*entity.WebAuthnSession, []byte, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	session, err := s.sessionRepo.GetByChallengeHash(ctx, s.tokenHasher.Candidates(encodeChallenge(challenge))...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidPasskey
+		}
+		return nil, nil, err
+	}
+	if session.Ceremony != ceremony || !session.IsValid() {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	if err := s.sessionRepo.MarkAsUsed(ctx, session.ID); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnSessionUsed) {
+			return nil, nil, ErrInvalidPasskey
+		}
+		return nil, nil, err
+	}
+	return session, challenge, nil
+}
+
+func (s *WebAuthnService) requireUserVerification() bool {
+	return s.cfg.WebAuthn.UserVerification == webauthn.UserVerificationRequired
+}
+
+func encodeChallenge(challenge []byte) string {
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+// decoyDescriptors returns one or two credentials that don't exist, derived
+// from the normalized identifier so asking again gives the same list.
+func (s *WebAuthnService) decoyDescriptors(value string, identifierType entity.IdentifierType) []webauthn.CredentialDescriptor {
+	key := strings.TrimSpace(value)
+	types := []entity.IdentifierType{identifierType}
+	if identifierType == "" {
+		types = guessIdentifierTypes(value)
+	}
+	for _, t := range types {
+		if normalized, err := normalizeIdentifier(t, value); err == nil {
+			key = string(t) + ":" + normalized
+			break
+		}
+	}
+
+	seed := sha256.Sum256([]byte(s.tokenHasher.Hash("webauthn-decoy:" + key)))
+	result := make([]webauthn.CredentialDescriptor, 0, 2)
+	for i := 0; i < 1+int(seed[0]%2); i++ {
+		id := sha256.Sum256(append(seed[:], byte(i)))
+		result = append(result, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         id[:],
+			Transports: []string{"internal", "hybrid"},
+		})
+	}
+	return result
+}
+
+func descriptors(credentials []*entity.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	result := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		result = append(result, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         c.CredentialID,
+			Transports: c.Transports,
+		})
+	}
+	return result
+}
@@ -3,18 +3,32 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis"`
-	JWT      JWTConfig      `yaml:"jwt"`
-	Auth     AuthConfig     `yaml:"auth"`
-	Kafka    KafkaConfig    `yaml:"kafka"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Redis        RedisConfig        `yaml:"redis"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Kafka        KafkaConfig        `yaml:"kafka"`
+	TokenHash    TokenHashConfig    `yaml:"token_hash"`
+	Verification VerificationConfig `yaml:"verification"`
+	Password     PasswordConfig     `yaml:"password"`
+	Lockout      LockoutConfig      `yaml:"lockout"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	OIDC         OIDCConfig         `yaml:"oidc"`
+	MFA          MFAConfig          `yaml:"mfa"`
+	WebAuthn     WebAuthnConfig     `yaml:"webauthn"`
+	Passwordless PasswordlessConfig `yaml:"passwordless"`
+	Kiosk        KioskConfig        `yaml:"kiosk"`
+	Mail         MailConfig         `yaml:"mail"`
+	I18n         I18nConfig         `yaml:"i18n"`
+	Admin        AdminConfig        `yaml:"admin"`
 }
 
 type ServerConfig struct {
@@ -38,20 +52,236 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// JWTConfig configures access token signing. Keys live in KeyDir as PEM files;
+// a key is generated there if none exists. The active key is replaced every
+// RotationInterval (0 disables rotation) and retired keys stay published until
+// the tokens they signed have expired.
 type JWTConfig struct {
-	Secret         string        `yaml:"secret"`
-	ExpirationTime time.Duration `yaml:"expiration_time"`
-	RefreshDuration time.Duration `yaml:"refresh_duration"`
+	Algorithm        string        `yaml:"algorithm"`
+	KeyDir           string        `yaml:"key_dir"`
+	RotationInterval time.Duration `yaml:"rotation_interval"`
+	ExpirationTime   time.Duration `yaml:"expiration_time"`
+	RefreshDuration  time.Duration `yaml:"refresh_duration"`
 }
 
+// AuthConfig points at the auth service, which owns roles and permissions.
+// Each request to it times out after Timeout seconds and failures are retried
+// MaxRetries times after a jittered RetryBackoff that doubles each time.
+// BreakerThreshold failures in a row stop calls for BreakerCooldown.
+//
+// A user's roles and permissions are cached (in Redis, or in memory without
+// it) for PermissionCacheTTL and then served for PermissionStaleWindow more
+// while being refreshed in the background; role-change events from the auth
+// service clear the cache earlier (see KafkaConsumerConfig). OutagePolicy is
+// what happens when the auth service can't be reached: "fail_closed" refuses
+// to issue tokens, "stale_cache" issues them with cached roles up to
+// PermissionMaxStale old.
 type AuthConfig struct {
-	ServiceURL string `yaml:"service_url"`
-	Timeout    int    `yaml:"timeout"`
+	ServiceURL            string        `yaml:"service_url"`
+	Timeout               int           `yaml:"timeout"`
+	MaxRetries            int           `yaml:"max_retries"`
+	RetryBackoff          time.Duration `yaml:"retry_backoff"`
+	BreakerThreshold      int           `yaml:"breaker_threshold"`
+	BreakerCooldown       time.Duration `yaml:"breaker_cooldown"`
+	PermissionCacheTTL    time.Duration `yaml:"permission_cache_ttl"`
+	PermissionStaleWindow time.Duration `yaml:"permission_stale_window"`
+	PermissionMaxStale    time.Duration `yaml:"permission_max_stale"`
+	OutagePolicy          string        `yaml:"outage_policy"`
 }
 
+// DefaultTokenHashPepper is the placeholder pepper of the default config. It
+// is refused in production.
+const DefaultTokenHashPepper = "your-token-pepper-change-in-production"
+
+// TokenHashConfig holds the HMAC peppers used to hash refresh and reset tokens.
+// To rotate, add a new key, point CurrentKeyID at it and keep the old key until
+// every token hashed with it has expired.
+type TokenHashConfig struct {
+	CurrentKeyID string            `yaml:"current_key_id"`
+	Keys         map[string]string `yaml:"keys"`
+}
+
+type VerificationConfig struct {
+	TokenTTL         time.Duration `yaml:"token_ttl"`
+	ResendCooldown   time.Duration `yaml:"resend_cooldown"`
+	MaxResendsPerDay int           `yaml:"max_resends_per_day"`
+}
+
+type PasswordConfig struct {
+	MinLength      int  `yaml:"min_length"`
+	RequireUpper   bool `yaml:"require_upper"`
+	RequireLower   bool `yaml:"require_lower"`
+	RequireDigit   bool `yaml:"require_digit"`
+	RequireSpecial bool `yaml:"require_special"`
+}
+
+// LockoutConfig controls account lockout after failed logins. MaxFailures
+// failures within Window lock the account for BaseDuration, doubling with each
+// further lockout up to MaxDuration. The MaxLockouts-th lockout is permanent
+// and needs an admin to unlock.
+type LockoutConfig struct {
+	MaxFailures  int           `yaml:"max_failures"`
+	Window       time.Duration `yaml:"window"`
+	BaseDuration time.Duration `yaml:"base_duration"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+	MaxLockouts  int           `yaml:"max_lockouts"`
+}
+
+// RateLimitConfig configures request rate limits for public endpoints.
+// Algorithm is "sliding_window" or "token_bucket". Rules are keyed by route
+// name (login, register, forgot_password, refresh, passwordless, kiosk).
+type RateLimitConfig struct {
+	Enabled   bool                     `yaml:"enabled"`
+	Algorithm string                   `yaml:"algorithm"`
+	Rules     map[string]RateLimitRule `yaml:"rules"`
+}
+
+// RateLimitRule allows Limit requests per Window for each key. KeyBy lists the
+// request attributes limited independently: "ip" and/or "email". "email" also
+// covers the identifier of logins by phone, username or card.
+type RateLimitRule struct {
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+	KeyBy  []string      `yaml:"key_by"`
+}
+
+// OIDCConfig configures the OpenID Connect provider. Issuer is the public base
+// URL of this service and must match what clients use to reach it.
+type OIDCConfig struct {
+	Issuer               string        `yaml:"issuer"`
+	AuthorizationCodeTTL time.Duration `yaml:"authorization_code_ttl"`
+	IDTokenTTL           time.Duration `yaml:"id_token_ttl"`
+}
+
+// MFAConfig configures TOTP two-factor authentication. SecretKey encrypts the
+// TOTP secrets at rest; changing it invalidates existing enrollments.
+// AllowedSkew is how many 30 second steps either side of now are accepted.
+type MFAConfig struct {
+	Issuer               string        `yaml:"issuer"`
+	SecretKey            string        `yaml:"secret_key"`
+	ChallengeTTL         time.Duration `yaml:"challenge_ttl"`
+	MaxChallengeAttempts int           `yaml:"max_challenge_attempts"`
+	AllowedSkew          int           `yaml:"allowed_skew"`
+	RecoveryCodeCount    int           `yaml:"recovery_code_count"`
+}
+
+// WebAuthnConfig configures passkey login. RPID is the domain passkeys are
+// bound to and Origins lists the exact web origins allowed to use them.
+// UserVerification is "required", "preferred" or "discouraged"; logins
+// without user verification still need the TOTP step if MFA is enabled.
+type WebAuthnConfig struct {
+	RPID             string        `yaml:"rp_id"`
+	RPName           string        `yaml:"rp_name"`
+	Origins          []string      `yaml:"origins"`
+	UserVerification string        `yaml:"user_verification"`
+	Timeout          time.Duration `yaml:"timeout"`
+}
+
+// PasswordlessConfig configures login by emailed link or code. LinkURL is the
+// page of the web app that receives the link token as the token query
+// parameter. A code is rejected for good after MaxAttempts wrong guesses.
+type PasswordlessConfig struct {
+	LinkURL           string        `yaml:"link_url"`
+	TokenTTL          time.Duration `yaml:"token_ttl"`
+	MaxAttempts       int           `yaml:"max_attempts"`
+	ResendCooldown    time.Duration `yaml:"resend_cooldown"`
+	MaxRequestsPerDay int           `yaml:"max_requests_per_day"`
+}
+
+// KioskConfig configures check-in kiosks. Tokens issued at a kiosk are valid
+// for TokenTTL and only for Audience, the check-in service. A card is locked
+// for PINLockout after MaxPINFailures wrong PINs; until a correct PIN, each
+// further wrong one locks it again.
+type KioskConfig struct {
+	Audience       string        `yaml:"audience"`
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+	MaxPINFailures int           `yaml:"max_pin_failures"`
+	PINLockout     time.Duration `yaml:"pin_lockout"`
+}
+
+// MailConfig configures outgoing email. Transport is "smtp", "file" (each
+// message is written to FileDir as an .eml file) or "log" (only recipient and
+// subject are logged). VerifyEmailURL and ResetPasswordURL are pages of the
+// web app that receive the token as the token query parameter.
+type MailConfig struct {
+	Transport        string          `yaml:"transport"`
+	From             string          `yaml:"from"`
+	FileDir          string          `yaml:"file_dir"`
+	SMTP             SMTPConfig      `yaml:"smtp"`
+	Queue            MailQueueConfig `yaml:"queue"`
+	VerifyEmailURL   string          `yaml:"verify_email_url"`
+	ResetPasswordURL string          `yaml:"reset_password_url"`
+}
+
+type SMTPConfig struct {
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// MailQueueConfig controls asynchronous delivery. A message that fails is
+// retried up to MaxAttempts times, waiting RetryBackoff and doubling it after
+// each attempt.
+type MailQueueConfig struct {
+	Workers      int           `yaml:"workers"`
+	Size         int           `yaml:"size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// I18nConfig sets the locale used when neither the request nor the identity
+// asks for one the catalog has.
+type I18nConfig struct {
+	DefaultLocale string `yaml:"default_locale"`
+}
+
+// AdminConfig guards the admin API: callers need one of Roles on top of the
+// permission each admin route requires.
+type AdminConfig struct {
+	Roles []string `yaml:"roles"`
+}
+
+// KafkaConfig sets where identity events go. Events are CloudEvents;
+// ContentMode is "structured" to send the whole event as the message value
+// or "binary" to send its data with the attributes as ce_ headers.
 type KafkaConfig struct {
-	Brokers []string `yaml:"brokers"`
-	Topic   string   `yaml:"topic"`
+	Brokers     []string            `yaml:"brokers"`
+	Topic       string              `yaml:"topic"`
+	ContentMode string              `yaml:"content_mode"`
+	Outbox      OutboxConfig        `yaml:"outbox"`
+	Consumer    KafkaConsumerConfig `yaml:"consumer"`
+}
+
+// OutboxConfig controls the relay that publishes outbox events to Kafka. It
+// checks for new events every PollInterval, BatchSize at a time. A failed
+// event is retried after RetryBackoff, doubling up to MaxBackoff, and
+// dead-lettered after MaxAttempts. Published events are kept for Retention.
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+	Retention    time.Duration `yaml:"retention"`
+}
+
+// KafkaConsumerConfig controls the consumer of the auth service's events,
+// which clears cached permissions when a user's roles change. It joins
+// consumer group GroupID on Topics. With RevokeSessions, a role change also
+// signs the user out everywhere so no token keeps the old roles. A message
+// whose handling fails is retried after RetryBackoff, doubling up to
+// MaxBackoff, and skipped after MaxAttempts unless it signs users out; those
+// are retried until handled.
+type KafkaConsumerConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	GroupID        string        `yaml:"group_id"`
+	Topics         []string      `yaml:"topics"`
+	RevokeSessions bool          `yaml:"revoke_sessions"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
 }
 
 func Load() *Config {
@@ -98,17 +328,136 @@ func defaultConfig() *Config {
 			DB:       0,
 		},
 		JWT: JWTConfig{
-			Secret:          "your-secret-key-change-in-production",
-			ExpirationTime:  24 * time.Hour,
-			RefreshDuration: 7 * 24 * time.Hour,
+			Algorithm:        "RS256",
+			KeyDir:           "keys",
+			RotationInterval: 30 * 24 * time.Hour,
+			ExpirationTime:   24 * time.Hour,
+			RefreshDuration:  7 * 24 * time.Hour,
 		},
 		Auth: AuthConfig{
-			ServiceURL: "http://localhost:8081",
-			Timeout:    30,
+			ServiceURL:            "http://localhost:8081",
+			Timeout:               5,
+			MaxRetries:            2,
+			RetryBackoff:          100 * time.Millisecond,
+			BreakerThreshold:      5,
+			BreakerCooldown:       30 * time.Second,
+			PermissionCacheTTL:    time.Hour,
+			PermissionStaleWindow: 5 * time.Minute,
+			PermissionMaxStale:    24 * time.Hour,
+			OutagePolicy:          "fail_closed",
 		},
 		Kafka: KafkaConfig{
-			Brokers: []string{"localhost:9092"},
-			Topic:   "identity-events",
+			Brokers:     []string{"localhost:9092"},
+			Topic:       "identity-events",
+			ContentMode: "structured",
+			Outbox: OutboxConfig{
+				PollInterval: time.Second,
+				BatchSize:    100,
+				MaxAttempts:  10,
+				RetryBackoff: time.Second,
+				MaxBackoff:   5 * time.Minute,
+				Retention:    7 * 24 * time.Hour,
+			},
+			Consumer: KafkaConsumerConfig{
+				GroupID:      "ms-ga-identifier",
+				Topics:       []string{"auth-events"},
+				MaxAttempts:  5,
+				RetryBackoff: time.Second,
+				MaxBackoff:   time.Minute,
+			},
+		},
+		Verification: VerificationConfig{
+			TokenTTL:         24 * time.Hour,
+			ResendCooldown:   time.Minute,
+			MaxResendsPerDay: 5,
+		},
+		Password: PasswordConfig{
+			MinLength:    8,
+			RequireUpper: true,
+			RequireLower: true,
+			RequireDigit: true,
+		},
+		Lockout: LockoutConfig{
+			MaxFailures:  5,
+			Window:       15 * time.Minute,
+			BaseDuration: 5 * time.Minute,
+			MaxDuration:  24 * time.Hour,
+			MaxLockouts:  5,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   true,
+			Algorithm: "sliding_window",
+			Rules: map[string]RateLimitRule{
+				"login":           {Limit: 10, Window: time.Minute, KeyBy: []string{"ip", "email"}},
+				"register":        {Limit: 5, Window: time.Hour, KeyBy: []string{"ip"}},
+				"forgot_password": {Limit: 5, Window: 15 * time.Minute, KeyBy: []string{"ip", "email"}},
+				"refresh":         {Limit: 30, Window: time.Minute, KeyBy: []string{"ip"}},
+				"passwordless":    {Limit: 5, Window: 15 * time.Minute, KeyBy: []string{"ip", "email"}},
+				"kiosk":           {Limit: 60, Window: time.Minute, KeyBy: []string{"ip"}},
+			},
+		},
+		OIDC: OIDCConfig{
+			Issuer:               "http://localhost:8080",
+			AuthorizationCodeTTL: time.Minute,
+			IDTokenTTL:           time.Hour,
+		},
+		MFA: MFAConfig{
+			Issuer:               "Gym",
+			SecretKey:            "your-mfa-secret-key-change-in-production",
+			ChallengeTTL:         5 * time.Minute,
+			MaxChallengeAttempts: 5,
+			AllowedSkew:          1,
+			RecoveryCodeCount:    10,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:             "localhost",
+			RPName:           "Gym",
+			Origins:          []string{"http://localhost:3000"},
+			UserVerification: "preferred",
+			Timeout:          5 * time.Minute,
+		},
+		Passwordless: PasswordlessConfig{
+			LinkURL:           "http://localhost:3000/login/passwordless",
+			TokenTTL:          15 * time.Minute,
+			MaxAttempts:       5,
+			ResendCooldown:    time.Minute,
+			MaxRequestsPerDay: 10,
+		},
+		Kiosk: KioskConfig{
+			Audience:       "gym-checkin",
+			TokenTTL:       2 * time.Minute,
+			MaxPINFailures: 3,
+			PINLockout:     30 * time.Minute,
+		},
+		Mail: MailConfig{
+			Transport: "file",
+			From:      "Gym <no-reply@localhost>",
+			FileDir:   "tmp/mail",
+			SMTP: SMTPConfig{
+				Host:    "localhost",
+				Port:    587,
+				Timeout: 10 * time.Second,
+			},
+			Queue: MailQueueConfig{
+				Workers:      2,
+				Size:         100,
+				MaxAttempts:  5,
+				RetryBackoff: 2 * time.Second,
+			},
+			VerifyEmailURL:   "http://localhost:3000/verify-email",
+			ResetPasswordURL: "http://localhost:3000/reset-password",
+		},
+		I18n: I18nConfig{
+			DefaultLocale: "en",
+		},
+		Admin: AdminConfig{
+			Roles: []string{"admin", "staff"},
+		},
+		TokenHash: TokenHashConfig{
+			CurrentKeyID: "v1",
+			Keys: map[string]string{
+				"v1": DefaultTokenHashPepper,
+			},
 		},
 	}
 }
@@ -145,10 +494,66 @@ func overrideFromEnv(cfg *Config) {
 			cfg.Redis.Port = port
 		}
 	}
-	if v := os.Getenv("JWT_SECRET"); v != "" {
-		cfg.JWT.Secret = v
+	if v := os.Getenv("JWT_ALGORITHM"); v != "" {
+		cfg.JWT.Algorithm = v
+	}
+	if v := os.Getenv("JWT_KEY_DIR"); v != "" {
+		cfg.JWT.KeyDir = v
+	}
+	if v := os.Getenv("OIDC_ISSUER"); v != "" {
+		cfg.OIDC.Issuer = v
+	}
+	if v := os.Getenv("MFA_SECRET_KEY"); v != "" {
+		cfg.MFA.SecretKey = v
+	}
+	if v := os.Getenv("WEBAUTHN_RP_ID"); v != "" {
+		cfg.WebAuthn.RPID = v
+	}
+	if v := os.Getenv("WEBAUTHN_ORIGINS"); v != "" {
+		cfg.WebAuthn.Origins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PASSWORDLESS_LINK_URL"); v != "" {
+		cfg.Passwordless.LinkURL = v
+	}
+	if v := os.Getenv("MAIL_TRANSPORT"); v != "" {
+		cfg.Mail.Transport = v
+	}
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		cfg.Mail.From = v
+	}
+	if v := os.Getenv("SMTP_HOST"); v != "" {
+		cfg.Mail.SMTP.Host = v
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			cfg.Mail.SMTP.Port = port
+		}
+	}
+	if v := os.Getenv("SMTP_USERNAME"); v != "" {
+		cfg.Mail.SMTP.Username = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.Mail.SMTP.Password = v
+	}
+	if v := os.Getenv("DEFAULT_LOCALE"); v != "" {
+		cfg.I18n.DefaultLocale = v
+	}
+	if v := os.Getenv("ADMIN_ROLES"); v != "" {
+		cfg.Admin.Roles = strings.Split(v, ",")
 	}
 	if v := os.Getenv("AUTH_SERVICE_URL"); v != "" {
 		cfg.Auth.ServiceURL = v
 	}
+	if v := os.Getenv("AUTH_OUTAGE_POLICY"); v != "" {
+		cfg.Auth.OutagePolicy = v
+	}
+	if v := os.Getenv("TOKEN_HASH_KEY_ID"); v != "" {
+		cfg.TokenHash.CurrentKeyID = v
+	}
+	if v := os.Getenv("TOKEN_HASH_PEPPER"); v != "" {
+		if cfg.TokenHash.Keys == nil {
+			cfg.TokenHash.Keys = make(map[string]string)
+		}
+		cfg.TokenHash.Keys[cfg.TokenHash.CurrentKeyID] = v
+	}
 }
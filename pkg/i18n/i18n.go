@@ -0,0 +1,278 @@
+// Package i18n holds the message catalog used for API responses and emails.
+//
+// Messages live in locales/<locale>.yaml, one file per locale, and are
+// text/template strings addressed by dotted keys, e.g. "password.reset_sent".
+// A message missing from a locale falls back to the default locale.
+package i18n
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales/*.yaml
+var localeFS embed.FS
+
+var ErrUnsupportedLocale = NewError("errors.unsupported_locale", "unsupported locale")
+
+// Error is an error with a catalog message, for errors that reach API
+// clients. Its Error text is the default locale's wording, for logs; the
+// catalog key is what gets translated, so wrapping doesn't get in the way.
+type Error struct {
+	key  string
+	text string
+}
+
+func NewError(key, text string) *Error {
+	return &Error{key: key, text: text}
+}
+
+func (e *Error) Error() string {
+	return e.text
+}
+
+func (e *Error) Key() string {
+	return e.key
+}
+
+// Catalog is the set of translated messages for every supported locale.
+type Catalog struct {
+	defaultLocale string
+	// locales lists the supported locales, default first, in the order the
+	// matcher was built from
+	locales  []string
+	matcher  language.Matcher
+	messages map[string]map[string]*template.Template
+}
+
+// NewCatalog loads the embedded locale files. defaultLocale must be one of
+// them.
+func NewCatalog(defaultLocale string) (*Catalog, error) {
+	files, err := fs.Glob(localeFS, "locales/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		messages: make(map[string]map[string]*template.Template),
+	}
+	texts := make(map[string]map[string]string)
+	for _, file := range files {
+		data, err := fs.ReadFile(localeFS, file)
+		if err != nil {
+			return nil, err
+		}
+		var tree map[string]interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		locale := strings.TrimSuffix(path.Base(file), ".yaml")
+		if _, err := language.Parse(locale); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		texts[locale] = make(map[string]string)
+		if err := flatten("", tree, texts[locale]); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	defaultTexts, ok := texts[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("%w: no messages for default locale %q", ErrUnsupportedLocale, defaultLocale)
+	}
+	c.defaultLocale = defaultLocale
+
+	for locale, messages := range texts {
+		c.messages[locale] = make(map[string]*template.Template, len(messages))
+		for key, text := range messages {
+			if _, ok := defaultTexts[key]; !ok {
+				return nil, fmt.Errorf("%s: message %q is not in the default locale", locale, key)
+			}
+			tmpl, err := template.New(key).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", locale, err)
+			}
+			c.messages[locale][key] = tmpl
+		}
+		if locale != defaultLocale {
+			c.locales = append(c.locales, locale)
+		}
+	}
+	sort.Strings(c.locales)
+	c.locales = append([]string{defaultLocale}, c.locales...)
+
+	tags := make([]language.Tag, len(c.locales))
+	for i, locale := range c.locales {
+		tags[i] = language.MustParse(locale)
+	}
+	c.matcher = language.NewMatcher(tags)
+
+	return c, nil
+}
+
+// flatten turns nested YAML maps into dotted keys.
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) error {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case string:
+			out[key] = v
+		case map[string]interface{}:
+			if err := flatten(key, v, out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %q is not a string", key)
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+// Locales lists the supported locales, default first.
+func (c *Catalog) Locales() []string {
+	return append([]string(nil), c.locales...)
+}
+
+// Match picks the supported locale for the first preference that has one.
+// Each preference is a locale or an Accept-Language header value; empty
+// ones are skipped. Without a match it returns the default locale.
+func (c *Catalog) Match(preferences ...string) string {
+	for _, pref := range preferences {
+		if locale, ok := c.match(pref); ok {
+			return locale
+		}
+	}
+	return c.defaultLocale
+}
+
+// Supported returns the supported locale for an explicitly chosen one, e.g.
+// "pt" for "pt-BR", or ErrUnsupportedLocale.
+func (c *Catalog) Supported(locale string) (string, error) {
+	if match, ok := c.match(locale); ok {
+		return match, nil
+	}
+	return "", fmt.Errorf("%w: %q, choose one of %s", ErrUnsupportedLocale, locale, strings.Join(c.locales, ", "))
+}
+
+func (c *Catalog) match(pref string) (string, bool) {
+	if strings.TrimSpace(pref) == "" {
+		return "", false
+	}
+	tags, _, err := language.ParseAcceptLanguage(pref)
+	if err != nil || len(tags) == 0 {
+		return "", false
+	}
+	_, index, confidence := c.matcher.Match(tags...)
+	if confidence < language.High {
+		return "", false
+	}
+	return c.locales[index], true
+}
+
+// Translate renders the message key in locale with data. It falls back to
+// the default locale, and to the key itself when no locale has the message.
+func (c *Catalog) Translate(locale, key string, data interface{}) string {
+	tmpl, ok := c.messages[locale][key]
+	if !ok {
+		if tmpl, ok = c.messages[c.defaultLocale][key]; !ok {
+			return key
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return key
+	}
+	return buf.String()
+}
+
+// Localizer returns a Localizer for locale, which should come from Match or
+// Supported.
+func (c *Catalog) Localizer(locale string) *Localizer {
+	return &Localizer{catalog: c, locale: locale}
+}
+
+// Localizer translates messages into one locale.
+type Localizer struct {
+	catalog *Catalog
+	locale  string
+}
+
+func (l *Localizer) Locale() string {
+	if l == nil {
+		return ""
+	}
+	return l.locale
+}
+
+// T renders the message key, with data when given.
+func (l *Localizer) T(key string, data ...interface{}) string {
+	if l == nil {
+		return key
+	}
+	var d interface{}
+	if len(data) > 0 {
+		d = data[0]
+	}
+	return l.catalog.Translate(l.locale, key, d)
+}
+
+// Message translates text if it is a message key and returns anything else
+// unchanged.
+func (l *Localizer) Message(text string) string {
+	if l == nil {
+		return text
+	}
+	if _, ok := l.catalog.messages[l.catalog.defaultLocale][text]; !ok {
+		return text
+	}
+	return l.catalog.Translate(l.locale, text, nil)
+}
+
+// ErrorMessage translates the first Error in err's chain. Detail added by
+// wrapping it, as in fmt.Errorf("%w: detail", ErrX), is kept as is. Errors
+// without one are returned as their own text.
+func (l *Localizer) ErrorMessage(err error) string {
+	var e *Error
+	if l == nil || !errors.As(err, &e) {
+		return err.Error()
+	}
+	message := l.catalog.Translate(l.locale, e.key, nil)
+	if detail, ok := strings.CutPrefix(err.Error(), e.text); ok {
+		message += detail
+	}
+	return message
+}
+
+type contextKey struct{}
+
+// WithLocalizer returns a copy of ctx that carries l.
+func WithLocalizer(ctx context.Context, l *Localizer) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Localizer stored in ctx, or nil. A nil Localizer
+// returns keys and texts untranslated.
+func FromContext(ctx context.Context) *Localizer {
+	l, _ := ctx.Value(contextKey{}).(*Localizer)
+	return l
+}
@@ -0,0 +1,210 @@
+package identityclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const apiPrefix = "/api/v1"
+
+// APIError is an error response of the public API.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("identity service: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+type RegisterRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Locale    string `json:"locale,omitempty"`
+}
+
+type RegisterResponse struct {
+	UserID  string `json:"user_id"`
+	Email   string `json:"email"`
+	Message string `json:"message"`
+}
+
+// LoginRequest signs in with any identifier of the account. IdentifierType
+// may be left empty to let the service guess it.
+type LoginRequest struct {
+	Identifier     string `json:"identifier"`
+	IdentifierType string `json:"identifier_type,omitempty"`
+	Password       string `json:"password"`
+	DeviceInfo     string `json:"device_info,omitempty"`
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	DeviceInfo   string `json:"device_info,omitempty"`
+}
+
+// TokenResponse carries the session tokens or, when MFARequired is set, the
+// MFA token to finish the login with CompleteMFA.
+type TokenResponse struct {
+	AccessToken           string   `json:"access_token,omitempty"`
+	RefreshToken          string   `json:"refresh_token,omitempty"`
+	TokenType             string   `json:"token_type,omitempty"`
+	ExpiresIn             int      `json:"expires_in,omitempty"`
+	Scope                 string   `json:"scope,omitempty"`
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`
+}
+
+type Profile struct {
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+	Phone       string `json:"phone"`
+	Locale      string `json:"locale"`
+	Timezone    string `json:"timezone"`
+}
+
+// User is the signed in user as returned by /me.
+type User struct {
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Profile     Profile  `json:"profile"`
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	if err := c.do(ctx, http.MethodPost, "/register", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Login(ctx context.Context, req LoginRequest) (*TokenResponse, error) {
+	var resp TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/login", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CompleteMFA finishes a login that returned MFARequired.
+func (c *Client) CompleteMFA(ctx context.Context, req MFALoginRequest) (*TokenResponse, error) {
+	var resp TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/login/mfa", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Refresh exchanges a refresh token for new tokens. The old refresh token
+// stops working.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	var resp TokenResponse
+	body := map[string]string{"refresh_token": refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/refresh", "", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Logout ends the session accessToken was issued for.
+func (c *Client) Logout(ctx context.Context, accessToken string) error {
+	return c.do(ctx, http.MethodPost, "/logout", accessToken, nil, nil)
+}
+
+// LogoutAll ends every session of the user.
+func (c *Client) LogoutAll(ctx context.Context, accessToken string) error {
+	return c.do(ctx, http.MethodPost, "/logout-all", accessToken, nil, nil)
+}
+
+func (c *Client) Me(ctx context.Context, accessToken string) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, "/me", accessToken, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ForgotPassword emails a reset link if the email belongs to an account. It
+// succeeds either way.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	body := map[string]string{"email": email}
+	return c.do(ctx, http.MethodPost, "/forgot-password", "", body, &messageResponse{})
+}
+
+func (c *Client) ResetPassword(ctx context.Context, token, newPassword string) error {
+	body := map[string]string{"token": token, "new_password": newPassword}
+	return c.do(ctx, http.MethodPost, "/reset-password", "", body, &messageResponse{})
+}
+
+// do sends a request to the public API and decodes the data of the response
+// envelope into out, which may be nil.
+func (c *Client) do(ctx context.Context, method, path, accessToken string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPrefix+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	if resp.StatusCode >= http.StatusBadRequest || !envelope.Success {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if envelope.Error != nil {
+			apiErr.Code = envelope.Error.Code
+			apiErr.Message = envelope.Error.Message
+		}
+		return apiErr
+	}
+
+	if out == nil || len(envelope.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
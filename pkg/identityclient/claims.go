@@ -0,0 +1,62 @@
+package identityclient
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an identity service access token.
+type Claims struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	// SessionID is the session the token was issued for.
+	SessionID string `json:"sid,omitempty"`
+	// Scope is the space separated OAuth scope granted to a client, empty
+	// for tokens from a first-party login.
+	Scope       string   `json:"scope,omitempty"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the token grants permission, directly or
+// through a wildcard: "*" grants everything and "identity:*" every
+// permission starting with "identity:".
+func (c *Claims) HasPermission(permission string) bool {
+	for _, granted := range c.Permissions {
+		if permissionMatches(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func permissionMatches(granted, required string) bool {
+	if granted == required || granted == "*" {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(granted, "*")
+	if !ok || !strings.HasSuffix(prefix, ":") {
+		return false
+	}
+	return strings.HasPrefix(required, prefix)
+}
@@ -0,0 +1,168 @@
+// Package identityclient lets other gym services check access tokens issued
+// by the identity service and call its public API.
+//
+// Tokens are verified locally against the service's JWKS, which is cached
+// and refreshed in the background by RunKeyRefresh. When the keys can't be
+// fetched, or a token names a key the service doesn't publish, the token is
+// checked with the introspection endpoint instead, provided client
+// credentials are configured. Local verification doesn't see logouts; call
+// Introspect directly where a revoked token must be refused at once.
+package identityclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultIssuer is the iss claim of the service's access tokens.
+	DefaultIssuer = "ms-ga-identifier"
+
+	defaultKeyRefreshInterval = 5 * time.Minute
+	defaultHTTPTimeout        = 10 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	// ErrKeysUnavailable is returned when a token can't be verified locally
+	// and there are no client credentials to introspect it with.
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+)
+
+type Config struct {
+	// BaseURL is the root the identity service is served at, e.g.
+	// http://identity:8080.
+	BaseURL string
+	// Issuer is the expected iss claim, DefaultIssuer when empty.
+	Issuer string
+	// Audience makes the client accept only tokens issued for it, such as
+	// kiosk check-in tokens. When empty, tokens with any audience are
+	// refused, like the identity service itself does.
+	Audience string
+	// ClientID and ClientSecret are the OAuth client credentials used for
+	// introspection. Without them there is no fallback.
+	ClientID     string
+	ClientSecret string
+	// KeyRefreshInterval is how often RunKeyRefresh refetches the JWKS,
+	// five minutes when zero.
+	KeyRefreshInterval time.Duration
+	// HTTPClient is used for every request; a client with a ten second
+	// timeout when nil.
+	HTTPClient *http.Client
+}
+
+// Client validates access tokens and calls the identity service's API. It is
+// safe for concurrent use.
+type Client struct {
+	baseURL  string
+	issuer   string
+	audience string
+	clientID string
+	secret   string
+	interval time.Duration
+	http     *http.Client
+	keys     *keyCache
+}
+
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, errors.New("identityclient: BaseURL must be an absolute URL")
+	}
+
+	c := &Client{
+		baseURL:  strings.TrimSuffix(cfg.BaseURL, "/"),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		clientID: cfg.ClientID,
+		secret:   cfg.ClientSecret,
+		interval: cfg.KeyRefreshInterval,
+		http:     cfg.HTTPClient,
+	}
+	if c.issuer == "" {
+		c.issuer = DefaultIssuer
+	}
+	if c.interval <= 0 {
+		c.interval = defaultKeyRefreshInterval
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	c.keys = newKeyCache(c.baseURL+"/.well-known/jwks.json", c.http)
+	return c, nil
+}
+
+// RunKeyRefresh fetches the JWKS now and then every KeyRefreshInterval until
+// ctx is cancelled. Failed fetches keep the keys from the last good one.
+func (c *Client) RunKeyRefresh(ctx context.Context) {
+	c.keys.refresh(ctx)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.keys.refresh(ctx)
+		}
+	}
+}
+
+// ValidateToken verifies an access token and returns its claims.
+func (c *Client) ValidateToken(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := c.keys.get(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// The token must use the algorithm its key was created for
+		if t.Method.Alg() != key.algorithm {
+			return nil, ErrInvalidToken
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods(supportedAlgorithms),
+		jwt.WithIssuer(c.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnknownKey):
+			if c.clientID == "" {
+				return nil, ErrKeysUnavailable
+			}
+			return c.Introspect(ctx, token)
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrExpiredToken
+		default:
+			return nil, ErrInvalidToken
+		}
+	}
+
+	if !c.audienceAllowed(claims.Audience) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (c *Client) audienceAllowed(audience jwt.ClaimStrings) bool {
+	if c.audience == "" {
+		return len(audience) == 0
+	}
+	for _, aud := range audience {
+		if aud == c.audience {
+			return true
+		}
+	}
+	return false
+}
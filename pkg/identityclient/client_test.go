@@ -0,0 +1,357 @@
+package identityclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdentity serves a JWKS and an introspection endpoint the way the
+// identity service does.
+type fakeIdentity struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	keys       map[string]*ecdsa.PrivateKey
+	jwksStatus int
+	introspect func(w http.ResponseWriter, r *http.Request)
+
+	jwksFetches atomic.Int32
+}
+
+func newFakeIdentity(t *testing.T) *fakeIdentity {
+	t.Helper()
+	f := &fakeIdentity{keys: make(map[string]*ecdsa.PrivateKey), jwksStatus: http.StatusOK}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", f.serveJWKS)
+	mux.HandleFunc("/oauth/introspect", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		introspect := f.introspect
+		f.mu.Unlock()
+		if introspect == nil {
+			http.NotFound(w, r)
+			return
+		}
+		introspect(w, r)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIdentity) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	f.jwksFetches.Add(1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.jwksStatus != http.StatusOK {
+		w.WriteHeader(f.jwksStatus)
+		return
+	}
+
+	keys := make([]jwk, 0, len(f.keys))
+	for kid, key := range f.keys {
+		keys = append(keys, jwk{
+			Kty: "EC",
+			Kid: kid,
+			Alg: "ES256",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// addKey publishes a new signing key and returns it.
+func (f *fakeIdentity) addKey(t *testing.T, kid string) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.keys[kid] = key
+	f.mu.Unlock()
+	return key
+}
+
+func (f *fakeIdentity) removeKey(kid string) {
+	f.mu.Lock()
+	delete(f.keys, kid)
+	f.mu.Unlock()
+}
+
+func (f *fakeIdentity) setJWKSStatus(status int) {
+	f.mu.Lock()
+	f.jwksStatus = status
+	f.mu.Unlock()
+}
+
+func (f *fakeIdentity) setIntrospect(handler func(w http.ResponseWriter, r *http.Request)) {
+	f.mu.Lock()
+	f.introspect = handler
+	f.mu.Unlock()
+}
+
+// signToken signs claims with key under kid, filling in the issuer and a
+// one hour expiry unless set.
+func signToken(t *testing.T, key *ecdsa.PrivateKey, kid string, claims *Claims) string {
+	t.Helper()
+	if claims.Issuer == "" {
+		claims.Issuer = DefaultIssuer
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestValidateTokenFetchesKeysOnce(t *testing.T) {
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	token := signToken(t, key, "k1", &Claims{UserID: "user-1", Email: "user@example.com", Roles: []string{"member"}})
+	for i := 0; i < 3; i++ {
+		claims, err := c.ValidateToken(context.Background(), token)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		if claims.UserID != "user-1" || claims.Email != "user@example.com" || !claims.HasRole("member") {
+			t.Fatalf("unexpected claims %+v", claims)
+		}
+	}
+	if got := f.jwksFetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		audience string
+		token    string
+		want     error
+	}{
+		{
+			name:  "expired",
+			token: signToken(t, key, "k1", &Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}}),
+			want:  ErrExpiredToken,
+		},
+		{
+			name:  "wrong issuer",
+			token: signToken(t, key, "k1", &Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "someone-else"}}),
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "wrong signature",
+			token: signToken(t, other, "k1", &Claims{}),
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "audience without one configured",
+			token: signToken(t, key, "k1", &Claims{RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"kiosk"}}}),
+			want:  ErrInvalidToken,
+		},
+		{
+			name:     "no audience with one configured",
+			audience: "kiosk",
+			token:    signToken(t, key, "k1", &Claims{}),
+			want:     ErrInvalidToken,
+		},
+		{
+			name:  "malformed",
+			token: "not-a-token",
+			want:  ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, Config{BaseURL: f.URL, Audience: tt.audience})
+			if _, err := c.ValidateToken(context.Background(), tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateToken error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTokenAcceptsConfiguredAudience(t *testing.T) {
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL, Audience: "kiosk"})
+
+	token := signToken(t, key, "k1", &Claims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"kiosk"}}})
+	if _, err := c.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+}
+
+func TestRunKeyRefreshPicksUpNewKeys(t *testing.T) {
+	f := newFakeIdentity(t)
+	f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL, KeyRefreshInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.RunKeyRefresh(ctx)
+
+	// The refresh keeps the last fetch recent, so an unknown kid can't
+	// trigger a refetch of its own: only the background refresh finds k2
+	key := f.addKey(t, "k2")
+	token := signToken(t, key, "k2", &Claims{UserID: "user-1"})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := c.ValidateToken(ctx, token)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("k2 never became usable: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRefreshFailureKeepsKeys(t *testing.T) {
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	if err := c.keys.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	f.setJWKSStatus(http.StatusInternalServerError)
+	if err := c.keys.refresh(context.Background()); err == nil {
+		t.Fatal("refresh succeeded against a failing JWKS")
+	}
+
+	token := signToken(t, key, "k1", &Claims{UserID: "user-1"})
+	if _, err := c.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("ValidateToken after failed refresh: %v", err)
+	}
+}
+
+func TestUnknownKidRefetchesJWKS(t *testing.T) {
+	f := newFakeIdentity(t)
+	f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+	if err := c.keys.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// The service rotated since the last fetch, which is old enough to
+	// fetch again
+	key := f.addKey(t, "k2")
+	c.keys.lastAttempt = time.Now().Add(-2 * minKeyRefetchInterval)
+
+	token := signToken(t, key, "k2", &Claims{UserID: "user-1"})
+	if _, err := c.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if got := f.jwksFetches.Load(); got != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", got)
+	}
+}
+
+func TestUnknownKidRefetchIsRateLimited(t *testing.T) {
+	f := newFakeIdentity(t)
+	f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+	if err := c.keys.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	key := f.addKey(t, "k2")
+	token := signToken(t, key, "k2", &Claims{UserID: "user-1"})
+	for i := 0; i < 3; i++ {
+		if _, err := c.ValidateToken(context.Background(), token); !errors.Is(err, ErrKeysUnavailable) {
+			t.Fatalf("ValidateToken error = %v, want %v", err, ErrKeysUnavailable)
+		}
+	}
+	if got := f.jwksFetches.Load(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func TestUnknownKidFallsBackToIntrospection(t *testing.T) {
+	f := newFakeIdentity(t)
+	f.setJWKSStatus(http.StatusServiceUnavailable)
+	f.setIntrospect(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":  true,
+			"sub":     "user-1",
+			"user_id": "user-1",
+			"iss":     DefaultIssuer,
+			"exp":     time.Now().Add(time.Hour).Unix(),
+		})
+	})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, Config{BaseURL: f.URL, ClientID: "gym-app", ClientSecret: "secret"})
+
+	claims, err := c.ValidateToken(context.Background(), signToken(t, key, "k1", &Claims{UserID: "user-1"}))
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != "user-1" {
+		t.Fatalf("UserID = %q, want user-1", claims.UserID)
+	}
+}
+
+func TestRemovedKeyStopsValidating(t *testing.T) {
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	f.addKey(t, "k2")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	token := signToken(t, key, "k1", &Claims{UserID: "user-1"})
+	if _, err := c.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	f.removeKey("k1")
+	if err := c.keys.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := c.ValidateToken(context.Background(), token); !errors.Is(err, ErrKeysUnavailable) {
+		t.Fatalf("ValidateToken error = %v, want %v", err, ErrKeysUnavailable)
+	}
+}
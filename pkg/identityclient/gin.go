@@ -0,0 +1,55 @@
+package identityclient
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginClaimsKey is where GinMiddleware keeps the claims in the gin context.
+const ginClaimsKey = "identityclient.claims"
+
+// GinMiddleware is Middleware for gin. The claims are available from
+// GinClaims as well as from the request context.
+func (c *Client) GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, status, message := c.authenticate(ctx.Request)
+		if claims == nil {
+			ctx.AbortWithStatusJSON(status, errorBody(status, message))
+			return
+		}
+		ctx.Set(ginClaimsKey, claims)
+		ctx.Request = ctx.Request.WithContext(ContextWithClaims(ctx.Request.Context(), claims))
+		ctx.Next()
+	}
+}
+
+// GinClaims returns the claims stored by GinMiddleware.
+func GinClaims(ctx *gin.Context) (*Claims, bool) {
+	value, exists := ctx.Get(ginClaimsKey)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+// GinRequirePermission lets the request through if the token grants any of
+// permissions; it must run after GinMiddleware.
+func GinRequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := GinClaims(ctx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorBody(http.StatusUnauthorized, "Authorization header required"))
+			return
+		}
+		for _, permission := range permissions {
+			if claims.HasPermission(permission) {
+				ctx.Next()
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorBody(http.StatusForbidden, "Missing permission: "+strings.Join(permissions, " or ")))
+	}
+}
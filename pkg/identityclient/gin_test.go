@@ -0,0 +1,119 @@
+package identityclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	engine := gin.New()
+	engine.GET("/me", c.GinMiddleware(), func(ctx *gin.Context) {
+		claims, ok := GinClaims(ctx)
+		if !ok {
+			t.Error("GinClaims found nothing")
+		}
+		fromContext, ok := ClaimsFromContext(ctx.Request.Context())
+		if !ok || fromContext != claims {
+			t.Error("request context claims differ from GinClaims")
+		}
+		ctx.String(http.StatusOK, claims.UserID)
+	})
+	engine.GET("/classes", c.GinMiddleware(), GinRequirePermission("classes:book"), func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+
+	member := signToken(t, key, "k1", &Claims{UserID: "user-1", Permissions: []string{"profile:read"}})
+	wildcard := signToken(t, key, "k1", &Claims{UserID: "user-2", Permissions: []string{"classes:*"}})
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+		wantBody      string
+		wantCode      string
+	}{
+		{name: "valid token", path: "/me", authorization: "Bearer " + member, wantStatus: http.StatusOK, wantBody: "user-1"},
+		{name: "no header", path: "/me", wantStatus: http.StatusUnauthorized, wantCode: "UNAUTHORIZED"},
+		{name: "not bearer", path: "/me", authorization: "Basic dXNlcjpwYXNz", wantStatus: http.StatusUnauthorized, wantCode: "UNAUTHORIZED"},
+		{name: "invalid token", path: "/me", authorization: "Bearer garbage", wantStatus: http.StatusUnauthorized, wantCode: "UNAUTHORIZED"},
+		{name: "missing permission", path: "/classes", authorization: "Bearer " + member, wantStatus: http.StatusForbidden, wantCode: "FORBIDDEN"},
+		{name: "wildcard permission", path: "/classes", authorization: "Bearer " + wildcard, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, w); code != tt.wantCode {
+					t.Fatalf("error code = %q, want %q", code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestGinMiddlewareKeysUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	f := newFakeIdentity(t)
+	key := f.addKey(t, "k1")
+	f.setJWKSStatus(http.StatusServiceUnavailable)
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	engine := gin.New()
+	engine.GET("/me", c.GinMiddleware(), func(ctx *gin.Context) {
+		t.Error("handler ran without a verified token")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, key, "k1", &Claims{UserID: "user-1"}))
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	// A token that can't be checked isn't the caller's fault
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if code := errorCode(t, w); code != "SERVICE_UNAVAILABLE" {
+		t.Fatalf("error code = %q, want SERVICE_UNAVAILABLE", code)
+	}
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Success bool `json:"success"`
+		Error   struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	if body.Success {
+		t.Fatal("error response has success true")
+	}
+	return body.Error.Code
+}
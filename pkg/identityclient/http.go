@@ -0,0 +1,104 @@
+package identityclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Middleware or
+// GinMiddleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// Middleware rejects requests without a valid bearer token with 401 and
+// stores the token's claims in the request context otherwise.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, status, message := c.authenticate(r)
+		if claims == nil {
+			writeError(w, status, message)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// RequirePermission wraps handlers that need any of permissions; it must run
+// after Middleware.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "Authorization header required")
+				return
+			}
+			for _, permission := range permissions {
+				if claims.HasPermission(permission) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, http.StatusForbidden, "Missing permission: "+strings.Join(permissions, " or "))
+		})
+	}
+}
+
+// authenticate validates the request's bearer token. On failure it returns
+// nil claims, the status to answer with and the reason.
+func (c *Client) authenticate(r *http.Request) (*Claims, int, string) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, http.StatusUnauthorized, "Authorization header required"
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, http.StatusUnauthorized, "Invalid authorization header format"
+	}
+
+	claims, err := c.ValidateToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) {
+			return nil, http.StatusUnauthorized, "Invalid or expired token"
+		}
+		// The token couldn't be checked at all, which isn't the caller's fault
+		return nil, http.StatusServiceUnavailable, "Token could not be verified"
+	}
+	return claims, 0, ""
+}
+
+// errorCodes are the error codes the identity service uses for each status.
+var errorCodes = map[int]string{
+	http.StatusUnauthorized:       "UNAUTHORIZED",
+	http.StatusForbidden:          "FORBIDDEN",
+	http.StatusServiceUnavailable: "SERVICE_UNAVAILABLE",
+}
+
+// writeError answers in the identity service's response envelope.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody(status, message))
+}
+
+func errorBody(status int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"success": false,
+		"error": map[string]string{
+			"code":    errorCodes[status],
+			"message": message,
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package identityclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// introspectionResponse is the RFC 7662 response of /oauth/introspect, with
+// the access token's own claims alongside the standard ones.
+type introspectionResponse struct {
+	Active      bool             `json:"active"`
+	Scope       string           `json:"scope"`
+	ClientID    string           `json:"client_id"`
+	Subject     string           `json:"sub"`
+	Audience    jwt.ClaimStrings `json:"aud"`
+	Issuer      string           `json:"iss"`
+	TokenID     string           `json:"jti"`
+	ExpiresAt   int64            `json:"exp"`
+	IssuedAt    int64            `json:"iat"`
+	NotBefore   int64            `json:"nbf"`
+	UserID      string           `json:"user_id"`
+	Email       string           `json:"email"`
+	SessionID   string           `json:"sid"`
+	Roles       []string         `json:"roles"`
+	Permissions []string         `json:"permissions"`
+}
+
+// Introspect asks the identity service whether token is active, which also
+// catches tokens revoked by logout. It needs the client credentials.
+func (c *Client) Introspect(ctx context.Context, token string) (*Claims, error) {
+	if c.clientID == "" {
+		return nil, errors.New("identityclient: introspection needs ClientID and ClientSecret")
+	}
+
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/oauth/introspect", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.secret))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection returned status code: %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !result.Active {
+		return nil, ErrInvalidToken
+	}
+	if result.Issuer != "" && result.Issuer != c.issuer {
+		return nil, ErrInvalidToken
+	}
+	if !c.audienceAllowed(result.Audience) {
+		return nil, ErrInvalidToken
+	}
+
+	userID := result.UserID
+	if userID == "" {
+		userID = result.Subject
+	}
+	claims := &Claims{
+		UserID:      userID,
+		Email:       result.Email,
+		SessionID:   result.SessionID,
+		Scope:       result.Scope,
+		Roles:       result.Roles,
+		Permissions: result.Permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       result.TokenID,
+			Subject:  result.Subject,
+			Issuer:   result.Issuer,
+			Audience: result.Audience,
+		},
+	}
+	if result.ExpiresAt != 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(result.ExpiresAt, 0))
+	}
+	if result.IssuedAt != 0 {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(result.IssuedAt, 0))
+	}
+	if result.NotBefore != 0 {
+		claims.NotBefore = jwt.NewNumericDate(time.Unix(result.NotBefore, 0))
+	}
+	return claims, nil
+}
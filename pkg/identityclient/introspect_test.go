@@ -0,0 +1,133 @@
+package identityclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	f := newFakeIdentity(t)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	var gotToken, gotHint, gotClientID, gotSecret string
+	f.setIntrospect(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		gotClientID, gotSecret, _ = r.BasicAuth()
+		gotToken = r.PostFormValue("token")
+		gotHint = r.PostFormValue("token_type_hint")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":      true,
+			"scope":       "openid email",
+			"client_id":   "gym-app",
+			"sub":         "user-1",
+			"iss":         DefaultIssuer,
+			"jti":         "token-1",
+			"exp":         expiresAt.Unix(),
+			"email":       "user@example.com",
+			"sid":         "session-1",
+			"roles":       []string{"member"},
+			"permissions": []string{"classes:book"},
+		})
+	})
+	c := newTestClient(t, Config{BaseURL: f.URL, ClientID: "gym-app", ClientSecret: "s3cret"})
+
+	claims, err := c.Introspect(context.Background(), "opaque-token")
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+
+	if gotToken != "opaque-token" || gotHint != "access_token" {
+		t.Errorf("form token = %q, hint = %q", gotToken, gotHint)
+	}
+	if gotClientID != "gym-app" || gotSecret != "s3cret" {
+		t.Errorf("basic auth = %q:%q", gotClientID, gotSecret)
+	}
+
+	// Without a user_id claim the subject is the user
+	if claims.UserID != "user-1" || claims.Subject != "user-1" {
+		t.Errorf("UserID = %q, Subject = %q", claims.UserID, claims.Subject)
+	}
+	if claims.Email != "user@example.com" || claims.SessionID != "session-1" || claims.ID != "token-1" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if !claims.HasScope("email") || !claims.HasRole("member") || !claims.HasPermission("classes:book") {
+		t.Errorf("scope, roles or permissions missing from %+v", claims)
+	}
+	if claims.ExpiresAt == nil || !claims.ExpiresAt.Time.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v, want %v", claims.ExpiresAt, expiresAt)
+	}
+}
+
+func TestIntrospectRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		audience string
+		status   int
+		body     map[string]interface{}
+		want     error
+	}{
+		{
+			name:   "inactive",
+			status: http.StatusOK,
+			body:   map[string]interface{}{"active": false},
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "wrong issuer",
+			status: http.StatusOK,
+			body:   map[string]interface{}{"active": true, "sub": "user-1", "iss": "someone-else"},
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "audience without one configured",
+			status: http.StatusOK,
+			body:   map[string]interface{}{"active": true, "sub": "user-1", "aud": "kiosk"},
+			want:   ErrInvalidToken,
+		},
+		{
+			name:     "other audience",
+			audience: "kiosk",
+			status:   http.StatusOK,
+			body:     map[string]interface{}{"active": true, "sub": "user-1", "aud": []string{"billing"}},
+			want:     ErrInvalidToken,
+		},
+		{
+			name:   "client refused",
+			status: http.StatusUnauthorized,
+			body:   map[string]interface{}{"error": "invalid_client"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIdentity(t)
+			f.setIntrospect(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(tt.body)
+			})
+			c := newTestClient(t, Config{BaseURL: f.URL, Audience: tt.audience, ClientID: "gym-app", ClientSecret: "s3cret"})
+
+			_, err := c.Introspect(context.Background(), "opaque-token")
+			if err == nil {
+				t.Fatal("Introspect succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Introspect error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntrospectNeedsCredentials(t *testing.T) {
+	f := newFakeIdentity(t)
+	c := newTestClient(t, Config{BaseURL: f.URL})
+
+	if _, err := c.Introspect(context.Background(), "opaque-token"); err == nil {
+		t.Fatal("Introspect succeeded without client credentials")
+	}
+}
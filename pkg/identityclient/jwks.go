@@ -0,0 +1,199 @@
+package identityclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minKeyRefetchInterval limits how often a token with an unknown kid makes
+// the cache refetch the JWKS, so garbage tokens can't hammer the service.
+const minKeyRefetchInterval = 30 * time.Second
+
+var supportedAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// errUnknownKey means the token's key isn't in the cache, even after a
+// refetch, or the JWKS couldn't be fetched at all.
+var errUnknownKey = errors.New("unknown signing key")
+
+type publicKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keyCache holds the service's public keys by kid.
+type keyCache struct {
+	url  string
+	http *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]*publicKey
+	lastAttempt time.Time
+
+	// fetching serializes fetches so concurrent misses share one request
+	fetching sync.Mutex
+}
+
+func newKeyCache(url string, client *http.Client) *keyCache {
+	return &keyCache{
+		url:  url,
+		http: client,
+		keys: make(map[string]*publicKey),
+	}
+}
+
+// get returns the key named kid, refetching the JWKS once if it's unknown
+// and the last fetch is old enough.
+func (k *keyCache) get(ctx context.Context, kid string) (*publicKey, error) {
+	if key := k.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	k.fetching.Lock()
+	defer k.fetching.Unlock()
+
+	// Another request may have fetched the key while this one waited
+	if key := k.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	k.mu.RLock()
+	recent := time.Since(k.lastAttempt) < minKeyRefetchInterval
+	k.mu.RUnlock()
+	if recent {
+		return nil, errUnknownKey
+	}
+
+	if err := k.fetch(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnknownKey, err)
+	}
+	if key := k.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+// refresh refetches the JWKS, keeping the current keys if that fails.
+func (k *keyCache) refresh(ctx context.Context) error {
+	k.fetching.Lock()
+	defer k.fetching.Unlock()
+	return k.fetch(ctx)
+}
+
+func (k *keyCache) lookup(kid string) *publicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+// fetch must be called with fetching held.
+func (k *keyCache) fetch(ctx context.Context) error {
+	k.mu.Lock()
+	k.lastAttempt = time.Now()
+	k.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks returned status code: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	// Keys this client can't use are skipped rather than failing the set
+	keys := make(map[string]*publicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		public, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[key.Kid] = &publicKey{algorithm: key.Alg, public: public}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case key.Kty == "RSA" && key.Alg == "RS256":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case key.Kty == "EC" && key.Alg == "ES256" && key.Crv == "P-256":
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case key.Kty == "OKP" && key.Alg == "EdDSA" && key.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s/%s", key.Kty, key.Alg)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -41,6 +42,10 @@ func (r *RedisClient) Del(ctx context.Context, keys ...string) error {
 	return r.client.Del(ctx, keys...).Err()
 }
 
+func (r *RedisClient) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return r.client.Exists(ctx, keys...).Result()
+}
+
 func (r *RedisClient) Incr(ctx context.Context, key string) (int64, error) {
 	return r.client.Incr(ctx, key).Result()
 }
@@ -53,6 +58,15 @@ func (r *RedisClient) GetTTL(ctx context.Context, key string) (time.Duration, er
 	return r.client.TTL(ctx, key).Result()
 }
 
+func (r *RedisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.client.Eval(ctx, script, keys, args...).Result()
+}
+
 func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
+
+// IsNil reports whether err means the key does not exist.
+func IsNil(err error) bool {
+	return errors.Is(err, redis.Nil)
+}
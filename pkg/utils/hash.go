@@ -1,9 +1,26 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrNoTokenHashKeys     = errors.New("no token hash keys configured")
+	ErrUnknownTokenHashKey = errors.New("current token hash key id not found in key set")
+	ErrEmptyTokenHashKey   = errors.New("token hash key has an empty pepper")
+)
+
+// tokenHashSeparator splits the key id from the digest in a stored token hash,
+// e.g. "v1$9f86d081...".
+const tokenHashSeparator = "$"
+
 type HashUtil struct{}
 
 func NewHashUtil() *HashUtil {
@@ -36,8 +53,62 @@ func CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
-func HashToken(token string) string {
-	// Simple hash for tokens - in production use secure hashing
-	hash, _ := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
-	return string(hash)
+// TokenHasher hashes opaque tokens (refresh, reset, ...) with HMAC-SHA256 and a
+// server-side pepper. Unlike bcrypt the output is deterministic, so the hash
+// can be used as a lookup key. Every hash is prefixed with the id of the key
+// that produced it so peppers can be rotated: new tokens are always hashed
+// with the current key, while lookups try every configured key.
+type TokenHasher struct {
+	currentKeyID string
+	keys         map[string][]byte
+	keyOrder     []string
+}
+
+func NewTokenHasher(currentKeyID string, keys map[string]string) (*TokenHasher, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoTokenHashKeys
+	}
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, ErrUnknownTokenHashKey
+	}
+
+	h := &TokenHasher{
+		currentKeyID: currentKeyID,
+		keys:         make(map[string][]byte, len(keys)),
+		keyOrder:     []string{currentKeyID},
+	}
+	for id, pepper := range keys {
+		if strings.Contains(id, tokenHashSeparator) {
+			return nil, errors.New("token hash key id must not contain " + tokenHashSeparator)
+		}
+		if pepper == "" {
+			return nil, fmt.Errorf("%w: %s", ErrEmptyTokenHashKey, id)
+		}
+		h.keys[id] = []byte(pepper)
+		if id != currentKeyID {
+			h.keyOrder = append(h.keyOrder, id)
+		}
+	}
+	return h, nil
+}
+
+// Hash returns the hash of token under the current key.
+func (h *TokenHasher) Hash(token string) string {
+	return h.hashWith(h.currentKeyID, token)
+}
+
+// Candidates returns the hash of token under every configured key, current key
+// first. Repositories match stored hashes against any of them.
+func (h *TokenHasher) Candidates(token string) []string {
+	hashes := make([]string, 0, len(h.keyOrder))
+	for _, id := range h.keyOrder {
+		hashes = append(hashes, h.hashWith(id, token))
+	}
+	return hashes
+}
+
+func (h *TokenHasher) hashWith(keyID, token string) string {
+	mac := hmac.New(sha256.New, h.keys[keyID])
+	mac.Write([]byte(token))
+	return keyID + tokenHashSeparator + hex.EncodeToString(mac.Sum(nil))
 }
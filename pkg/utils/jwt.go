@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
@@ -12,33 +13,92 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// JWTUtil signs access tokens with the active key of a KeySet and verifies
+// them against any key the set still publishes.
 type JWTUtil struct {
-	secret          string
-	expirationTime  time.Duration
+	keySet         *KeySet
+	expirationTime time.Duration
 }
 
 type Claims struct {
 	UserID      string   `json:"user_id"`
 	Email       string   `json:"email"`
+	SessionID   string   `json:"sid,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
 	Roles       []string `json:"roles"`
 	Permissions []string `json:"permissions"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTUtil(secret string, expirationTime time.Duration) *JWTUtil {
+func NewJWTUtil(keySet *KeySet, expirationTime time.Duration) *JWTUtil {
 	return &JWTUtil{
-		secret:         secret,
+		keySet:         keySet,
 		expirationTime: expirationTime,
 	}
 }
 
-func (j *JWTUtil) GenerateToken(userID, email string, roles, permissions []string) (string, error) {
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	SessionID     string           `json:"sid,omitempty"`
+	ProfileClaims
+	jwt.RegisteredClaims
+}
+
+// ProfileClaims are the OpenID Connect standard claims of the profile and
+// phone scopes. Unset fields are left out.
+type ProfileClaims struct {
+	Name                string `json:"name,omitempty"`
+	GivenName           string `json:"given_name,omitempty"`
+	FamilyName          string `json:"family_name,omitempty"`
+	Locale              string `json:"locale,omitempty"`
+	Zoneinfo            string `json:"zoneinfo,omitempty"`
+	UpdatedAt           int64  `json:"updated_at,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+}
+
+// GenerateToken issues a first-party access token. sessionID ties the token to
+// the refresh token family it was issued for.
+func (j *JWTUtil) GenerateToken(userID, email, sessionID string, roles, permissions []string) (string, error) {
 	claims := Claims{
 		UserID:      userID,
 		Email:       email,
+		SessionID:   sessionID,
 		Roles:       roles,
 		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expirationTime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "ms-ga-identifier",
+		},
+	}
+
+	return j.Sign(claims)
+}
+
+// GenerateClientToken issues an access token to the OAuth client clientID,
+// for audience. scope is the space separated scope granted to the client. It
+// carries no roles or permissions, and this service's own API only accepts it
+// on routes that allow its scope.
+func (j *JWTUtil) GenerateClientToken(userID, email, sessionID, clientID, scope, audience string) (string, error) {
+	claims := Claims{
+		UserID:      userID,
+		Email:       email,
+		SessionID:   sessionID,
+		ClientID:    clientID,
+		Scope:       scope,
+		Roles:       []string{},
+		Permissions: []string{},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Audience:  jwt.ClaimStrings{audience},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.expirationTime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -46,37 +106,101 @@ func (j *JWTUtil) GenerateToken(userID, email string, roles, permissions []strin
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secret))
+	return j.Sign(claims)
+}
+
+// GenerateAudienceToken issues an access token that only audience accepts,
+// valid for ttl. It carries no roles or permissions, and this service's own
+// API refuses it.
+func (j *JWTUtil) GenerateAudienceToken(userID, sessionID, scope, audience string, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:      userID,
+		SessionID:   sessionID,
+		Scope:       scope,
+		Roles:       []string{},
+		Permissions: []string{},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "ms-ga-identifier",
+		},
+	}
+
+	return j.Sign(claims)
+}
+
+// Sign signs arbitrary claims with the active key and sets the kid header.
+func (j *JWTUtil) Sign(claims jwt.Claims) (string, error) {
+	key := j.keySet.Active()
+	method, err := signingMethodFor(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
 func (j *JWTUtil) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(j.secret), nil
-	})
+	claims := &Claims{}
+	if err := j.Parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
 
+// Parse verifies tokenString against the key named by its kid header and
+// decodes it into claims.
+func (j *JWTUtil) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, j.keyFunc,
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}),
+	)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
+			return ErrExpiredToken
 		}
-		return nil, ErrInvalidToken
+		return ErrInvalidToken
 	}
+	if !token.Valid {
+		return ErrInvalidToken
+	}
+	return nil
+}
 
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+func (j *JWTUtil) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := j.keySet.Get(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The token must use the algorithm its key was created for
+	if token.Method.Alg() != key.Algorithm {
 		return nil, ErrInvalidToken
 	}
-
-	return claims, nil
+	return key.Public(), nil
 }
 
-func (j *JWTUtil) GetSecret() string {
-	return j.secret
+func (j *JWTUtil) KeySet() *KeySet {
+	return j.keySet
 }
 
 func (j *JWTUtil) GetExpirationTime() time.Duration {
 	return j.expirationTime
 }
+
+func signingMethodFor(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
@@ -0,0 +1,537 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+
+	keySetManifestFile = "manifest.json"
+	keySetLockFile     = "manifest.lock"
+	rsaKeyBits         = 2048
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownSigningKey    = errors.New("unknown signing key")
+)
+
+// SigningKey is one asymmetric key of a KeySet. A key is published when it is
+// created but only signs from ActivatesAt. RetiredAt is set once a newer key
+// takes over signing; the key is then only used for verification.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	Private     crypto.Signer
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// JWK is the JSON Web Key representation of a public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type manifestEntry struct {
+	ID          string     `json:"kid"`
+	Algorithm   string     `json:"alg"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
+
+// KeySet holds the JWT signing keys. Keys are stored in dir as "<kid>.pem"
+// (PKCS#8) next to a manifest recording when each key was created, starts
+// signing and was retired. PEM files dropped into dir without a manifest
+// entry are picked up too. Retired keys are kept for verification for
+// retention, which must cover the lifetime of the tokens they signed.
+//
+// A rotated-in key is published publishAhead before it starts signing, so
+// clients caching the key set already know it when its first token arrives.
+// Instances sharing dir take a lock on it to change the manifest, and
+// re-read it first so they don't drop each other's keys.
+type KeySet struct {
+	mu           sync.RWMutex
+	updateMu     sync.Mutex
+	dir          string
+	algorithm    string
+	retention    time.Duration
+	publishAhead time.Duration
+	keys         map[string]*SigningKey
+}
+
+// LoadKeySet loads the keys in dir, generating and persisting a first key for
+// algorithm if there is none. The first key signs straight away.
+func LoadKeySet(dir, algorithm string, retention, publishAhead time.Duration) (*KeySet, error) {
+	if _, err := signingMethodFor(algorithm); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	ks := &KeySet{
+		dir:          dir,
+		algorithm:    algorithm,
+		retention:    retention,
+		publishAhead: publishAhead,
+	}
+	err := ks.update(func(keys map[string]*SigningKey, now time.Time) (bool, error) {
+		if signingAt(keys, now) != nil {
+			return false, nil
+		}
+		_, err := ks.addKey(keys, now, now)
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key directory so rotations done by other instances
+// sharing it are picked up.
+func (ks *KeySet) Reload() error {
+	return ks.update(func(map[string]*SigningKey, time.Time) (bool, error) {
+		return false, nil
+	})
+}
+
+// update re-reads the key directory under its lock, lets fn change the keys
+// and, if fn reports a change, writes the manifest before releasing the lock.
+func (ks *KeySet) update(fn func(keys map[string]*SigningKey, now time.Time) (bool, error)) error {
+	ks.updateMu.Lock()
+	defer ks.updateMu.Unlock()
+
+	unlock, err := lockKeyDir(filepath.Join(ks.dir, keySetLockFile))
+	if err != nil {
+		return fmt.Errorf("failed to lock key directory: %w", err)
+	}
+	defer unlock()
+
+	keys, err := ks.load()
+	if err != nil {
+		return err
+	}
+	changed, err := fn(keys, time.Now())
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := ks.writeManifest(keys); err != nil {
+			return err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	return nil
+}
+
+// load reads the keys in the directory.
+func (ks *KeySet) load() (map[string]*SigningKey, error) {
+	manifest, err := ks.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	pemFiles, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*SigningKey, len(pemFiles))
+	for _, path := range pemFiles {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		signer, err := readPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key %s: %w", kid, err)
+		}
+
+		key := &SigningKey{ID: kid, Private: signer}
+		if entry, ok := manifest[kid]; ok {
+			key.Algorithm = entry.Algorithm
+			key.CreatedAt = entry.CreatedAt
+			key.ActivatesAt = entry.CreatedAt
+			if entry.ActivatesAt != nil {
+				key.ActivatesAt = *entry.ActivatesAt
+			}
+			key.RetiredAt = entry.RetiredAt
+		} else {
+			// Operator supplied key: infer algorithm, use the file time
+			alg, err := algorithmForKey(signer)
+			if err != nil {
+				return nil, fmt.Errorf("signing key %s: %w", kid, err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			key.Algorithm = alg
+			key.CreatedAt = info.ModTime()
+			key.ActivatesAt = info.ModTime()
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return signingAt(ks.keys, time.Now())
+}
+
+// Get returns the key with kid if it may still be used for verification.
+func (ks *KeySet) Get(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok || ks.expired(key, time.Now()) {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+// Rotate generates a new key that takes over signing after publishAhead, when
+// the current one is retired.
+func (ks *KeySet) Rotate() (*SigningKey, error) {
+	var key *SigningKey
+	err := ks.update(func(keys map[string]*SigningKey, now time.Time) (bool, error) {
+		var err error
+		key, err = ks.addKey(keys, now, now.Add(ks.publishAhead))
+		return err == nil, err
+	})
+	return key, err
+}
+
+// rotateIfDue rotates once the signing key has signed for every, counting the
+// time its successor will be published for. It returns nil if no rotation
+// was due, e.g. because another instance has already started one.
+func (ks *KeySet) rotateIfDue(every time.Duration) (*SigningKey, error) {
+	var key *SigningKey
+	err := ks.update(func(keys map[string]*SigningKey, now time.Time) (bool, error) {
+		for _, k := range keys {
+			if k.RetiredAt == nil && k.ActivatesAt.After(now) {
+				// A rotation is already under way
+				return false, nil
+			}
+		}
+		active := signingAt(keys, now)
+		if active != nil && now.Sub(active.ActivatesAt)+ks.publishAhead < every {
+			return false, nil
+		}
+
+		activatesAt := now.Add(ks.publishAhead)
+		if active == nil {
+			activatesAt = now
+		}
+		var err error
+		key, err = ks.addKey(keys, now, activatesAt)
+		return err == nil, err
+	})
+	return key, err
+}
+
+// Prune deletes retired keys whose tokens have all expired.
+func (ks *KeySet) Prune() error {
+	return ks.update(func(keys map[string]*SigningKey, now time.Time) (bool, error) {
+		pruned := false
+		for kid, key := range keys {
+			if !ks.expired(key, now) {
+				continue
+			}
+			if err := os.Remove(ks.keyPath(kid)); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			delete(keys, kid)
+			pruned = true
+		}
+		return pruned, nil
+	})
+}
+
+// RunRotation rotates the signing key once it has signed for every and prunes
+// expired keys, until ctx is done.
+func (ks *KeySet) RunRotation(ctx context.Context, every, checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				Errorf("Failed to reload signing keys", ErrorField(err.Error()))
+				continue
+			}
+			key, err := ks.rotateIfDue(every)
+			if err != nil {
+				Errorf("Failed to rotate signing key", ErrorField(err.Error()))
+				continue
+			}
+			if key != nil {
+				Info("Rotated JWT signing key",
+					String("kid", key.ID),
+					String("alg", key.Algorithm),
+					String("activates_at", key.ActivatesAt.Format(time.RFC3339)),
+				)
+			}
+			if err := ks.Prune(); err != nil {
+				Errorf("Failed to prune signing keys", ErrorField(err.Error()))
+			}
+		}
+	}
+}
+
+// JWKS returns the public keys that may still verify tokens.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		if !ks.expired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	set := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if jwk, err := publicJWK(key); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// addKey generates a key that signs from activatesAt and retires the keys
+// signing until then.
+func (ks *KeySet) addKey(keys map[string]*SigningKey, now, activatesAt time.Time) (*SigningKey, error) {
+	signer, err := generateKey(ks.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		ID:          uuid.New().String(),
+		Algorithm:   ks.algorithm,
+		Private:     signer,
+		CreatedAt:   now,
+		ActivatesAt: activatesAt,
+	}
+	if err := os.WriteFile(ks.keyPath(key.ID), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if k.RetiredAt == nil {
+			k.RetiredAt = &activatesAt
+		}
+	}
+	keys[key.ID] = key
+	return key, nil
+}
+
+func (ks *KeySet) expired(key *SigningKey, now time.Time) bool {
+	return key.RetiredAt != nil && now.After(key.RetiredAt.Add(ks.retention))
+}
+
+func (ks *KeySet) keyPath(kid string) string {
+	return filepath.Join(ks.dir, kid+".pem")
+}
+
+func (ks *KeySet) readManifest() (map[string]manifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(ks.dir, keySetManifestFile))
+	if os.IsNotExist(err) {
+		return map[string]manifestEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse key manifest: %w", err)
+	}
+	manifest := make(map[string]manifestEntry, len(entries))
+	for _, e := range entries {
+		manifest[e.ID] = e
+	}
+	return manifest, nil
+}
+
+// writeManifest replaces the manifest atomically so concurrent readers never
+// see a partial file.
+func (ks *KeySet) writeManifest(keys map[string]*SigningKey) error {
+	entries := make([]manifestEntry, 0, len(keys))
+	for _, key := range keys {
+		activatesAt := key.ActivatesAt
+		entries = append(entries, manifestEntry{
+			ID:          key.ID,
+			Algorithm:   key.Algorithm,
+			CreatedAt:   key.CreatedAt,
+			ActivatesAt: &activatesAt,
+			RetiredAt:   key.RetiredAt,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(ks.dir, keySetManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(ks.dir, keySetManifestFile))
+}
+
+// signingAt returns the key that signs at t: the newest one that has been
+// activated and not yet retired.
+func signingAt(keys map[string]*SigningKey, t time.Time) *SigningKey {
+	var active *SigningKey
+	for _, key := range keys {
+		if key.ActivatesAt.After(t) || (key.RetiredAt != nil && !key.RetiredAt.After(t)) {
+			continue
+		}
+		if active == nil || key.ActivatesAt.After(active.ActivatesAt) {
+			active = key
+		}
+	}
+	return active
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key is not a signing key")
+	}
+	return signer, nil
+}
+
+func algorithmForKey(signer crypto.Signer) (string, error) {
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		return AlgorithmRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrUnsupportedAlgorithm
+		}
+		return AlgorithmES256, nil
+	case ed25519.PrivateKey:
+		return AlgorithmEdDSA, nil
+	default:
+		return "", ErrUnsupportedAlgorithm
+	}
+}
+
+func publicJWK(key *SigningKey) (JWK, error) {
+	jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, ErrUnsupportedAlgorithm
+	}
+	return jwk, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+// lockKeyDir is a no-op where flock is unavailable; KeySet still serializes
+// its own updates, but instances sharing the key directory aren't
+// coordinated.
+func lockKeyDir(string) (func(), error) {
+	return func() {}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gym-api/ms-ga-identifier/pkg/i18n"
 )
 
 type Response struct {
@@ -25,7 +26,10 @@ func SuccessResponse(c *gin.Context, statusCode int, data interface{}) {
 	})
 }
 
+// ErrorResponse translates message into the request's locale when it is a
+// catalog key, e.g. "errors.identity_not_found".
 func ErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	message = i18n.FromContext(c.Request.Context()).Message(message)
 	c.JSON(statusCode, Response{
 		Success: false,
 		Error: &ErrorDetail{
@@ -62,3 +66,13 @@ func Conflict(c *gin.Context, message string) {
 func TooManyRequests(c *gin.Context, message string) {
 	ErrorResponse(c, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", message)
 }
+
+func ServiceUnavailable(c *gin.Context, message string) {
+	ErrorResponse(c, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", message)
+}
+
+// ErrorMessage is err's message in the request's locale, for errors with a
+// catalog message (see i18n.Error), and err's own text otherwise.
+func ErrorMessage(c *gin.Context, err error) string {
+	return i18n.FromContext(c.Request.Context()).ErrorMessage(err)
+}
@@ -0,0 +1,165 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// cborPair is a map entry for cborEncode, which keeps entries in order.
+type cborPair struct {
+	key, value interface{}
+}
+
+type cborMap []cborPair
+
+// cborHead encodes an initial byte and its argument in the shortest form.
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+// cborEncode encodes the subset of CBOR decodeCBOR understands.
+func cborEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		return cborEncode(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case cborMap:
+		out := cborHead(5, uint64(len(v)))
+		for _, p := range v {
+			out = append(out, cborEncode(p.key)...)
+			out = append(out, cborEncode(p.value)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("cborEncode: unsupported type")
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	encoded := cborEncode(cborMap{
+		{"fmt", "none"},
+		{int64(-2), []byte{1, 2, 3}},
+		{int64(1), []interface{}{int64(500), int64(-70000), true, false, nil}},
+	})
+	// A tag is dropped and trailing bytes are returned
+	encoded = append([]byte{0xd8, 0x18}, encoded...)
+	encoded = append(encoded, 0xaa)
+
+	value, rest, err := decodeCBOR(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xaa}) {
+		t.Fatalf("rest = %x, want aa", rest)
+	}
+	m, ok := value.(map[interface{}]interface{})
+	if !ok || len(m) != 3 {
+		t.Fatalf("value = %#v, want a map with 3 entries", value)
+	}
+	if m["fmt"] != "none" {
+		t.Fatalf("fmt = %#v", m["fmt"])
+	}
+	if b, _ := m[int64(-2)].([]byte); !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Fatalf("-2 = %#v", m[int64(-2)])
+	}
+	items, _ := m[int64(1)].([]interface{})
+	want := []interface{}{int64(500), int64(-70000), true, false, nil}
+	if len(items) != len(want) {
+		t.Fatalf("1 = %#v", m[int64(1)])
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Fatalf("1 = %#v, want %#v", items, want)
+		}
+	}
+}
+
+func TestDecodeCBORTruncated(t *testing.T) {
+	encoded := cborEncode(cborMap{
+		{int64(1), int64(2)},
+		{int64(3), int64(-7)},
+		{int64(-2), bytes.Repeat([]byte{0x01}, 32)},
+		{"name", "passkey"},
+		{"list", []interface{}{int64(1000), int64(70000), int64(1) << 40}},
+	})
+	if _, _, err := decodeCBOR(encoded); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(encoded); n++ {
+		if _, _, err := decodeCBOR(encoded[:n]); !errors.Is(err, errInvalidCBOR) {
+			t.Fatalf("decoding the first %d of %d bytes: err = %v, want errInvalidCBOR", n, len(encoded), err)
+		}
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x81}, depth), 0x00)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "byte string longer than the input", data: append(cborHead(2, 0xffffffff), 0x00)},
+		{name: "text string longer than the input", data: append(cborHead(3, 1<<62), 'a')},
+		{name: "array longer than the input", data: append(cborHead(4, 1<<40), 0x00)},
+		{name: "map longer than the input", data: append(cborHead(5, 0xffffffffffffffff), 0x00, 0x00)},
+		{name: "unsigned integer over int64", data: cborHead(0, 1<<63)},
+		{name: "negative integer under int64", data: cborHead(1, 1<<63)},
+		{name: "indefinite length array", data: []byte{0x9f, 0x00, 0xff}},
+		{name: "indefinite length byte string", data: []byte{0x5f, 0x41, 0x00, 0xff}},
+		{name: "reserved additional information", data: []byte{0x1c}},
+		{name: "float", data: []byte{0xf9, 0x3c, 0x00}},
+		{name: "undefined", data: []byte{0xf7}},
+		{name: "nested too deep", data: nested(cborMaxDepth + 1)},
+		{name: "tags nested too deep", data: append(bytes.Repeat([]byte{0xc1}, cborMaxDepth+1), 0x00)},
+		{name: "byte string map key", data: cborEncode(cborMap{{[]byte{1}, int64(1)}})},
+		{name: "array map key", data: cborEncode(cborMap{{[]interface{}{}, int64(1)}})},
+		{name: "duplicate map key", data: cborEncode(cborMap{{int64(1), int64(1)}, {int64(1), int64(2)}})},
+		{name: "empty", data: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.data); !errors.Is(err, errInvalidCBOR) {
+				t.Fatalf("err = %v, want errInvalidCBOR", err)
+			}
+		})
+	}
+
+	if _, _, err := decodeCBOR(nested(cborMaxDepth)); err != nil {
+		t.Fatalf("nesting at the limit: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms lists the accepted algorithms in order of preference,
+// as offered to authenticators in pubKeyCredParams.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053).
+const (
+	coseKeyType  int64 = 1
+	coseKeyAlg   int64 = 3
+	coseKeyCurve int64 = -1 // EC2 and OKP
+	coseKeyX     int64 = -2 // EC2 and OKP
+	coseKeyY     int64 = -3 // EC2
+	coseKeyN     int64 = -1 // RSA
+	coseKeyE     int64 = -2 // RSA
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+
+	minRSABits = 2048
+)
+
+// publicKey is a credential public key decoded from its COSE form.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and checks it's a supported algorithm.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	value, rest, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	m, ok := value.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, ErrInvalidPublicKey
+	}
+
+	kty, _ := m[coseKeyType].(int64)
+	alg, _ := m[coseKeyAlg].(int64)
+
+	switch {
+	case alg == AlgES256 && kty == coseKeyTypeEC2:
+		crv, _ := m[coseKeyCurve].(int64)
+		x, _ := m[coseKeyX].([]byte)
+		y, _ := m[coseKeyY].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalidPublicKey
+		}
+		// ecdh rejects points that aren't on the curve
+		point := append(append([]byte{0x04}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return &publicKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case alg == AlgEdDSA && kty == coseKeyTypeOKP:
+		crv, _ := m[coseKeyCurve].(int64)
+		x, _ := m[coseKeyX].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidPublicKey
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case alg == AlgRS256 && kty == coseKeyTypeRSA:
+		n, _ := m[coseKeyN].([]byte)
+		e, _ := m[coseKeyE].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidPublicKey
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		modulus := new(big.Int).SetBytes(n)
+		if exponent < 3 || exponent%2 == 0 || modulus.BitLen() < minRSABits {
+			return nil, ErrInvalidPublicKey
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: modulus, E: exponent}}, nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// verify checks sig over data.
+func (k *publicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,458 @@
+// Package webauthn implements the relying party side of WebAuthn registration
+// and authentication ceremonies for passkeys and security keys.
+//
+// Credentials are requested with attestation "none": attestation statements
+// are not verified and a credential is trusted on first use, like a password
+// chosen by the user.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoRPID               = errors.New("webauthn relying party id is not configured")
+	ErrNoOrigins            = errors.New("webauthn origins are not configured")
+	ErrInvalidResponse      = errors.New("malformed webauthn response")
+	ErrCeremonyMismatch     = errors.New("webauthn response is for a different ceremony")
+	ErrChallengeMismatch    = errors.New("webauthn challenge does not match")
+	ErrOriginMismatch       = errors.New("webauthn origin is not allowed")
+	ErrRPIDMismatch         = errors.New("webauthn relying party id does not match")
+	ErrUserNotPresent       = errors.New("user presence was not confirmed")
+	ErrUserNotVerified      = errors.New("user verification is required")
+	ErrInvalidPublicKey     = errors.New("invalid credential public key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported credential algorithm")
+	ErrInvalidSignature     = errors.New("invalid webauthn signature")
+	// ErrSignCountRegressed means the authenticator's counter did not move
+	// forward, which suggests the credential has been cloned.
+	ErrSignCountRegressed = errors.New("webauthn sign count did not increase")
+)
+
+// User verification requirements.
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+const (
+	challengeSize       = 32
+	maxCredentialIDSize = 1023
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+
+	attestationNone = "none"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent        byte = 0x01
+	flagUserVerified       byte = 0x04
+	flagBackupEligible     byte = 0x08
+	flagBackedUp           byte = 0x10
+	flagAttestedCredential byte = 0x40
+	flagExtensions         byte = 0x80
+)
+
+// URLEncodedBase64 is a byte slice that is base64url encoded in JSON, as used
+// by the WebAuthn JSON serialization. Padding is accepted but not emitted.
+type URLEncodedBase64 []byte
+
+func (b URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty verifies ceremonies for one relying party id, accepting
+// responses from any of its configured origins.
+type RelyingParty struct {
+	id       string
+	name     string
+	origins  []string
+	rpIDHash [32]byte
+}
+
+func NewRelyingParty(id, name string, origins []string) (*RelyingParty, error) {
+	if id == "" {
+		return nil, ErrNoRPID
+	}
+	if len(origins) == 0 {
+		return nil, ErrNoOrigins
+	}
+	return &RelyingParty{
+		id:       id,
+		name:     name,
+		origins:  origins,
+		rpIDHash: sha256.Sum256([]byte(id)),
+	}, nil
+}
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the account a credential is created for. ID is the
+// user handle the authenticator returns on login; it must not contain
+// personal data.
+type UserEntity struct {
+	ID          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string           `json:"type"`
+	ID         URLEncodedBase64 `json:"id"`
+	Transports []string         `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the publicKey options for navigator.credentials.create.
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              URLEncodedBase64       `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options for navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions builds registration options asking for a discoverable
+// credential. Credentials in exclude are refused by the authenticator so the
+// same one isn't registered twice.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor, userVerification string, timeout time.Duration) *CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.id, Name: rp.name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: userVerification,
+		},
+		Attestation: attestationNone,
+	}
+}
+
+// RequestOptions builds authentication options. With no allowed credentials
+// the authenticator offers any discoverable credential for this relying party.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string, timeout time.Duration) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON" binding:"required"`
+	AttestationObject URLEncodedBase64 `json:"attestationObject" binding:"required"`
+	Transports        []string         `json:"transports,omitempty"`
+}
+
+// RegistrationCredential is the PublicKeyCredential returned by
+// navigator.credentials.create, in its JSON form.
+type RegistrationCredential struct {
+	ID       string              `json:"id"`
+	RawID    URLEncodedBase64    `json:"rawId" binding:"required"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response" binding:"required"`
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData URLEncodedBase64 `json:"authenticatorData" binding:"required"`
+	Signature         URLEncodedBase64 `json:"signature" binding:"required"`
+	UserHandle        URLEncodedBase64 `json:"userHandle,omitempty"`
+}
+
+// AssertionCredential is the PublicKeyCredential returned by
+// navigator.credentials.get, in its JSON form.
+type AssertionCredential struct {
+	ID       string            `json:"id"`
+	RawID    URLEncodedBase64  `json:"rawId" binding:"required"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response" binding:"required"`
+}
+
+// ClientData is the part of clientDataJSON the relying party checks.
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ParseClientData decodes clientDataJSON. Callers use the challenge to find
+// the ceremony a response belongs to before verifying it.
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var cd ClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	return &cd, nil
+}
+
+// Credential is a newly registered credential. PublicKey is the COSE_Key as
+// sent by the authenticator and is what VerifyAssertion expects back.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// VerifyRegistration checks the response to a registration ceremony started
+// with challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(cred *RegistrationCredential, challenge []byte, requireUV bool) (*Credential, error) {
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, clientDataTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	value, rest, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	attestation, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+	format, _ := attestation["fmt"].(string)
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if format == "" || rawAuthData == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredential == 0 {
+		return nil, ErrInvalidResponse
+	}
+	if !bytes.Equal(authData.credentialID, cred.RawID) {
+		return nil, ErrInvalidResponse
+	}
+
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.publicKey,
+		Algorithm:      key.alg,
+		SignCount:      authData.signCount,
+		AAGUID:         authData.aaguid,
+		Transports:     cred.Response.Transports,
+		UserVerified:   authData.flags&flagUserVerified != 0,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// Assertion is the outcome of a successful authentication ceremony.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// VerifyAssertion checks the response to an authentication ceremony started
+// with challenge against a stored credential's public key and sign count.
+func (rp *RelyingParty) VerifyAssertion(cred *AssertionCredential, challenge, publicKeyCOSE []byte, storedSignCount uint32, requireUV bool) (*Assertion, error) {
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, clientDataTypeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(cred.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(publicKeyCOSE)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), cred.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, cred.Response.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Authenticators that don't keep a counter always report zero
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, ErrSignCountRegressed
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackedUp:     authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	cd, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != ceremony {
+		return ErrCeremonyMismatch
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	for _, origin := range rp.origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginMismatch
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(authData *authenticatorData, requireUV bool) error {
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rp.rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// authenticatorData is the binary structure signed by the authenticator.
+// The attested credential fields are only set during registration.
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrInvalidResponse
+	}
+	ad := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if ad.flags&flagAttestedCredential != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidResponse
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDSize || idLen > len(rest) {
+			return nil, ErrInvalidResponse
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if ad.flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	return ad, nil
+}
@@ -0,0 +1,482 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://app.example.com"
+)
+
+// softAuthenticator is an in-process authenticator holding one credential.
+type softAuthenticator struct {
+	credentialID []byte
+	publicKey    []byte // COSE_Key
+	sign         func(data []byte) []byte
+}
+
+func newES256Authenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := pub.Bytes() // 0x04 || x || y
+	return &softAuthenticator{
+		credentialID: randomBytes(t, 16),
+		publicKey: cborEncode(cborMap{
+			{coseKeyType, coseKeyTypeEC2},
+			{coseKeyAlg, AlgES256},
+			{coseKeyCurve, coseCurveP256},
+			{coseKeyX, point[1:33]},
+			{coseKeyY, point[33:]},
+		}),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+func newEdDSAAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		credentialID: randomBytes(t, 32),
+		publicKey: cborEncode(cborMap{
+			{coseKeyType, coseKeyTypeOKP},
+			{coseKeyAlg, AlgEdDSA},
+			{coseKeyCurve, coseCurveEd25519},
+			{coseKeyX, []byte(pub)},
+		}),
+		sign: func(data []byte) []byte {
+			return ed25519.Sign(key, data)
+		},
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// ceremony describes what the authenticator and browser put in a response.
+// Tests start from validCeremony and change one field.
+type ceremony struct {
+	clientDataType string
+	challenge      []byte
+	origin         string
+	rpID           string
+	flags          byte
+	signCount      uint32
+}
+
+func validCeremony(clientDataType string, challenge []byte) ceremony {
+	return ceremony{
+		clientDataType: clientDataType,
+		challenge:      challenge,
+		origin:         testOrigin,
+		rpID:           testRPID,
+		flags:          flagUserPresent | flagUserVerified,
+		signCount:      1,
+	}
+}
+
+func (c ceremony) clientDataJSON(t *testing.T) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{
+		"type":        c.clientDataType,
+		"challenge":   base64.RawURLEncoding.EncodeToString(c.challenge),
+		"origin":      c.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func (c ceremony) authenticatorData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	flags := c.flags
+	if attested != nil {
+		flags |= flagAttestedCredential
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, c.signCount)
+	return append(data, attested...)
+}
+
+// register answers a registration ceremony with attestation "none".
+func (a *softAuthenticator) register(t *testing.T, c ceremony) *RegistrationCredential {
+	t.Helper()
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.publicKey...)
+
+	return &RegistrationCredential{
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: AttestationResponse{
+			ClientDataJSON: c.clientDataJSON(t),
+			AttestationObject: cborEncode(cborMap{
+				{"fmt", attestationNone},
+				{"attStmt", cborMap{}},
+				{"authData", c.authenticatorData(attested)},
+			}),
+			Transports: []string{"internal", "hybrid"},
+		},
+	}
+}
+
+// assert answers an authentication ceremony.
+func (a *softAuthenticator) assert(t *testing.T, c ceremony) *AssertionCredential {
+	t.Helper()
+	clientDataJSON := c.clientDataJSON(t)
+	authData := c.authenticatorData(nil)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	return &AssertionCredential{
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         a.sign(append(append([]byte(nil), authData...), clientDataHash[:]...)),
+		},
+	}
+}
+
+func newTestRelyingParty(t *testing.T) *RelyingParty {
+	t.Helper()
+	rp, err := NewRelyingParty(testRPID, "Example", []string{"https://example.com", testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+var testAuthenticators = []struct {
+	name string
+	alg  int64
+	new  func(t *testing.T) *softAuthenticator
+}{
+	{name: "ES256", alg: AlgES256, new: newES256Authenticator},
+	{name: "EdDSA", alg: AlgEdDSA, new: newEdDSAAuthenticator},
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	for _, tt := range testAuthenticators {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			authenticator := tt.new(t)
+
+			challenge := newTestChallenge(t)
+			c := validCeremony(clientDataTypeCreate, challenge)
+			c.flags |= flagBackupEligible | flagBackedUp
+			c.signCount = 0
+			credential, err := rp.VerifyRegistration(authenticator.register(t, c), challenge, true)
+			if err != nil {
+				t.Fatalf("VerifyRegistration: %v", err)
+			}
+			if !bytes.Equal(credential.ID, authenticator.credentialID) {
+				t.Fatalf("credential id = %x, want %x", credential.ID, authenticator.credentialID)
+			}
+			if !bytes.Equal(credential.PublicKey, authenticator.publicKey) {
+				t.Fatal("public key isn't the COSE key the authenticator sent")
+			}
+			if credential.Algorithm != tt.alg {
+				t.Fatalf("algorithm = %d, want %d", credential.Algorithm, tt.alg)
+			}
+			if !credential.UserVerified || !credential.BackupEligible || !credential.BackedUp {
+				t.Fatalf("flags not reported: %+v", credential)
+			}
+			if len(credential.Transports) != 2 {
+				t.Fatalf("transports = %v", credential.Transports)
+			}
+
+			for _, signCount := range []uint32{1, 2, 10} {
+				challenge := newTestChallenge(t)
+				c := validCeremony(clientDataTypeGet, challenge)
+				c.signCount = signCount
+				assertion, err := rp.VerifyAssertion(authenticator.assert(t, c), challenge, credential.PublicKey, credential.SignCount, true)
+				if err != nil {
+					t.Fatalf("VerifyAssertion with sign count %d: %v", signCount, err)
+				}
+				if assertion.SignCount != signCount || !assertion.UserVerified {
+					t.Fatalf("assertion = %+v", assertion)
+				}
+				credential.SignCount = assertion.SignCount
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(c *ceremony)
+		requireUV bool
+		want      error
+	}{
+		{name: "wrong origin", change: func(c *ceremony) { c.origin = "https://evil.example.net" }, want: ErrOriginMismatch},
+		{name: "origin of a subdomain not configured", change: func(c *ceremony) { c.origin = "https://other.example.com" }, want: ErrOriginMismatch},
+		{name: "wrong rp id", change: func(c *ceremony) { c.rpID = "evil.example.net" }, want: ErrRPIDMismatch},
+		{name: "wrong challenge", change: func(c *ceremony) { c.challenge = []byte("another challenge") }, want: ErrChallengeMismatch},
+		{name: "login client data", change: func(c *ceremony) { c.clientDataType = clientDataTypeGet }, want: ErrCeremonyMismatch},
+		{name: "user not present", change: func(c *ceremony) { c.flags = flagUserVerified }, want: ErrUserNotPresent},
+		{name: "user not verified", change: func(c *ceremony) { c.flags = flagUserPresent }, requireUV: true, want: ErrUserNotVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			challenge := newTestChallenge(t)
+			c := validCeremony(clientDataTypeCreate, challenge)
+			tt.change(&c)
+
+			cred := newES256Authenticator(t).register(t, c)
+			if _, err := rp.VerifyRegistration(cred, challenge, tt.requireUV); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationAllowsPresenceOnly(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := newTestChallenge(t)
+	c := validCeremony(clientDataTypeCreate, challenge)
+	c.flags = flagUserPresent
+
+	credential, err := rp.VerifyRegistration(newEdDSAAuthenticator(t).register(t, c), challenge, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.UserVerified {
+		t.Fatal("credential reported as user verified")
+	}
+}
+
+func TestVerifyRegistrationRejectsMalformed(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := newTestChallenge(t)
+	c := validCeremony(clientDataTypeCreate, challenge)
+	authenticator := newES256Authenticator(t)
+
+	t.Run("raw id differs from the attested one", func(t *testing.T) {
+		cred := authenticator.register(t, c)
+		cred.RawID = randomBytes(t, 16)
+		if _, err := rp.VerifyRegistration(cred, challenge, false); !errors.Is(err, ErrInvalidResponse) {
+			t.Fatalf("err = %v, want ErrInvalidResponse", err)
+		}
+	})
+
+	t.Run("truncated attestation object", func(t *testing.T) {
+		cred := authenticator.register(t, c)
+		object := cred.Response.AttestationObject
+		for n := 0; n < len(object); n++ {
+			cred.Response.AttestationObject = object[:n]
+			if _, err := rp.VerifyRegistration(cred, challenge, false); err == nil {
+				t.Fatalf("accepted the first %d of %d bytes", n, len(object))
+			}
+		}
+	})
+
+	t.Run("trailing bytes", func(t *testing.T) {
+		cred := authenticator.register(t, c)
+		cred.Response.AttestationObject = append(cred.Response.AttestationObject, 0x00)
+		if _, err := rp.VerifyRegistration(cred, challenge, false); !errors.Is(err, ErrInvalidResponse) {
+			t.Fatalf("err = %v, want ErrInvalidResponse", err)
+		}
+	})
+
+	t.Run("credential id length past the data", func(t *testing.T) {
+		attested := binary.BigEndian.AppendUint16(make([]byte, 16), maxCredentialIDSize)
+		attested = append(attested, authenticator.credentialID...)
+		cred := authenticator.register(t, c)
+		cred.Response.AttestationObject = cborEncode(cborMap{
+			{"fmt", attestationNone},
+			{"attStmt", cborMap{}},
+			{"authData", c.authenticatorData(attested)},
+		})
+		if _, err := rp.VerifyRegistration(cred, challenge, false); !errors.Is(err, ErrInvalidResponse) {
+			t.Fatalf("err = %v, want ErrInvalidResponse", err)
+		}
+	})
+
+	t.Run("point off the curve", func(t *testing.T) {
+		offCurve := &softAuthenticator{
+			credentialID: authenticator.credentialID,
+			publicKey: cborEncode(cborMap{
+				{coseKeyType, coseKeyTypeEC2},
+				{coseKeyAlg, AlgES256},
+				{coseKeyCurve, coseCurveP256},
+				{coseKeyX, bytes.Repeat([]byte{0x01}, 32)},
+				{coseKeyY, bytes.Repeat([]byte{0x02}, 32)},
+			}),
+		}
+		if _, err := rp.VerifyRegistration(offCurve.register(t, c), challenge, false); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Fatalf("err = %v, want ErrInvalidPublicKey", err)
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		unsupported := &softAuthenticator{
+			credentialID: authenticator.credentialID,
+			publicKey: cborEncode(cborMap{
+				{coseKeyType, coseKeyTypeEC2},
+				{coseKeyAlg, int64(-35)}, // ES384
+				{coseKeyCurve, int64(2)},
+				{coseKeyX, bytes.Repeat([]byte{0x01}, 48)},
+				{coseKeyY, bytes.Repeat([]byte{0x02}, 48)},
+			}),
+		}
+		if _, err := rp.VerifyRegistration(unsupported.register(t, c), challenge, false); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Fatalf("err = %v, want ErrUnsupportedAlgorithm", err)
+		}
+	})
+
+	t.Run("deeply nested public key", func(t *testing.T) {
+		nested := &softAuthenticator{
+			credentialID: authenticator.credentialID,
+			publicKey:    append(bytes.Repeat([]byte{0x81}, cborMaxDepth+1), 0x00),
+		}
+		if _, err := rp.VerifyRegistration(nested.register(t, c), challenge, false); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Fatalf("err = %v, want ErrInvalidPublicKey", err)
+		}
+	})
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(c *ceremony)
+		requireUV bool
+		want      error
+	}{
+		{name: "wrong origin", change: func(c *ceremony) { c.origin = "http://app.example.com" }, want: ErrOriginMismatch},
+		{name: "wrong rp id", change: func(c *ceremony) { c.rpID = "app.example.com" }, want: ErrRPIDMismatch},
+		{name: "wrong challenge", change: func(c *ceremony) { c.challenge = []byte("another challenge") }, want: ErrChallengeMismatch},
+		{name: "registration client data", change: func(c *ceremony) { c.clientDataType = clientDataTypeCreate }, want: ErrCeremonyMismatch},
+		{name: "user not present", change: func(c *ceremony) { c.flags = flagUserVerified }, want: ErrUserNotPresent},
+		{name: "user not verified", change: func(c *ceremony) { c.flags = flagUserPresent }, requireUV: true, want: ErrUserNotVerified},
+	}
+	for _, auth := range testAuthenticators {
+		for _, tt := range tests {
+			t.Run(auth.name+"/"+tt.name, func(t *testing.T) {
+				rp := newTestRelyingParty(t)
+				authenticator := auth.new(t)
+				challenge := newTestChallenge(t)
+				c := validCeremony(clientDataTypeGet, challenge)
+				tt.change(&c)
+
+				cred := authenticator.assert(t, c)
+				if _, err := rp.VerifyAssertion(cred, challenge, authenticator.publicKey, 0, tt.requireUV); !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyAssertionSignature(t *testing.T) {
+	for _, auth := range testAuthenticators {
+		t.Run(auth.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			authenticator := auth.new(t)
+			challenge := newTestChallenge(t)
+			c := validCeremony(clientDataTypeGet, challenge)
+
+			t.Run("another credential's key", func(t *testing.T) {
+				other := auth.new(t)
+				cred := authenticator.assert(t, c)
+				if _, err := rp.VerifyAssertion(cred, challenge, other.publicKey, 0, false); !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("err = %v, want ErrInvalidSignature", err)
+				}
+			})
+
+			t.Run("tampered authenticator data", func(t *testing.T) {
+				cred := authenticator.assert(t, c)
+				// Raise the sign count after signing
+				cred.Response.AuthenticatorData[36]++
+				if _, err := rp.VerifyAssertion(cred, challenge, authenticator.publicKey, 0, false); !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("err = %v, want ErrInvalidSignature", err)
+				}
+			})
+
+			t.Run("truncated authenticator data", func(t *testing.T) {
+				cred := authenticator.assert(t, c)
+				cred.Response.AuthenticatorData = cred.Response.AuthenticatorData[:36]
+				if _, err := rp.VerifyAssertion(cred, challenge, authenticator.publicKey, 0, false); !errors.Is(err, ErrInvalidResponse) {
+					t.Fatalf("err = %v, want ErrInvalidResponse", err)
+				}
+			})
+		})
+	}
+}
+
+func TestVerifyAssertionSignCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored uint32
+		got    uint32
+		want   error
+	}{
+		{name: "increased", stored: 4, got: 5},
+		{name: "no counter", stored: 0, got: 0},
+		{name: "first use of a counter", stored: 0, got: 1},
+		{name: "repeated", stored: 5, got: 5, want: ErrSignCountRegressed},
+		{name: "went back", stored: 5, got: 3, want: ErrSignCountRegressed},
+		{name: "reset to zero", stored: 5, got: 0, want: ErrSignCountRegressed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t)
+			authenticator := newES256Authenticator(t)
+			challenge := newTestChallenge(t)
+			c := validCeremony(clientDataTypeGet, challenge)
+			c.signCount = tt.got
+
+			_, err := rp.VerifyAssertion(authenticator.assert(t, c), challenge, authenticator.publicKey, tt.stored, false)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}